@@ -3,6 +3,7 @@ export interface Project {
   id: string;
   name: string;
   description: string;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -10,17 +11,36 @@ export interface Project {
 export interface Environment {
   id: string;
   project_id: string;
+  key: string;
   name: string;
+  sort_order: number;
+  color: string;
+  production: boolean;
+  new_flags_enabled: boolean;
+  version: number;
   created_at: string;
   updated_at: string;
 }
 
+export interface FlagOwner {
+  type: 'user' | 'team';
+  id: string;
+}
+
 export interface Flag {
   id: string;
   project_id: string;
   key: string;
   description: string;
   type: 'boolean' | 'string' | 'number' | 'json';
+  default_value: string;
+  tags: string[];
+  owner?: FlagOwner;
+  kind: 'temporary' | 'permanent';
+  status: 'active' | 'archived';
+  removal_date?: string;
+  archived_at?: string;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -31,6 +51,7 @@ export interface FlagValue {
   env_id: string;
   value: string;
   enabled: boolean;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -39,24 +60,44 @@ export interface FlagWithValues extends Flag {
   values?: FlagValue[];
 }
 
+// Envelope returned by paginated list endpoints
+export interface Page<T> {
+  items: T[];
+  next_cursor?: string;
+  total: number;
+}
+
 // Request types
 export interface CreateProjectRequest {
   name: string;
   description?: string;
 }
 
+// Updates send back the version they were made from; a stale one gets 412
 export interface UpdateProjectRequest {
   name?: string;
   description?: string;
+  version?: number;
 }
 
 export interface CreateEnvironmentRequest {
   project_id: string;
+  key?: string;
   name: string;
+  sort_order?: number;
+  color?: string;
+  production?: boolean;
+  new_flags_enabled?: boolean;
+  clone_from?: string;
 }
 
 export interface UpdateEnvironmentRequest {
   name?: string;
+  sort_order?: number;
+  color?: string;
+  production?: boolean;
+  new_flags_enabled?: boolean;
+  version?: number;
 }
 
 export interface CreateFlagRequest {
@@ -64,12 +105,19 @@ export interface CreateFlagRequest {
   key: string;
   description?: string;
   type: 'boolean' | 'string' | 'number' | 'json';
+  default_value?: string;
+  tags?: string[];
+  owner?: FlagOwner;
 }
 
 export interface UpdateFlagRequest {
   key?: string;
   description?: string;
   type?: 'boolean' | 'string' | 'number' | 'json';
+  default_value?: string;
+  tags?: string[];
+  owner?: FlagOwner | { type: ''; id?: string };
+  version?: number;
 }
 
 export interface CreateFlagValueRequest {
@@ -82,6 +130,7 @@ export interface CreateFlagValueRequest {
 export interface UpdateFlagValueRequest {
   value?: string;
   enabled?: boolean;
+  version?: number;
 }
 
 // API client
@@ -124,7 +173,8 @@ class ApiClient {
 
   // Projects
   async getProjects(): Promise<Project[]> {
-    return this.request<Project[]>('/api/projects');
+    const page = await this.request<Page<Project>>('/api/projects');
+    return page.items;
   }
 
   async getProject(id: string): Promise<Project> {
@@ -153,7 +203,8 @@ class ApiClient {
 
   // Environments
   async getEnvironments(): Promise<Environment[]> {
-    return this.request<Environment[]>('/api/environments');
+    const page = await this.request<Page<Environment>>('/api/environments');
+    return page.items;
   }
 
   async getEnvironment(id: string): Promise<Environment> {
@@ -161,7 +212,8 @@ class ApiClient {
   }
 
   async getProjectEnvironments(projectId: string): Promise<Environment[]> {
-    return this.request<Environment[]>(`/api/projects/${projectId}/environments`);
+    const page = await this.request<Page<Environment>>(`/api/projects/${projectId}/environments`);
+    return page.items;
   }
 
   async createEnvironment(data: CreateEnvironmentRequest): Promise<Environment> {
@@ -186,9 +238,10 @@ class ApiClient {
 
   // Flags
   async getProjectFlags(projectId: string, includeValues = false): Promise<FlagWithValues[]> {
-    return this.request<FlagWithValues[]>(
+    const page = await this.request<Page<FlagWithValues>>(
       `/api/projects/${projectId}/flags?includeValues=${includeValues}`
     );
+    return page.items;
   }
 
   async getFlag(id: string): Promise<Flag> {
@@ -209,6 +262,18 @@ class ApiClient {
     });
   }
 
+  async archiveFlag(id: string): Promise<Flag> {
+    return this.request<Flag>(`/api/flags/${id}/archive`, {
+      method: 'POST',
+    });
+  }
+
+  async restoreFlag(id: string): Promise<Flag> {
+    return this.request<Flag>(`/api/flags/${id}/restore`, {
+      method: 'POST',
+    });
+  }
+
   async deleteFlag(id: string): Promise<void> {
     return this.request<void>(`/api/flags/${id}`, {
       method: 'DELETE',
@@ -153,7 +153,7 @@ function Projects() {
                   }
 
                   if (editingProject) {
-                    handleUpdateProject(editingProject.id, data)
+                    handleUpdateProject(editingProject.id, { ...data, version: editingProject.version })
                   } else {
                     handleCreateProject(data)
                   }
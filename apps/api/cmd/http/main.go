@@ -1,15 +1,20 @@
 package main
 
 import (
+	"api/internal/analytics"
+	"api/internal/cache"
 	database "api/internal/config/db"
 	"api/internal/config/env"
 	"api/internal/controller"
+	"api/internal/mail"
 	"api/internal/middleware"
 	"api/internal/repository"
 	"api/internal/route"
 	"api/internal/service"
 	"api/internal/validation"
+	"context"
 	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -37,6 +42,39 @@ func main() {
 	flagRepo := repository.NewFlagRepository(db)
 	flagValueRepo := repository.NewFlagValueRepository(db)
 	userRepo := repository.NewUserRepository(db)
+	evaluationRepo := repository.NewEvaluationRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	oidcStateRepo := repository.NewOIDCStateRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	userTokenRepo := repository.NewUserTokenRepository(db)
+	loginThrottleRepo := repository.NewLoginThrottleRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	projectMemberRepo := repository.NewProjectMemberRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+
+	// Initialize flag configuration cache
+	configCache := cache.NewConfigCache(cfg.Cache.ConfigTTL)
+
+	// Load roles from the database; permission checks use them from here on
+	roleCache := middleware.NewRoleCache(service.RoleDefinitions(roleRepo), cfg.Cache.RoleTTL)
+	if err := roleCache.Reload(context.Background()); err != nil {
+		log.Fatalf("Failed to load roles: %v", err)
+	}
+	middleware.UseRoleCache(roleCache)
+
+	// Initialize evaluation analytics, flushed to Postgres in the background
+	recorder := analytics.NewRecorder(evaluationRepo, cfg.Analytics.FlushInterval)
+	recorder.Start()
+	defer recorder.Stop()
+
+	// Expired idempotency keys are deleted in the background
+	pruneCtx, stopPruning := context.WithCancel(context.Background())
+	defer stopPruning()
+	go middleware.PruneIdempotencyKeys(pruneCtx, idempotencyRepo, cfg.Idempotency.PruneInterval)
 
 	// Initialize SSE controller
 	sseController := controller.NewSSEController()
@@ -44,23 +82,70 @@ func main() {
 	// Initialize validator once
 	validator := validation.NewValidator()
 
-	// Get JWT secret from config (in production, use environment variable)
-	jwtSecret := "your-super-secret-jwt-key-change-in-production" // TODO: Get from config
+	if !middleware.ValidRole(middleware.Role(cfg.Auth.RegistrationRole)) {
+		log.Fatalf("Invalid registration role %q", cfg.Auth.RegistrationRole)
+	}
+
+	// Load the keys access tokens are signed and verified with
+	keyRing, err := middleware.NewKeyRing(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// Initialize the mailer for account emails
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
 
 	// Initialize services with SSE controller
-	projectService := service.NewProjectService(projectRepo, sseController)
-	envService := service.NewEnvironmentService(envRepo, sseController)
-	flagService := service.NewFlagService(flagRepo, flagValueRepo, sseController)
-	authService := service.NewAuthService(userRepo, jwtSecret)
+	txManager := repository.NewTxManager(db)
+	projectService := service.NewProjectService(projectRepo, sseController, configCache)
+	envService := service.NewEnvironmentService(envRepo, flagValueRepo, txManager, sseController, configCache)
+	flagService := service.NewFlagService(flagRepo, flagValueRepo, userRepo, teamRepo, txManager, sseController, configCache)
+	accountService := service.NewAccountService(userRepo, userTokenRepo, sessionRepo, mailer, cfg.Auth, cfg.Mail.AppURL)
+	authService := service.NewAuthService(userRepo, sessionRepo, loginThrottleRepo, auditRepo, orgRepo, accountService, keyRing, cfg.Auth)
+	mfaService := service.NewMFAService(userRepo, mfaRepo, loginThrottleRepo, auditRepo, authService, keyRing, cfg.Auth.MFA, cfg.Auth.Lockout)
+	auditService := service.NewAuditService(auditRepo)
+	userService := service.NewUserService(userRepo, sessionRepo, auditRepo, accountService)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, userRepo, orgRepo, auditRepo)
+	projectMemberService := service.NewProjectMemberService(projectMemberRepo, projectRepo, userRepo, teamRepo, auditRepo)
+	roleService := service.NewRoleService(roleRepo, auditRepo, roleCache)
+	orgService := service.NewOrganizationService(orgRepo, auditRepo, userService, configCache)
+	teamService := service.NewTeamService(teamRepo, userRepo, auditRepo)
+	evaluationService := service.NewEvaluationService(flagRepo, flagValueRepo, evaluationRepo, configCache, recorder)
 
 	// Initialize controllers
 	projectController := controller.NewProjectController(projectService, validator)
-	envController := controller.NewEnvironmentController(envService)
+	envController := controller.NewEnvironmentController(envService, validator)
 	flagController := controller.NewFlagController(flagService)
 	authController := controller.NewAuthController(authService, validator)
+	evaluationController := controller.NewEvaluationController(evaluationService, validator)
+	mfaController := controller.NewMFAController(mfaService, validator)
+	accountController := controller.NewAccountController(accountService, validator)
+	auditController := controller.NewAuditController(auditService)
+	userController := controller.NewUserController(userService, validator)
+	accessTokenController := controller.NewAccessTokenController(accessTokenService, validator)
+	projectMemberController := controller.NewProjectMemberController(projectMemberService, validator)
+	roleController := controller.NewRoleController(roleService, validator)
+	orgController := controller.NewOrganizationController(orgService, validator)
+	teamController := controller.NewTeamController(teamService, validator)
+
+	// Single sign-on is only wired up when an OIDC issuer is configured
+	var oidcController *controller.OIDCController
+	if cfg.Auth.OIDC.Enabled() {
+		oidcService, err := service.NewOIDCService(cfg.Auth.OIDC, userRepo, orgRepo, oidcStateRepo, authService)
+		if err != nil {
+			log.Fatalf("Failed to configure OIDC: %v", err)
+		}
+		oidcController = controller.NewOIDCController(oidcService, cfg.Auth.OIDC)
+	}
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -74,19 +159,17 @@ func main() {
 
 	// Middleware
 	app.Use(recover.New())
-	app.Use(middleware.LoggingMiddleware())
-	app.Use(logger.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
-	}))
-	
+	app.Use(middleware.LoggingMiddleware(cfg.Log.Level))
+	if cfg.Log.Level == "debug" {
+		app.Use(logger.New())
+	}
+	app.Use(cors.New(corsConfig(cfg.CORS)))
+
 	// Custom error middleware (must be last)
 	app.Use(middleware.ErrorMiddleware())
 
 	// Setup routes
-	router := route.NewRouter(app, projectController, envController, flagController, sseController, authController, cfg)
+	router := route.NewRouter(app, projectController, envController, flagController, sseController, authController, evaluationController, oidcController, mfaController, accountController, auditController, userController, projectMemberController, roleController, accessTokenController, orgController, teamController, middleware.NewAuthorizer(projectMemberRepo, teamRepo), keyRing, authService, accessTokenService, idempotencyRepo, cfg)
 	router.SetupRoutes()
 
 	// Health check endpoint
@@ -99,8 +182,19 @@ func main() {
 
 	// Start server
 	port := cfg.Server.Port
-	log.Printf("Server starting on port %s", port)
+	log.Printf("Server starting on port %s (%s mode)", port, cfg.Server.Mode)
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// corsConfig lets the admin UI on another origin send the headers the API
+// reads and read the ones it sets
+func corsConfig(cfg env.CORSConfig) cors.Config {
+	return cors.Config{
+		AllowOrigins:  strings.Join(cfg.AllowOrigins, ","),
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  "Origin,Content-Type,Accept,Authorization,If-Match,Idempotency-Key,X-Confirm-Environment",
+		ExposeHeaders: "ETag,Location,Idempotent-Replayed",
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api/internal/config/env"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// The admin UI's cross-origin requests get past the preflight with every
+// header the API reads
+func TestCORSPreflight(t *testing.T) {
+	origin := "https://admin.example.com"
+	app := fiber.New()
+	app.Use(cors.New(corsConfig(env.CORSConfig{AllowOrigins: []string{origin}})))
+
+	headers := []string{"Authorization", "Content-Type", "If-Match", "Idempotency-Key", "X-Confirm-Environment"}
+	for _, header := range headers {
+		t.Run(header, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodOptions, "/api/v1/flags", nil)
+			req.Header.Set(fiber.HeaderOrigin, origin)
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodPut)
+			req.Header.Set(fiber.HeaderAccessControlRequestHeaders, header)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusNoContent {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusNoContent)
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != origin {
+				t.Errorf("allowed origin = %q, want %q", got, origin)
+			}
+			allowed := strings.Split(resp.Header.Get(fiber.HeaderAccessControlAllowHeaders), ",")
+			found := false
+			for _, h := range allowed {
+				if strings.EqualFold(strings.TrimSpace(h), header) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("allowed headers = %v, want %s among them", allowed, header)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS flag_tags;
+DROP TABLE IF EXISTS tags;
+DROP INDEX IF EXISTS idx_flags_owner;
+ALTER TABLE flags
+    DROP CONSTRAINT IF EXISTS flags_owner_check,
+    DROP COLUMN IF EXISTS owner_id,
+    DROP COLUMN IF EXISTS owner_type;
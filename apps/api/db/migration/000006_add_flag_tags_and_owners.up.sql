@@ -0,0 +1,22 @@
+ALTER TABLE flags
+    ADD COLUMN owner_type VARCHAR(10) CHECK (owner_type IN ('user', 'team')),
+    ADD COLUMN owner_id UUID,
+    ADD CONSTRAINT flags_owner_check CHECK ((owner_type IS NULL) = (owner_id IS NULL));
+
+CREATE INDEX idx_flags_owner ON flags(owner_type, owner_id);
+
+CREATE TABLE tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(project_id, name)
+);
+
+CREATE TABLE flag_tags (
+    flag_id UUID NOT NULL REFERENCES flags(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (flag_id, tag_id)
+);
+
+CREATE INDEX idx_flag_tags_tag_id ON flag_tags(tag_id);
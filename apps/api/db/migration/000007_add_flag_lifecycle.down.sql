@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_flags_status;
+ALTER TABLE flags
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS removal_date,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS kind;
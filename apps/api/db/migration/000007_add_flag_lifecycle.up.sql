@@ -0,0 +1,7 @@
+ALTER TABLE flags
+    ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'temporary' CHECK (kind IN ('temporary', 'permanent')),
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'archived')),
+    ADD COLUMN removal_date DATE,
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_flags_status ON flags(project_id, status);
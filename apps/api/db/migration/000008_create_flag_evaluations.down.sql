@@ -0,0 +1,2 @@
+ALTER TABLE flags DROP COLUMN IF EXISTS last_evaluated_at;
+DROP TABLE IF EXISTS flag_evaluations;
@@ -0,0 +1,13 @@
+CREATE TABLE flag_evaluations (
+    flag_id UUID NOT NULL REFERENCES flags(id) ON DELETE CASCADE,
+    env_id UUID NOT NULL REFERENCES environments(id) ON DELETE CASCADE,
+    value TEXT NOT NULL,
+    bucket_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    last_evaluated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (flag_id, env_id, value, bucket_start)
+);
+
+CREATE INDEX idx_flag_evaluations_bucket_start ON flag_evaluations(bucket_start);
+
+ALTER TABLE flags ADD COLUMN last_evaluated_at TIMESTAMP WITH TIME ZONE;
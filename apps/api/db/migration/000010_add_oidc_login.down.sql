@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS oidc_login_states;
+DROP INDEX IF EXISTS idx_users_external_identity;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS auth_provider;
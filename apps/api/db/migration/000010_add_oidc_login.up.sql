@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN auth_provider VARCHAR(20) NOT NULL DEFAULT 'password';
+ALTER TABLE users ADD COLUMN external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_users_external_identity ON users(auth_provider, external_id)
+    WHERE external_id IS NOT NULL;
+
+-- In-flight authorization-code logins, consumed by the callback
+CREATE TABLE oidc_login_states (
+    state VARCHAR(64) PRIMARY KEY,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,14 @@
+-- mfa_secret is set when enrolment starts and mfa_enabled once the user
+-- confirms a code. mfa_last_used_step stops a code being replayed.
+ALTER TABLE users ADD COLUMN mfa_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN mfa_last_used_step BIGINT;
+
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, code_hash)
+);
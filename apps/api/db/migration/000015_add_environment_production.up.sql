@@ -0,0 +1,4 @@
+ALTER TABLE environments ADD COLUMN production BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing environments named like production are locked down straight away
+UPDATE environments SET production = TRUE WHERE name ILIKE 'prod%';
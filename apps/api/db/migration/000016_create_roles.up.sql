@@ -0,0 +1,53 @@
+CREATE TABLE roles (
+    name VARCHAR(20) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    built_in BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- A permission granted by a role, optionally limited to non-production or
+-- to specific environments
+CREATE TABLE role_permissions (
+    role VARCHAR(20) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(50) NOT NULL,
+    non_production BOOLEAN NOT NULL DEFAULT FALSE,
+    environment_ids UUID[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('admin', 'Full access, including users, roles and the audit trail', TRUE),
+    ('manager', 'Manages projects, environments and flags', TRUE),
+    ('developer', 'Creates and updates flags and changes values outside production', TRUE),
+    ('viewer', 'Read-only access', TRUE);
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', unnest(ARRAY[
+    'project:create', 'project:read', 'project:update', 'project:delete',
+    'environment:create', 'environment:read', 'environment:update', 'environment:delete',
+    'flag:create', 'flag:read', 'flag:update', 'flag:delete',
+    'flag_value:update',
+    'user:manage', 'audit:read', 'role:manage'
+]);
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'manager', unnest(ARRAY[
+    'project:create', 'project:read', 'project:update',
+    'environment:create', 'environment:read', 'environment:update', 'environment:delete',
+    'flag:create', 'flag:read', 'flag:update', 'flag:delete',
+    'flag_value:update'
+]);
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'developer', unnest(ARRAY[
+    'project:read',
+    'environment:read', 'environment:create',
+    'flag:create', 'flag:read', 'flag:update'
+]);
+
+INSERT INTO role_permissions (role, permission, non_production) VALUES
+    ('developer', 'flag_value:update', TRUE);
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'viewer', unnest(ARRAY['project:read', 'environment:read', 'flag:read']);
@@ -0,0 +1,3 @@
+ALTER TABLE audit_events DROP COLUMN IF EXISTS actor_token_id, DROP COLUMN IF EXISTS actor_type;
+DROP TABLE IF EXISTS access_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS account_type;
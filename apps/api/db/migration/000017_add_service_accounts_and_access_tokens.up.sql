@@ -0,0 +1,25 @@
+-- Service accounts are users that can't sign in and authenticate only with
+-- access tokens
+ALTER TABLE users ADD COLUMN account_type VARCHAR(20) NOT NULL DEFAULT 'user';
+
+-- Personal access tokens and service account tokens. Only a hash of each
+-- token is stored; token_prefix identifies it in listings.
+CREATE TABLE access_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_access_tokens_user_id ON access_tokens(user_id);
+
+-- Whether a person or a machine acted, and through which token
+ALTER TABLE audit_events
+    ADD COLUMN actor_type VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN actor_token_id UUID;
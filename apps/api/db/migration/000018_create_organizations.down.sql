@@ -0,0 +1,5 @@
+DELETE FROM role_permissions WHERE permission = 'organization:manage';
+ALTER TABLE audit_events DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,35 @@
+-- Organisations are tenants: each owns its users and projects, and nothing
+-- is shared between them. The host organisation runs the installation; it
+-- takes self-registered and single sign-on users and its admins manage the
+-- other organisations.
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    host BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_organizations_host ON organizations(host) WHERE host;
+
+INSERT INTO organizations (name, slug, host) VALUES ('Default', 'default', TRUE);
+
+-- Existing users and projects move into the host organisation
+ALTER TABLE users ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE users SET organization_id = (SELECT id FROM organizations WHERE host);
+ALTER TABLE users ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_users_organization_id ON users(organization_id);
+
+ALTER TABLE projects ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE projects SET organization_id = (SELECT id FROM organizations WHERE host);
+ALTER TABLE projects ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_projects_organization_id ON projects(organization_id);
+
+-- Admins manage their own organisation
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'organization:manage');
+
+-- NULL for events outside any organisation, such as IP lockouts
+ALTER TABLE audit_events ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+UPDATE audit_events SET organization_id = (SELECT id FROM organizations WHERE host);
+CREATE INDEX idx_audit_events_organization_id ON audit_events(organization_id);
@@ -0,0 +1,4 @@
+DELETE FROM role_permissions WHERE permission = 'team:manage';
+DROP TABLE IF EXISTS project_teams;
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
@@ -0,0 +1,6 @@
+ALTER TABLE environments
+    DROP CONSTRAINT IF EXISTS environments_project_key_unique,
+    DROP COLUMN IF EXISTS new_flags_enabled,
+    DROP COLUMN IF EXISTS color,
+    DROP COLUMN IF EXISTS sort_order,
+    DROP COLUMN IF EXISTS key;
@@ -0,0 +1,39 @@
+-- Environments get a URL-safe key unique within their project, an explicit
+-- position, a display colour and the state new flags start in there
+ALTER TABLE environments
+    ADD COLUMN key VARCHAR(50),
+    ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN color VARCHAR(7) NOT NULL DEFAULT '#6b7280',
+    ADD COLUMN new_flags_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing keys are derived from names; where two names give the same key,
+-- later environments get part of their ID appended
+WITH slugs AS (
+    SELECT id, project_id, created_at,
+        LEFT(COALESCE(NULLIF(TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '-', 'g'))), ''), 'env'), 40) AS slug
+    FROM environments
+), numbered AS (
+    SELECT id, slug,
+        ROW_NUMBER() OVER (PARTITION BY project_id, slug ORDER BY created_at, id) AS n
+    FROM slugs
+)
+UPDATE environments e
+SET key = CASE WHEN numbered.n = 1 THEN numbered.slug ELSE numbered.slug || '-' || LEFT(e.id::text, 8) END
+FROM numbered
+WHERE numbered.id = e.id;
+
+-- Production sorts last, otherwise environments keep their creation order
+WITH ordered AS (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY project_id ORDER BY production, created_at, id) AS position
+    FROM environments
+)
+UPDATE environments e
+SET sort_order = ordered.position
+FROM ordered
+WHERE ordered.id = e.id;
+
+UPDATE environments SET color = '#dc2626' WHERE production;
+
+ALTER TABLE environments
+    ALTER COLUMN key SET NOT NULL,
+    ADD CONSTRAINT environments_project_key_unique UNIQUE (project_id, key);
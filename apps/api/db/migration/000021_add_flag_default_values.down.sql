@@ -0,0 +1,3 @@
+-- Materialised values can't be told apart from ones set by hand, so they
+-- are kept
+ALTER TABLE flags DROP COLUMN IF EXISTS default_value;
@@ -0,0 +1,18 @@
+-- A flag's default value is its off variation: what every environment
+-- starts with until a value is set there
+ALTER TABLE flags ADD COLUMN default_value TEXT NOT NULL DEFAULT '';
+
+UPDATE flags SET default_value = CASE type
+    WHEN 'boolean' THEN 'false'
+    WHEN 'number' THEN '0'
+    WHEN 'json' THEN '{}'
+    ELSE ''
+END;
+
+-- Flags left unset in some environments get their default there, disabled,
+-- so every flag is listed in every environment of its project
+INSERT INTO flag_values (id, flag_id, env_id, value, enabled)
+SELECT gen_random_uuid(), f.id, e.id, f.default_value, FALSE
+FROM flags f
+JOIN environments e ON e.project_id = f.project_id
+ON CONFLICT (flag_id, env_id) DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE flag_values DROP COLUMN version;
+ALTER TABLE flags DROP COLUMN version;
+ALTER TABLE environments DROP COLUMN version;
+ALTER TABLE projects DROP COLUMN version;
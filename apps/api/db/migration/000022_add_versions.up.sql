@@ -0,0 +1,6 @@
+-- Every change to a project, environment, flag or flag value bumps its
+-- version, which clients send back to detect concurrent edits
+ALTER TABLE projects ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE environments ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE flags ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE flag_values ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,19 @@
+-- Responses to requests sent with an Idempotency-Key, replayed when a
+-- client retries with the same key. Keys are scoped to the credentials
+-- that sent them. The fingerprint is a SHA-256 hash of the method, path
+-- and body, so reusing a key for a different request can be refused.
+-- Rows without a status are requests still being handled; their short
+-- expiry lets another attempt take over if the server died meanwhile.
+CREATE TABLE idempotency_keys (
+    scope CHAR(64) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INTEGER,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,3 @@
+ALTER TABLE idempotency_keys
+    DROP COLUMN location,
+    DROP COLUMN etag;
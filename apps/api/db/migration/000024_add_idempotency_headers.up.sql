@@ -0,0 +1,4 @@
+-- Replayed responses carry the ETag and Location headers of the original
+ALTER TABLE idempotency_keys
+    ADD COLUMN etag VARCHAR(255),
+    ADD COLUMN location TEXT;
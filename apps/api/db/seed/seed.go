@@ -16,11 +16,11 @@ func NewSeeder(db *sql.DB) *Seeder {
 }
 
 func (s *Seeder) Seed(ctx context.Context) error {
-	// Create demo project
+	// Create demo project in the host organisation
 	projectID := uuid.New()
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO projects (id, name, description) 
-		VALUES ($1, $2, $3) 
+		INSERT INTO projects (id, organization_id, name, description)
+		SELECT $1, id, $2, $3 FROM organizations WHERE host
 		ON CONFLICT DO NOTHING`,
 		projectID, "Demo Project", "A demonstration project for Flagit")
 	if err != nil {
@@ -32,9 +32,9 @@ func (s *Seeder) Seed(ctx context.Context) error {
 	envProdID := uuid.New()
 	
 	_, err = s.db.ExecContext(ctx, `
-		INSERT INTO environments (id, project_id, name) VALUES 
-		($1, $2, $3),
-		($4, $2, $5) 
+		INSERT INTO environments (id, project_id, key, name, sort_order, color, production, new_flags_enabled) VALUES 
+		($1, $2, 'development', $3, 1, '#6b7280', FALSE, TRUE),
+		($4, $2, 'production', $5, 2, '#dc2626', TRUE, FALSE) 
 		ON CONFLICT DO NOTHING`,
 		envDevID, projectID, "Development", envProdID, projectID, "Production")
 	if err != nil {
@@ -46,9 +46,9 @@ func (s *Seeder) Seed(ctx context.Context) error {
 	flagMaintenanceID := uuid.New()
 	
 	_, err = s.db.ExecContext(ctx, `
-		INSERT INTO flags (id, project_id, key, description, type) VALUES 
-		($1, $2, $3, $4, $5),
-		($6, $2, $7, $8, $9) 
+		INSERT INTO flags (id, project_id, key, description, type, default_value) VALUES 
+		($1, $2, $3, $4, $5, 'false'),
+		($6, $2, $7, $8, $9, 'false') 
 		ON CONFLICT DO NOTHING`,
 		flagBetaFeaturesID, projectID, "beta_features", "Enable beta features", "boolean",
 		flagMaintenanceID, projectID, "maintenance_mode", "Enable maintenance mode", "boolean")
@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// BucketSize is the granularity evaluation counts are stored at
+const BucketSize = time.Hour
+
+type countKey struct {
+	flagID      uuid.UUID
+	envID       uuid.UUID
+	value       string
+	bucketStart time.Time
+}
+
+// Recorder aggregates flag evaluation counts in memory and periodically
+// flushes them to Postgres, so evaluations never wait on a database write
+type Recorder struct {
+	repo     repository.EvaluationRepository
+	interval time.Duration
+	counts   map[countKey]*model.EvaluationCount
+	mutex    sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewRecorder creates a recorder that flushes every interval once started
+func NewRecorder(repo repository.EvaluationRepository, interval time.Duration) *Recorder {
+	return &Recorder{
+		repo:     repo,
+		interval: interval,
+		counts:   make(map[countKey]*model.EvaluationCount),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Record counts n evaluations of a flag serving value in an environment at the given time
+func (r *Recorder) Record(flagID, envID uuid.UUID, value string, n int64, at time.Time) {
+	key := countKey{
+		flagID:      flagID,
+		envID:       envID,
+		value:       value,
+		bucketStart: at.UTC().Truncate(BucketSize),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count, ok := r.counts[key]
+	if !ok {
+		count = &model.EvaluationCount{
+			FlagID:      flagID,
+			EnvID:       envID,
+			Value:       value,
+			BucketStart: key.bucketStart,
+		}
+		r.counts[key] = count
+	}
+	count.Count += n
+	if at.After(count.LastEvaluatedAt) {
+		count.LastEvaluatedAt = at
+	}
+}
+
+// Start flushes the aggregated counts in the background until Stop is called
+func (r *Recorder) Start() {
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Flush(context.Background()); err != nil {
+					log.Printf("Failed to flush flag evaluations: %v", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background flushing and writes any remaining counts
+func (r *Recorder) Stop() {
+	close(r.stop)
+	<-r.done
+
+	if err := r.Flush(context.Background()); err != nil {
+		log.Printf("Failed to flush flag evaluations: %v", err)
+	}
+}
+
+// Flush writes the aggregated counts to the repository. On failure the
+// counts are merged back so they are retried on the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mutex.Lock()
+	pending := r.counts
+	r.counts = make(map[countKey]*model.EvaluationCount)
+	r.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := make([]model.EvaluationCount, 0, len(pending))
+	for _, count := range pending {
+		counts = append(counts, *count)
+	}
+
+	if err := r.repo.Increment(ctx, counts); err != nil {
+		for _, count := range counts {
+			r.Record(count.FlagID, count.EnvID, count.Value, count.Count, count.LastEvaluatedAt)
+		}
+		return err
+	}
+
+	return nil
+}
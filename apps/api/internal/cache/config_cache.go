@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ConfigCache is a read-through, in-memory cache of the flag configuration
+// served per environment. Entries are invalidated by the same write paths
+// that broadcast SSE events; the TTL only bounds staleness caused by writes
+// that bypass the API (e.g. manual SQL). Callers get their own copy of the
+// cached values, so changing them doesn't change the cache.
+type ConfigCache struct {
+	ttl        time.Duration
+	entries    map[uuid.UUID]configEntry
+	generation uint64
+	mutex      sync.RWMutex
+}
+
+type configEntry struct {
+	values    []model.FlagValue
+	expiresAt time.Time
+}
+
+// LoaderFunc loads the configuration of an environment on a cache miss
+type LoaderFunc func(ctx context.Context, envID uuid.UUID) ([]model.FlagValue, error)
+
+// NewConfigCache creates a new cache whose entries expire after ttl
+func NewConfigCache(ttl time.Duration) *ConfigCache {
+	return &ConfigCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]configEntry),
+	}
+}
+
+// Get returns the cached configuration of an environment, if present and fresh
+func (c *ConfigCache) Get(envID uuid.UUID) ([]model.FlagValue, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.entries[envID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return slices.Clone(entry.values), true
+}
+
+// Set stores the configuration of an environment
+func (c *ConfigCache) Set(envID uuid.UUID, values []model.FlagValue) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[envID] = configEntry{
+		values:    slices.Clone(values),
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// GetOrLoad returns the cached configuration of an environment, calling load
+// and caching its result on a miss
+func (c *ConfigCache) GetOrLoad(ctx context.Context, envID uuid.UUID, load LoaderFunc) ([]model.FlagValue, error) {
+	if values, ok := c.Get(envID); ok {
+		return values, nil
+	}
+
+	c.mutex.RLock()
+	generation := c.generation
+	c.mutex.RUnlock()
+
+	values, err := load(ctx, envID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't cache a result that was loaded while an invalidation happened
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.generation == generation {
+		c.entries[envID] = configEntry{
+			values:    slices.Clone(values),
+			expiresAt: time.Now().Add(c.ttl),
+		}
+	}
+
+	return values, nil
+}
+
+// Invalidate drops the cached configuration of the given environments
+func (c *ConfigCache) Invalidate(envIDs ...uuid.UUID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	for _, envID := range envIDs {
+		delete(c.entries, envID)
+	}
+}
+
+// InvalidateAll drops every cached configuration
+func (c *ConfigCache) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.entries = make(map[uuid.UUID]configEntry)
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// environmentValues returns the configuration of an environment with n flags
+func environmentValues(envID uuid.UUID, n int) []model.FlagValue {
+	values := make([]model.FlagValue, n)
+	for i := range values {
+		values[i] = model.FlagValue{
+			ID:      uuid.New(),
+			FlagID:  uuid.New(),
+			FlagKey: fmt.Sprintf("flag_%d", i),
+			EnvID:   envID,
+			Value:   "false",
+		}
+	}
+	return values
+}
+
+func TestConfigCacheGetOrLoad(t *testing.T) {
+	envID := uuid.New()
+	values := environmentValues(envID, 3)
+	loads := 0
+	load := func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+		loads++
+		return values, nil
+	}
+
+	c := NewConfigCache(time.Minute)
+	for i := 0; i < 3; i++ {
+		got, err := c.GetOrLoad(context.Background(), envID, load)
+		if err != nil {
+			t.Fatalf("GetOrLoad: %v", err)
+		}
+		if len(got) != len(values) {
+			t.Fatalf("GetOrLoad returned %d values, want %d", len(got), len(values))
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loaded %d times, want 1", loads)
+	}
+
+	c.Invalidate(envID)
+	if _, err := c.GetOrLoad(context.Background(), envID, load); err != nil {
+		t.Fatalf("GetOrLoad: %v", err)
+	}
+	if loads != 2 {
+		t.Errorf("loaded %d times after invalidation, want 2", loads)
+	}
+}
+
+// Changing the values a caller got back leaves the cache as it was
+func TestConfigCacheReturnsCopies(t *testing.T) {
+	envID := uuid.New()
+	loaded := environmentValues(envID, 3)
+	load := func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+		return loaded, nil
+	}
+
+	c := NewConfigCache(time.Minute)
+	first, err := c.GetOrLoad(context.Background(), envID, load)
+	if err != nil {
+		t.Fatalf("GetOrLoad: %v", err)
+	}
+	first[0].Value = "changed by the first caller"
+	loaded[1].Value = "changed by the loader"
+
+	second, err := c.GetOrLoad(context.Background(), envID, load)
+	if err != nil {
+		t.Fatalf("GetOrLoad: %v", err)
+	}
+	second[2].Value = "changed by the second caller"
+
+	set := environmentValues(envID, 1)
+	otherEnv := uuid.New()
+	c.Set(otherEnv, set)
+	set[0].Value = "changed after Set"
+
+	for _, check := range []struct {
+		envID uuid.UUID
+		n     int
+	}{{envID, 3}, {otherEnv, 1}} {
+		cached, ok := c.Get(check.envID)
+		if !ok || len(cached) != check.n {
+			t.Fatalf("Get = %d values, %v; want %d", len(cached), ok, check.n)
+		}
+		for i, value := range cached {
+			if value.Value != "false" {
+				t.Errorf("cached value %d = %q, want it unchanged", i, value.Value)
+			}
+		}
+	}
+}
+
+func TestConfigCacheSkipsLoadRacingInvalidation(t *testing.T) {
+	envID := uuid.New()
+	c := NewConfigCache(time.Minute)
+
+	_, err := c.GetOrLoad(context.Background(), envID, func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+		// A write lands while the configuration is being read
+		c.Invalidate(id)
+		return environmentValues(id, 1), nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad: %v", err)
+	}
+
+	if _, ok := c.Get(envID); ok {
+		t.Error("configuration loaded during an invalidation was cached")
+	}
+}
+
+func BenchmarkConfigCacheGetOrLoad(b *testing.B) {
+	for _, flags := range []int{100, 2000} {
+		b.Run(fmt.Sprintf("hit/flags=%d", flags), func(b *testing.B) {
+			envID := uuid.New()
+			values := environmentValues(envID, flags)
+			load := func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+				return values, nil
+			}
+			c := NewConfigCache(time.Minute)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetOrLoad(ctx, envID, load); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("miss/flags=%d", flags), func(b *testing.B) {
+			envID := uuid.New()
+			values := environmentValues(envID, flags)
+			load := func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+				return values, nil
+			}
+			c := NewConfigCache(time.Minute)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Invalidate(envID)
+				if _, err := c.GetOrLoad(ctx, envID, load); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkConfigCacheGetOrLoadParallel(b *testing.B) {
+	envIDs := make([]uuid.UUID, 8)
+	configs := make(map[uuid.UUID][]model.FlagValue, len(envIDs))
+	for i := range envIDs {
+		envIDs[i] = uuid.New()
+		configs[envIDs[i]] = environmentValues(envIDs[i], 500)
+	}
+	load := func(ctx context.Context, id uuid.UUID) ([]model.FlagValue, error) {
+		return configs[id], nil
+	}
+	c := NewConfigCache(time.Minute)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := c.GetOrLoad(ctx, envIDs[i%len(envIDs)], load); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
@@ -1,30 +1,198 @@
 package env
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ModeDevelopment = "development"
+	ModeProduction  = "production"
+)
+
+// Defaults that must be overridden before running in production
+const (
+	DefaultJWTSecret  = "your-super-secret-jwt-key-change-in-production"
+	DefaultDBPassword = "password"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
+	Database  DatabaseConfig  `yaml:"database"`
+	Server    ServerConfig    `yaml:"server"`
+	Auth      AuthConfig      `yaml:"auth"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Log       LogConfig       `yaml:"log"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Analytics AnalyticsConfig `yaml:"analytics"`
+	Mail      MailConfig      `yaml:"mail"`
+
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
 }
 
 type ServerConfig struct {
-	Port string
+	Port         string        `yaml:"port"`
+	Mode         string        `yaml:"mode"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+}
+
+type AuthConfig struct {
+	// Algorithm is HS256, RS256 or ES256
+	Algorithm string `yaml:"algorithm"`
+	// JWTSecrets verify incoming tokens; with HS256 the first one also signs
+	// new tokens, so a secret can be rotated by prepending the new one
+	JWTSecrets []string `yaml:"jwt_secrets"`
+	// AcceptHMAC keeps JWTSecrets verifying with RS256/ES256, while tokens
+	// issued before moving off HS256 are still valid. It is off by default:
+	// otherwise anyone holding a secret can mint tokens.
+	AcceptHMAC bool `yaml:"accept_hmac"`
+	// SigningKeys are PEM files for RS256/ES256. The first must be a private
+	// key and signs new tokens; the rest (private or public) only verify.
+	SigningKeys     []SigningKeyConfig `yaml:"signing_keys"`
+	Issuer          string             `yaml:"issuer"`
+	Audience        string             `yaml:"audience"`
+	AccessTokenTTL  time.Duration      `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration      `yaml:"refresh_token_ttl"`
+	// PasswordResetTTL and EmailVerificationTTL bound how long emailed
+	// links stay valid
+	PasswordResetTTL     time.Duration `yaml:"password_reset_ttl"`
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl"`
+	// PasswordLogin allows signing in with a username and password; it can
+	// be turned off to require single sign-on
+	PasswordLogin bool `yaml:"password_login"`
+	// OpenRegistration lets anyone create an account at /api/auth/register
+	// with RegistrationRole; without it users must be invited by an admin
+	OpenRegistration bool          `yaml:"open_registration"`
+	RegistrationRole string        `yaml:"registration_role"`
+	InvitationTTL    time.Duration `yaml:"invitation_ttl"`
+
+	OIDC    OIDCConfig    `yaml:"oidc"`
+	MFA     MFAConfig     `yaml:"mfa"`
+	Lockout LockoutConfig `yaml:"lockout"`
+}
+
+// LockoutConfig throttles failed password logins per username and per client
+// IP. Failures within FailureWindow count towards a lockout; after DelayAfter
+// failures each further failed attempt is answered progressively more slowly,
+// up to MaxDelay.
+type LockoutConfig struct {
+	MaxUserFailures int           `yaml:"max_user_failures"`
+	MaxIPFailures   int           `yaml:"max_ip_failures"`
+	FailureWindow   time.Duration `yaml:"failure_window"`
+	Duration        time.Duration `yaml:"duration"`
+	DelayAfter      int           `yaml:"delay_after"`
+	MaxDelay        time.Duration `yaml:"max_delay"`
+}
+
+// MFAConfig configures TOTP two-factor authentication for password logins
+type MFAConfig struct {
+	// Issuer is the account label shown in authenticator apps
+	Issuer string `yaml:"issuer"`
+	// RequiredRoles must enrol before they can finish logging in
+	RequiredRoles []string      `yaml:"required_roles"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl"`
+	// MaxChallengeFailures is how many wrong codes a login challenge takes
+	// before it is invalidated
+	MaxChallengeFailures int `yaml:"max_challenge_failures"`
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider.
+// It is enabled when an issuer is set.
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	// GroupsClaim names the ID token claim listing the user's groups, and
+	// RoleMapping maps those groups to roles. Users matching no group get
+	// DefaultRole.
+	GroupsClaim string            `yaml:"groups_claim"`
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	DefaultRole string            `yaml:"default_role"`
+	// SuccessRedirectURL receives the tokens in its URL fragment after
+	// login; without it the callback responds with JSON
+	SuccessRedirectURL string `yaml:"success_redirect_url"`
+}
+
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+type SigningKeyConfig struct {
+	ID   string `yaml:"id"`
+	File string `yaml:"file"`
+}
+
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+type CacheConfig struct {
+	ConfigTTL time.Duration `yaml:"config_ttl"`
+	RoleTTL   time.Duration `yaml:"role_ttl"`
+}
+
+type AnalyticsConfig struct {
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// IdempotencyConfig sets how long responses to requests sent with an
+// Idempotency-Key are kept for replaying to retries, and how often expired
+// ones are deleted
+type IdempotencyConfig struct {
+	Window        time.Duration `yaml:"window"`
+	PruneInterval time.Duration `yaml:"prune_interval"`
+}
+
+// Mail drivers
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverFile = "file"
+	MailDriverLog  = "log"
+)
+
+type MailConfig struct {
+	// Driver is smtp, file (writes .eml files to Dir) or log
+	Driver string `yaml:"driver"`
+	From   string `yaml:"from"`
+	Dir    string `yaml:"dir"`
+	// AppURL is the admin UI base URL that emailed links point to
+	AppURL string     `yaml:"app_url"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
+// LoadConfig builds the configuration from defaults, then the YAML file
+// named by CONFIG_FILE (or ./config.yaml if present), then environment
+// variables, and validates the result
 func LoadConfig() (*Config, error) {
 	// Load .env file
 	err := godotenv.Load()
@@ -33,21 +201,294 @@ func LoadConfig() (*Config, error) {
 		fmt.Println("Warning: .env file not found")
 	}
 
-	config := &Config{
+	config := defaultConfig()
+
+	if err := config.loadFile(os.Getenv("CONFIG_FILE")); err != nil {
+		return nil, err
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	config.applyDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func defaultConfig() *Config {
+	return &Config{
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "password"),
-			DBName:   getEnv("DB_NAME", "flagits"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:     "localhost",
+			Port:     "5432",
+			User:     "postgres",
+			Password: DefaultDBPassword,
+			DBName:   "flagits",
+			SSLMode:  "disable",
 		},
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
+			Port:         "8080",
+			Mode:         ModeDevelopment,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  120 * time.Second,
+		},
+		Auth: AuthConfig{
+			Algorithm:       "HS256",
+			Issuer:          "flagit",
+			Audience:        "flagit-api",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			PasswordLogin:   true,
+
+			OpenRegistration: true,
+			RegistrationRole: "viewer",
+			InvitationTTL:    7 * 24 * time.Hour,
+
+			PasswordResetTTL:     time.Hour,
+			EmailVerificationTTL: 48 * time.Hour,
+			MFA: MFAConfig{
+				Issuer:               "Flagit",
+				ChallengeTTL:         5 * time.Minute,
+				MaxChallengeFailures: 5,
+			},
+			Lockout: LockoutConfig{
+				MaxUserFailures: 5,
+				MaxIPFailures:   20,
+				FailureWindow:   15 * time.Minute,
+				Duration:        15 * time.Minute,
+				DelayAfter:      3,
+				MaxDelay:        5 * time.Second,
+			},
+			OIDC: OIDCConfig{
+				Scopes:      []string{"openid", "profile", "email"},
+				GroupsClaim: "groups",
+				DefaultRole: "viewer",
+			},
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Cache: CacheConfig{
+			ConfigTTL: 30 * time.Second,
+			RoleTTL:   time.Minute,
 		},
+		Analytics: AnalyticsConfig{
+			FlushInterval: 30 * time.Second,
+		},
+		Idempotency: IdempotencyConfig{
+			Window:        24 * time.Hour,
+			PruneInterval: time.Hour,
+		},
+		Mail: MailConfig{
+			Driver: MailDriverLog,
+			From:   "Flagit <no-reply@localhost>",
+			Dir:    "tmp/mail",
+			AppURL: "http://localhost:5173",
+			SMTP: SMTPConfig{
+				Port: "587",
+			},
+		},
+	}
+}
+
+// loadFile overlays the YAML file at path; an empty path falls back to
+// ./config.yaml and is skipped if that doesn't exist
+func (c *Config) loadFile(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = "config.yaml"
 	}
 
-	return config, nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides settings with any environment variables that are set,
+// returning an error naming every variable that couldn't be parsed
+func (c *Config) applyEnv() error {
+	var errs []error
+
+	setString(&c.Database.Host, "DB_HOST")
+	setString(&c.Database.Port, "DB_PORT")
+	setString(&c.Database.User, "DB_USER")
+	setString(&c.Database.Password, "DB_PASSWORD")
+	setString(&c.Database.DBName, "DB_NAME")
+	setString(&c.Database.SSLMode, "DB_SSLMODE")
+
+	setString(&c.Server.Port, "SERVER_PORT")
+	setString(&c.Server.Mode, "APP_ENV")
+	setDuration(&errs, &c.Server.ReadTimeout, "SERVER_READ_TIMEOUT")
+	setDuration(&errs, &c.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT")
+	setDuration(&errs, &c.Server.IdleTimeout, "SERVER_IDLE_TIMEOUT")
+
+	setString(&c.Auth.Algorithm, "JWT_ALGORITHM")
+	setList(&c.Auth.JWTSecrets, "JWT_SECRET")
+	setList(&c.Auth.JWTSecrets, "JWT_SECRETS")
+	setBool(&errs, &c.Auth.AcceptHMAC, "JWT_ACCEPT_HMAC")
+	setSigningKeys(&errs, &c.Auth.SigningKeys, "JWT_SIGNING_KEYS")
+	setString(&c.Auth.Issuer, "JWT_ISSUER")
+	setString(&c.Auth.Audience, "JWT_AUDIENCE")
+	setDuration(&errs, &c.Auth.AccessTokenTTL, "JWT_ACCESS_TOKEN_TTL")
+	setDuration(&errs, &c.Auth.RefreshTokenTTL, "REFRESH_TOKEN_TTL")
+	setBool(&errs, &c.Auth.PasswordLogin, "PASSWORD_LOGIN_ENABLED")
+	setBool(&errs, &c.Auth.OpenRegistration, "REGISTRATION_ENABLED")
+	setString(&c.Auth.RegistrationRole, "REGISTRATION_ROLE")
+	setDuration(&errs, &c.Auth.InvitationTTL, "INVITATION_TTL")
+	setDuration(&errs, &c.Auth.PasswordResetTTL, "PASSWORD_RESET_TTL")
+	setDuration(&errs, &c.Auth.EmailVerificationTTL, "EMAIL_VERIFICATION_TTL")
+
+	setString(&c.Auth.MFA.Issuer, "MFA_ISSUER")
+	setList(&c.Auth.MFA.RequiredRoles, "MFA_REQUIRED_ROLES")
+	setDuration(&errs, &c.Auth.MFA.ChallengeTTL, "MFA_CHALLENGE_TTL")
+	setInt(&errs, &c.Auth.MFA.MaxChallengeFailures, "MFA_MAX_CHALLENGE_FAILURES")
+
+	setInt(&errs, &c.Auth.Lockout.MaxUserFailures, "LOGIN_MAX_USER_FAILURES")
+	setInt(&errs, &c.Auth.Lockout.MaxIPFailures, "LOGIN_MAX_IP_FAILURES")
+	setDuration(&errs, &c.Auth.Lockout.FailureWindow, "LOGIN_FAILURE_WINDOW")
+	setDuration(&errs, &c.Auth.Lockout.Duration, "LOGIN_LOCKOUT_DURATION")
+	setInt(&errs, &c.Auth.Lockout.DelayAfter, "LOGIN_DELAY_AFTER")
+	setDuration(&errs, &c.Auth.Lockout.MaxDelay, "LOGIN_MAX_DELAY")
+
+	setString(&c.Auth.OIDC.Issuer, "OIDC_ISSUER")
+	setString(&c.Auth.OIDC.ClientID, "OIDC_CLIENT_ID")
+	setString(&c.Auth.OIDC.ClientSecret, "OIDC_CLIENT_SECRET")
+	setString(&c.Auth.OIDC.RedirectURL, "OIDC_REDIRECT_URL")
+	setList(&c.Auth.OIDC.Scopes, "OIDC_SCOPES")
+	setString(&c.Auth.OIDC.GroupsClaim, "OIDC_GROUPS_CLAIM")
+	setMap(&errs, &c.Auth.OIDC.RoleMapping, "OIDC_ROLE_MAPPING")
+	setString(&c.Auth.OIDC.DefaultRole, "OIDC_DEFAULT_ROLE")
+	setString(&c.Auth.OIDC.SuccessRedirectURL, "OIDC_SUCCESS_REDIRECT_URL")
+
+	setList(&c.CORS.AllowOrigins, "CORS_ALLOW_ORIGINS")
+	setString(&c.Log.Level, "LOG_LEVEL")
+
+	setDuration(&errs, &c.Cache.ConfigTTL, "CONFIG_CACHE_TTL")
+	setDuration(&errs, &c.Cache.RoleTTL, "ROLE_CACHE_TTL")
+	setDuration(&errs, &c.Analytics.FlushInterval, "ANALYTICS_FLUSH_INTERVAL")
+	setDuration(&errs, &c.Idempotency.Window, "IDEMPOTENCY_WINDOW")
+	setDuration(&errs, &c.Idempotency.PruneInterval, "IDEMPOTENCY_PRUNE_INTERVAL")
+
+	setString(&c.Mail.Driver, "MAIL_DRIVER")
+	setString(&c.Mail.From, "MAIL_FROM")
+	setString(&c.Mail.Dir, "MAIL_DIR")
+	setString(&c.Mail.AppURL, "APP_URL")
+	setString(&c.Mail.SMTP.Host, "SMTP_HOST")
+	setString(&c.Mail.SMTP.Port, "SMTP_PORT")
+	setString(&c.Mail.SMTP.Username, "SMTP_USERNAME")
+	setString(&c.Mail.SMTP.Password, "SMTP_PASSWORD")
+
+	return errors.Join(errs...)
+}
+
+// applyDefaults fills in settings whose default depends on other settings
+func (c *Config) applyDefaults() {
+	// Outside production, HS256 falls back to a well-known development secret
+	if c.Auth.Algorithm == "HS256" && len(c.Auth.JWTSecrets) == 0 && !c.IsProduction() {
+		c.Auth.JWTSecrets = []string{DefaultJWTSecret}
+	}
+}
+
+// Validate checks the configuration is usable, and refuses to run in
+// production with the default secrets
+func (c *Config) Validate() error {
+	if c.Server.Mode != ModeDevelopment && c.Server.Mode != ModeProduction {
+		return fmt.Errorf("invalid APP_ENV %q: must be %s or %s", c.Server.Mode, ModeDevelopment, ModeProduction)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", c.Log.Level)
+	}
+
+	switch c.Auth.Algorithm {
+	case "HS256":
+		if len(c.Auth.JWTSecrets) == 0 {
+			return errors.New("at least one JWT secret is required for HS256")
+		}
+	case "RS256", "ES256":
+		if len(c.Auth.SigningKeys) == 0 {
+			return fmt.Errorf("at least one signing key is required for %s", c.Auth.Algorithm)
+		}
+	default:
+		return fmt.Errorf("invalid JWT_ALGORITHM %q: must be HS256, RS256 or ES256", c.Auth.Algorithm)
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 || c.Auth.RefreshTokenTTL <= 0 {
+		return errors.New("access and refresh token TTLs must be positive")
+	}
+
+	if c.Auth.Lockout.MaxUserFailures < 1 || c.Auth.Lockout.MaxIPFailures < 1 ||
+		c.Auth.Lockout.FailureWindow <= 0 || c.Auth.Lockout.Duration <= 0 {
+		return errors.New("login lockout thresholds, window and duration must be positive")
+	}
+
+	if c.Auth.MFA.ChallengeTTL <= 0 || c.Auth.MFA.MaxChallengeFailures < 1 {
+		return errors.New("MFA challenge TTL and failure limit must be positive")
+	}
+
+	if c.Idempotency.Window <= 0 || c.Idempotency.PruneInterval <= 0 {
+		return errors.New("idempotency window and prune interval must be positive")
+	}
+
+	switch c.Mail.Driver {
+	case MailDriverSMTP:
+		if c.Mail.SMTP.Host == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+	case MailDriverFile, MailDriverLog:
+	default:
+		return fmt.Errorf("invalid MAIL_DRIVER %q: must be smtp, file or log", c.Mail.Driver)
+	}
+
+	if c.Auth.OIDC.Enabled() && (c.Auth.OIDC.ClientID == "" || c.Auth.OIDC.RedirectURL == "") {
+		return errors.New("OIDC requires a client ID and redirect URL")
+	}
+
+	if !c.Auth.PasswordLogin && !c.Auth.OIDC.Enabled() {
+		return errors.New("password login can only be disabled when OIDC is configured")
+	}
+
+	if c.IsProduction() {
+		for _, secret := range c.Auth.JWTSecrets {
+			if secret == DefaultJWTSecret {
+				return errors.New("refusing to start in production with the default JWT secret")
+			}
+			if len(secret) < 32 {
+				return errors.New("JWT secrets must be at least 32 characters in production")
+			}
+		}
+		if c.Database.Password == DefaultDBPassword {
+			return errors.New("refusing to start in production with the default database password")
+		}
+		if c.Mail.Driver == MailDriverLog {
+			return errors.New("refusing to start in production with MAIL_DRIVER=log: emails would only be logged")
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Server.Mode == ModeProduction
 }
 
 func (c *DatabaseConfig) GetDSN() string {
@@ -55,9 +496,96 @@ func (c *DatabaseConfig) GetDSN() string {
 		c.User, c.Password, c.Host, c.Port, c.DBName, c.SSLMode)
 }
 
-func getEnv(key, defaultValue string) string {
+func setString(target *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
+	}
+}
+
+func setDuration(errs *[]error, target *time.Duration, key string) {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			*target = d
+		} else {
+			*errs = append(*errs, fmt.Errorf("invalid duration %s=%q", key, value))
+		}
+	}
+}
+
+func setBool(errs *[]error, target *bool, key string) {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			*target = b
+		} else {
+			*errs = append(*errs, fmt.Errorf("invalid boolean %s=%q", key, value))
+		}
+	}
+}
+
+func setInt(errs *[]error, target *int, key string) {
 	if value := os.Getenv(key); value != "" {
-		return value
+		if n, err := strconv.Atoi(value); err == nil {
+			*target = n
+		} else {
+			*errs = append(*errs, fmt.Errorf("invalid integer %s=%q", key, value))
+		}
+	}
+}
+
+// setList reads a comma-separated list
+func setList(target *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) > 0 {
+		*target = items
+	}
+}
+
+// setMap reads a comma-separated list of key=value pairs
+func setMap(errs *[]error, target *map[string]string, key string) {
+	var items []string
+	setList(&items, key)
+	if len(items) == 0 {
+		return
+	}
+
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("invalid %s entry %q: expected key=value", key, item))
+			continue
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	*target = values
+}
+
+// setSigningKeys reads a comma-separated list of id=path pairs
+func setSigningKeys(errs *[]error, target *[]SigningKeyConfig, key string) {
+	var items []string
+	setList(&items, key)
+	if len(items) == 0 {
+		return
+	}
+
+	keys := make([]SigningKeyConfig, 0, len(items))
+	for _, item := range items {
+		id, file, ok := strings.Cut(item, "=")
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("invalid %s entry %q: expected id=path", key, item))
+			continue
+		}
+		keys = append(keys, SigningKeyConfig{ID: strings.TrimSpace(id), File: strings.TrimSpace(file)})
 	}
-	return defaultValue
+	*target = keys
 }
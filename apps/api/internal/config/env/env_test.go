@@ -0,0 +1,114 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+// A variable that doesn't parse stops the configuration from loading instead
+// of silently keeping the default
+func TestLoadConfigInvalidValues(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"SERVER_READ_TIMEOUT", "10"},
+		{"JWT_ACCESS_TOKEN_TTL", "fifteen minutes"},
+		{"PASSWORD_LOGIN_ENABLED", "yes please"},
+		{"LOGIN_MAX_USER_FAILURES", "five"},
+		{"OIDC_ROLE_MAPPING", "admins"},
+		{"JWT_SIGNING_KEYS", "keys/current.pem"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatalf("%s=%q loaded without an error", tt.key, tt.value)
+			}
+			if !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("error %q doesn't name %s", err, tt.key)
+			}
+		})
+	}
+}
+
+// Every variable that doesn't parse is reported, not only the first
+func TestLoadConfigReportsEveryInvalidValue(t *testing.T) {
+	t.Setenv("CONFIG_CACHE_TTL", "soon")
+	t.Setenv("MFA_MAX_CHALLENGE_FAILURES", "many")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("loaded without an error")
+	}
+	for _, key := range []string{"CONFIG_CACHE_TTL", "MFA_MAX_CHALLENGE_FAILURES"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q doesn't name %s", err, key)
+		}
+	}
+}
+
+func TestLoadConfigValidValues(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT", "3s")
+	t.Setenv("PASSWORD_LOGIN_ENABLED", "false")
+	t.Setenv("OIDC_ISSUER", "https://login.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "flagit")
+	t.Setenv("OIDC_REDIRECT_URL", "https://flagit.example.com/api/auth/oidc/callback")
+	t.Setenv("LOGIN_MAX_USER_FAILURES", "7")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Server.ReadTimeout.String() != "3s" || cfg.Auth.PasswordLogin || cfg.Auth.Lockout.MaxUserFailures != 7 {
+		t.Errorf("read timeout %v, password login %v, max user failures %d; want 3s, false, 7",
+			cfg.Server.ReadTimeout, cfg.Auth.PasswordLogin, cfg.Auth.Lockout.MaxUserFailures)
+	}
+}
+
+func TestValidateProductionMailDriver(t *testing.T) {
+	tests := []struct {
+		driver  string
+		wantErr bool
+	}{
+		{driver: MailDriverLog, wantErr: true},
+		{driver: MailDriverFile},
+		{driver: MailDriverSMTP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			cfg := productionConfig()
+			cfg.Mail.Driver = tt.driver
+
+			err := cfg.Validate()
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "MAIL_DRIVER")) {
+				t.Errorf("error = %v, want one naming MAIL_DRIVER", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("error = %v, want none", err)
+			}
+		})
+	}
+
+	// The log driver remains the default outside production
+	cfg := productionConfig()
+	cfg.Server.Mode = ModeDevelopment
+	cfg.Mail.Driver = MailDriverLog
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("development with the log driver: %v", err)
+	}
+}
+
+// productionConfig is the default configuration with the production settings
+// Validate insists on
+func productionConfig() *Config {
+	cfg := defaultConfig()
+	cfg.Server.Mode = ModeProduction
+	cfg.Auth.JWTSecrets = []string{strings.Repeat("s", 32)}
+	cfg.Database.Password = "not-the-default"
+	cfg.Mail.SMTP.Host = "smtp.example.com"
+	return cfg
+}
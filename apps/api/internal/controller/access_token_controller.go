@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/model"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AccessTokenController struct {
+	service   service.AccessTokenService
+	validator *validation.Validator
+}
+
+func NewAccessTokenController(service service.AccessTokenService, validator *validation.Validator) *AccessTokenController {
+	return &AccessTokenController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// GetOwnTokens lists the signed-in user's access tokens
+func (c *AccessTokenController) GetOwnTokens(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	return c.list(ctx, userID)
+}
+
+// CreateOwnToken issues an access token to the signed-in user
+func (c *AccessTokenController) CreateOwnToken(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	return c.create(ctx, userID)
+}
+
+// RevokeOwnToken revokes one of the signed-in user's access tokens
+func (c *AccessTokenController) RevokeOwnToken(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	return c.revoke(ctx, userID, "id")
+}
+
+// GetUserTokens lists a user's or service account's access tokens
+func (c *AccessTokenController) GetUserTokens(ctx *fiber.Ctx) error {
+	userID, ok := c.idParam(ctx, "id", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+	return c.list(ctx, userID)
+}
+
+// CreateUserToken issues an access token to a service account
+func (c *AccessTokenController) CreateUserToken(ctx *fiber.Ctx) error {
+	userID, ok := c.idParam(ctx, "id", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+	return c.create(ctx, userID)
+}
+
+// RevokeUserToken revokes one of a user's or service account's access
+// tokens
+func (c *AccessTokenController) RevokeUserToken(ctx *fiber.Ctx) error {
+	userID, ok := c.idParam(ctx, "id", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+	return c.revoke(ctx, userID, "tokenId")
+}
+
+func (c *AccessTokenController) list(ctx *fiber.Ctx, userID uuid.UUID) error {
+	tokens, err := c.service.ListTokens(ctx.UserContext(), userID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch access tokens")
+	}
+
+	response := make([]dto.AccessTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = tokens[i].ToResponse()
+	}
+	return ctx.JSON(response)
+}
+
+func (c *AccessTokenController) create(ctx *fiber.Ctx, userID uuid.UUID) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.CreateAccessTokenRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	token, raw, err := c.service.CreateToken(ctx.UserContext(), actorID, userID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to create access token")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(createdTokenResponse(token, raw))
+}
+
+func (c *AccessTokenController) revoke(ctx *fiber.Ctx, userID uuid.UUID, param string) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	tokenID, ok := c.idParam(ctx, param, "Invalid token ID")
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.RevokeToken(ctx.UserContext(), actorID, userID, tokenID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to revoke access token")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// idParam parses a UUID route parameter, writing a 400 if invalid
+func (c *AccessTokenController) idParam(ctx *fiber.Ctx, name, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Params(name))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func createdTokenResponse(token *model.AccessToken, raw string) dto.CreatedAccessTokenResponse {
+	return dto.CreatedAccessTokenResponse{
+		AccessTokenResponse: token.ToResponse(),
+		Token:               raw,
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccountController struct {
+	service   service.AccountService
+	validator *validation.Validator
+}
+
+func NewAccountController(service service.AccountService, validator *validation.Validator) *AccountController {
+	return &AccountController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// ForgotPassword emails a reset link; it responds the same whether or not
+// the address has an account
+func (c *AccountController) ForgotPassword(ctx *fiber.Ctx) error {
+	var req dto.ForgotPasswordRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.ForgotPassword(ctx.UserContext(), req.Email); err != nil {
+		return respondError(ctx, err, "Failed to send password reset email")
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// ResetPassword sets a new password with an emailed reset token
+func (c *AccountController) ResetPassword(ctx *fiber.Ctx) error {
+	var req dto.ResetPasswordRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.ResetPassword(ctx.UserContext(), &req); err != nil {
+		return respondError(ctx, err, "Failed to reset password")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ChangePassword changes the signed-in user's password
+func (c *AccountController) ChangePassword(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	sessionID, ok := currentSessionID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.ChangePasswordRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.ChangePassword(ctx.UserContext(), userID, sessionID, &req); err != nil {
+		return respondError(ctx, err, "Failed to change password")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// VerifyEmail confirms an address with an emailed verification token
+func (c *AccountController) VerifyEmail(ctx *fiber.Ctx) error {
+	var req dto.VerifyEmailRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.VerifyEmail(ctx.UserContext(), req.Token); err != nil {
+		return respondError(ctx, err, "Failed to verify email")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ResendVerification sends the signed-in user a new verification link
+func (c *AccountController) ResendVerification(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	if err := c.service.SendVerificationEmail(ctx.UserContext(), userID); err != nil {
+		return respondError(ctx, err, "Failed to send verification email")
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// AcceptInvitation sets an invited user's first password
+func (c *AccountController) AcceptInvitation(ctx *fiber.Ctx) error {
+	var req dto.AcceptInvitationRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.AcceptInvitation(ctx.UserContext(), &req); err != nil {
+		return respondError(ctx, err, "Failed to accept invitation")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
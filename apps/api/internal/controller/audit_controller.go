@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"api/internal/pagination"
+	"api/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditController struct {
+	service service.AuditService
+}
+
+func NewAuditController(service service.AuditService) *AuditController {
+	return &AuditController{service: service}
+}
+
+// GetEvents lists audit events, filtered by ?action=, ?actor_id=,
+// ?actor_type=, ?target_type= and ?target_id=
+func (c *AuditController) GetEvents(ctx *fiber.Ctx) error {
+	params, err := pagination.FromRequest(ctx, "action", "actor_id", "actor_type", "target_type", "target_id")
+	if err != nil {
+		return respondError(ctx, err, "")
+	}
+
+	events, err := c.service.ListEvents(ctx.UserContext(), params)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch audit events")
+	}
+
+	return ctx.JSON(events)
+}
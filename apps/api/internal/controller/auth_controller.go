@@ -34,8 +34,11 @@ func (c *AuthController) Register(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(errors.NewAppError(fiber.StatusBadRequest, err.Error()))
 	}
 
-	response, err := c.authService.Register(ctx.Context(), &req)
+	response, err := c.authService.Register(ctx.UserContext(), &req, clientInfo(ctx))
 	if err != nil {
+		if err == errors.ErrPasswordLoginDisabled || err == errors.ErrRegistrationDisabled {
+			return respondError(ctx, err, "")
+		}
 		return ctx.Status(fiber.StatusBadRequest).JSON(errors.NewAppError(fiber.StatusBadRequest, err.Error()))
 	}
 
@@ -53,14 +56,89 @@ func (c *AuthController) Login(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(errors.NewAppError(fiber.StatusBadRequest, err.Error()))
 	}
 
-	response, err := c.authService.Login(ctx.Context(), &req)
+	response, err := c.authService.Login(ctx.UserContext(), &req, clientInfo(ctx))
 	if err != nil {
+		if err == errors.ErrPasswordLoginDisabled {
+			return respondError(ctx, err, "")
+		}
 		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrInvalidCredentials)
 	}
 
 	return ctx.JSON(response)
 }
 
+func (c *AuthController) Refresh(ctx *fiber.Ctx) error {
+	var req dto.RefreshTokenRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRequestBody)
+	}
+
+	if err := c.validator.Validate(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.NewAppError(fiber.StatusBadRequest, err.Error()))
+	}
+
+	response, err := c.authService.Refresh(ctx.UserContext(), req.RefreshToken, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to refresh token")
+	}
+
+	return ctx.JSON(response)
+}
+
+// Logout revokes the session of the access token used for the request
+func (c *AuthController) Logout(ctx *fiber.Ctx) error {
+	sessionIDStr, _ := ctx.Locals("session_id").(string)
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	if err := c.authService.Logout(ctx.UserContext(), sessionID); err != nil {
+		return respondError(ctx, err, "Failed to log out")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeUserSessions signs a user out of every session
+func (c *AuthController) RevokeUserSessions(ctx *fiber.Ctx) error {
+	userID, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	revoked, err := c.authService.RevokeUserSessions(ctx.UserContext(), userID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to revoke sessions")
+	}
+
+	return ctx.JSON(dto.RevokeSessionsResponse{Revoked: revoked})
+}
+
+// UnlockUser lifts a login lockout on a user
+func (c *AuthController) UnlockUser(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	userID, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	unlocked, err := c.authService.UnlockUser(ctx.UserContext(), actorID, userID, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to unlock user")
+	}
+
+	return ctx.JSON(dto.UnlockUserResponse{Unlocked: unlocked})
+}
+
 func (c *AuthController) Profile(ctx *fiber.Ctx) error {
 	// Get user ID from context (set by auth middleware)
 	userIDStr := ctx.Locals("user_id")
@@ -74,7 +152,7 @@ func (c *AuthController) Profile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidField)
 	}
 
-	user, err := c.authService.GetUserByID(ctx.Context(), userID)
+	user, err := c.authService.GetUserByID(ctx.UserContext(), userID)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(errors.ErrInternalServer)
 	}
@@ -87,3 +165,23 @@ func (c *AuthController) Profile(ctx *fiber.Ctx) error {
 	var _ *model.User = user // Force usage of model package
 	return ctx.JSON(user.ToResponse())
 }
+
+// JWKS publishes the public signing keys
+func (c *AuthController) JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(c.authService.JWKS())
+}
+
+func clientInfo(ctx *fiber.Ctx) dto.ClientInfo {
+	client := dto.ClientInfo{
+		UserAgent: ctx.Get("User-Agent"),
+		IPAddress: ctx.IP(),
+	}
+	// Set on authenticated routes, so audit events record who acted and how
+	client.PrincipalType, _ = ctx.Locals("principal_type").(string)
+	tokenIDStr, _ := ctx.Locals("token_id").(string)
+	if tokenID, err := uuid.Parse(tokenIDStr); err == nil {
+		client.TokenID = &tokenID
+	}
+	return client
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"api/internal/errors"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// currentUserID returns the ID of the authenticated user, as set by the
+// auth middleware
+func currentUserID(ctx *fiber.Ctx) (uuid.UUID, bool) {
+	userIDStr, _ := ctx.Locals("user_id").(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// currentSessionID returns the session of the access token used for the
+// request
+func currentSessionID(ctx *fiber.Ctx) (uuid.UUID, bool) {
+	sessionIDStr, _ := ctx.Locals("session_id").(string)
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return sessionID, true
+}
+
+// checkedBodyID replaces an ID parsed from a body field with the one the
+// authorization middleware checked, so the handler acts on the resource the
+// caller was authorised for
+func checkedBodyID(ctx *fiber.Ctx, field string, id *uuid.UUID) {
+	if checked, ok := ctx.Locals("body_" + field).(string); ok {
+		*id, _ = uuid.Parse(checked)
+	}
+}
+
+// parseBody parses and validates a request body, writing the error response
+// if either fails
+func parseBody(ctx *fiber.Ctx, validator *validation.Validator, req interface{}) bool {
+	if err := ctx.BodyParser(req); err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRequestBody)
+		return false
+	}
+	if err := validator.Validate(req); err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(errors.NewAppError(fiber.StatusBadRequest, err.Error()))
+		return false
+	}
+	return true
+}
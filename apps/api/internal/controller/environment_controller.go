@@ -1,9 +1,13 @@
 package controller
 
 import (
+	"errors"
+
 	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/pagination"
 	"api/internal/service"
-	"context"
+	"api/internal/validation"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,34 +15,45 @@ import (
 )
 
 type EnvironmentController struct {
-	service service.EnvironmentService
+	service   service.EnvironmentService
+	validator *validation.Validator
 }
 
-func NewEnvironmentController(service service.EnvironmentService) *EnvironmentController {
-	return &EnvironmentController{service: service}
+func NewEnvironmentController(service service.EnvironmentService, validator *validation.Validator) *EnvironmentController {
+	return &EnvironmentController{service: service, validator: validator}
 }
 
 func (c *EnvironmentController) CreateEnvironment(ctx *fiber.Ctx) error {
 	var req dto.CreateEnvironmentRequest
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
 	}
+	checkedBodyID(ctx, "project_id", &req.ProjectID)
 
-	env, err := c.service.CreateEnvironment(context.Background(), &req)
+	env, err := c.service.CreateEnvironment(ctx.UserContext(), &req)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create environment",
-		})
+		return respondError(ctx, err, "Failed to create environment")
 	}
 
+	setETag(ctx, env.Version)
 	return ctx.Status(http.StatusCreated).JSON(env)
 }
 
 func (c *EnvironmentController) GetEnvironments(ctx *fiber.Ctx) error {
-	environments, err := c.service.GetAllEnvironments(context.Background())
+	params, err := pagination.FromRequest(ctx, "project_id")
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	environments, err := c.service.GetAllEnvironments(ctx.UserContext(), params)
 	if err != nil {
+		if pagination.IsInvalidRequest(err) {
+			return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch environments",
 		})
@@ -56,8 +71,20 @@ func (c *EnvironmentController) GetProjectEnvironments(ctx *fiber.Ctx) error {
 		})
 	}
 
-	environments, err := c.service.GetProjectEnvironments(context.Background(), projectID)
+	params, err := pagination.FromRequest(ctx)
 	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	environments, err := c.service.GetProjectEnvironments(ctx.UserContext(), projectID, params)
+	if err != nil {
+		if pagination.IsInvalidRequest(err) {
+			return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch project environments",
 		})
@@ -75,13 +102,12 @@ func (c *EnvironmentController) GetEnvironment(ctx *fiber.Ctx) error {
 		})
 	}
 
-	env, err := c.service.GetEnvironment(context.Background(), id)
+	env, err := c.service.GetEnvironment(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch environment",
-		})
+		return respondError(ctx, err, "Failed to fetch environment")
 	}
 
+	setETag(ctx, env.Version)
 	return ctx.JSON(env)
 }
 
@@ -95,19 +121,19 @@ func (c *EnvironmentController) UpdateEnvironment(ctx *fiber.Ctx) error {
 	}
 
 	var req dto.UpdateEnvironmentRequest
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	if !parseBody(ctx, c.validator, &req) || !ifMatchVersion(ctx, &req.Version, &req.IfMatch) {
+		return nil
 	}
 
-	env, err := c.service.UpdateEnvironment(context.Background(), id, &req)
+	env, err := c.service.UpdateEnvironment(ctx.UserContext(), id, &req)
+	if errors.Is(err, apperrors.ErrVersionMismatch) {
+		return respondStale(ctx, env, env.Version)
+	}
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update environment",
-		})
+		return respondError(ctx, err, "Failed to update environment")
 	}
 
+	setETag(ctx, env.Version)
 	return ctx.JSON(env)
 }
 
@@ -120,12 +146,43 @@ func (c *EnvironmentController) DeleteEnvironment(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = c.service.DeleteEnvironment(context.Background(), id)
+	err = c.service.DeleteEnvironment(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete environment",
-		})
+		return respondError(ctx, err, "Failed to delete environment")
 	}
 
 	return ctx.Status(http.StatusNoContent).Send(nil)
 }
+
+// PromoteEnvironment copies flag values from the environment in the route
+// to another of its project, or with dry_run reports what would change.
+// Conflicts block the copy with a 409 listing them.
+func (c *EnvironmentController) PromoteEnvironment(ctx *fiber.Ctx) error {
+	idStr := ctx.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid environment ID",
+		})
+	}
+
+	var req dto.PromoteEnvironmentRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+	checkedBodyID(ctx, "target_env_id", &req.TargetEnvID)
+
+	promotion, err := c.service.PromoteEnvironment(ctx.UserContext(), id, &req)
+	if errors.Is(err, apperrors.ErrPromotionConflict) || errors.Is(err, apperrors.ErrInvalidFlagValue) {
+		appErr := err.(*apperrors.AppError)
+		return ctx.Status(appErr.Code).JSON(fiber.Map{
+			"error":     appErr.Message,
+			"promotion": promotion,
+		})
+	}
+	if err != nil {
+		return respondError(ctx, err, "Failed to promote environment")
+	}
+
+	return ctx.JSON(promotion)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	apperrors "api/internal/errors"
+	"api/internal/pagination"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// respondError writes application and pagination errors with their own
+// status code, and anything else as a 500 with the given message
+func respondError(ctx *fiber.Ctx, err error, fallback string) error {
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) {
+		return ctx.Status(appErr.Code).JSON(fiber.Map{
+			"error": appErr.Message,
+		})
+	}
+
+	if pagination.IsInvalidRequest(err) {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
+		"error": fallback,
+	})
+}
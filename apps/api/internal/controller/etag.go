@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setETag sets the ETag of a versioned resource, which is its version
+func setETag(ctx *fiber.Ctx, version int) {
+	ctx.Set(fiber.HeaderETag, strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion reads the version an update was made from out of the
+// If-Match header into version, overriding any version field of the body.
+// A list of ETags or * (RFC 9110 section 13.1.1) goes into ifMatch instead:
+// the update applies if the current version matches any of them, or with
+// *, whatever it is. It writes the error response if the header doesn't
+// parse.
+func ifMatchVersion(ctx *fiber.Ctx, version **int, ifMatch **dto.IfMatch) bool {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return true
+	}
+	if header == "*" {
+		*version, *ifMatch = nil, &dto.IfMatch{Any: true}
+		return true
+	}
+
+	var versions []int
+	for _, etag := range strings.Split(header, ",") {
+		parsed, ok := parseETag(strings.TrimSpace(etag))
+		if !ok {
+			ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": apperrors.ErrInvalidIfMatch.Message,
+			})
+			return false
+		}
+		versions = append(versions, parsed)
+	}
+
+	if len(versions) == 1 {
+		*version, *ifMatch = &versions[0], nil
+		return true
+	}
+	*version, *ifMatch = nil, &dto.IfMatch{Versions: versions}
+	return true
+}
+
+// parseETag reads the version out of an ETag set by setETag, accepting it
+// weak or unquoted too
+func parseETag(etag string) (int, bool) {
+	etag = strings.TrimPrefix(etag, "W/")
+	unquoted, err := strconv.Unquote(etag)
+	if err != nil {
+		unquoted = etag
+	}
+	version, err := strconv.Atoi(unquoted)
+	return version, err == nil
+}
+
+// respondStale answers an update made from an outdated version with the
+// resource's current state, for the client to merge its changes into
+func respondStale(ctx *fiber.Ctx, current interface{}, version int) error {
+	setETag(ctx, version)
+	return ctx.Status(http.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":   apperrors.ErrVersionMismatch.Message,
+		"current": current,
+	})
+}
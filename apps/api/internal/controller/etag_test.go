@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	bodyVersion := 7
+
+	tests := []struct {
+		name        string
+		ifMatch     string
+		ok          bool
+		want        *int
+		wantIfMatch *dto.IfMatch
+	}{
+		{name: "no header keeps the body's version", ifMatch: "", ok: true, want: &bodyVersion},
+		{name: "strong ETag", ifMatch: `"3"`, ok: true, want: intPtr(3)},
+		{name: "weak ETag", ifMatch: `W/"3"`, ok: true, want: intPtr(3)},
+		{name: "unquoted version", ifMatch: "3", ok: true, want: intPtr(3)},
+		{name: "surrounding whitespace", ifMatch: `  "12" `, ok: true, want: intPtr(12)},
+		{name: "wildcard", ifMatch: "*", ok: true, wantIfMatch: &dto.IfMatch{Any: true}},
+		{name: "several ETags", ifMatch: `"3", W/"4","5"`, ok: true, wantIfMatch: &dto.IfMatch{Versions: []int{3, 4, 5}}},
+		{name: "not a version", ifMatch: `"abc"`, ok: false},
+		{name: "a list with something else", ifMatch: `"3", "abc"`, ok: false},
+		{name: "wildcard in a list", ifMatch: `"3", *`, ok: false},
+		{name: "empty list element", ifMatch: `"3",`, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Put("/", func(c *fiber.Ctx) error {
+				version := &bodyVersion
+				var ifMatch *dto.IfMatch
+				ok := ifMatchVersion(c, &version, &ifMatch)
+				if ok != tt.ok {
+					t.Errorf("ifMatchVersion = %v, want %v", ok, tt.ok)
+				}
+				if ok && !reflect.DeepEqual(version, tt.want) {
+					t.Errorf("version = %v, want %v", version, tt.want)
+				}
+				if ok && !reflect.DeepEqual(ifMatch, tt.wantIfMatch) {
+					t.Errorf("ifMatch = %+v, want %+v", ifMatch, tt.wantIfMatch)
+				}
+				if ok {
+					return c.SendStatus(fiber.StatusNoContent)
+				}
+				return nil
+			})
+
+			req := httptest.NewRequest(fiber.MethodPut, "/", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tt.ifMatch)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+
+			wantStatus := fiber.StatusNoContent
+			if !tt.ok {
+				wantStatus = apperrors.ErrInvalidIfMatch.Code
+			}
+			if resp.StatusCode != wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, wantStatus)
+			}
+		})
+	}
+}
+
+// An ETag the API sends is accepted back as If-Match
+func TestETagRoundTrip(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		setETag(c, 42)
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Put("/", func(c *fiber.Ctx) error {
+		var version *int
+		var ifMatch *dto.IfMatch
+		if !ifMatchVersion(c, &version, &ifMatch) {
+			return nil
+		}
+		return c.JSON(version)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	etag := resp.Header.Get(fiber.HeaderETag)
+	if etag != `"42"` {
+		t.Fatalf("ETag = %s, want \"42\"", etag)
+	}
+
+	req := httptest.NewRequest(fiber.MethodPut, "/", nil)
+	req.Header.Set(fiber.HeaderIfMatch, etag)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "42" {
+		t.Errorf("If-Match read version %s, want 42", body)
+	}
+}
+
+func TestRespondStale(t *testing.T) {
+	app := fiber.New()
+	app.Put("/", func(c *fiber.Ctx) error {
+		return respondStale(c, fiber.Map{"name": "Changed elsewhere", "version": 5}, 5)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPut, "/", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != apperrors.ErrVersionMismatch.Code {
+		t.Errorf("status = %d, want %d", resp.StatusCode, apperrors.ErrVersionMismatch.Code)
+	}
+	if etag := resp.Header.Get(fiber.HeaderETag); etag != `"5"` {
+		t.Errorf("ETag = %s, want the current version \"5\"", etag)
+	}
+
+	var body struct {
+		Error   string `json:"error"`
+		Current struct {
+			Name    string `json:"name"`
+			Version int    `json:"version"`
+		} `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Current.Name != "Changed elsewhere" || body.Current.Version != 5 {
+		t.Errorf("current = %+v, want the resource's current state", body.Current)
+	}
+	if body.Error == "" {
+		t.Error("response has no error message")
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/service"
+	"api/internal/validation"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type EvaluationController struct {
+	service   service.EvaluationService
+	validator *validation.Validator
+}
+
+func NewEvaluationController(service service.EvaluationService, validator *validation.Validator) *EvaluationController {
+	return &EvaluationController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+func (c *EvaluationController) Evaluate(ctx *fiber.Ctx) error {
+	envIDStr := ctx.Params("envId")
+	envID, err := uuid.Parse(envIDStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid environment ID",
+		})
+	}
+
+	var keys []string
+	if keysParam := ctx.Query("keys"); keysParam != "" {
+		for _, key := range strings.Split(keysParam, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	results, err := c.service.Evaluate(ctx.UserContext(), envID, keys)
+	if err != nil {
+		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to evaluate flags",
+		})
+	}
+
+	return ctx.JSON(results)
+}
+
+func (c *EvaluationController) SubmitSummary(ctx *fiber.Ctx) error {
+	envIDStr := ctx.Params("envId")
+	envID, err := uuid.Parse(envIDStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid environment ID",
+		})
+	}
+
+	var req dto.EvaluationSummaryRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := c.validator.Validate(&req); err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	accepted, err := c.service.RecordSummary(ctx.UserContext(), envID, &req)
+	if err != nil {
+		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record evaluations",
+		})
+	}
+
+	return ctx.Status(http.StatusAccepted).JSON(fiber.Map{
+		"accepted": accepted,
+		"ignored":  len(req.Counters) - accepted,
+	})
+}
+
+func (c *EvaluationController) GetFlagInsights(ctx *fiber.Ctx) error {
+	idStr := ctx.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid flag ID",
+		})
+	}
+
+	days := ctx.QueryInt("days", 7)
+	interval := ctx.Query("interval", "hour")
+	if days < 1 || days > 90 {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "days must be between 1 and 90",
+		})
+	}
+	if interval != "hour" && interval != "day" {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "interval must be one of: hour, day",
+		})
+	}
+
+	insights, err := c.service.GetFlagInsights(ctx.UserContext(), id, days, interval)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch flag insights")
+	}
+
+	return ctx.JSON(insights)
+}
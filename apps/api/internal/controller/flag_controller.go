@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"errors"
+
 	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/pagination"
 	"api/internal/service"
-	"context"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -25,19 +28,20 @@ func (c *FlagController) CreateFlag(ctx *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	checkedBodyID(ctx, "project_id", &req.ProjectID)
 
-	flag, err := c.service.CreateFlag(context.Background(), &req)
+	flag, err := c.service.CreateFlag(ctx.UserContext(), &req)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create flag",
-		})
+		return respondError(ctx, err, "Failed to create flag")
 	}
 
+	setETag(ctx, flag.Version)
 	return ctx.Status(http.StatusCreated).JSON(flag)
 }
 
 func (c *FlagController) GetProjectFlags(ctx *fiber.Ctx) error {
-	projectIDStr := ctx.Params("projectId")
+	// GET /api/flags takes the project from the query string instead of the path
+	projectIDStr := ctx.Params("projectId", ctx.Query("project_id"))
 	projectID, err := uuid.Parse(projectIDStr)
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
@@ -47,8 +51,20 @@ func (c *FlagController) GetProjectFlags(ctx *fiber.Ctx) error {
 
 	includeValues := ctx.Query("includeValues") == "true"
 
-	flags, err := c.service.GetProjectFlags(context.Background(), projectID, includeValues)
+	params, err := pagination.FromRequest(ctx, "type", "enabled_in", "tag", "owner", "owner_type", "status", "kind")
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	flags, err := c.service.GetProjectFlags(ctx.UserContext(), projectID, params, includeValues)
 	if err != nil {
+		if pagination.IsInvalidRequest(err) {
+			return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch project flags",
 		})
@@ -57,6 +73,32 @@ func (c *FlagController) GetProjectFlags(ctx *fiber.Ctx) error {
 	return ctx.JSON(flags)
 }
 
+func (c *FlagController) GetStaleFlags(ctx *fiber.Ctx) error {
+	projectIDStr := ctx.Params("projectId")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid project ID",
+		})
+	}
+
+	days := ctx.QueryInt("days", 30)
+	if days < 1 {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "days must be at least 1",
+		})
+	}
+
+	flags, err := c.service.GetStaleFlags(ctx.UserContext(), projectID, days)
+	if err != nil {
+		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch stale flags",
+		})
+	}
+
+	return ctx.JSON(flags)
+}
+
 func (c *FlagController) GetFlag(ctx *fiber.Ctx) error {
 	idStr := ctx.Params("id")
 	id, err := uuid.Parse(idStr)
@@ -66,13 +108,12 @@ func (c *FlagController) GetFlag(ctx *fiber.Ctx) error {
 		})
 	}
 
-	flag, err := c.service.GetFlag(context.Background(), id)
+	flag, err := c.service.GetFlag(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch flag",
-		})
+		return respondError(ctx, err, "Failed to fetch flag")
 	}
 
+	setETag(ctx, flag.Version)
 	return ctx.JSON(flag)
 }
 
@@ -91,18 +132,41 @@ func (c *FlagController) UpdateFlag(ctx *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if !ifMatchVersion(ctx, &req.Version, &req.IfMatch) {
+		return nil
+	}
 
-	flag, err := c.service.UpdateFlag(context.Background(), id, &req)
+	flag, err := c.service.UpdateFlag(ctx.UserContext(), id, &req)
+	if errors.Is(err, apperrors.ErrVersionMismatch) {
+		return respondStale(ctx, flag, flag.Version)
+	}
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update flag",
+		return respondError(ctx, err, "Failed to update flag")
+	}
+
+	setETag(ctx, flag.Version)
+	return ctx.JSON(flag)
+}
+
+func (c *FlagController) ArchiveFlag(ctx *fiber.Ctx) error {
+	idStr := ctx.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid flag ID",
 		})
 	}
 
+	flag, err := c.service.ArchiveFlag(ctx.UserContext(), id)
+	if err != nil {
+		return respondError(ctx, err, "Failed to archive flag")
+	}
+
+	setETag(ctx, flag.Version)
 	return ctx.JSON(flag)
 }
 
-func (c *FlagController) DeleteFlag(ctx *fiber.Ctx) error {
+func (c *FlagController) RestoreFlag(ctx *fiber.Ctx) error {
 	idStr := ctx.Params("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
@@ -111,13 +175,29 @@ func (c *FlagController) DeleteFlag(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = c.service.DeleteFlag(context.Background(), id)
+	flag, err := c.service.RestoreFlag(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete flag",
+		return respondError(ctx, err, "Failed to restore flag")
+	}
+
+	setETag(ctx, flag.Version)
+	return ctx.JSON(flag)
+}
+
+func (c *FlagController) DeleteFlag(ctx *fiber.Ctx) error {
+	idStr := ctx.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid flag ID",
 		})
 	}
 
+	err = c.service.DeleteFlag(ctx.UserContext(), id)
+	if err != nil {
+		return respondError(ctx, err, "Failed to delete flag")
+	}
+
 	return ctx.Status(http.StatusNoContent).Send(nil)
 }
 
@@ -131,11 +211,9 @@ func (c *FlagController) GetFlagValues(ctx *fiber.Ctx) error {
 		})
 	}
 
-	values, err := c.service.GetFlagValues(context.Background(), flagID)
+	values, err := c.service.GetFlagValues(ctx.UserContext(), flagID)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch flag values",
-		})
+		return respondError(ctx, err, "Failed to fetch flag values")
 	}
 
 	return ctx.JSON(values)
@@ -150,11 +228,9 @@ func (c *FlagController) GetEnvironmentFlags(ctx *fiber.Ctx) error {
 		})
 	}
 
-	values, err := c.service.GetEnvironmentFlags(context.Background(), envID)
+	values, err := c.service.GetEnvironmentFlags(ctx.UserContext(), envID)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch environment flags",
-		})
+		return respondError(ctx, err, "Failed to fetch environment flags")
 	}
 
 	return ctx.JSON(values)
@@ -167,14 +243,15 @@ func (c *FlagController) CreateOrUpdateFlagValue(ctx *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	checkedBodyID(ctx, "flag_id", &req.FlagID)
+	checkedBodyID(ctx, "env_id", &req.EnvID)
 
-	flagValue, err := c.service.CreateOrUpdateFlagValue(context.Background(), &req)
+	flagValue, err := c.service.CreateOrUpdateFlagValue(ctx.UserContext(), &req)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create/update flag value",
-		})
+		return respondError(ctx, err, "Failed to create/update flag value")
 	}
 
+	setETag(ctx, flagValue.Version)
 	return ctx.Status(http.StatusCreated).JSON(flagValue)
 }
 
@@ -193,14 +270,19 @@ func (c *FlagController) UpdateFlagValue(ctx *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if !ifMatchVersion(ctx, &req.Version, &req.IfMatch) {
+		return nil
+	}
 
-	flagValue, err := c.service.UpdateFlagValue(context.Background(), id, &req)
+	flagValue, err := c.service.UpdateFlagValue(ctx.UserContext(), id, &req)
+	if errors.Is(err, apperrors.ErrVersionMismatch) {
+		return respondStale(ctx, flagValue, flagValue.Version)
+	}
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update flag value",
-		})
+		return respondError(ctx, err, "Failed to update flag value")
 	}
 
+	setETag(ctx, flagValue.Version)
 	return ctx.JSON(flagValue)
 }
 
@@ -213,11 +295,9 @@ func (c *FlagController) DeleteFlagValue(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = c.service.DeleteFlagValue(context.Background(), id)
+	err = c.service.DeleteFlagValue(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete flag value",
-		})
+		return respondError(ctx, err, "Failed to delete flag value")
 	}
 
 	return ctx.Status(http.StatusNoContent).Send(nil)
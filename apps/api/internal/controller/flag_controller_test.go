@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// missingFlagService knows no flags or flag values
+type missingFlagService struct {
+	service.FlagService
+}
+
+func (missingFlagService) GetFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	return nil, apperrors.ErrFlagNotFound
+}
+
+func (missingFlagService) ArchiveFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	return nil, apperrors.ErrFlagNotFound
+}
+
+func (missingFlagService) RestoreFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	return nil, apperrors.ErrFlagNotFound
+}
+
+func (missingFlagService) DeleteFlagValue(ctx context.Context, id uuid.UUID) error {
+	return apperrors.ErrFlagValueNotFound
+}
+
+func TestFlagNotFound(t *testing.T) {
+	c := NewFlagController(missingFlagService{})
+	app := fiber.New()
+	app.Get("/flags/:id", c.GetFlag)
+	app.Post("/flags/:id/archive", c.ArchiveFlag)
+	app.Post("/flags/:id/restore", c.RestoreFlag)
+	app.Delete("/flags/values/:id", c.DeleteFlagValue)
+
+	id := uuid.New().String()
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: fiber.MethodGet, path: "/flags/" + id},
+		{method: fiber.MethodPost, path: "/flags/" + id + "/archive"},
+		{method: fiber.MethodPost, path: "/flags/" + id + "/restore"},
+		{method: fiber.MethodDelete, path: "/flags/values/" + id},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusNotFound {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+			}
+		})
+	}
+}
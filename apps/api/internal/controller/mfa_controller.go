@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type MFAController struct {
+	service   service.MFAService
+	validator *validation.Validator
+}
+
+func NewMFAController(service service.MFAService, validator *validation.Validator) *MFAController {
+	return &MFAController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// Verify completes a login that is waiting on a second factor
+func (c *MFAController) Verify(ctx *fiber.Ctx) error {
+	var req dto.MFAVerifyRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	response, err := c.service.Verify(ctx.UserContext(), &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to verify authentication code")
+	}
+
+	return ctx.JSON(response)
+}
+
+// Setup starts the enrolment a login is waiting on
+func (c *MFAController) Setup(ctx *fiber.Ctx) error {
+	var req dto.MFASetupRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	response, err := c.service.StartChallengeEnrollment(ctx.UserContext(), req.MFAToken)
+	if err != nil {
+		return respondError(ctx, err, "Failed to start enrolment")
+	}
+
+	return ctx.JSON(response)
+}
+
+// SetupConfirm finishes enrolment and the login waiting on it
+func (c *MFAController) SetupConfirm(ctx *fiber.Ctx) error {
+	var req dto.MFASetupConfirmRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	response, err := c.service.ConfirmChallengeEnrollment(ctx.UserContext(), &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to confirm enrolment")
+	}
+
+	return ctx.JSON(response)
+}
+
+// Enroll starts enrolment for the signed-in user
+func (c *MFAController) Enroll(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	response, err := c.service.StartEnrollment(ctx.UserContext(), userID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to start enrolment")
+	}
+
+	return ctx.JSON(response)
+}
+
+// Confirm enables MFA for the signed-in user
+func (c *MFAController) Confirm(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.MFAConfirmRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	response, err := c.service.ConfirmEnrollment(ctx.UserContext(), userID, req.Code)
+	if err != nil {
+		return respondError(ctx, err, "Failed to confirm enrolment")
+	}
+
+	return ctx.JSON(response)
+}
+
+// Disable turns MFA off for the signed-in user
+func (c *MFAController) Disable(ctx *fiber.Ctx) error {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.MFADisableRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if err := c.service.Disable(ctx.UserContext(), userID, req.Code); err != nil {
+		return respondError(ctx, err, "Failed to disable two-factor authentication")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Reset clears another user's MFA (admin)
+func (c *MFAController) Reset(ctx *fiber.Ctx) error {
+	userID, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := c.service.Reset(ctx.UserContext(), userID); err != nil {
+		return respondError(ctx, err, "Failed to reset two-factor authentication")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
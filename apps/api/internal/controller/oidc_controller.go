@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/errors"
+	"api/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so a
+// callback URL can't be replayed in another browser
+const oidcStateCookie = "flagit_oidc_state"
+
+type OIDCController struct {
+	service service.OIDCService
+	cfg     env.OIDCConfig
+}
+
+func NewOIDCController(service service.OIDCService, cfg env.OIDCConfig) *OIDCController {
+	return &OIDCController{
+		service: service,
+		cfg:     cfg,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (c *OIDCController) Login(ctx *fiber.Ctx) error {
+	authURL, state, err := c.service.AuthorizationURL(ctx.UserContext())
+	if err != nil {
+		return respondError(ctx, err, "Failed to start single sign-on")
+	}
+
+	ctx.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		Expires:  time.Now().Add(10 * time.Minute),
+		HTTPOnly: true,
+		Secure:   ctx.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return ctx.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback completes the login when the identity provider redirects back
+func (c *OIDCController) Callback(ctx *fiber.Ctx) error {
+	if providerErr := ctx.Query("error"); providerErr != "" {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   errors.ErrOIDCLoginFailed.Message,
+			"details": ctx.Query("error_description", providerErr),
+		})
+	}
+
+	state := ctx.Query("state")
+	code := ctx.Query("code")
+	if state == "" || code == "" || ctx.Cookies(oidcStateCookie) != state {
+		return respondError(ctx, errors.ErrOIDCStateInvalid, "")
+	}
+	ctx.ClearCookie(oidcStateCookie)
+
+	response, err := c.service.Callback(ctx.UserContext(), state, code, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to complete single sign-on")
+	}
+
+	if c.cfg.SuccessRedirectURL == "" {
+		return ctx.JSON(response)
+	}
+
+	// Hand the tokens to the frontend in the fragment, which browsers don't
+	// send to servers or include in Referer headers
+	fragment := url.Values{
+		"token":         {response.Token},
+		"refresh_token": {response.RefreshToken},
+		"expires_in":    {strconv.Itoa(response.ExpiresIn)},
+	}
+	return ctx.Redirect(c.cfg.SuccessRedirectURL+"#"+fragment.Encode(), fiber.StatusFound)
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/pagination"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type OrganizationController struct {
+	service   service.OrganizationService
+	validator *validation.Validator
+}
+
+func NewOrganizationController(service service.OrganizationService, validator *validation.Validator) *OrganizationController {
+	return &OrganizationController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// GetCurrent returns the caller's organisation
+func (c *OrganizationController) GetCurrent(ctx *fiber.Ctx) error {
+	org, err := c.service.GetCurrent(ctx.UserContext())
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch organization")
+	}
+
+	return ctx.JSON(org)
+}
+
+// UpdateCurrent renames the caller's organisation
+func (c *OrganizationController) UpdateCurrent(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.UpdateOrganizationRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	org, err := c.service.UpdateCurrent(ctx.UserContext(), actorID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update organization")
+	}
+
+	return ctx.JSON(org)
+}
+
+// GetOrganizations lists organisations, searching name and slug with ?q=
+func (c *OrganizationController) GetOrganizations(ctx *fiber.Ctx) error {
+	params, err := pagination.FromRequest(ctx)
+	if err != nil {
+		return respondError(ctx, err, "")
+	}
+
+	orgs, err := c.service.ListOrganizations(ctx.UserContext(), params)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch organizations")
+	}
+
+	return ctx.JSON(orgs)
+}
+
+func (c *OrganizationController) GetOrganization(ctx *fiber.Ctx) error {
+	id, ok := c.orgIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	org, err := c.service.GetOrganization(ctx.UserContext(), id)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch organization")
+	}
+
+	return ctx.JSON(org)
+}
+
+// CreateOrganization adds an organisation and invites its first admin
+func (c *OrganizationController) CreateOrganization(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.CreateOrganizationRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	org, admin, err := c.service.CreateOrganization(ctx.UserContext(), actorID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to create organization")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"organization": org,
+		"admin":        admin.ToResponse(),
+	})
+}
+
+func (c *OrganizationController) UpdateOrganization(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	id, ok := c.orgIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	var req dto.UpdateOrganizationRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	org, err := c.service.UpdateOrganization(ctx.UserContext(), actorID, id, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update organization")
+	}
+
+	return ctx.JSON(org)
+}
+
+// DeleteOrganization deletes an organisation with all its users and projects
+func (c *OrganizationController) DeleteOrganization(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	id, ok := c.orgIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.DeleteOrganization(ctx.UserContext(), actorID, id, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to delete organization")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// orgIDParam parses the :id route parameter, writing a 400 if invalid
+func (c *OrganizationController) orgIDParam(ctx *fiber.Ctx) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
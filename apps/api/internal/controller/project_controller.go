@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"errors"
+
 	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/pagination"
 	"api/internal/service"
 	"api/internal/validation"
-	"context"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -38,19 +41,32 @@ func (c *ProjectController) CreateProject(ctx *fiber.Ctx) error {
 		})
 	}
 
-	project, err := c.service.CreateProject(context.Background(), &req)
+	project, err := c.service.CreateProject(ctx.UserContext(), &req)
 	if err != nil {
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create project",
 		})
 	}
 
+	setETag(ctx, project.Version)
 	return ctx.Status(http.StatusCreated).JSON(project)
 }
 
 func (c *ProjectController) GetProjects(ctx *fiber.Ctx) error {
-	projects, err := c.service.GetAllProjects(context.Background())
+	params, err := pagination.FromRequest(ctx)
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	projects, err := c.service.GetAllProjects(ctx.UserContext(), params)
 	if err != nil {
+		if pagination.IsInvalidRequest(err) {
+			return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch projects",
 		})
@@ -68,13 +84,12 @@ func (c *ProjectController) GetProject(ctx *fiber.Ctx) error {
 		})
 	}
 
-	project, err := c.service.GetProject(context.Background(), id)
+	project, err := c.service.GetProject(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch project",
-		})
+		return respondError(ctx, err, "Failed to fetch project")
 	}
 
+	setETag(ctx, project.Version)
 	return ctx.JSON(project)
 }
 
@@ -93,14 +108,19 @@ func (c *ProjectController) UpdateProject(ctx *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if !ifMatchVersion(ctx, &req.Version, &req.IfMatch) {
+		return nil
+	}
 
-	project, err := c.service.UpdateProject(context.Background(), id, &req)
+	project, err := c.service.UpdateProject(ctx.UserContext(), id, &req)
+	if errors.Is(err, apperrors.ErrVersionMismatch) {
+		return respondStale(ctx, project, project.Version)
+	}
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update project",
-		})
+		return respondError(ctx, err, "Failed to update project")
 	}
 
+	setETag(ctx, project.Version)
 	return ctx.JSON(project)
 }
 
@@ -113,11 +133,9 @@ func (c *ProjectController) DeleteProject(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = c.service.DeleteProject(context.Background(), id)
+	err = c.service.DeleteProject(ctx.UserContext(), id)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete project",
-		})
+		return respondError(ctx, err, "Failed to delete project")
 	}
 
 	return ctx.Status(http.StatusNoContent).Send(nil)
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ProjectMemberController struct {
+	service   service.ProjectMemberService
+	validator *validation.Validator
+}
+
+func NewProjectMemberController(service service.ProjectMemberService, validator *validation.Validator) *ProjectMemberController {
+	return &ProjectMemberController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+func (c *ProjectMemberController) GetMembers(ctx *fiber.Ctx) error {
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+
+	members, err := c.service.ListMembers(ctx.UserContext(), projectID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch project members")
+	}
+
+	return ctx.JSON(members)
+}
+
+// SetMember adds a user to a project or changes their role there
+func (c *ProjectMemberController) SetMember(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+	userID, ok := c.idParam(ctx, "userId", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+
+	var req dto.SetProjectMemberRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	member, err := c.service.SetMember(ctx.UserContext(), actorID, projectID, userID, req.Role, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to set project member")
+	}
+
+	return ctx.JSON(member)
+}
+
+func (c *ProjectMemberController) RemoveMember(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+	userID, ok := c.idParam(ctx, "userId", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.RemoveMember(ctx.UserContext(), actorID, projectID, userID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to remove project member")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (c *ProjectMemberController) GetTeams(ctx *fiber.Ctx) error {
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+
+	teams, err := c.service.ListTeams(ctx.UserContext(), projectID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch project teams")
+	}
+
+	return ctx.JSON(teams)
+}
+
+// SetTeam gives a team a role in a project or changes it
+func (c *ProjectMemberController) SetTeam(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+	teamID, ok := c.idParam(ctx, "teamId", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	var req dto.SetProjectMemberRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	team, err := c.service.SetTeam(ctx.UserContext(), actorID, projectID, teamID, req.Role, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to set project team")
+	}
+
+	return ctx.JSON(team)
+}
+
+func (c *ProjectMemberController) RemoveTeam(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	projectID, ok := c.idParam(ctx, "id", "Invalid project ID")
+	if !ok {
+		return nil
+	}
+	teamID, ok := c.idParam(ctx, "teamId", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.RemoveTeam(ctx.UserContext(), actorID, projectID, teamID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to remove project team")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// idParam parses a UUID route parameter, writing a 400 if invalid
+func (c *ProjectMemberController) idParam(ctx *fiber.Ctx, name, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Params(name))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RoleController struct {
+	service   service.RoleService
+	validator *validation.Validator
+}
+
+func NewRoleController(service service.RoleService, validator *validation.Validator) *RoleController {
+	return &RoleController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+func (c *RoleController) GetRoles(ctx *fiber.Ctx) error {
+	roles, err := c.service.ListRoles(ctx.UserContext())
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch roles")
+	}
+
+	return ctx.JSON(roles)
+}
+
+func (c *RoleController) GetRole(ctx *fiber.Ctx) error {
+	role, err := c.service.GetRole(ctx.UserContext(), ctx.Params("name"))
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch role")
+	}
+
+	return ctx.JSON(role)
+}
+
+func (c *RoleController) CreateRole(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.CreateRoleRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	role, err := c.service.CreateRole(ctx.UserContext(), actorID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to create role")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(role)
+}
+
+func (c *RoleController) UpdateRole(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.UpdateRoleRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	role, err := c.service.UpdateRole(ctx.UserContext(), actorID, ctx.Params("name"), &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update role")
+	}
+
+	return ctx.JSON(role)
+}
+
+func (c *RoleController) DeleteRole(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	if err := c.service.DeleteRole(ctx.UserContext(), actorID, ctx.Params("name"), clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to delete role")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
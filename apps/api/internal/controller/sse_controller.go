@@ -7,26 +7,40 @@ import (
 	"sync"
 	"time"
 
+	"api/internal/errors"
 	"api/internal/sse"
+	"api/internal/tenant"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 type SSEController struct {
-	clients map[uuid.UUID]chan interface{}
+	clients map[uuid.UUID]*sseClient
 	mutex   sync.RWMutex
 }
 
+// sseClient is a connected client and the organisation whose events it
+// receives
+type sseClient struct {
+	organizationID uuid.UUID
+	events         chan interface{}
+}
+
 // Ensure SSEController implements sse.Service interface
 var _ sse.Service = (*SSEController)(nil)
 
 func NewSSEController() *SSEController {
 	return &SSEController{
-		clients: make(map[uuid.UUID]chan interface{}),
+		clients: make(map[uuid.UUID]*sseClient),
 	}
 }
 
+// RegisterClient streams the events of the caller's organisation
 func (c *SSEController) RegisterClient(ctx *fiber.Ctx) error {
+	org, ok := tenant.FromContext(ctx.UserContext())
+	if !ok {
+		return ctx.Status(http.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
 	clientID := uuid.New()
 
 	// Create a new channel for this client
@@ -34,7 +48,7 @@ func (c *SSEController) RegisterClient(ctx *fiber.Ctx) error {
 
 	// Register the client
 	c.mutex.Lock()
-	c.clients[clientID] = ch
+	c.clients[clientID] = &sseClient{organizationID: org.ID, events: ch}
 	c.mutex.Unlock()
 
 	// Set headers for SSE
@@ -69,13 +83,16 @@ func (c *SSEController) RegisterClient(ctx *fiber.Ctx) error {
 	return ctx.SendStatus(http.StatusOK)
 }
 
-func (c *SSEController) BroadcastEvent(eventType sse.EventType, data interface{}) {
+func (c *SSEController) BroadcastEvent(organizationID uuid.UUID, eventType sse.EventType, data interface{}) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	for _, ch := range c.clients {
+	for _, client := range c.clients {
+		if client.organizationID != organizationID {
+			continue
+		}
 		select {
-		case ch <- map[string]interface{}{
+		case client.events <- map[string]interface{}{
 			"type": eventType,
 			"data": data,
 		}:
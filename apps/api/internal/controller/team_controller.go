@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/pagination"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type TeamController struct {
+	service   service.TeamService
+	validator *validation.Validator
+}
+
+func NewTeamController(service service.TeamService, validator *validation.Validator) *TeamController {
+	return &TeamController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// GetTeams lists the organisation's teams, searching with ?q= and filtered
+// to one user's teams with ?member=
+func (c *TeamController) GetTeams(ctx *fiber.Ctx) error {
+	params, err := pagination.FromRequest(ctx, "member")
+	if err != nil {
+		return respondError(ctx, err, "")
+	}
+
+	teams, err := c.service.ListTeams(ctx.UserContext(), params)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch teams")
+	}
+
+	return ctx.JSON(teams)
+}
+
+func (c *TeamController) GetTeam(ctx *fiber.Ctx) error {
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	team, err := c.service.GetTeam(ctx.UserContext(), teamID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch team")
+	}
+
+	return ctx.JSON(team)
+}
+
+func (c *TeamController) CreateTeam(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.CreateTeamRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	team, err := c.service.CreateTeam(ctx.UserContext(), actorID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to create team")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(team)
+}
+
+func (c *TeamController) UpdateTeam(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	var req dto.UpdateTeamRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	team, err := c.service.UpdateTeam(ctx.UserContext(), actorID, teamID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update team")
+	}
+
+	return ctx.JSON(team)
+}
+
+func (c *TeamController) DeleteTeam(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.DeleteTeam(ctx.UserContext(), actorID, teamID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to delete team")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (c *TeamController) GetMembers(ctx *fiber.Ctx) error {
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+
+	members, err := c.service.ListMembers(ctx.UserContext(), teamID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch team members")
+	}
+
+	return ctx.JSON(members)
+}
+
+// SetMember adds a user to a team or changes their role in it
+func (c *TeamController) SetMember(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+	userID, ok := c.idParam(ctx, "userId", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+
+	var req dto.SetTeamMemberRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	member, err := c.service.SetMember(ctx.UserContext(), actorID, teamID, userID, req.Role, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to set team member")
+	}
+
+	return ctx.JSON(member)
+}
+
+func (c *TeamController) RemoveMember(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	teamID, ok := c.idParam(ctx, "id", "Invalid team ID")
+	if !ok {
+		return nil
+	}
+	userID, ok := c.idParam(ctx, "userId", "Invalid user ID")
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.RemoveMember(ctx.UserContext(), actorID, teamID, userID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to remove team member")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// idParam parses a UUID route parameter, writing a 400 if invalid
+func (c *TeamController) idParam(ctx *fiber.Ctx, name, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Params(name))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"api/internal/dto"
+	"api/internal/errors"
+	"api/internal/pagination"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type UserController struct {
+	service   service.UserService
+	validator *validation.Validator
+}
+
+func NewUserController(service service.UserService, validator *validation.Validator) *UserController {
+	return &UserController{
+		service:   service,
+		validator: validator,
+	}
+}
+
+// GetUsers lists users, searching with ?q= and filtered by ?role=, ?active=
+// and ?type=
+func (c *UserController) GetUsers(ctx *fiber.Ctx) error {
+	params, err := pagination.FromRequest(ctx, "role", "active", "type")
+	if err != nil {
+		return respondError(ctx, err, "")
+	}
+
+	users, err := c.service.ListUsers(ctx.UserContext(), params)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch users")
+	}
+
+	page := pagination.Page[dto.UserResponse]{
+		Items:      make([]dto.UserResponse, len(users.Items)),
+		NextCursor: users.NextCursor,
+		Total:      users.Total,
+	}
+	for i := range users.Items {
+		page.Items[i] = users.Items[i].ToResponse()
+	}
+
+	return ctx.JSON(page)
+}
+
+func (c *UserController) GetUser(ctx *fiber.Ctx) error {
+	userID, ok := c.userIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	user, err := c.service.GetUser(ctx.UserContext(), userID)
+	if err != nil {
+		return respondError(ctx, err, "Failed to fetch user")
+	}
+
+	return ctx.JSON(user.ToResponse())
+}
+
+// InviteUser creates an account with a role and emails the user a link to
+// set their password. The response doesn't reveal whether the address had an
+// account in another organisation.
+func (c *UserController) InviteUser(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.InviteUserRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	if _, err := c.service.InviteUser(ctx.UserContext(), actorID, &req, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to invite user")
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(dto.InvitationResponse{
+		Email:     req.Email,
+		Role:      req.Role,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	})
+}
+
+// CreateServiceAccount creates an account for automation, which
+// authenticates only with access tokens
+func (c *UserController) CreateServiceAccount(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+
+	var req dto.CreateServiceAccountRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	user, err := c.service.CreateServiceAccount(ctx.UserContext(), actorID, &req, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to create service account")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(user.ToResponse())
+}
+
+func (c *UserController) UpdateRole(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	userID, ok := c.userIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	var req dto.UpdateUserRoleRequest
+	if !parseBody(ctx, c.validator, &req) {
+		return nil
+	}
+
+	user, err := c.service.UpdateRole(ctx.UserContext(), actorID, userID, req.Role, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update role")
+	}
+
+	return ctx.JSON(user.ToResponse())
+}
+
+func (c *UserController) ActivateUser(ctx *fiber.Ctx) error {
+	return c.setActive(ctx, true)
+}
+
+func (c *UserController) DeactivateUser(ctx *fiber.Ctx) error {
+	return c.setActive(ctx, false)
+}
+
+func (c *UserController) DeleteUser(ctx *fiber.Ctx) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	userID, ok := c.userIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	if err := c.service.DeleteUser(ctx.UserContext(), actorID, userID, clientInfo(ctx)); err != nil {
+		return respondError(ctx, err, "Failed to delete user")
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (c *UserController) setActive(ctx *fiber.Ctx, active bool) error {
+	actorID, ok := currentUserID(ctx)
+	if !ok {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+	}
+	userID, ok := c.userIDParam(ctx)
+	if !ok {
+		return nil
+	}
+
+	user, err := c.service.SetActive(ctx.UserContext(), actorID, userID, active, clientInfo(ctx))
+	if err != nil {
+		return respondError(ctx, err, "Failed to update user")
+	}
+
+	return ctx.JSON(user.ToResponse())
+}
+
+// userIDParam parses the :id route parameter, writing a 400 if invalid
+func (c *UserController) userIDParam(ctx *fiber.Ctx) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api/internal/dto"
+	"api/internal/model"
+	"api/internal/service"
+	"api/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// invitingUserService creates accounts for every address but taken ones,
+// which belong to another organisation
+type invitingUserService struct {
+	service.UserService
+	taken string
+}
+
+func (s invitingUserService) InviteUser(ctx context.Context, actorID uuid.UUID, req *dto.InviteUserRequest, client dto.ClientInfo) (*model.User, error) {
+	if req.Email == s.taken {
+		return nil, nil
+	}
+	return &model.User{ID: uuid.New(), Email: req.Email, Role: req.Role}, nil
+}
+
+// An address in another organisation gets the same answer as a new one
+func TestInviteUserResponse(t *testing.T) {
+	c := NewUserController(invitingUserService{taken: "eve@example.com"}, validation.NewValidator())
+	app := fiber.New()
+	app.Post("/users/invite", func(ctx *fiber.Ctx) error {
+		ctx.Locals("user_id", uuid.New().String())
+		return ctx.Next()
+	}, c.InviteUser)
+
+	invite := func(email string) (int, string) {
+		body := `{"email":"` + email + `","role":"viewer","first_name":"Eve"}`
+		req := httptest.NewRequest(fiber.MethodPost, "/users/invite", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		response, _ := io.ReadAll(resp.Body)
+		// Only the address differs between the two requests
+		return resp.StatusCode, strings.ReplaceAll(string(response), email, "<email>")
+	}
+
+	newStatus, newBody := invite("grace@example.com")
+	takenStatus, takenBody := invite("eve@example.com")
+	if newStatus != fiber.StatusAccepted {
+		t.Errorf("status = %d, want %d", newStatus, fiber.StatusAccepted)
+	}
+	if takenStatus != newStatus || takenBody != newBody {
+		t.Errorf("taken address got %d %s, new address %d %s", takenStatus, takenBody, newStatus, newBody)
+	}
+}
@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name" validate:"required,min=3,max=50"`
+	Description string `json:"description" validate:"max=50"`
+	Role        string `json:"role" validate:"required"`
+}
+
+type AccessTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAccessTokenResponse carries the token itself, which is only ever
+// shown once
+type CreatedAccessTokenResponse struct {
+	AccessTokenResponse
+	Token string `json:"token"`
+}
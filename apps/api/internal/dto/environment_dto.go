@@ -4,11 +4,41 @@ import (
 	"github.com/google/uuid"
 )
 
+// CreateEnvironmentRequest creates an environment. The key is derived from
+// the name when omitted, and the environment is placed last when no sort
+// order is given.
 type CreateEnvironmentRequest struct {
-	ProjectID uuid.UUID `json:"project_id" validate:"required"`
-	Name      string    `json:"name" validate:"required,min=1,max=100"`
+	ProjectID       uuid.UUID `json:"project_id" validate:"required"`
+	Key             string    `json:"key" validate:"omitempty,max=50"`
+	Name            string    `json:"name" validate:"required,min=1,max=100"`
+	SortOrder       *int      `json:"sort_order" validate:"omitempty,min=0"`
+	Color           string    `json:"color" validate:"omitempty,hexrgb"`
+	Production      bool      `json:"production"`
+	NewFlagsEnabled bool      `json:"new_flags_enabled"`
+	// CloneFrom names an environment of the same project whose flag values
+	// the new environment starts with
+	CloneFrom *uuid.UUID `json:"clone_from"`
 }
 
+// UpdateEnvironmentRequest changes an environment's settings; its key can't
+// be changed
 type UpdateEnvironmentRequest struct {
-	Name *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Name            *string  `json:"name" validate:"omitempty,min=1,max=100"`
+	SortOrder       *int     `json:"sort_order" validate:"omitempty,min=0"`
+	Color           *string  `json:"color" validate:"omitempty,hexrgb"`
+	Production      *bool    `json:"production"`
+	NewFlagsEnabled *bool    `json:"new_flags_enabled"`
+	Version         *int     `json:"version"` // Overridden by If-Match
+	IfMatch         *IfMatch `json:"-"`
+}
+
+// PromoteEnvironmentRequest copies flag values from the environment in the
+// route to another environment of its project. FlagIDs limits the copy to
+// some flags; DryRun only reports the changes, and Overwrite applies them
+// despite conflicts.
+type PromoteEnvironmentRequest struct {
+	TargetEnvID uuid.UUID   `json:"target_env_id" validate:"required"`
+	FlagIDs     []uuid.UUID `json:"flag_ids" validate:"omitempty,max=1000"`
+	DryRun      bool        `json:"dry_run"`
+	Overwrite   bool        `json:"overwrite"`
 }
@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"time"
+)
+
+// EvaluationSummaryRequest is submitted periodically by SDKs that evaluate flags locally
+type EvaluationSummaryRequest struct {
+	Counters []EvaluationCounter `json:"counters" validate:"required,min=1,max=1000,dive"`
+}
+
+type EvaluationCounter struct {
+	FlagKey         string     `json:"flag_key" validate:"required,min=1,max=100"`
+	Value           string     `json:"value"`
+	Count           int64      `json:"count" validate:"required,min=1"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at"`
+}
@@ -9,12 +9,32 @@ type CreateFlagRequest struct {
 	Key         string    `json:"key" validate:"required,min=1,max=100"`
 	Description string    `json:"description" validate:"max=500"`
 	Type        string    `json:"type" validate:"required,oneof=boolean string number json"`
+	// DefaultValue is the off variation every environment starts with; the
+	// type's zero value when omitted
+	DefaultValue *string           `json:"default_value" validate:"omitempty,max=10000"`
+	Tags         []string          `json:"tags" validate:"omitempty,max=20,dive,min=1,max=50"`
+	Owner        *FlagOwnerRequest `json:"owner" validate:"omitempty"`
+	Kind         string            `json:"kind" validate:"omitempty,oneof=temporary permanent"`
+	RemovalDate  *string           `json:"removal_date" validate:"omitempty,datetime=2006-01-02"`
 }
 
 type UpdateFlagRequest struct {
 	Key         *string `json:"key" validate:"omitempty,min=1,max=100"`
 	Description *string `json:"description" validate:"omitempty,max=500"`
 	Type        *string `json:"type" validate:"omitempty,oneof=boolean string number json"`
+	// DefaultValue only applies to environments created later
+	DefaultValue *string           `json:"default_value" validate:"omitempty,max=10000"`
+	Tags         *[]string         `json:"tags" validate:"omitempty,max=20,dive,min=1,max=50"`
+	Owner        *FlagOwnerRequest `json:"owner" validate:"omitempty"` // Empty type clears the owner
+	Kind         *string           `json:"kind" validate:"omitempty,oneof=temporary permanent"`
+	RemovalDate  *string           `json:"removal_date" validate:"omitempty,datetime=2006-01-02"`
+	Version      *int              `json:"version"` // Overridden by If-Match
+	IfMatch      *IfMatch          `json:"-"`
+}
+
+type FlagOwnerRequest struct {
+	Type string    `json:"type" validate:"omitempty,oneof=user team"`
+	ID   uuid.UUID `json:"id"`
 }
 
 type CreateFlagValueRequest struct {
@@ -25,6 +45,8 @@ type CreateFlagValueRequest struct {
 }
 
 type UpdateFlagValueRequest struct {
-	Value   *string `json:"value"`
-	Enabled *bool   `json:"enabled"`
+	Value   *string  `json:"value"`
+	Enabled *bool    `json:"enabled"`
+	Version *int     `json:"version"` // Overridden by If-Match
+	IfMatch *IfMatch `json:"-"`
 }
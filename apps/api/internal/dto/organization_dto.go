@@ -0,0 +1,15 @@
+package dto
+
+// CreateOrganizationRequest creates a tenant and invites its first admin
+type CreateOrganizationRequest struct {
+	Name           string `json:"name" validate:"required,min=2,max=100"`
+	Slug           string `json:"slug" validate:"required"`
+	AdminEmail     string `json:"admin_email" validate:"required,email"`
+	AdminFirstName string `json:"admin_first_name" validate:"omitempty,max=50,alpha_space"`
+	AdminLastName  string `json:"admin_last_name" validate:"omitempty,max=50,alpha_space"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name *string `json:"name" validate:"omitempty,min=2,max=100"`
+	Slug *string `json:"slug"`
+}
@@ -6,6 +6,12 @@ type CreateProjectRequest struct {
 }
 
 type UpdateProjectRequest struct {
-	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
-	Description *string `json:"description" validate:"omitempty,max=500"`
+	Name        *string  `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string  `json:"description" validate:"omitempty,max=500"`
+	Version     *int     `json:"version"` // Overridden by If-Match
+	IfMatch     *IfMatch `json:"-"`
+}
+
+type SetProjectMemberRequest struct {
+	Role string `json:"role" validate:"required"`
 }
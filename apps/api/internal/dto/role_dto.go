@@ -0,0 +1,22 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+)
+
+type RolePermissionRequest struct {
+	Permission     string      `json:"permission" validate:"required"`
+	NonProduction  bool        `json:"non_production"`
+	EnvironmentIDs []uuid.UUID `json:"environment_ids"`
+}
+
+type CreateRoleRequest struct {
+	Name        string                  `json:"name" validate:"required"`
+	Description string                  `json:"description" validate:"max=500"`
+	Permissions []RolePermissionRequest `json:"permissions" validate:"dive"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string                  `json:"description" validate:"omitempty,max=500"`
+	Permissions *[]RolePermissionRequest `json:"permissions" validate:"omitempty,dive"`
+}
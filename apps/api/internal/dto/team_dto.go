@@ -0,0 +1,15 @@
+package dto
+
+type CreateTeamRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=100"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+type UpdateTeamRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=2,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+}
+
+type SetTeamMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=member maintainer"`
+}
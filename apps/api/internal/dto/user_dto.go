@@ -20,22 +20,138 @@ type RegisterRequest struct {
 	LastName  string `json:"last_name" validate:"required,min=1,max=50,alpha_space"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// ClientInfo describes the client a session was started from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+	// PrincipalType and TokenID describe how the caller authenticated, for
+	// the audit trail
+	PrincipalType string
+	TokenID       *uuid.UUID
+}
+
 // User response DTOs
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Role      string    `json:"role"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             uuid.UUID `json:"id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	Active         bool      `json:"active"`
+	EmailVerified  bool      `json:"email_verified"`
+	AuthProvider   string    `json:"auth_provider"`
+	MFAEnabled     bool      `json:"mfa_enabled"`
+	AccountType    string    `json:"account_type"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// LoginResponse carries either the session tokens or, when a second factor
+// is needed, an MFA challenge token to complete the login with
 type LoginResponse struct {
-	User  UserResponse `json:"user"`
-	Token string       `json:"token"`
+	User         UserResponse `json:"user"`
+	Token        string       `json:"token,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	ExpiresIn    int          `json:"expires_in,omitempty"` // Access token lifetime in seconds
+
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string `json:"mfa_token,omitempty"`
+}
+
+// MFA request DTOs
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+type MFASetupRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type MFAConfirmRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type MFASetupConfirmRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type MFADisableRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MFA response DTOs
+type MFAEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFAConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	// Login is set when enrolment completed a login challenge
+	Login *LoginResponse `json:"login,omitempty"`
+}
+
+// Account recovery request DTOs
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+// User administration request DTOs
+type InviteUserRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Role      string `json:"role" validate:"required"`
+	FirstName string `json:"first_name" validate:"omitempty,max=50,alpha_space"`
+	LastName  string `json:"last_name" validate:"omitempty,max=50,alpha_space"`
+}
+
+// InvitationResponse acknowledges an invitation. It is the same whether or
+// not the address already had an account in another organisation.
+type InvitationResponse struct {
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type UnlockUserResponse struct {
+	Unlocked bool `json:"unlocked"`
 }
 
 type AuthError struct {
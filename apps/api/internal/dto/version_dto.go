@@ -0,0 +1,10 @@
+package dto
+
+// IfMatch holds an If-Match header that names no single version: with Any
+// (If-Match: *) an update applies whatever the current version, otherwise
+// when the current version is any of Versions. It takes the place of the
+// request's Version.
+type IfMatch struct {
+	Any      bool
+	Versions []int
+}
@@ -27,6 +27,78 @@ var (
 		Code:    http.StatusBadRequest,
 		Message: "Invalid JSON format",
 	}
+	ErrInvalidResetToken = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid or expired password reset link",
+	}
+	ErrInvalidVerificationToken = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid or expired verification link",
+	}
+	ErrIncorrectPassword = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Current password is incorrect",
+	}
+	ErrInvalidInvitation = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid or expired invitation",
+	}
+	ErrInvalidRole = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid role",
+	}
+	ErrEnvironmentProjectMismatch = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Environment belongs to a different project",
+	}
+	ErrInvalidEnvironmentKey = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Environment keys must be up to 50 lowercase letters, digits, hyphens or underscores and can't be a UUID",
+	}
+	ErrEnvironmentKeyNeedsProject = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "project_id is required to address an environment by key",
+	}
+	ErrPromoteSameEnvironment = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Source and target environments must differ",
+	}
+	ErrInvalidIfMatch = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "If-Match must be the ETag of the resource being updated",
+	}
+	ErrInvalidIdempotencyKey = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Idempotency-Key must be at most 255 characters",
+	}
+	ErrInvalidPermission = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Unknown permission",
+	}
+	ErrInvalidRoleName = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Role names must be 2-20 lowercase letters, digits, hyphens or underscores",
+	}
+	ErrInvalidOrganizationSlug = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Organization slugs must be 2-50 lowercase letters, digits or hyphens",
+	}
+	ErrInvalidFlagOwner = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Flag owner must be a user or team of this organization",
+	}
+	ErrInvalidScope = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Token scopes must be known permissions",
+	}
+	ErrNotServiceAccount = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Tokens can only be issued to yourself or to service accounts",
+	}
+	ErrInvalidExpiry = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Expiry must be in the future",
+	}
 	ErrMissingRequiredField = &AppError{
 		Code:    http.StatusBadRequest,
 		Message: "Missing required field",
@@ -53,6 +125,42 @@ var (
 		Code:    http.StatusUnauthorized,
 		Message: "User account is inactive",
 	}
+	ErrSessionRevoked = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Session has been revoked or has expired",
+	}
+	ErrInvalidRefreshToken = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Invalid or expired refresh token",
+	}
+	ErrPasswordLoginDisabled = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Password login is disabled; sign in with single sign-on",
+	}
+	ErrOIDCStateInvalid = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid or expired single sign-on state",
+	}
+	ErrOIDCLoginFailed = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Single sign-on failed",
+	}
+	ErrInvalidMFAToken = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Invalid or expired MFA token",
+	}
+	ErrInvalidMFACode = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Invalid authentication code",
+	}
+	ErrInvalidAccessToken = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Invalid, expired or revoked access token",
+	}
+	ErrRefreshTokenReused = &AppError{
+		Code:    http.StatusUnauthorized,
+		Message: "Refresh token has already been used; session revoked",
+	}
 
 	// Authorization errors
 	ErrInsufficientPermissions = &AppError{
@@ -63,10 +171,30 @@ var (
 		Code:    http.StatusForbidden,
 		Message: "Access denied",
 	}
+	ErrEnvironmentRestricted = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Your role can't make this change in this environment",
+	}
+	ErrSessionRequired = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Access tokens cannot be used for this action",
+	}
+	ErrHostOrganizationRequired = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Only the host organization can do this",
+	}
 	ErrInsufficientRole = &AppError{
 		Code:    http.StatusForbidden,
 		Message: "Insufficient role",
 	}
+	ErrRegistrationDisabled = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Registration is disabled; ask an administrator for an invitation",
+	}
+	ErrMFARequired = &AppError{
+		Code:    http.StatusForbidden,
+		Message: "Two-factor authentication is required for your role",
+	}
 
 	// Not found errors
 	ErrUserNotFound = &AppError{
@@ -89,6 +217,34 @@ var (
 		Code:    http.StatusNotFound,
 		Message: "Flag value not found",
 	}
+	ErrAccessTokenNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "Access token not found",
+	}
+	ErrRoleNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "Role not found",
+	}
+	ErrOrganizationNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "Organization not found",
+	}
+	ErrProjectMemberNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "User is not a member of this project",
+	}
+	ErrTeamNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "Team not found",
+	}
+	ErrTeamMemberNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "User is not a member of this team",
+	}
+	ErrProjectTeamNotFound = &AppError{
+		Code:    http.StatusNotFound,
+		Message: "Team has no role in this project",
+	}
 
 	// Conflict errors
 	ErrUsernameExists = &AppError{
@@ -117,6 +273,107 @@ var (
 		Code:    http.StatusConflict,
 		Message: "Cannot delete flag with existing values",
 	}
+	ErrFlagArchived = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Flag is archived",
+	}
+	ErrInvalidFlagValue = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Value doesn't match the flag's type",
+	}
+	ErrFlagTypeMismatchesValues = &AppError{
+		Code:    http.StatusBadRequest,
+		Message: "Flag has values that don't match the new type; change them first",
+	}
+	ErrFlagNotArchived = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Flag must be archived before it can be deleted",
+	}
+	ErrIdempotencyKeyInProgress = &AppError{
+		Code:    http.StatusConflict,
+		Message: "A request with this Idempotency-Key is still being handled; retry later",
+	}
+	ErrPromotionConflict = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Some flags conflict with the target environment; review them and retry with overwrite",
+	}
+
+	ErrCannotModifySelf = &AppError{
+		Code:    http.StatusConflict,
+		Message: "You cannot change the role or status of your own account",
+	}
+	ErrLastAdmin = &AppError{
+		Code:    http.StatusConflict,
+		Message: "At least one active admin is required",
+	}
+	ErrOrganizationSlugExists = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Organization slug already exists",
+	}
+	ErrHostOrganizationDelete = &AppError{
+		Code:    http.StatusConflict,
+		Message: "The host organization can't be deleted",
+	}
+	ErrEnvironmentKeyExists = &AppError{
+		Code:    http.StatusConflict,
+		Message: "An environment with this key already exists in the project",
+	}
+	ErrTeamNameExists = &AppError{
+		Code:    http.StatusConflict,
+		Message: "A team with this name already exists",
+	}
+	ErrRoleExists = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Role already exists",
+	}
+	ErrBuiltInRole = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Built-in roles cannot be changed or deleted",
+	}
+	ErrRoleInUse = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Role is assigned to users, project members or project teams",
+	}
+	ErrEmailAlreadyVerified = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Email address is already verified",
+	}
+	ErrMFAAlreadyEnabled = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Two-factor authentication is already enabled",
+	}
+	ErrMFANotEnabled = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Two-factor authentication is not enabled",
+	}
+	ErrMFAEnrollmentNotStarted = &AppError{
+		Code:    http.StatusConflict,
+		Message: "Two-factor enrolment has not been started",
+	}
+
+	// Precondition errors
+	ErrProductionConfirmationRequired = &AppError{
+		Code:    http.StatusPreconditionRequired,
+		Message: "Changes to a production environment must be confirmed with the X-Confirm-Environment header set to its key",
+	}
+	ErrIdempotencyKeyReused = &AppError{
+		Code:    http.StatusUnprocessableEntity,
+		Message: "Idempotency-Key was already used for a different request",
+	}
+	ErrVersionRequired = &AppError{
+		Code:    http.StatusPreconditionRequired,
+		Message: "Updates must name the version they change, in an If-Match header or a version field",
+	}
+	ErrVersionMismatch = &AppError{
+		Code:    http.StatusPreconditionFailed,
+		Message: "The resource changed since it was read; review its current state and retry",
+	}
+
+	// Rate limiting errors
+	ErrTooManyLoginAttempts = &AppError{
+		Code:    http.StatusTooManyRequests,
+		Message: "Too many failed login attempts; try again later",
+	}
 
 	// Server errors
 	ErrInternalServer = &AppError{
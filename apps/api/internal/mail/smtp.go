@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"api/internal/config/env"
+)
+
+// SMTPMailer delivers mail through an SMTP server, using STARTTLS when the
+// server offers it and PLAIN auth when a username is configured
+type SMTPMailer struct {
+	from string
+	cfg  env.SMTPConfig
+}
+
+func NewSMTPMailer(from string, cfg env.SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{from: from, cfg: cfg}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	return smtp.SendMail(addr, auth, sender.Address, []string{msg.To}, msg.format(m.from, time.Now()))
+}
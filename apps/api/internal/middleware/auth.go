@@ -2,12 +2,15 @@ package middleware
 
 import (
 	"api/internal/errors"
+	"api/internal/tenant"
+	"context"
 	stderrors "errors"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // JWTClaims represents the claims in the JWT token
@@ -15,11 +18,67 @@ type JWTClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// SessionID ties the access token to a server-side session so it can be
+	// revoked before it expires
+	SessionID string `json:"sid"`
+	// OrganizationID is the tenant every request with the token acts in;
+	// HostOrganization marks members of the organisation running the
+	// installation
+	OrganizationID   string `json:"org"`
+	HostOrganization bool   `json:"host_org,omitempty"`
+	// TokenType is always TokenTypeAccess
+	TokenType string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware creates a JWT authentication middleware
-func AuthMiddleware(secret string) fiber.Handler {
+// Token types, stored in the typ claim. Each validator accepts only its own
+// type, so a token can't stand in for another even where audiences aren't
+// checked.
+const (
+	TokenTypeAccess = "access"
+	TokenTypeMFA    = "mfa"
+)
+
+// Principal types, stored in c.Locals("principal_type")
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+)
+
+// AccessTokenPrefix starts every personal access token and service account
+// token, telling them apart from JWTs
+const AccessTokenPrefix = "fit_"
+
+// TokenPrincipal is the user or service account an access token belongs to
+type TokenPrincipal struct {
+	UserID           string
+	Username         string
+	Role             string
+	Type             string
+	TokenID          string
+	OrganizationID   string
+	HostOrganization bool
+	// Scopes are the permissions the token may use, on top of its owner's
+	// role
+	Scopes []string
+}
+
+// TokenValidator resolves an access token to its principal; it returns an
+// *errors.AppError when the token is unknown, expired or revoked, or its
+// owner is inactive
+type TokenValidator interface {
+	ValidateAccessToken(ctx context.Context, token string) (*TokenPrincipal, error)
+}
+
+// SessionValidator checks that a token's user is still active and that its
+// session hasn't been revoked; it returns an *errors.AppError when not
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID, sessionID uuid.UUID) error
+}
+
+// AuthMiddleware creates an authentication middleware accepting JWTs from a
+// signed-in session and access tokens
+func AuthMiddleware(keys *KeyRing, sessions SessionValidator, tokens TokenValidator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
@@ -35,82 +94,225 @@ func AuthMiddleware(secret string) fiber.Handler {
 			})
 		}
 
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, stderrors.New("unexpected signing method")
+		if strings.HasPrefix(tokenString, AccessTokenPrefix) {
+			principal, err := tokens.ValidateAccessToken(c.Context(), tokenString)
+			if err != nil {
+				return respondAuthError(c, err)
+			}
+			if err := setPrincipal(c, principal); err != nil {
+				return respondAuthError(c, err)
 			}
-			return []byte(secret), nil
-		})
+			return c.Next()
+		}
 
+		// Parse and validate token
+		claims, err := ValidateJWT(tokenString, keys)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(errors.ErrInvalidToken)
 		}
 
-		// Extract claims
-		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-			// Store user info in context
-			c.Locals("user_id", claims.UserID)
-			c.Locals("username", claims.Username)
-			c.Locals("role", claims.Role)
-			return c.Next()
+		// Check the user and session are still active
+		if err := validateSession(c, claims, sessions); err != nil {
+			return respondAuthError(c, err)
+		}
+
+		// Store user info in context
+		if err := setClaims(c, claims); err != nil {
+			return respondAuthError(c, err)
+		}
+		return c.Next()
+	}
+}
+
+func respondAuthError(c *fiber.Ctx, err error) error {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		return c.Status(appErr.Code).JSON(appErr)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(errors.ErrInternalServer)
+}
+
+func validateSession(c *fiber.Ctx, claims *JWTClaims, sessions SessionValidator) error {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return errors.ErrInvalidToken
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return errors.ErrInvalidToken
+	}
+	return sessions.ValidateSession(c.Context(), userID, sessionID)
+}
+
+func setClaims(c *fiber.Ctx, claims *JWTClaims) error {
+	c.Locals("user_id", claims.UserID)
+	c.Locals("username", claims.Username)
+	c.Locals("role", claims.Role)
+	c.Locals("session_id", claims.SessionID)
+	c.Locals("principal_type", PrincipalUser)
+	return setOrganization(c, claims.OrganizationID, claims.HostOrganization)
+}
+
+func setPrincipal(c *fiber.Ctx, principal *TokenPrincipal) error {
+	c.Locals("user_id", principal.UserID)
+	c.Locals("username", principal.Username)
+	c.Locals("role", principal.Role)
+	c.Locals("principal_type", principal.Type)
+	c.Locals("token_id", principal.TokenID)
+	c.Locals("scopes", principal.Scopes)
+	return setOrganization(c, principal.OrganizationID, principal.HostOrganization)
+}
+
+// setOrganization scopes the request to the caller's organisation, both in
+// the locals and in the user context handlers pass to services. Tokens
+// issued before organisations existed carry none and must be refreshed.
+func setOrganization(c *fiber.Ctx, organizationID string, host bool) error {
+	orgID, err := uuid.Parse(organizationID)
+	if err != nil {
+		return errors.ErrInvalidToken
+	}
+
+	c.Locals("organization_id", orgID.String())
+	c.Locals("host_organization", host)
+	c.SetUserContext(tenant.WithOrganization(c.UserContext(), tenant.Organization{ID: orgID, Host: host}))
+	return nil
+}
+
+// usingAccessToken reports whether the request authenticated with an access
+// token rather than a session
+func usingAccessToken(c *fiber.Ctx) bool {
+	_, ok := c.Locals("scopes").([]string)
+	return ok
+}
+
+// tokenAllows reports whether an access token's scopes include a
+// permission. Session requests aren't limited by scopes.
+func tokenAllows(c *fiber.Ctx, permission Permission) bool {
+	scopes, ok := c.Locals("scopes").([]string)
+	if !ok {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == string(permission) {
+			return true
 		}
+	}
+	return false
+}
 
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token claims",
-		})
+// RequireSession creates middleware that refuses access tokens, for account
+// actions only a signed-in person should take
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if usingAccessToken(c) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrSessionRequired)
+		}
+		return c.Next()
 	}
 }
 
-// GenerateJWT creates a new JWT token
-func GenerateJWT(userID, username, role, secret string) (string, error) {
+// GenerateJWT creates a new access token for a session in an organisation,
+// signed with the key ring's active key
+func GenerateJWT(userID, username, role, sessionID, organizationID string, hostOrganization bool, keys *KeyRing) (string, error) {
+	now := time.Now()
+
 	// Create claims
 	claims := &JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:           userID,
+		Username:         username,
+		Role:             role,
+		SessionID:        sessionID,
+		OrganizationID:   organizationID,
+		HostOrganization: hostOrganization,
+		TokenType:        TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   userID,
+			Issuer:    keys.issuer,
+			ExpiresAt: jwt.NewNumericDate(now.Add(keys.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
+	if keys.audience != "" {
+		claims.Audience = jwt.ClaimStrings{keys.audience}
+	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return keys.sign(claims)
+}
 
-	// Sign token with secret
-	tokenString, err := token.SignedString([]byte(secret))
+// ValidateJWT validates an access token against the key ring, along with its
+// type, issuer and audience, and returns its claims
+func ValidateJWT(tokenString string, keys *KeyRing) (*JWTClaims, error) {
+	token, err := keys.parse(tokenString, &JWTClaims{}, keys.audience)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && claims.TokenType == TokenTypeAccess {
+		return claims, nil
+	}
+
+	return nil, stderrors.New("invalid token claims")
 }
 
-// ValidateJWT validates a JWT token and returns claims
-func ValidateJWT(tokenString, secret string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, stderrors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+// MFA challenge token purposes
+const (
+	MFAPurposeVerify = "mfa_verify"
+	MFAPurposeEnroll = "mfa_enroll"
+)
+
+// MFAClaims represent a challenge token, issued after a correct password
+// while a second factor is still needed. Its type and audience differ from
+// access tokens so it can't be used as one.
+type MFAClaims struct {
+	UserID  string `json:"user_id"`
+	Purpose string `json:"purpose"`
+	// TokenType is always TokenTypeMFA
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func mfaAudience(keys *KeyRing) string {
+	return keys.audience + ":mfa"
+}
+
+// GenerateMFAToken creates a short-lived MFA challenge token. Each token has
+// a unique ID, so wrong codes are counted per challenge even for challenges
+// issued in the same second.
+func GenerateMFAToken(userID, purpose string, ttl time.Duration, keys *KeyRing) (string, error) {
+	now := time.Now()
+	claims := &MFAClaims{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenType: TokenTypeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			Issuer:    keys.issuer,
+			Audience:  jwt.ClaimStrings{mfaAudience(keys)},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
 
+	return keys.sign(claims)
+}
+
+// ValidateMFAToken validates an MFA challenge token issued for a purpose
+func ValidateMFAToken(tokenString, purpose string, keys *KeyRing) (*MFAClaims, error) {
+	token, err := keys.parse(tokenString, &MFAClaims{}, mfaAudience(keys))
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*MFAClaims); ok && token.Valid && claims.TokenType == TokenTypeMFA && claims.Purpose == purpose {
 		return claims, nil
 	}
 
-	return nil, stderrors.New("invalid token claims")
+	return nil, stderrors.New("invalid MFA token")
 }
 
 // OptionalAuthMiddleware creates a middleware that optionally validates JWT token
-func OptionalAuthMiddleware(secret string) fiber.Handler {
+func OptionalAuthMiddleware(keys *KeyRing, sessions SessionValidator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
@@ -126,26 +328,12 @@ func OptionalAuthMiddleware(secret string) fiber.Handler {
 			return c.Next()
 		}
 
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, stderrors.New("unexpected signing method")
+		// Parse and validate token; an invalid token or inactive session
+		// continues without user info
+		if claims, err := ValidateJWT(tokenString, keys); err == nil {
+			if validateSession(c, claims, sessions) == nil {
+				setClaims(c, claims)
 			}
-			return []byte(secret), nil
-		})
-
-		if err != nil {
-			// Invalid token, continue without user info
-			return c.Next()
-		}
-
-		// Extract claims
-		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-			// Store user info in context
-			c.Locals("user_id", claims.UserID)
-			c.Locals("username", claims.Username)
-			c.Locals("role", claims.Role)
 		}
 
 		return c.Next()
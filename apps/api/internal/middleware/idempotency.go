@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"api/internal/errors"
+	"api/internal/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// Set on responses replayed from an earlier request with the same key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// idempotencyLease is how long a request being handled holds its key
+	// before a retry may take over, in case the server died handling it. It
+	// must outlast any request.
+	idempotencyLease = time.Minute
+)
+
+// IdempotencyStore keeps the requests sent with an Idempotency-Key and their
+// responses
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, req *model.IdempotentRequest, lease time.Duration) (*model.IdempotentRequest, error)
+	Complete(ctx context.Context, req *model.IdempotentRequest, window time.Duration) error
+	Release(ctx context.Context, req *model.IdempotentRequest) error
+}
+
+// Idempotency makes POST, PUT and DELETE requests sent with an
+// Idempotency-Key header safe to retry. The first request with a key is
+// handled and its response kept for the window; retries with the same key
+// get that response back instead of repeating the request. Reusing a key for
+// a different request fails with 422, and retrying while the first request
+// is still being handled fails with 409. Only successes and conflicts (409
+// and 412) are kept; after any other response, such as a refused permission
+// or a server error, the request can be retried with the same key.
+//
+// Keys are scoped to the caller: the user for sessions, or the access token,
+// so they survive a session being refreshed. The middleware goes after
+// authentication, and requests without a caller aren't made idempotent.
+// Responses are stored as they were
+// sent, so it must not be used on routes whose responses carry credentials.
+func Idempotency(store IdempotencyStore, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" || !idempotentMethod(c.Method()) {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(errors.ErrInvalidIdempotencyKey.Code).JSON(errors.ErrInvalidIdempotencyKey)
+		}
+
+		scope, ok := idempotencyScope(c)
+		if !ok {
+			return c.Next()
+		}
+
+		ctx := c.UserContext()
+		req := &model.IdempotentRequest{
+			Scope:       scope,
+			Key:         key,
+			Fingerprint: requestFingerprint(c),
+		}
+		existing, err := store.Reserve(ctx, req, idempotencyLease)
+		if err != nil {
+			log.Printf("Failed to reserve idempotency key: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(errors.ErrInternalServer)
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != req.Fingerprint:
+				return c.Status(errors.ErrIdempotencyKeyReused.Code).JSON(errors.ErrIdempotencyKeyReused)
+			case !existing.Handled():
+				return c.Status(errors.ErrIdempotencyKeyInProgress.Code).JSON(errors.ErrIdempotencyKeyInProgress)
+			}
+
+			c.Set(HeaderIdempotentReplayed, "true")
+			if existing.ContentType != "" {
+				c.Set(fiber.HeaderContentType, existing.ContentType)
+			}
+			if existing.ETag != "" {
+				c.Set(fiber.HeaderETag, existing.ETag)
+			}
+			if existing.Location != "" {
+				c.Set(fiber.HeaderLocation, existing.Location)
+			}
+			return c.Status(existing.StatusCode).Send(existing.ResponseBody)
+		}
+
+		// A panicking handler leaves no response to keep
+		handled := false
+		defer func() {
+			if !handled {
+				release(store, req)
+			}
+		}()
+
+		err = c.Next()
+		handled = true
+
+		status := c.Response().StatusCode()
+		if err != nil || !keptStatus(status) {
+			release(store, req)
+			return err
+		}
+
+		req.StatusCode = status
+		req.ContentType = string(c.Response().Header.ContentType())
+		req.ETag = string(c.Response().Header.Peek(fiber.HeaderETag))
+		req.Location = string(c.Response().Header.Peek(fiber.HeaderLocation))
+		req.ResponseBody = append([]byte(nil), c.Response().Body()...)
+		if err := store.Complete(ctx, req, window); err != nil {
+			// The request succeeded, so its response still goes out; a retry
+			// will find the key reserved until its lease runs out
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+		return nil
+	}
+}
+
+// IdempotencyPruner deletes the requests whose window has passed
+type IdempotencyPruner interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// PruneIdempotencyKeys deletes expired keys every interval until the context
+// is done, so handling requests never waits on it
+func PruneIdempotencyKeys(ctx context.Context, pruner IdempotencyPruner, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := pruner.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to prune idempotency keys: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func idempotentMethod(method string) bool {
+	return method == fiber.MethodPost || method == fiber.MethodPut || method == fiber.MethodDelete
+}
+
+// keptStatus reports whether a response is replayed to retries. Conflicts
+// are, since a retry would meet the same state; other failures may be down
+// to the caller's permissions or the server and are worth retrying.
+func keptStatus(status int) bool {
+	return (status >= 200 && status < 300) || status == fiber.StatusConflict || status == fiber.StatusPreconditionFailed
+}
+
+func release(store IdempotencyStore, req *model.IdempotentRequest) {
+	if err := store.Release(context.Background(), req); err != nil {
+		log.Printf("Failed to release idempotency key: %v", err)
+	}
+}
+
+// idempotencyScope identifies the caller by a hash of its access token's ID,
+// or of its user ID when it holds a session. Sessions rotate their tokens on
+// refresh, so the credentials themselves can't identify the caller.
+func idempotencyScope(c *fiber.Ctx) (string, bool) {
+	principal := ""
+	if tokenID, ok := c.Locals("token_id").(string); ok && tokenID != "" {
+		principal = "token:" + tokenID
+	} else if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		principal = "user:" + userID
+	} else {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(principal))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// requestFingerprint hashes what a retry must repeat exactly
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,463 @@
+package middleware
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api/internal/errors"
+	"api/internal/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// memIdempotencyStore keeps requests in memory, ignoring expiry
+type memIdempotencyStore struct {
+	mutex    sync.Mutex
+	requests map[string]model.IdempotentRequest
+	failing  bool
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{requests: make(map[string]model.IdempotentRequest)}
+}
+
+func (s *memIdempotencyStore) Reserve(ctx context.Context, req *model.IdempotentRequest, lease time.Duration) (*model.IdempotentRequest, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failing {
+		return nil, stderrors.New("store unavailable")
+	}
+	if existing, ok := s.requests[req.Scope+"/"+req.Key]; ok {
+		return &existing, nil
+	}
+	s.requests[req.Scope+"/"+req.Key] = *req
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) Complete(ctx context.Context, req *model.IdempotentRequest, window time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests[req.Scope+"/"+req.Key] = *req
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(ctx context.Context, req *model.IdempotentRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.requests, req.Scope+"/"+req.Key)
+	return nil
+}
+
+// idempotentCall is a request sent to the test app and what it should get
+type idempotentCall struct {
+	method string
+	path   string
+	// user is the caller, "alice" unless set, and token the ID of the access
+	// token it used, if any. session is the bearer token, which changes when
+	// a session is refreshed.
+	user    string
+	token   string
+	session string
+	key     string
+	body    string
+
+	wantStatus   int
+	wantReplayed bool
+	// wantBody and wantContentType, when set, are the response body and
+	// content type expected
+	wantBody        string
+	wantContentType string
+	// wantHeaders are response headers expected with their values
+	wantHeaders map[string]string
+}
+
+func TestIdempotency(t *testing.T) {
+	key := "3f1c2b9e-key"
+
+	tests := []struct {
+		name  string
+		calls []idempotentCall
+		// wantHandled is how many times handlers ran
+		wantHandled int64
+	}{
+		{
+			name: "without a key",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", wantStatus: fiber.StatusCreated, wantBody: `{"n":2}`},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "retry replays the response",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, body: `{"name":"a"}`, wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, body: `{"name":"a"}`, wantStatus: fiber.StatusCreated, wantReplayed: true, wantBody: `{"n":1}`, wantContentType: fiber.MIMEApplicationJSON},
+				{method: fiber.MethodPost, path: "/items", key: key, body: `{"name":"a"}`, wantStatus: fiber.StatusCreated, wantReplayed: true, wantBody: `{"n":1}`},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "replays keep the ETag and Location",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/located", key: key, wantStatus: fiber.StatusCreated, wantHeaders: map[string]string{fiber.HeaderETag: `"1"`, fiber.HeaderLocation: "/items/1"}},
+				{method: fiber.MethodPost, path: "/located", key: key, wantStatus: fiber.StatusCreated, wantReplayed: true, wantHeaders: map[string]string{fiber.HeaderETag: `"1"`, fiber.HeaderLocation: "/items/1"}},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "conflicts are replayed",
+			calls: []idempotentCall{
+				{method: fiber.MethodPut, path: "/conflict", key: key, wantStatus: fiber.StatusConflict},
+				{method: fiber.MethodPut, path: "/conflict", key: key, wantStatus: fiber.StatusConflict, wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "stale versions are replayed",
+			calls: []idempotentCall{
+				{method: fiber.MethodPut, path: "/stale", key: key, wantStatus: fiber.StatusPreconditionFailed},
+				{method: fiber.MethodPut, path: "/stale", key: key, wantStatus: fiber.StatusPreconditionFailed, wantReplayed: true},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "other client errors are not kept",
+			calls: []idempotentCall{
+				{method: fiber.MethodPut, path: "/invalid", key: key, wantStatus: fiber.StatusBadRequest},
+				{method: fiber.MethodPut, path: "/invalid", key: key, wantStatus: fiber.StatusBadRequest},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "refused permissions are not kept",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/guarded", key: key, user: "mallory", wantStatus: fiber.StatusForbidden},
+				{method: fiber.MethodPost, path: "/guarded", key: key, user: "mallory", wantStatus: fiber.StatusForbidden},
+				{method: fiber.MethodPost, path: "/guarded", key: key, user: "mallory", wantStatus: fiber.StatusForbidden},
+			},
+			wantHandled: 0,
+		},
+		{
+			name: "key reused with another body",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, body: `{"name":"a"}`, wantStatus: fiber.StatusCreated},
+				{method: fiber.MethodPost, path: "/items", key: key, body: `{"name":"b"}`, wantStatus: errors.ErrIdempotencyKeyReused.Code},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "key reused on another route",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, wantStatus: fiber.StatusCreated},
+				{method: fiber.MethodDelete, path: "/items", key: key, wantStatus: errors.ErrIdempotencyKeyReused.Code},
+				{method: fiber.MethodPost, path: "/items?dry_run=true", key: key, wantStatus: errors.ErrIdempotencyKeyReused.Code},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "keys are scoped to the caller",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, user: "mallory", wantStatus: fiber.StatusCreated, wantBody: `{"n":2}`},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "keys survive a session refresh",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, session: "first", wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, session: "refreshed", wantStatus: fiber.StatusCreated, wantReplayed: true, wantBody: `{"n":1}`},
+			},
+			wantHandled: 1,
+		},
+		{
+			name: "keys are scoped to the access token",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, token: "ci", wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, token: "ci", wantStatus: fiber.StatusCreated, wantReplayed: true, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, token: "deploy", wantStatus: fiber.StatusCreated, wantBody: `{"n":2}`},
+				{method: fiber.MethodPost, path: "/items", key: key, wantStatus: fiber.StatusCreated, wantBody: `{"n":3}`},
+			},
+			wantHandled: 3,
+		},
+		{
+			name: "requests without a caller",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: key, user: "-", wantStatus: fiber.StatusCreated, wantBody: `{"n":1}`},
+				{method: fiber.MethodPost, path: "/items", key: key, user: "-", wantStatus: fiber.StatusCreated, wantBody: `{"n":2}`},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "server errors are not kept",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/unavailable", key: key, wantStatus: fiber.StatusServiceUnavailable},
+				{method: fiber.MethodPost, path: "/unavailable", key: key, wantStatus: fiber.StatusServiceUnavailable},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "handler errors are not kept",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/error", key: key, wantStatus: fiber.StatusInternalServerError},
+				{method: fiber.MethodPost, path: "/error", key: key, wantStatus: fiber.StatusInternalServerError},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "panics are not kept",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/panic", key: key, wantStatus: fiber.StatusInternalServerError},
+				{method: fiber.MethodPost, path: "/panic", key: key, wantStatus: fiber.StatusInternalServerError},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "reads are not idempotent requests",
+			calls: []idempotentCall{
+				{method: fiber.MethodGet, path: "/items", key: key, wantStatus: fiber.StatusOK},
+				{method: fiber.MethodGet, path: "/items", key: key, wantStatus: fiber.StatusOK},
+			},
+			wantHandled: 2,
+		},
+		{
+			name: "key too long",
+			calls: []idempotentCall{
+				{method: fiber.MethodPost, path: "/items", key: strings.Repeat("k", maxIdempotencyKeyLength+1), wantStatus: errors.ErrInvalidIdempotencyKey.Code},
+			},
+			wantHandled: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, handled := newIdempotentApp(newMemIdempotencyStore())
+			for i, call := range tt.calls {
+				call.send(t, app, i)
+			}
+			if n := handled.Load(); n != tt.wantHandled {
+				t.Errorf("handlers ran %d times, want %d", n, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestIdempotencyRequestInProgress(t *testing.T) {
+	app, handled := newIdempotentApp(newMemIdempotencyStore())
+	started, release := make(chan struct{}), make(chan struct{})
+	app.Post("/slow", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		close(started)
+		<-release
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	call := idempotentCall{method: fiber.MethodPost, path: "/slow", key: "key"}
+	firstStatus := make(chan int)
+	go func() {
+		resp, err := app.Test(call.request(), -1)
+		if err != nil {
+			firstStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		firstStatus <- resp.StatusCode
+	}()
+	<-started
+
+	call.wantStatus = errors.ErrIdempotencyKeyInProgress.Code
+	call.send(t, app, 1)
+
+	close(release)
+	if status := <-firstStatus; status != fiber.StatusCreated {
+		t.Fatalf("first request status = %d, want %d", status, fiber.StatusCreated)
+	}
+	call.wantStatus, call.wantReplayed = fiber.StatusCreated, true
+	call.send(t, app, 2)
+
+	if n := handled.Load(); n != 1 {
+		t.Errorf("handlers ran %d times, want 1", n)
+	}
+}
+
+func TestIdempotencyStoreUnavailable(t *testing.T) {
+	store := newMemIdempotencyStore()
+	store.failing = true
+	app, handled := newIdempotentApp(store)
+
+	call := idempotentCall{method: fiber.MethodPost, path: "/items", key: "key", wantStatus: fiber.StatusInternalServerError}
+	call.send(t, app, 0)
+	if n := handled.Load(); n != 0 {
+		t.Errorf("handlers ran %d times, want 0", n)
+	}
+}
+
+// countingPruner counts the sweeps, failing the first
+type countingPruner struct {
+	sweeps atomic.Int64
+}
+
+func (p *countingPruner) DeleteExpired(ctx context.Context) (int64, error) {
+	if p.sweeps.Add(1) == 1 {
+		return 0, stderrors.New("connection reset")
+	}
+	return 1, nil
+}
+
+func TestPruneIdempotencyKeys(t *testing.T) {
+	pruner := &countingPruner{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		PruneIdempotencyKeys(ctx, pruner, time.Millisecond)
+		close(done)
+	}()
+
+	// A failed sweep doesn't stop the next ones
+	deadline := time.Now().Add(time.Second)
+	for pruner.sweeps.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := pruner.sweeps.Load(); n < 3 {
+		t.Fatalf("pruned %d times in a second, want at least 3", n)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pruning didn't stop with its context")
+	}
+}
+
+// newIdempotentApp serves test routes behind the middleware, counting the
+// requests that reach a handler
+func newIdempotentApp(store IdempotencyStore) (*fiber.App, *atomic.Int64) {
+	handled := &atomic.Int64{}
+	app := fiber.New()
+	app.Use(recover.New())
+	// Stands in for authentication
+	app.Use(func(c *fiber.Ctx) error {
+		if user := c.Get("X-Test-User"); user != "-" {
+			c.Locals("user_id", user)
+		}
+		if token := c.Get("X-Test-Token"); token != "" {
+			c.Locals("token_id", token)
+			c.Locals("scopes", []string{})
+		}
+		return c.Next()
+	})
+	app.Use(Idempotency(store, time.Hour))
+
+	app.Get("/items", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/items", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"n": handled.Add(1)})
+	})
+	app.Delete("/items", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.Post("/located", func(c *fiber.Ctx) error {
+		n := handled.Add(1)
+		c.Set(fiber.HeaderETag, fmt.Sprintf(`"%d"`, n))
+		c.Location(fmt.Sprintf("/items/%d", n))
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"n": n})
+	})
+	// Refuses everyone but alice before reaching the handler, like the
+	// authorization middleware
+	app.Post("/guarded", func(c *fiber.Ctx) error {
+		if c.Locals("user_id") != "alice" {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientPermissions)
+		}
+		return c.Next()
+	}, func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	app.Put("/conflict", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.Status(fiber.StatusConflict).JSON(errors.ErrUsernameExists)
+	})
+	app.Put("/stale", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.Status(errors.ErrVersionMismatch.Code).JSON(errors.ErrVersionMismatch)
+	})
+	app.Put("/invalid", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRequestBody)
+	})
+	app.Post("/unavailable", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	})
+	app.Post("/error", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		return stderrors.New("handler failed")
+	})
+	app.Post("/panic", func(c *fiber.Ctx) error {
+		handled.Add(1)
+		panic("handler panicked")
+	})
+	return app, handled
+}
+
+func (call idempotentCall) request() *http.Request {
+	user := call.user
+	if user == "" {
+		user = "alice"
+	}
+	req := httptest.NewRequest(call.method, call.path, strings.NewReader(call.body))
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+call.session+call.token)
+	req.Header.Set("X-Test-User", user)
+	if call.token != "" {
+		req.Header.Set("X-Test-Token", call.token)
+	}
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if call.key != "" {
+		req.Header.Set(HeaderIdempotencyKey, call.key)
+	}
+	return req
+}
+
+func (call idempotentCall) send(t *testing.T, app *fiber.App, i int) {
+	t.Helper()
+
+	resp, err := app.Test(call.request())
+	if err != nil {
+		t.Fatalf("call %d: app.Test: %v", i, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != call.wantStatus {
+		t.Errorf("call %d: status = %d, want %d (%s)", i, resp.StatusCode, call.wantStatus, body)
+	}
+	if replayed := resp.Header.Get(HeaderIdempotentReplayed) == "true"; replayed != call.wantReplayed {
+		t.Errorf("call %d: replayed = %v, want %v", i, replayed, call.wantReplayed)
+	}
+	if call.wantBody != "" && string(body) != call.wantBody {
+		t.Errorf("call %d: body = %s, want %s", i, body, call.wantBody)
+	}
+	if call.wantContentType != "" && resp.Header.Get(fiber.HeaderContentType) != call.wantContentType {
+		t.Errorf("call %d: content type = %q, want %q", i, resp.Header.Get(fiber.HeaderContentType), call.wantContentType)
+	}
+	for header, want := range call.wantHeaders {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("call %d: %s = %q, want %q", i, header, got, want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"api/internal/config/env"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+var (
+	ErrUnknownSigningKey = stderrors.New("unknown signing key")
+	ErrNoSigningKey      = stderrors.New("no signing key configured")
+)
+
+// verificationKey is a key that tokens may be signed with, identified by kid
+type verificationKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// KeyRing signs access tokens with one active key and verifies them against
+// every configured key, so keys can be rotated without logging users out.
+// Asymmetric public keys are published as a JWKS; HMAC secrets never are.
+type KeyRing struct {
+	signingID     string
+	signingMethod jwt.SigningMethod
+	signingKey    interface{}
+
+	keys     map[string]verificationKey
+	hmacKeys []verificationKey
+	methods  []string
+
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// NewKeyRing builds a key ring from the auth configuration. With HS256 the
+// first secret signs; otherwise the first PEM key, which must be a private
+// key of the configured algorithm, signs. All keys verify, and so do the
+// secrets with HS256; with RS256/ES256 secrets only verify while
+// AcceptHMAC is set to migrate off HS256.
+func NewKeyRing(cfg env.AuthConfig) (*KeyRing, error) {
+	ring := &KeyRing{
+		keys:     make(map[string]verificationKey),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		ttl:      cfg.AccessTokenTTL,
+	}
+
+	secrets := cfg.JWTSecrets
+	if cfg.Algorithm != AlgorithmHS256 {
+		if !cfg.AcceptHMAC {
+			secrets = nil
+		} else if len(secrets) > 0 {
+			log.Printf("Warning: JWT_ACCEPT_HMAC is set, so %s tokens signed with a JWT secret are still accepted; unset it once HS256 tokens have expired", AlgorithmHS256)
+		}
+	}
+
+	for _, secret := range secrets {
+		key := verificationKey{
+			id:     hmacKeyID(secret),
+			method: jwt.SigningMethodHS256,
+			key:    []byte(secret),
+		}
+		ring.add(key)
+		ring.hmacKeys = append(ring.hmacKeys, key)
+	}
+
+	var privateKeys = make(map[string]interface{})
+	for _, keyCfg := range cfg.SigningKeys {
+		if keyCfg.ID == "" {
+			return nil, fmt.Errorf("signing key %s has no id", keyCfg.File)
+		}
+		if _, exists := ring.keys[keyCfg.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key id %q", keyCfg.ID)
+		}
+
+		data, err := os.ReadFile(keyCfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %q: %w", keyCfg.ID, err)
+		}
+
+		key, private, err := parsePEMKey(keyCfg.ID, data)
+		if err != nil {
+			return nil, err
+		}
+		ring.add(key)
+		if private != nil {
+			privateKeys[key.id] = private
+		}
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		if len(ring.hmacKeys) == 0 {
+			return nil, fmt.Errorf("%s requires at least one JWT secret", AlgorithmHS256)
+		}
+		signer := ring.hmacKeys[0]
+		ring.signingID, ring.signingMethod, ring.signingKey = signer.id, signer.method, signer.key
+	case AlgorithmRS256, AlgorithmES256:
+		if len(cfg.SigningKeys) == 0 {
+			return nil, fmt.Errorf("%s requires at least one signing key", cfg.Algorithm)
+		}
+		signer := ring.keys[cfg.SigningKeys[0].ID]
+		private, ok := privateKeys[signer.id]
+		if !ok {
+			return nil, fmt.Errorf("signing key %q must be a private key", signer.id)
+		}
+		if signer.method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("signing key %q is a %s key, not %s", signer.id, signer.method.Alg(), cfg.Algorithm)
+		}
+		ring.signingID, ring.signingMethod, ring.signingKey = signer.id, signer.method, private
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	return ring, nil
+}
+
+func (k *KeyRing) add(key verificationKey) {
+	k.keys[key.id] = key
+	for _, alg := range k.methods {
+		if alg == key.method.Alg() {
+			return
+		}
+	}
+	k.methods = append(k.methods, key.method.Alg())
+}
+
+// sign signs the claims with the active key, recording its kid in the header
+func (k *KeyRing) sign(claims jwt.Claims) (string, error) {
+	if k.signingKey == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.signingMethod, claims)
+	token.Header["kid"] = k.signingID
+	return token.SignedString(k.signingKey)
+}
+
+// parse verifies a token with the key named by its kid, along with its
+// issuer and the given audience. Tokens issued before kids were added are
+// tried against each HMAC secret in turn.
+func (k *KeyRing) parse(tokenString string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	options := []jwt.ParserOption{jwt.WithValidMethods(k.methods)}
+	if k.issuer != "" {
+		options = append(options, jwt.WithIssuer(k.issuer))
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownSigningKey
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.key, nil
+	}, options...)
+
+	if err == nil || !stderrors.Is(err, ErrUnknownSigningKey) {
+		return token, err
+	}
+
+	unverified, _, parseErr := jwt.NewParser().ParseUnverified(tokenString, claims)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if _, hasKid := unverified.Header["kid"]; hasKid {
+		return nil, err
+	}
+
+	for _, key := range k.hmacKeys {
+		key := key
+		token, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			return key.key, nil
+		}, append(options, jwt.WithValidMethods([]string{key.method.Alg()}))...)
+
+		// Only a signature mismatch is worth retrying with an older secret
+		if err == nil || !stderrors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			return token, err
+		}
+	}
+
+	return nil, err
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key, active signer first
+func (k *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	var ids []string
+	for id := range k.keys {
+		if id != k.signingID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{k.signingID}, ids...)
+
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+
+		switch pub := key.key.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encodeBase64URL(pub.N.Bytes())
+			jwk.E = encodeBase64URL(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			ecdh, err := pub.ECDH()
+			if err != nil {
+				continue
+			}
+			// Uncompressed point: 0x04 || X || Y
+			point := ecdh.Bytes()[1:]
+			size := len(point) / 2
+			jwk.KeyType = "EC"
+			jwk.Curve = pub.Curve.Params().Name
+			jwk.X = encodeBase64URL(point[:size])
+			jwk.Y = encodeBase64URL(point[size:])
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// parsePEMKey parses an RSA or EC key, private or public. For a private key
+// both the verification key and the private key are returned.
+func parsePEMKey(id string, data []byte) (verificationKey, interface{}, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return verificationKey{id: id, method: jwt.SigningMethodRS256, key: &private.PublicKey}, private, nil
+	}
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return verificationKey{id: id, method: jwt.SigningMethodRS256, key: public}, nil, nil
+	}
+	if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		if private.Curve != elliptic.P256() {
+			return verificationKey{}, nil, fmt.Errorf("signing key %q must use the P-256 curve", id)
+		}
+		return verificationKey{id: id, method: jwt.SigningMethodES256, key: &private.PublicKey}, private, nil
+	}
+	if public, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		if public.Curve != elliptic.P256() {
+			return verificationKey{}, nil, fmt.Errorf("signing key %q must use the P-256 curve", id)
+		}
+		return verificationKey{id: id, method: jwt.SigningMethodES256, key: public}, nil, nil
+	}
+
+	return verificationKey{}, nil, fmt.Errorf("signing key %q is not a PEM encoded RSA or EC key", id)
+}
+
+// hmacKeyID derives a stable kid for a secret without revealing it
+func hmacKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "hs-" + hex.EncodeToString(sum[:8])
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api/internal/config/env"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// pemKeys writes keys to PEM files, private keys as PKCS#8 and public keys
+// as PKIX, and returns their paths
+type pemKeys struct {
+	t   *testing.T
+	dir string
+}
+
+func newPEMKeys(t *testing.T) *pemKeys {
+	return &pemKeys{t: t, dir: t.TempDir()}
+}
+
+func (p *pemKeys) write(name string, key interface{}) string {
+	p.t.Helper()
+
+	var block *pem.Block
+	switch key := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			p.t.Fatalf("marshal %s: %v", name, err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			p.t.Fatalf("marshal %s: %v", name, err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+
+	path := filepath.Join(p.dir, name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		p.t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	return key
+}
+
+func ecKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("generate EC key: %v", err)
+	}
+	return key
+}
+
+func authConfig(algorithm string, secrets []string, keys ...env.SigningKeyConfig) env.AuthConfig {
+	return env.AuthConfig{
+		Algorithm:      algorithm,
+		JWTSecrets:     secrets,
+		SigningKeys:    keys,
+		Issuer:         "flagit",
+		Audience:       "flagit-api",
+		AccessTokenTTL: 15 * time.Minute,
+	}
+}
+
+func mustKeyRing(t *testing.T, cfg env.AuthConfig) *KeyRing {
+	t.Helper()
+	ring, err := NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return ring
+}
+
+func issue(t *testing.T, ring *KeyRing) string {
+	t.Helper()
+	token, err := GenerateJWT(uuid.NewString(), "ada", "admin", uuid.NewString(), uuid.NewString(), false, ring)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	return token
+}
+
+// hmacToken signs access token claims with a secret, naming kid in the
+// header unless it is empty, as tokens issued before kids were added
+func hmacToken(t *testing.T, secret, kid string) string {
+	t.Helper()
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &JWTClaims{
+		UserID:    uuid.NewString(),
+		Role:      "admin",
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "flagit",
+			Audience:  jwt.ClaimStrings{"flagit-api"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed
+}
+
+func TestKeyRingRotatesHMACSecrets(t *testing.T) {
+	oldRing := mustKeyRing(t, authConfig(AlgorithmHS256, []string{"old-secret"}))
+	rotated := mustKeyRing(t, authConfig(AlgorithmHS256, []string{"new-secret", "old-secret"}))
+	retired := mustKeyRing(t, authConfig(AlgorithmHS256, []string{"new-secret"}))
+
+	tests := []struct {
+		name  string
+		token string
+		ring  *KeyRing
+		valid bool
+	}{
+		{name: "old token after rotation", token: issue(t, oldRing), ring: rotated, valid: true},
+		{name: "new token after rotation", token: issue(t, rotated), ring: rotated, valid: true},
+		{name: "new token is signed with the new secret", token: issue(t, rotated), ring: retired, valid: true},
+		{name: "old token after retiring its secret", token: issue(t, oldRing), ring: retired, valid: false},
+		{name: "token without kid", token: hmacToken(t, "old-secret", ""), ring: rotated, valid: true},
+		{name: "token without kid after retiring its secret", token: hmacToken(t, "old-secret", ""), ring: retired, valid: false},
+		{name: "unknown kid", token: hmacToken(t, "old-secret", "hs-unknown"), ring: rotated, valid: false},
+		{name: "secret under another secret's kid", token: hmacToken(t, "forged", hmacKeyID("old-secret")), ring: rotated, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(tt.token, tt.ring)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateJWT error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestKeyRingRotatesAsymmetricKeys(t *testing.T) {
+	pems := newPEMKeys(t)
+	oldKey, newKey := rsaKey(t), ecKey(t, elliptic.P256())
+	oldPrivate := pems.write("old", oldKey)
+	oldPublic := pems.write("old-public", &oldKey.PublicKey)
+	newPrivate := pems.write("new", newKey)
+
+	before := mustKeyRing(t, authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{ID: "rsa-1", File: oldPrivate}))
+	after := mustKeyRing(t, authConfig(AlgorithmES256, nil,
+		env.SigningKeyConfig{ID: "ec-1", File: newPrivate},
+		env.SigningKeyConfig{ID: "rsa-1", File: oldPublic},
+	))
+
+	if _, err := ValidateJWT(issue(t, before), after); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+	if _, err := ValidateJWT(issue(t, after), after); err != nil {
+		t.Errorf("token signed with the new key: %v", err)
+	}
+	if _, err := ValidateJWT(issue(t, after), before); err == nil {
+		t.Error("token signed with a key the ring doesn't hold was accepted")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+	}
+	if got := jwks.Keys[0]; got.KeyID != "ec-1" || got.KeyType != "EC" || got.Algorithm != AlgorithmES256 || got.Curve != "P-256" || got.X == "" || got.Y == "" {
+		t.Errorf("signing key JWK = %+v", got)
+	}
+	if got := jwks.Keys[1]; got.KeyID != "rsa-1" || got.KeyType != "RSA" || got.Algorithm != AlgorithmRS256 || got.N == "" || got.E == "" {
+		t.Errorf("verification key JWK = %+v", got)
+	}
+}
+
+func TestKeyRingHMACWithAsymmetricAlgorithm(t *testing.T) {
+	pems := newPEMKeys(t)
+	key := rsaKey(t)
+	signingKey := env.SigningKeyConfig{ID: "rsa-1", File: pems.write("rsa", key)}
+	publicPEM, err := os.ReadFile(pems.write("rsa-public", &key.PublicKey))
+	if err != nil {
+		t.Fatalf("read public key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		acceptHMAC bool
+		token      string
+		valid      bool
+	}{
+		{name: "secret with kid", token: hmacToken(t, "secret", hmacKeyID("secret")), valid: false},
+		{name: "secret without kid", token: hmacToken(t, "secret", ""), valid: false},
+		{name: "secret with kid while migrating", acceptHMAC: true, token: hmacToken(t, "secret", hmacKeyID("secret")), valid: true},
+		{name: "secret without kid while migrating", acceptHMAC: true, token: hmacToken(t, "secret", ""), valid: true},
+		// The published public key must never work as an HMAC secret
+		{name: "public key as secret", token: hmacToken(t, string(publicPEM), "rsa-1"), valid: false},
+		{name: "public key as secret while migrating", acceptHMAC: true, token: hmacToken(t, string(publicPEM), "rsa-1"), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := authConfig(AlgorithmRS256, []string{"secret"}, signingKey)
+			cfg.AcceptHMAC = tt.acceptHMAC
+			ring := mustKeyRing(t, cfg)
+
+			_, err := ValidateJWT(tt.token, ring)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateJWT error = %v, want valid %v", err, tt.valid)
+			}
+			if len(ring.JWKS().Keys) != 1 {
+				t.Errorf("JWKS has %d keys, want only the RSA key", len(ring.JWKS().Keys))
+			}
+		})
+	}
+}
+
+func TestKeyRingChecksIssuerAndAudience(t *testing.T) {
+	ring := mustKeyRing(t, authConfig(AlgorithmHS256, []string{"secret"}))
+
+	otherIssuer := authConfig(AlgorithmHS256, []string{"secret"})
+	otherIssuer.Issuer = "another-issuer"
+	otherAudience := authConfig(AlgorithmHS256, []string{"secret"})
+	otherAudience.Audience = "another-api"
+
+	for name, cfg := range map[string]env.AuthConfig{"issuer": otherIssuer, "audience": otherAudience} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ValidateJWT(issue(t, mustKeyRing(t, cfg)), ring); err == nil {
+				t.Errorf("token for another %s was accepted", name)
+			}
+		})
+	}
+
+	mfaToken, err := GenerateMFAToken(uuid.NewString(), MFAPurposeVerify, time.Minute, ring)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	if _, err := ValidateJWT(mfaToken, ring); err == nil {
+		t.Error("MFA challenge token was accepted as an access token")
+	}
+}
+
+// Without an audience to tell them apart, the typ claim still keeps MFA
+// challenge tokens and access tokens from standing in for each other
+func TestTokenTypesWithoutAudience(t *testing.T) {
+	cfg := authConfig(AlgorithmHS256, []string{"secret"})
+	cfg.Audience = ""
+	ring := mustKeyRing(t, cfg)
+
+	mfaToken, err := GenerateMFAToken(uuid.NewString(), MFAPurposeVerify, time.Minute, ring)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	if _, err := ValidateMFAToken(mfaToken, MFAPurposeVerify, ring); err != nil {
+		t.Errorf("MFA challenge token was refused: %v", err)
+	}
+	if _, err := ValidateJWT(mfaToken, ring); err == nil {
+		t.Error("MFA challenge token was accepted as an access token")
+	}
+
+	accessToken := issue(t, ring)
+	if _, err := ValidateJWT(accessToken, ring); err != nil {
+		t.Errorf("access token was refused: %v", err)
+	}
+	if _, err := ValidateMFAToken(accessToken, "", ring); err == nil {
+		t.Error("access token was accepted as an MFA challenge token")
+	}
+
+	// Tokens that don't say they're access tokens aren't taken for one
+	now := time.Now()
+	for name, typ := range map[string]string{"no type": "", "another type": "refresh"} {
+		t.Run(name, func(t *testing.T) {
+			token, err := ring.sign(&JWTClaims{
+				UserID:           uuid.NewString(),
+				TokenType:        typ,
+				RegisteredClaims: jwt.RegisteredClaims{Issuer: "flagit", ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+			})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if _, err := ValidateJWT(token, ring); err == nil {
+				t.Errorf("token of type %q was accepted as an access token", typ)
+			}
+		})
+	}
+}
+
+func TestNewKeyRingRejects(t *testing.T) {
+	pems := newPEMKeys(t)
+	rsaPrivate := pems.write("rsa", rsaKey(t))
+	rsaPublic := pems.write("rsa-public", &rsaKey(t).PublicKey)
+	ecPrivate := pems.write("ec", ecKey(t, elliptic.P256()))
+	p384Private := pems.write("p384", ecKey(t, elliptic.P384()))
+	notPEM := filepath.Join(pems.dir, "not-a-key.pem")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  env.AuthConfig
+	}{
+		{name: "HS256 without secrets", cfg: authConfig(AlgorithmHS256, nil)},
+		{name: "RS256 without keys", cfg: authConfig(AlgorithmRS256, []string{"secret"})},
+		{name: "unsupported algorithm", cfg: authConfig("none", []string{"secret"})},
+		{name: "public signing key", cfg: authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{ID: "rsa-1", File: rsaPublic})},
+		{name: "signing key of another algorithm", cfg: authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{ID: "ec-1", File: ecPrivate})},
+		{name: "curve other than P-256", cfg: authConfig(AlgorithmES256, nil, env.SigningKeyConfig{ID: "ec-1", File: p384Private})},
+		{name: "key without an id", cfg: authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{File: rsaPrivate})},
+		{
+			name: "duplicate key id",
+			cfg: authConfig(AlgorithmRS256, nil,
+				env.SigningKeyConfig{ID: "key", File: rsaPrivate},
+				env.SigningKeyConfig{ID: "key", File: rsaPublic},
+			),
+		},
+		{name: "missing key file", cfg: authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{ID: "rsa-1", File: filepath.Join(pems.dir, "missing.pem")})},
+		{name: "file that isn't a key", cfg: authConfig(AlgorithmRS256, nil, env.SigningKeyConfig{ID: "rsa-1", File: notPEM})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyRing(tt.cfg); err == nil {
+				t.Error("NewKeyRing succeeded")
+			}
+		})
+	}
+}
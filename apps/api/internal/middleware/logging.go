@@ -8,8 +8,17 @@ import (
 	"github.com/google/uuid"
 )
 
-// LoggingMiddleware provides request/response logging
-func LoggingMiddleware() fiber.Handler {
+// LoggingMiddleware provides request/response logging. At level "warn" only
+// 4xx/5xx responses are logged, and at "error" only 5xx responses
+func LoggingMiddleware(level string) fiber.Handler {
+	minStatus := 0
+	switch level {
+	case "warn":
+		minStatus = fiber.StatusBadRequest
+	case "error":
+		minStatus = fiber.StatusInternalServerError
+	}
+
 	return func(c *fiber.Ctx) error {
 		// Generate request ID
 		requestID := uuid.New().String()
@@ -26,7 +35,9 @@ func LoggingMiddleware() fiber.Handler {
 		duration := time.Since(start)
 
 		// Log request details
-		logRequest(c, requestID, start, duration, err)
+		if c.Response().StatusCode() >= minStatus || err != nil {
+			logRequest(c, requestID, start, duration, err)
+		}
 
 		return err
 	}
@@ -0,0 +1,452 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"reflect"
+	"strings"
+
+	"api/internal/errors"
+	"api/internal/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ProjectAccess looks up which project or environment a resource belongs to
+// and a user's roles within a project. The lookups only see the caller's
+// organisation; they return uuid.Nil for missing resources and no roles for
+// non-members.
+type ProjectAccess interface {
+	MemberRoles(ctx context.Context, projectID, userID uuid.UUID) ([]string, error)
+	ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error)
+	ProjectOfEnvironment(ctx context.Context, envID uuid.UUID) (uuid.UUID, error)
+	ProjectOfFlag(ctx context.Context, flagID uuid.UUID) (uuid.UUID, error)
+	ProjectOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error)
+	EnvironmentOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error)
+	EnvironmentInfo(ctx context.Context, envID uuid.UUID) (projectID uuid.UUID, key string, production bool, err error)
+	EnvironmentByKey(ctx context.Context, projectID uuid.UUID, key string) (uuid.UUID, error)
+}
+
+// TeamAccess looks up the teams of the caller's organisation and a user's
+// role within one, which is empty for non-members
+type TeamAccess interface {
+	TeamExists(ctx context.Context, teamID uuid.UUID) (bool, error)
+	MemberRole(ctx context.Context, teamID, userID uuid.UUID) (string, error)
+}
+
+// ProjectResolver finds the project a request acts on. It returns uuid.Nil
+// when the request names no valid resource, leaving the handler to reject it,
+// and a not-found error when the resource doesn't exist in the caller's
+// organisation, so other tenants' resources are indistinguishable from
+// missing ones.
+type ProjectResolver func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error)
+
+// EnvironmentResolver finds the environment a request changes, returning
+// uuid.Nil when it names none
+type EnvironmentResolver func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error)
+
+// ProjectParam reads the project ID from a route parameter, falling back to
+// the query parameter project_id
+func ProjectParam(name string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return existingProject(c, parseID(c.Params(name, c.Query("project_id"))), access)
+	}
+}
+
+// ProjectBody reads the project ID from a field of the JSON body
+func ProjectBody(field string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return existingProject(c, bodyID(c, field), access)
+	}
+}
+
+// EnvironmentParam resolves the project of the environment in a route
+// parameter
+func EnvironmentParam(name string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return lookup(c, parseID(c.Params(name)), access.ProjectOfEnvironment, errors.ErrEnvironmentNotFound)
+	}
+}
+
+// FlagParam resolves the project of the flag in a route parameter
+func FlagParam(name string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return lookup(c, parseID(c.Params(name)), access.ProjectOfFlag, errors.ErrFlagNotFound)
+	}
+}
+
+// FlagBody resolves the project of the flag in a field of the JSON body
+func FlagBody(field string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return lookup(c, bodyID(c, field), access.ProjectOfFlag, errors.ErrFlagNotFound)
+	}
+}
+
+// FlagValueParam resolves the project of the flag value in a route parameter
+func FlagValueParam(name string) ProjectResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return lookup(c, parseID(c.Params(name)), access.ProjectOfFlagValue, errors.ErrFlagValueNotFound)
+	}
+}
+
+// EnvironmentBody reads the environment ID from a field of the JSON body
+func EnvironmentBody(field string) EnvironmentResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return bodyID(c, field), nil
+	}
+}
+
+// EnvironmentIDParam reads the environment ID from a route parameter
+func EnvironmentIDParam(name string) EnvironmentResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return parseID(c.Params(name)), nil
+	}
+}
+
+// UnlessDryRun resolves no environment for requests whose JSON body sets
+// dry_run, as they change nothing
+func UnlessDryRun(environment EnvironmentResolver) EnvironmentResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		var body struct {
+			DryRun bool `json:"dry_run"`
+		}
+		if err := json.Unmarshal(c.Body(), &body); err == nil && body.DryRun {
+			return uuid.Nil, nil
+		}
+		return environment(c, access)
+	}
+}
+
+// FlagValueEnvironment resolves the environment of the stored flag value in
+// a route parameter
+func FlagValueEnvironment(name string) EnvironmentResolver {
+	return func(c *fiber.Ctx, access ProjectAccess) (uuid.UUID, error) {
+		return lookup(c, parseID(c.Params(name)), access.EnvironmentOfFlagValue, errors.ErrFlagValueNotFound)
+	}
+}
+
+// Authorizer checks permissions against the caller's effective roles: in the
+// project the request acts on, the union of their own membership's role and
+// those of their teams there, and their global role when they have neither.
+// Global admins keep full access everywhere.
+type Authorizer struct {
+	access ProjectAccess
+	teams  TeamAccess
+}
+
+func NewAuthorizer(access ProjectAccess, teams TeamAccess) *Authorizer {
+	return &Authorizer{access: access, teams: teams}
+}
+
+// RequirePermission creates middleware that checks the caller's effective
+// roles in the resolved project grant a permission. With a nil resolver only
+// the global role is checked.
+func (a *Authorizer) RequirePermission(permission Permission, project ProjectResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, err := a.effectiveRoles(c, project)
+		if err != nil {
+			return a.fail(c, err)
+		}
+
+		if !HasAnyPermission(roles, permission) || !tokenAllows(c, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientPermissions)
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireEnvironmentPermission creates middleware that checks the caller's
+// effective roles grant a permission in the environment the request changes,
+// applying any environment scope on each role's grant. The environment must
+// belong to the resolved project.
+func (a *Authorizer) RequireEnvironmentPermission(permission Permission, project ProjectResolver, environment EnvironmentResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, err := a.effectiveRoles(c, project)
+		if err != nil {
+			return a.fail(c, err)
+		}
+
+		if !HasAnyPermission(roles, permission) || !tokenAllows(c, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientPermissions)
+		}
+
+		envID, err := environment(c, a.access)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		// Requests without a valid environment are rejected by the handler
+		if envID == uuid.Nil {
+			return c.Next()
+		}
+
+		envProjectID, _, production, err := a.access.EnvironmentInfo(c.UserContext(), envID)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if envProjectID == uuid.Nil {
+			return a.fail(c, errors.ErrEnvironmentNotFound)
+		}
+		if projectID := localString(c, "project_id"); projectID != "" && projectID != envProjectID.String() {
+			return c.Status(fiber.StatusBadRequest).JSON(errors.ErrEnvironmentProjectMismatch)
+		}
+
+		if !HasAnyEnvironmentPermission(roles, permission, envID, production) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrEnvironmentRestricted)
+		}
+
+		c.Locals("environment_id", envID.String())
+		return c.Next()
+	}
+}
+
+// RequireConfirmation creates middleware that makes changes to production
+// environments deliberate: the request must carry the X-Confirm-Environment
+// header set to the key of the environment it changes. Requests changing no
+// environment, or a non-production one, pass through.
+func (a *Authorizer) RequireConfirmation(environment EnvironmentResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		envID, err := environment(c, a.access)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if envID == uuid.Nil {
+			return c.Next()
+		}
+
+		projectID, key, production, err := a.access.EnvironmentInfo(c.UserContext(), envID)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if projectID == uuid.Nil {
+			return a.fail(c, errors.ErrEnvironmentNotFound)
+		}
+		if production && c.Get("X-Confirm-Environment") != key {
+			return a.fail(c, errors.ErrProductionConfirmationRequired)
+		}
+
+		return c.Next()
+	}
+}
+
+// ResolveEnvironmentKeys creates middleware letting the routes under prefix
+// name an environment by its key instead of its ID. A key in the first path
+// segment is looked up in the project given by the project_id query
+// parameter and replaced with the environment's ID before routing goes on,
+// so handlers and resolvers only ever see IDs.
+func (a *Authorizer) ResolveEnvironmentKeys(prefix string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rest := strings.TrimPrefix(strings.TrimPrefix(c.Path(), prefix), "/")
+		segment, tail, _ := strings.Cut(rest, "/")
+		if segment == "" || parseID(segment) != uuid.Nil {
+			return c.Next()
+		}
+
+		projectID := parseID(c.Query("project_id"))
+		if projectID == uuid.Nil {
+			return a.fail(c, errors.ErrEnvironmentKeyNeedsProject)
+		}
+		envID, err := a.access.EnvironmentByKey(c.UserContext(), projectID, segment)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if envID == uuid.Nil {
+			return a.fail(c, errors.ErrEnvironmentNotFound)
+		}
+
+		path := prefix + "/" + envID.String()
+		if tail != "" {
+			path += "/" + tail
+		}
+		c.Path(path)
+		return c.Next()
+	}
+}
+
+// RequireOwnerOrAdmin creates middleware that admits global admins and the
+// resolved project's owners, i.e. members holding the admin role there
+// directly or through a team
+func (a *Authorizer) RequireOwnerOrAdmin(project ProjectResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, err := a.effectiveRoles(c, project)
+		if err != nil {
+			return a.fail(c, err)
+		}
+
+		if !hasRole(roles, RoleAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrAccessDenied)
+		}
+		if usingAccessToken(c) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrSessionRequired)
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireTeamMaintainer creates middleware that admits callers whose global
+// role can manage every team, and maintainers of the team in a route
+// parameter. Maintainers need a signed-in session.
+func (a *Authorizer) RequireTeamMaintainer(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roleStr, _ := c.Locals("role").(string)
+		userID := parseID(localString(c, "user_id"))
+		if roleStr == "" || userID == uuid.Nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+		}
+
+		// Requests without a valid team are rejected by the handler
+		teamID := parseID(c.Params(param))
+		if teamID == uuid.Nil {
+			return c.Next()
+		}
+		exists, err := a.teams.TeamExists(c.UserContext(), teamID)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if !exists {
+			return a.fail(c, errors.ErrTeamNotFound)
+		}
+
+		if HasPermission(Role(roleStr), TeamManage) && tokenAllows(c, TeamManage) {
+			return c.Next()
+		}
+
+		teamRole, err := a.teams.MemberRole(c.UserContext(), teamID, userID)
+		if err != nil {
+			return a.fail(c, err)
+		}
+		if teamRole != model.TeamRoleMaintainer {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientPermissions)
+		}
+		if usingAccessToken(c) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrSessionRequired)
+		}
+
+		return c.Next()
+	}
+}
+
+// effectiveRoles resolves the caller's roles for the request and stores
+// them, with the project, in the context
+func (a *Authorizer) effectiveRoles(c *fiber.Ctx, project ProjectResolver) ([]Role, error) {
+	roleStr, _ := c.Locals("role").(string)
+	userID := parseID(localString(c, "user_id"))
+	if roleStr == "" || userID == uuid.Nil {
+		return nil, errors.ErrAuthenticationRequired
+	}
+
+	roles := []Role{Role(roleStr)}
+	projectID := uuid.Nil
+	if project != nil {
+		var err error
+		if projectID, err = project(c, a.access); err != nil {
+			return nil, err
+		}
+	}
+
+	if projectID != uuid.Nil {
+		c.Locals("project_id", projectID.String())
+		if roles[0] != RoleAdmin {
+			memberRoles, err := a.access.MemberRoles(c.UserContext(), projectID, userID)
+			if err != nil {
+				return nil, err
+			}
+			if len(memberRoles) > 0 {
+				roles = roles[:0]
+				for _, memberRole := range memberRoles {
+					roles = append(roles, Role(memberRole))
+				}
+			}
+		}
+	}
+
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	c.Locals("effective_roles", names)
+	return roles, nil
+}
+
+func hasRole(roles []Role, role Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authorizer) fail(c *fiber.Ctx, err error) error {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		return c.Status(appErr.Code).JSON(appErr)
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(errors.ErrInternalServer)
+}
+
+// lookup resolves the resource with an ID through find, failing with
+// notFound if it doesn't exist in the caller's organisation
+func lookup(c *fiber.Ctx, id uuid.UUID, find func(context.Context, uuid.UUID) (uuid.UUID, error), notFound *errors.AppError) (uuid.UUID, error) {
+	if id == uuid.Nil {
+		return uuid.Nil, nil
+	}
+	found, err := find(c.UserContext(), id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if found == uuid.Nil {
+		return uuid.Nil, notFound
+	}
+	return found, nil
+}
+
+// existingProject checks a project named by the request exists in the
+// caller's organisation
+func existingProject(c *fiber.Ctx, projectID uuid.UUID, access ProjectAccess) (uuid.UUID, error) {
+	if projectID == uuid.Nil {
+		return uuid.Nil, nil
+	}
+	exists, err := access.ProjectExists(c.UserContext(), projectID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !exists {
+		return uuid.Nil, errors.ErrProjectNotFound
+	}
+	return projectID, nil
+}
+
+func parseID(s string) uuid.UUID {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// bodyID reads the UUID in a field of the JSON body. It decodes the field
+// into a struct as the handler's BodyParser does, so keys repeating the field
+// in another case resolve to the same value for both, and records the ID
+// under "body_<field>" for the handler to act on.
+func bodyID(c *fiber.Ctx, field string) uuid.UUID {
+	body := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "ID",
+		Type: reflect.TypeOf(uuid.UUID{}),
+		Tag:  reflect.StructTag(`json:"` + field + `"`),
+	}}))
+	id := uuid.Nil
+	if err := json.Unmarshal(c.Body(), body.Interface()); err == nil {
+		id = body.Elem().Field(0).Interface().(uuid.UUID)
+	}
+	c.Locals("body_"+field, id.String())
+	return id
+}
+
+func localString(c *fiber.Ctx, key string) string {
+	value, _ := c.Locals(key).(string)
+	return value
+}
@@ -0,0 +1,384 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api/internal/errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// fakeProjectAccess holds one organisation's projects, environments and
+// flags, and the roles of the caller in each project
+type fakeProjectAccess struct {
+	members      map[uuid.UUID][]string
+	projects     map[uuid.UUID]bool
+	flags        map[uuid.UUID]uuid.UUID
+	environments map[uuid.UUID]fakeEnvironment
+}
+
+type fakeEnvironment struct {
+	projectID  uuid.UUID
+	key        string
+	production bool
+}
+
+func (a *fakeProjectAccess) MemberRoles(ctx context.Context, projectID, userID uuid.UUID) ([]string, error) {
+	return a.members[projectID], nil
+}
+
+func (a *fakeProjectAccess) ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	return a.projects[projectID], nil
+}
+
+func (a *fakeProjectAccess) ProjectOfEnvironment(ctx context.Context, envID uuid.UUID) (uuid.UUID, error) {
+	return a.environments[envID].projectID, nil
+}
+
+func (a *fakeProjectAccess) ProjectOfFlag(ctx context.Context, flagID uuid.UUID) (uuid.UUID, error) {
+	return a.flags[flagID], nil
+}
+
+func (a *fakeProjectAccess) ProjectOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (a *fakeProjectAccess) EnvironmentOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error) {
+	return uuid.Nil, nil
+}
+
+func (a *fakeProjectAccess) EnvironmentInfo(ctx context.Context, envID uuid.UUID) (uuid.UUID, string, bool, error) {
+	env := a.environments[envID]
+	return env.projectID, env.key, env.production, nil
+}
+
+func (a *fakeProjectAccess) EnvironmentByKey(ctx context.Context, projectID uuid.UUID, key string) (uuid.UUID, error) {
+	for id, env := range a.environments {
+		if env.projectID == projectID && env.key == key {
+			return id, nil
+		}
+	}
+	return uuid.Nil, nil
+}
+
+// accessFixture is a caller who develops in one project and has no
+// membership in another
+type accessFixture struct {
+	access *fakeProjectAccess
+
+	project, otherProject         uuid.UUID
+	flag, otherFlag               uuid.UUID
+	staging, production, otherEnv uuid.UUID
+}
+
+func newAccessFixture() *accessFixture {
+	f := &accessFixture{
+		project: uuid.New(), otherProject: uuid.New(),
+		flag: uuid.New(), otherFlag: uuid.New(),
+		staging: uuid.New(), production: uuid.New(), otherEnv: uuid.New(),
+	}
+	f.access = &fakeProjectAccess{
+		members:  map[uuid.UUID][]string{f.project: {string(RoleDeveloper)}},
+		projects: map[uuid.UUID]bool{f.project: true, f.otherProject: true},
+		flags:    map[uuid.UUID]uuid.UUID{f.flag: f.project, f.otherFlag: f.otherProject},
+		environments: map[uuid.UUID]fakeEnvironment{
+			f.staging:    {projectID: f.project, key: "staging"},
+			f.production: {projectID: f.project, key: "production", production: true},
+			f.otherEnv:   {projectID: f.otherProject, key: "staging"},
+		},
+	}
+	return f
+}
+
+// flagValueRequest mirrors the body of a flag value change
+type flagValueRequest struct {
+	FlagID uuid.UUID `json:"flag_id"`
+	EnvID  uuid.UUID `json:"env_id"`
+}
+
+// serve runs a request through the handlers as a signed-in user with a
+// global role. The final handler answers with the IDs its body parser sees,
+// so tests can compare them with what was authorised.
+func serve(t *testing.T, role Role, body string, headers map[string]string, handlers ...fiber.Handler) (int, flagValueRequest) {
+	t.Helper()
+
+	app := fiber.New()
+	chain := append([]fiber.Handler{func(c *fiber.Ctx) error {
+		c.Locals("role", string(role))
+		c.Locals("user_id", uuid.New().String())
+		return c.Next()
+	}}, handlers...)
+	chain = append(chain, func(c *fiber.Ctx) error {
+		var req flagValueRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRequestBody)
+		}
+		return c.JSON(req)
+	})
+	app.Post("/", chain...)
+
+	req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed flagValueRequest
+	if resp.StatusCode == fiber.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(raw, &parsed); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return resp.StatusCode, parsed
+}
+
+func TestBodyIDMatchesBodyParser(t *testing.T) {
+	id, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name string
+		body string
+		want uuid.UUID
+	}{
+		{name: "exact key", body: fmt.Sprintf(`{"flag_id":%q}`, id), want: id},
+		{name: "key in another case", body: fmt.Sprintf(`{"FLAG_ID":%q}`, id), want: id},
+		{name: "later key in another case wins", body: fmt.Sprintf(`{"flag_id":%q,"Flag_Id":%q}`, id, other), want: other},
+		{name: "later exact key wins", body: fmt.Sprintf(`{"FLAG_ID":%q,"flag_id":%q}`, other, id), want: id},
+		{name: "missing field", body: `{}`, want: uuid.Nil},
+		{name: "invalid ID", body: `{"flag_id":"not-a-uuid"}`, want: uuid.Nil},
+		{name: "invalid JSON", body: `{"flag_id":`, want: uuid.Nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", func(c *fiber.Ctx) error {
+				if got := bodyID(c, "flag_id"); got != tt.want {
+					t.Errorf("bodyID = %s, want %s", got, tt.want)
+				}
+				if got := localString(c, "body_flag_id"); got != tt.want.String() {
+					t.Errorf("recorded ID = %s, want %s", got, tt.want)
+				}
+
+				var req flagValueRequest
+				if err := c.BodyParser(&req); err == nil && req.FlagID != tt.want {
+					t.Errorf("BodyParser read %s, bodyID read %s", req.FlagID, tt.want)
+				}
+				return c.SendStatus(fiber.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if _, err := app.Test(req); err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+		})
+	}
+}
+
+func TestRequireEnvironmentPermission(t *testing.T) {
+	f := newAccessFixture()
+	authz := NewAuthorizer(f.access, nil)
+	guard := authz.RequireEnvironmentPermission(FlagValueUpdate, FlagBody("flag_id"), EnvironmentBody("env_id"))
+
+	tests := []struct {
+		name string
+		role Role
+		body string
+		want int
+	}{
+		{
+			name: "member in a covered environment",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.flag, f.staging),
+			want: fiber.StatusOK,
+		},
+		{
+			name: "member outside the role's environment scope",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.flag, f.production),
+			want: errors.ErrEnvironmentRestricted.Code,
+		},
+		{
+			name: "non-member falls back to the global role",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.otherFlag, f.otherEnv),
+			want: fiber.StatusForbidden,
+		},
+		{
+			name: "global admin",
+			role: RoleAdmin,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.otherFlag, f.otherEnv),
+			want: fiber.StatusOK,
+		},
+		{
+			name: "environment of another project",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.flag, f.otherEnv),
+			want: errors.ErrEnvironmentProjectMismatch.Code,
+		},
+		{
+			name: "unknown flag",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, uuid.New(), f.staging),
+			want: errors.ErrFlagNotFound.Code,
+		},
+		{
+			name: "unknown environment",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q}`, f.flag, uuid.New()),
+			want: errors.ErrEnvironmentNotFound.Code,
+		},
+		{
+			name: "flag repeated in another case",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"FLAG_ID":%q,"env_id":%q}`, f.flag, f.otherFlag, f.otherEnv),
+			want: fiber.StatusForbidden,
+		},
+		{
+			name: "environment repeated in another case",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"flag_id":%q,"env_id":%q,"Env_Id":%q}`, f.flag, f.staging, f.production),
+			want: errors.ErrEnvironmentRestricted.Code,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, parsed := serve(t, tt.role, tt.body, nil, guard)
+			if status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if status == fiber.StatusOK && parsed.FlagID == uuid.Nil {
+				t.Error("handler parsed no flag")
+			}
+		})
+	}
+}
+
+// The handler must act on the resources that were authorised, whichever
+// spelling of a field it decodes
+func TestRequireEnvironmentPermissionHandlerSeesCheckedIDs(t *testing.T) {
+	f := newAccessFixture()
+	authz := NewAuthorizer(f.access, nil)
+	guard := authz.RequireEnvironmentPermission(FlagValueUpdate, FlagBody("flag_id"), EnvironmentBody("env_id"))
+
+	body := fmt.Sprintf(`{"FLAG_ID":%q,"flag_id":%q,"Env_ID":%q,"env_id":%q}`, f.otherFlag, f.flag, f.production, f.staging)
+	status, parsed := serve(t, RoleViewer, body, nil, guard)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if parsed.FlagID != f.flag || parsed.EnvID != f.staging {
+		t.Errorf("handler parsed flag %s in %s, want flag %s in %s", parsed.FlagID, parsed.EnvID, f.flag, f.staging)
+	}
+}
+
+func TestProjectBody(t *testing.T) {
+	f := newAccessFixture()
+	authz := NewAuthorizer(f.access, nil)
+	guard := authz.RequirePermission(FlagCreate, ProjectBody("project_id"))
+
+	tests := []struct {
+		name string
+		role Role
+		body string
+		want int
+	}{
+		{name: "member", role: RoleViewer, body: fmt.Sprintf(`{"project_id":%q}`, f.project), want: fiber.StatusOK},
+		{name: "non-member", role: RoleViewer, body: fmt.Sprintf(`{"project_id":%q}`, f.otherProject), want: fiber.StatusForbidden},
+		{name: "global admin", role: RoleAdmin, body: fmt.Sprintf(`{"project_id":%q}`, f.otherProject), want: fiber.StatusOK},
+		{name: "unknown project", role: RoleViewer, body: fmt.Sprintf(`{"project_id":%q}`, uuid.New()), want: errors.ErrProjectNotFound.Code},
+		{
+			name: "project repeated in another case",
+			role: RoleViewer,
+			body: fmt.Sprintf(`{"project_id":%q,"Project_ID":%q}`, f.project, f.otherProject),
+			want: fiber.StatusForbidden,
+		},
+		{name: "no project checks the global role", role: RoleViewer, body: `{}`, want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := serve(t, tt.role, tt.body, nil, guard); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireConfirmation(t *testing.T) {
+	f := newAccessFixture()
+	authz := NewAuthorizer(f.access, nil)
+
+	tests := []struct {
+		name    string
+		guard   fiber.Handler
+		body    string
+		confirm string
+		want    int
+	}{
+		{
+			name:  "non-production environment",
+			guard: authz.RequireConfirmation(EnvironmentBody("env_id")),
+			body:  fmt.Sprintf(`{"env_id":%q}`, f.staging),
+			want:  fiber.StatusOK,
+		},
+		{
+			name:  "production without confirmation",
+			guard: authz.RequireConfirmation(EnvironmentBody("env_id")),
+			body:  fmt.Sprintf(`{"env_id":%q}`, f.production),
+			want:  errors.ErrProductionConfirmationRequired.Code,
+		},
+		{
+			name:    "production confirmed with another key",
+			guard:   authz.RequireConfirmation(EnvironmentBody("env_id")),
+			body:    fmt.Sprintf(`{"env_id":%q}`, f.production),
+			confirm: "staging",
+			want:    errors.ErrProductionConfirmationRequired.Code,
+		},
+		{
+			name:    "production confirmed",
+			guard:   authz.RequireConfirmation(EnvironmentBody("env_id")),
+			body:    fmt.Sprintf(`{"env_id":%q}`, f.production),
+			confirm: "production",
+			want:    fiber.StatusOK,
+		},
+		{
+			name:  "production repeated in another case",
+			guard: authz.RequireConfirmation(EnvironmentBody("env_id")),
+			body:  fmt.Sprintf(`{"env_id":%q,"ENV_ID":%q}`, f.staging, f.production),
+			want:  errors.ErrProductionConfirmationRequired.Code,
+		},
+		{
+			name:  "dry run",
+			guard: authz.RequireConfirmation(UnlessDryRun(EnvironmentBody("env_id"))),
+			body:  fmt.Sprintf(`{"env_id":%q,"dry_run":true}`, f.production),
+			want:  fiber.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.confirm != "" {
+				headers["X-Confirm-Environment"] = tt.confirm
+			}
+			if status, _ := serve(t, RoleViewer, tt.body, headers, tt.guard); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
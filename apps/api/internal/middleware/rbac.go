@@ -4,6 +4,7 @@ import (
 	"api/internal/errors"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 // Role represents user roles in the system
@@ -37,27 +38,62 @@ const (
 	FlagRead   Permission = "flag:read"
 	FlagUpdate Permission = "flag:update"
 	FlagDelete Permission = "flag:delete"
+
+	// Flag value permissions, which may be limited to some environments
+	FlagValueUpdate Permission = "flag_value:update"
+
+	// User management permissions
+	UserManage Permission = "user:manage"
+
+	// Audit trail permissions
+	AuditRead Permission = "audit:read"
+
+	// Role management permissions
+	RoleManage Permission = "role:manage"
+
+	// Organisation permissions, over the caller's own organisation
+	OrganizationManage Permission = "organization:manage"
+
+	// Team permissions, over every team of the organisation; maintainers
+	// manage their own teams without it
+	TeamManage Permission = "team:manage"
 )
 
-// RolePermissions maps roles to their allowed permissions
+// Permissions lists every permission a role can be granted
+var Permissions = []Permission{
+	ProjectCreate, ProjectRead, ProjectUpdate, ProjectDelete,
+	EnvironmentCreate, EnvironmentRead, EnvironmentUpdate, EnvironmentDelete,
+	FlagCreate, FlagRead, FlagUpdate, FlagDelete,
+	FlagValueUpdate,
+	UserManage, AuditRead, RoleManage, OrganizationManage, TeamManage,
+}
+
+// RolePermissions maps the built-in roles to their allowed permissions. They
+// are seeded into the database, which also holds custom roles; checks use
+// the loaded definitions once a RoleCache is in use.
 var RolePermissions = map[Role][]Permission{
 	RoleAdmin: {
 		// Admin has all permissions
 		ProjectCreate, ProjectRead, ProjectUpdate, ProjectDelete,
 		EnvironmentCreate, EnvironmentRead, EnvironmentUpdate, EnvironmentDelete,
 		FlagCreate, FlagRead, FlagUpdate, FlagDelete,
+		FlagValueUpdate,
+		UserManage, AuditRead, RoleManage, OrganizationManage, TeamManage,
 	},
 	RoleManager: {
 		// Manager can manage everything within their projects
 		ProjectCreate, ProjectRead, ProjectUpdate,
 		EnvironmentCreate, EnvironmentRead, EnvironmentUpdate, EnvironmentDelete,
 		FlagCreate, FlagRead, FlagUpdate, FlagDelete,
+		FlagValueUpdate,
 	},
 	RoleDeveloper: {
-		// Developer can read and create/update flags
+		// Developer can read and create/update flags, and change values
+		// outside production
 		ProjectRead,
 		EnvironmentRead, EnvironmentCreate,
 		FlagCreate, FlagRead, FlagUpdate,
+		FlagValueUpdate,
 	},
 	RoleViewer: {
 		// Viewer can only read
@@ -67,14 +103,96 @@ var RolePermissions = map[Role][]Permission{
 	},
 }
 
+// EnvironmentScope limits a permission to some of a project's environments.
+// The zero value covers every environment.
+type EnvironmentScope struct {
+	// NonProduction excludes environments marked as production
+	NonProduction bool
+	// Environments, when not empty, lists the only environments covered
+	Environments []uuid.UUID
+}
+
+// Covers reports whether the scope includes an environment
+func (s EnvironmentScope) Covers(envID uuid.UUID, production bool) bool {
+	if s.NonProduction && production {
+		return false
+	}
+	if len(s.Environments) == 0 {
+		return true
+	}
+	for _, id := range s.Environments {
+		if id == envID {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleEnvironmentScopes narrows some of the built-in roles' permissions to a
+// subset of environments. Permissions not listed apply in every environment.
+var RoleEnvironmentScopes = map[Role]map[Permission]EnvironmentScope{
+	RoleDeveloper: {
+		FlagValueUpdate: {NonProduction: true},
+	},
+}
+
+// HasEnvironmentPermission checks if a role has a permission in an
+// environment
+func HasEnvironmentPermission(role Role, permission Permission, envID uuid.UUID, production bool) bool {
+	if !HasPermission(role, permission) {
+		return false
+	}
+	definition, _ := lookupRole(role)
+	scope, scoped := definition.Scopes[permission]
+	return !scoped || scope.Covers(envID, production)
+}
+
+// HasAnyPermission checks if any of a user's roles has a permission
+func HasAnyPermission(roles []Role, permission Permission) bool {
+	for _, role := range roles {
+		if HasPermission(role, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyEnvironmentPermission checks if any of a user's roles has a
+// permission in an environment, so grants limited to different environments
+// add up
+func HasAnyEnvironmentPermission(roles []Role, permission Permission, envID uuid.UUID, production bool) bool {
+	for _, role := range roles {
+		if HasEnvironmentPermission(role, permission, envID, production) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role Role) bool {
+	_, exists := lookupRole(role)
+	return exists
+}
+
+// ValidPermission reports whether permission is a known permission
+func ValidPermission(permission Permission) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // HasPermission checks if a user role has a specific permission
 func HasPermission(role Role, permission Permission) bool {
-	permissions, exists := RolePermissions[role]
+	definition, exists := lookupRole(role)
 	if !exists {
 		return false
 	}
 
-	for _, p := range permissions {
+	for _, p := range definition.Permissions {
 		if p == permission {
 			return true
 		}
@@ -93,7 +211,7 @@ func RequirePermission(permission Permission) fiber.Handler {
 		}
 
 		role := Role(roleStr)
-		if !HasPermission(role, permission) {
+		if !HasPermission(role, permission) || !tokenAllows(c, permission) {
 			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientPermissions)
 		}
 
@@ -115,6 +233,11 @@ func RequireRole(requiredRole Role) fiber.Handler {
 			return c.Status(fiber.StatusForbidden).JSON(errors.ErrInsufficientRole)
 		}
 
+		// Role checks guard administration, which access tokens can't do
+		if usingAccessToken(c) {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrSessionRequired)
+		}
+
 		return c.Next()
 	}
 }
@@ -124,29 +247,13 @@ func RequireAdmin() fiber.Handler {
 	return RequireRole(RoleAdmin)
 }
 
-// RequireOwnerOrAdmin creates middleware that checks if user is resource owner or admin
-func RequireOwnerOrAdmin() fiber.Handler {
+// RequireHostOrganization creates middleware that admits only members of
+// the host organisation, for managing the installation itself
+func RequireHostOrganization() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get user info from context
-		userID, userOk := c.Locals("user_id").(string)
-		roleStr, roleOk := c.Locals("role").(string)
-		if !userOk || !roleOk || userID == "" || roleStr == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(errors.ErrAuthenticationRequired)
+		if host, _ := c.Locals("host_organization").(bool); !host {
+			return c.Status(fiber.StatusForbidden).JSON(errors.ErrHostOrganizationRequired)
 		}
-
-		role := Role(roleStr)
-		// Admin can access everything
-		if role == RoleAdmin {
-			return c.Next()
-		}
-
-		// TODO: Implement ownership checking based on resource
-		// For now, we'll check path parameter against user ID
-		resourceID := c.Params("id")
-		if userID == resourceID {
-			return c.Next()
-		}
-
-		return c.Status(fiber.StatusForbidden).JSON(errors.ErrAccessDenied)
+		return c.Next()
 	}
 }
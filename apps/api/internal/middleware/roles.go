@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RoleDefinition is what a role grants: its permissions and any environment
+// scopes narrowing them
+type RoleDefinition struct {
+	Permissions []Permission
+	Scopes      map[Permission]EnvironmentScope
+}
+
+// RoleLoader loads the definitions of every role
+type RoleLoader func(ctx context.Context) (map[Role]RoleDefinition, error)
+
+// RoleCache is an in-memory copy of the role definitions stored in the
+// database. It is reloaded by the API's own role changes; the TTL only bounds
+// staleness from changes made by other instances.
+type RoleCache struct {
+	load     RoleLoader
+	ttl      time.Duration
+	roles    map[Role]RoleDefinition
+	loadedAt time.Time
+	mutex    sync.RWMutex
+}
+
+// NewRoleCache creates a cache that reloads through load after ttl
+func NewRoleCache(load RoleLoader, ttl time.Duration) *RoleCache {
+	return &RoleCache{
+		load: load,
+		ttl:  ttl,
+	}
+}
+
+// Reload replaces the cached definitions with freshly loaded ones
+func (c *RoleCache) Reload(ctx context.Context) error {
+	roles, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.roles = roles
+	c.loadedAt = time.Now()
+	return nil
+}
+
+// Get returns a role's definition, reloading first if the cache has expired.
+// A failed reload keeps serving the previous definitions.
+func (c *RoleCache) Get(role Role) (RoleDefinition, bool) {
+	if c.claimReload() {
+		if err := c.Reload(context.Background()); err != nil {
+			log.Printf("Failed to reload roles: %v", err)
+		}
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	definition, ok := c.roles[role]
+	return definition, ok
+}
+
+// claimReload reports whether the cache has expired, resetting its age so
+// only one caller reloads it
+func (c *RoleCache) claimReload() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Since(c.loadedAt) <= c.ttl {
+		return false
+	}
+	c.loadedAt = time.Now()
+	return true
+}
+
+// activeRoles is the cache permission checks consult, if one is in use
+var activeRoles struct {
+	sync.RWMutex
+	cache *RoleCache
+}
+
+// UseRoleCache makes permission checks use the role definitions in cache
+// instead of the built-in ones
+func UseRoleCache(cache *RoleCache) {
+	activeRoles.Lock()
+	defer activeRoles.Unlock()
+	activeRoles.cache = cache
+}
+
+func lookupRole(role Role) (RoleDefinition, bool) {
+	activeRoles.RLock()
+	cache := activeRoles.cache
+	activeRoles.RUnlock()
+
+	if cache != nil {
+		return cache.Get(role)
+	}
+
+	permissions, ok := RolePermissions[role]
+	return RoleDefinition{Permissions: permissions, Scopes: RoleEnvironmentScopes[role]}, ok
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions
+const (
+	AuditLoginLockout      = "auth.lockout"
+	AuditAccountUnlock     = "auth.unlock"
+	AuditUserInvite        = "user.invite"
+	AuditUserRoleChange    = "user.role_change"
+	AuditUserActivate      = "user.activate"
+	AuditUserDeactivate    = "user.deactivate"
+	AuditUserDelete        = "user.delete"
+	AuditMemberSet         = "project.member_set"
+	AuditMemberRemove      = "project.member_remove"
+	AuditProjectTeamSet    = "project.team_set"
+	AuditProjectTeamRemove = "project.team_remove"
+	AuditRoleCreate        = "role.create"
+	AuditRoleUpdate        = "role.update"
+	AuditRoleDelete        = "role.delete"
+	AuditTokenCreate       = "token.create"
+	AuditTokenRevoke       = "token.revoke"
+	AuditServiceAccount    = "user.service_account_create"
+	AuditOrgCreate         = "organization.create"
+	AuditOrgUpdate         = "organization.update"
+	AuditOrgDelete         = "organization.delete"
+	AuditTeamCreate        = "team.create"
+	AuditTeamUpdate        = "team.update"
+	AuditTeamDelete        = "team.delete"
+	AuditTeamMemberSet     = "team.member_set"
+	AuditTeamMemberRemove  = "team.member_remove"
+)
+
+// Kinds of audit event targets
+const (
+	AuditTargetUser      = "user"
+	AuditTargetUsername  = "username"
+	AuditTargetIPAddress = "ip_address"
+	AuditTargetProject   = "project"
+	AuditTargetRole      = "role"
+	AuditTargetOrg       = "organization"
+	AuditTargetTeam      = "team"
+)
+
+// AuditEvent records a security-relevant action. OrganizationID is nil for
+// events outside any organisation, such as IP lockouts. ActorID is nil when
+// no signed-in user caused it; ActorType tells people from service accounts
+// and ActorTokenID is set when the actor used an access token.
+type AuditEvent struct {
+	ID             uuid.UUID              `json:"id" db:"id"`
+	OrganizationID *uuid.UUID             `json:"organization_id,omitempty" db:"organization_id"`
+	ActorID        *uuid.UUID             `json:"actor_id,omitempty" db:"actor_id"`
+	ActorType      string                 `json:"actor_type,omitempty" db:"actor_type"`
+	ActorTokenID   *uuid.UUID             `json:"actor_token_id,omitempty" db:"actor_token_id"`
+	Action         string                 `json:"action" db:"action"`
+	TargetType     string                 `json:"target_type" db:"target_type"`
+	TargetID       string                 `json:"target_id" db:"target_id"`
+	IPAddress      string                 `json:"ip_address" db:"ip_address"`
+	Metadata       map[string]interface{} `json:"metadata" db:"metadata"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
@@ -9,7 +9,18 @@ import (
 type Environment struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	ProjectID uuid.UUID `json:"project_id" db:"project_id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// Key addresses the environment in routes in place of its ID; it is
+	// unique within the project and can't be changed
+	Key       string `json:"key" db:"key"`
+	Name      string `json:"name" db:"name"`
+	SortOrder int    `json:"sort_order" db:"sort_order"`
+	Color     string `json:"color" db:"color"`
+	// Production environments are excluded from non-production grants, and
+	// changes to them must be confirmed
+	Production bool `json:"production" db:"production"`
+	// NewFlagsEnabled is whether flags created later start enabled here
+	NewFlagsEnabled bool      `json:"new_flags_enabled" db:"new_flags_enabled"`
+	Version         int       `json:"version" db:"version"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EvaluationValueOff is recorded as the served value when a flag is disabled
+const EvaluationValueOff = "(off)"
+
+// EvaluationCount is the number of times a flag served a value in an
+// environment during one time bucket
+type EvaluationCount struct {
+	FlagID          uuid.UUID `json:"flag_id" db:"flag_id"`
+	EnvID           uuid.UUID `json:"env_id" db:"env_id"`
+	Value           string    `json:"value" db:"value"`
+	BucketStart     time.Time `json:"bucket_start" db:"bucket_start"`
+	Count           int64     `json:"count" db:"count"`
+	LastEvaluatedAt time.Time `json:"last_evaluated_at" db:"last_evaluated_at"`
+}
+
+// EvaluationResult is the value of a flag served by the evaluation endpoint
+type EvaluationResult struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Enabled bool   `json:"enabled"`
+}
+
+type FlagInsights struct {
+	FlagID          uuid.UUID             `json:"flag_id"`
+	LastEvaluatedAt *time.Time            `json:"last_evaluated_at"`
+	Environments    []EnvironmentInsights `json:"environments"`
+}
+
+type EnvironmentInsights struct {
+	EnvID           uuid.UUID          `json:"env_id"`
+	LastEvaluatedAt *time.Time         `json:"last_evaluated_at"`
+	Total           int64              `json:"total"`
+	Series          []EvaluationBucket `json:"series"`
+}
+
+type EvaluationBucket struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Value       string    `json:"value"`
+	Count       int64     `json:"count"`
+}
@@ -1,27 +1,98 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	OwnerTypeUser = "user"
+	OwnerTypeTeam = "team"
+)
+
+// Flag kinds: temporary flags are expected to be removed once rolled out
+const (
+	FlagKindTemporary = "temporary"
+	FlagKindPermanent = "permanent"
+)
+
+const (
+	FlagStatusActive   = "active"
+	FlagStatusArchived = "archived"
+)
+
+// Flag types, which decide what values a flag can take
+const (
+	FlagTypeBoolean = "boolean"
+	FlagTypeString  = "string"
+	FlagTypeNumber  = "number"
+	FlagTypeJSON    = "json"
+)
+
+// ValidFlagValue reports whether a value is one a flag of the type can take:
+// "true" or "false" for booleans, a JSON number for numbers and any JSON
+// document for json flags
+func ValidFlagValue(flagType, value string) bool {
+	switch flagType {
+	case FlagTypeBoolean:
+		return value == "true" || value == "false"
+	case FlagTypeNumber:
+		var number float64
+		return json.Unmarshal([]byte(value), &number) == nil
+	case FlagTypeJSON:
+		return json.Valid([]byte(value))
+	default:
+		return true
+	}
+}
+
+// Reasons a flag shows up in the stale report
+const (
+	StaleReasonUnchanged      = "unchanged"
+	StaleReasonFullyRolledOut = "fully_rolled_out"
+	StaleReasonPastRemoval    = "past_removal_date"
+	StaleReasonNotEvaluated   = "not_evaluated"
+)
+
 type Flag struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	ProjectID   uuid.UUID `json:"project_id" db:"project_id"`
-	Key         string    `json:"key" db:"key"`
-	Description string    `json:"description" db:"description"`
-	Type        string    `json:"type" db:"type"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ProjectID       uuid.UUID  `json:"project_id" db:"project_id"`
+	Key             string     `json:"key" db:"key"`
+	Description     string     `json:"description" db:"description"`
+	Type            string     `json:"type" db:"type"`
+	DefaultValue    string     `json:"default_value" db:"default_value"` // Off variation new environments start with
+	Tags            []string   `json:"tags"`
+	Owner           *FlagOwner `json:"owner,omitempty"`
+	Kind            string     `json:"kind" db:"kind"`
+	Status          string     `json:"status" db:"status"`
+	RemovalDate     *time.Time `json:"removal_date,omitempty" db:"removal_date"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty" db:"last_evaluated_at"`
+	Version         int        `json:"version" db:"version"` // Bumped by every change; updates must name the version they change
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+func (f *Flag) IsArchived() bool {
+	return f.Status == FlagStatusArchived
+}
+
+// FlagOwner is the user or team responsible for a flag
+type FlagOwner struct {
+	Type string    `json:"type" db:"owner_type"`
+	ID   uuid.UUID `json:"id" db:"owner_id"`
 }
 
 type FlagValue struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	FlagID    uuid.UUID `json:"flag_id" db:"flag_id"`
+	FlagKey   string    `json:"flag_key,omitempty" db:"key"` // Only set when listing an environment's values
 	EnvID     uuid.UUID `json:"env_id" db:"env_id"`
 	Value     string    `json:"value" db:"value"`
 	Enabled   bool      `json:"enabled" db:"enabled"`
+	Version   int       `json:"version" db:"version"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -30,3 +101,10 @@ type FlagWithValues struct {
 	Flag
 	Values []FlagValue `json:"values,omitempty"`
 }
+
+// StaleFlag is a flag that is a candidate for clean-up
+type StaleFlag struct {
+	Flag
+	Reasons       []string  `json:"reasons"`
+	LastChangedAt time.Time `json:"last_changed_at"`
+}
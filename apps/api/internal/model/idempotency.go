@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// IdempotentRequest is a request sent with an Idempotency-Key, along with
+// the response replayed to retries once it has been handled
+type IdempotentRequest struct {
+	// Scope identifies the user or access token that sent the request, so
+	// keys of different callers never collide
+	Scope string
+	Key   string
+	// Fingerprint is a hash of the method, path and body; a retry must match it
+	Fingerprint  string
+	StatusCode   int // 0 while the request is being handled
+	ContentType  string
+	ETag         string
+	Location     string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// Handled reports whether the response to the request has been stored
+func (r *IdempotentRequest) Handled() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// What promoting a flag does to the target environment's value
+const (
+	PromoteActionCreate    = "create"
+	PromoteActionUpdate    = "update"
+	PromoteActionUnchanged = "unchanged"
+	PromoteActionSkip      = "skip"
+)
+
+// Reasons a flag can't be promoted as is
+const (
+	// The target's value changed after the source's, so promoting would
+	// discard a change made directly in the target
+	PromoteConflictTargetChanged = "target_changed"
+	// The source environment has no value for the flag
+	PromoteConflictNoSourceValue = "no_source_value"
+	// The flag isn't an active flag of the project
+	PromoteConflictFlagNotFound = "flag_not_found"
+	// The source value doesn't match the flag's type. It is never copied,
+	// even with overwrite.
+	PromoteConflictInvalidValue = "invalid_value"
+)
+
+// FlagValueState is a flag's value in one environment
+type FlagValueState struct {
+	Value     string    `json:"value"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *FlagValueState) equal(other *FlagValueState) bool {
+	return s.Value == other.Value && s.Enabled == other.Enabled
+}
+
+// FlagValueChange describes what promoting one flag changes in the target
+// environment
+type FlagValueChange struct {
+	FlagID      uuid.UUID       `json:"flag_id"`
+	FlagKey     string          `json:"flag_key,omitempty"`
+	Action      string          `json:"action"`
+	Source      *FlagValueState `json:"source,omitempty"`
+	Target      *FlagValueState `json:"target,omitempty"`
+	Conflict    string          `json:"conflict,omitempty"`
+	FlagValueID *uuid.UUID      `json:"flag_value_id,omitempty"` // Set once applied
+	Version     int             `json:"version,omitempty"`       // Of the target value, once applied
+}
+
+// Copies reports whether applying the change writes the source's value to
+// the target
+func (c *FlagValueChange) Copies() bool {
+	return c.Action == PromoteActionCreate || c.Action == PromoteActionUpdate
+}
+
+// Promotion copies flag values from one environment to another of the same
+// project. Conflicting flags block the whole promotion unless Overwrite is
+// set, in which case flags with no source value are skipped and the others
+// copied anyway.
+type Promotion struct {
+	SourceEnvID uuid.UUID         `json:"source_env_id"`
+	TargetEnvID uuid.UUID         `json:"target_env_id"`
+	FlagIDs     []uuid.UUID       `json:"-"` // Every flag with a source value when empty
+	DryRun      bool              `json:"dry_run"`
+	Overwrite   bool              `json:"overwrite"`
+	Applied     bool              `json:"applied"`
+	Changes     []FlagValueChange `json:"changes"`
+	Created     int               `json:"created"`
+	Updated     int               `json:"updated"`
+	Unchanged   int               `json:"unchanged"`
+	Conflicts   int               `json:"conflicts"`
+}
+
+// Plan records the change promoting a flag of the type makes, given its
+// value in the source and target environments, either of which may be
+// missing
+func (p *Promotion) Plan(flagID uuid.UUID, flagKey, flagType string, source, target *FlagValueState) {
+	change := FlagValueChange{
+		FlagID:  flagID,
+		FlagKey: flagKey,
+		Source:  source,
+		Target:  target,
+	}
+
+	switch {
+	case source == nil:
+		change.Action = PromoteActionSkip
+		change.Conflict = PromoteConflictNoSourceValue
+	case !ValidFlagValue(flagType, source.Value):
+		change.Action = PromoteActionSkip
+		change.Conflict = PromoteConflictInvalidValue
+	case target == nil:
+		change.Action = PromoteActionCreate
+	case source.equal(target):
+		change.Action = PromoteActionUnchanged
+	default:
+		change.Action = PromoteActionUpdate
+		if target.UpdatedAt.After(source.UpdatedAt) {
+			change.Conflict = PromoteConflictTargetChanged
+		}
+	}
+
+	p.add(change)
+}
+
+// PlanMissing records a selected flag that isn't an active flag of the
+// project
+func (p *Promotion) PlanMissing(flagID uuid.UUID) {
+	p.add(FlagValueChange{
+		FlagID:   flagID,
+		Action:   PromoteActionSkip,
+		Conflict: PromoteConflictFlagNotFound,
+	})
+}
+
+func (p *Promotion) add(change FlagValueChange) {
+	switch {
+	case change.Conflict != "":
+		p.Conflicts++
+	case change.Action == PromoteActionCreate:
+		p.Created++
+	case change.Action == PromoteActionUpdate:
+		p.Updated++
+	case change.Action == PromoteActionUnchanged:
+		p.Unchanged++
+	}
+	p.Changes = append(p.Changes, change)
+}
+
+// HasInvalidValues reports whether a source value doesn't match its flag's
+// type
+func (p *Promotion) HasInvalidValues() bool {
+	for _, change := range p.Changes {
+		if change.Conflict == PromoteConflictInvalidValue {
+			return true
+		}
+	}
+	return false
+}
+
+// CanApply reports whether the planned changes may be written
+func (p *Promotion) CanApply() bool {
+	return !p.DryRun && !p.HasInvalidValues() && (p.Conflicts == 0 || p.Overwrite)
+}
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPromotionPlan(t *testing.T) {
+	earlier := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	state := func(value string, enabled bool, updatedAt time.Time) *FlagValueState {
+		return &FlagValueState{Value: value, Enabled: enabled, UpdatedAt: updatedAt}
+	}
+
+	tests := []struct {
+		name         string
+		flagType     string
+		source       *FlagValueState
+		target       *FlagValueState
+		wantAction   string
+		wantConflict string
+	}{
+		{name: "added", flagType: "boolean", source: state("true", true, earlier), target: nil, wantAction: PromoteActionCreate},
+		{name: "changed value", flagType: "string", source: state("blue", true, later), target: state("green", true, earlier), wantAction: PromoteActionUpdate},
+		{name: "changed state", flagType: "boolean", source: state("true", true, later), target: state("true", false, earlier), wantAction: PromoteActionUpdate},
+		{name: "unchanged", flagType: "number", source: state("42", true, earlier), target: state("42", true, later), wantAction: PromoteActionUnchanged},
+		{
+			name:         "target changed since",
+			flagType:     "string",
+			source:       state("blue", true, earlier),
+			target:       state("green", true, later),
+			wantAction:   PromoteActionUpdate,
+			wantConflict: PromoteConflictTargetChanged,
+		},
+		{name: "no source value", flagType: "boolean", source: nil, target: state("true", true, earlier), wantAction: PromoteActionSkip, wantConflict: PromoteConflictNoSourceValue},
+		{name: "source doesn't match type", flagType: "number", source: state("forty-two", true, later), target: nil, wantAction: PromoteActionSkip, wantConflict: PromoteConflictInvalidValue},
+		{name: "boolean source not a boolean", flagType: "boolean", source: state("yes", true, later), target: state("true", true, earlier), wantAction: PromoteActionSkip, wantConflict: PromoteConflictInvalidValue},
+		{name: "json source not JSON", flagType: "json", source: state("{", true, later), target: nil, wantAction: PromoteActionSkip, wantConflict: PromoteConflictInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Promotion
+			flagID := uuid.New()
+			p.Plan(flagID, "beta-banner", tt.flagType, tt.source, tt.target)
+
+			if len(p.Changes) != 1 {
+				t.Fatalf("planned %d changes, want 1", len(p.Changes))
+			}
+			change := p.Changes[0]
+			if change.FlagID != flagID || change.FlagKey != "beta-banner" {
+				t.Errorf("change is for %s %q", change.FlagID, change.FlagKey)
+			}
+			if change.Action != tt.wantAction || change.Conflict != tt.wantConflict {
+				t.Errorf("action = %q, conflict = %q; want %q, %q", change.Action, change.Conflict, tt.wantAction, tt.wantConflict)
+			}
+			if change.Copies() != (tt.wantAction == PromoteActionCreate || tt.wantAction == PromoteActionUpdate) {
+				t.Errorf("Copies() = %v for action %q", change.Copies(), change.Action)
+			}
+
+			// Each change counts once, conflicts before their action
+			counts := map[string]int{"created": p.Created, "updated": p.Updated, "unchanged": p.Unchanged, "conflicts": p.Conflicts}
+			want := map[string]int{"created": 0, "updated": 0, "unchanged": 0, "conflicts": 0}
+			switch {
+			case tt.wantConflict != "":
+				want["conflicts"] = 1
+			case tt.wantAction == PromoteActionCreate:
+				want["created"] = 1
+			case tt.wantAction == PromoteActionUpdate:
+				want["updated"] = 1
+			case tt.wantAction == PromoteActionUnchanged:
+				want["unchanged"] = 1
+			}
+			for name, n := range want {
+				if counts[name] != n {
+					t.Errorf("%s = %d, want %d", name, counts[name], n)
+				}
+			}
+		})
+	}
+}
+
+func TestPromotionPlanMissing(t *testing.T) {
+	var p Promotion
+	p.PlanMissing(uuid.New())
+
+	if len(p.Changes) != 1 || p.Changes[0].Action != PromoteActionSkip || p.Changes[0].Conflict != PromoteConflictFlagNotFound {
+		t.Errorf("changes = %+v, want a skipped flag that wasn't found", p.Changes)
+	}
+	if p.Conflicts != 1 {
+		t.Errorf("conflicts = %d, want 1", p.Conflicts)
+	}
+}
+
+func TestPromotionCanApply(t *testing.T) {
+	now := time.Now()
+	clean := func(p *Promotion) {
+		p.Plan(uuid.New(), "a", "boolean", &FlagValueState{Value: "true", UpdatedAt: now}, nil)
+	}
+	conflicting := func(p *Promotion) {
+		clean(p)
+		p.Plan(uuid.New(), "b", "boolean", nil, &FlagValueState{Value: "true", UpdatedAt: now})
+	}
+	invalid := func(p *Promotion) {
+		clean(p)
+		p.Plan(uuid.New(), "c", "number", &FlagValueState{Value: "NaN?", UpdatedAt: now}, nil)
+	}
+
+	tests := []struct {
+		name      string
+		plan      func(p *Promotion)
+		dryRun    bool
+		overwrite bool
+		want      bool
+	}{
+		{name: "no conflicts", plan: clean, want: true},
+		{name: "nothing to promote", plan: func(p *Promotion) {}, want: true},
+		{name: "dry run", plan: clean, dryRun: true, want: false},
+		{name: "conflicts", plan: conflicting, want: false},
+		{name: "conflicts overwritten", plan: conflicting, overwrite: true, want: true},
+		{name: "conflicts overwritten in a dry run", plan: conflicting, overwrite: true, dryRun: true, want: false},
+		{name: "invalid value", plan: invalid, want: false},
+		{name: "invalid value isn't overwritten", plan: invalid, overwrite: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Promotion{DryRun: tt.dryRun, Overwrite: tt.overwrite}
+			tt.plan(p)
+			if got := p.CanApply(); got != tt.want {
+				t.Errorf("CanApply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role is a named set of permissions assigned to users globally or within a
+// project. Built-in roles are seeded and can't be changed or deleted.
+type Role struct {
+	Name        string           `json:"name" db:"name"`
+	Description string           `json:"description" db:"description"`
+	BuiltIn     bool             `json:"built_in" db:"built_in"`
+	Permissions []RolePermission `json:"permissions"`
+	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// RolePermission grants a permission, optionally only outside production or
+// in the listed environments
+type RolePermission struct {
+	Permission     string      `json:"permission" db:"permission"`
+	NonProduction  bool        `json:"non_production" db:"non_production"`
+	EnvironmentIDs []uuid.UUID `json:"environment_ids" db:"environment_ids"`
+}
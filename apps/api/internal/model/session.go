@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons recorded when a session is revoked
+const (
+	SessionRevokedLogout        = "logout"
+	SessionRevokedReuseDetected = "reuse_detected"
+	SessionRevokedByAdmin       = "admin"
+	SessionRevokedUserInactive  = "user_inactive"
+	SessionRevokedPassword      = "password_changed"
+	SessionRevokedRoleChanged   = "role_changed"
+)
+
+// Session is a single login. Refresh tokens rotate within it, and revoking
+// it invalidates both its refresh tokens and the access tokens issued for it.
+type Session struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	UserAgent     string     `json:"user_agent" db:"user_agent"`
+	IPAddress     string     `json:"ip_address" db:"ip_address"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedReason *string    `json:"revoked_reason,omitempty" db:"revoked_reason"`
+}
+
+// IsActive reports whether the session can still be used at the given time
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is a single-use token; only a SHA-256 hash of it is stored
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	SessionID uuid.UUID  `json:"session_id" db:"session_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+// OIDCLoginState holds the secrets of an authorization-code login between
+// the redirect to the identity provider and its callback
+type OIDCLoginState struct {
+	State        string    `json:"state" db:"state"`
+	Nonce        string    `json:"-" db:"nonce"`
+	CodeVerifier string    `json:"-" db:"code_verifier"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
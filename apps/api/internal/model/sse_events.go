@@ -18,21 +18,27 @@ type SSEEvent struct {
 type ProjectEvent struct {
 	ProjectID uuid.UUID `json:"project_id"`
 	Name      string    `json:"name"`
+	Version   int       `json:"version"`
 }
 
 // EnvironmentEvent represents an environment-related event payload
 type EnvironmentEvent struct {
 	EnvironmentID uuid.UUID `json:"environment_id"`
 	ProjectID     uuid.UUID `json:"project_id"`
+	Key           string    `json:"key"`
 	Name          string    `json:"name"`
+	Version       int       `json:"version"`
 }
 
 // FlagEvent represents a flag-related event payload
 type FlagEvent struct {
-	FlagID    uuid.UUID `json:"flag_id"`
-	ProjectID uuid.UUID `json:"project_id"`
-	Name      string    `json:"name"`
-	Key       string    `json:"key"`
+	FlagID    uuid.UUID  `json:"flag_id"`
+	ProjectID uuid.UUID  `json:"project_id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	Tags      []string   `json:"tags"`
+	Owner     *FlagOwner `json:"owner,omitempty"`
+	Version   int        `json:"version"`
 }
 
 // FlagValueEvent represents a flag value-related event payload
@@ -40,4 +46,5 @@ type FlagValueEvent struct {
 	FlagValueID  uuid.UUID `json:"flag_value_id"`
 	FlagID       uuid.UUID `json:"flag_id"`
 	EnvironmentID uuid.UUID `json:"environment_id"`
+	Version      int       `json:"version"`
 }
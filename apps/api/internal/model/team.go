@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles within a team. Maintainers manage the team's details and members.
+const (
+	TeamRoleMember     = "member"
+	TeamRoleMaintainer = "maintainer"
+)
+
+// Team groups users within an organisation so project roles and flag
+// ownership can be given to all of them at once
+type Team struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	MemberCount    int       `json:"member_count" db:"member_count"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TeamMember is a user's membership of a team
+type TeamMember struct {
+	TeamID    uuid.UUID `json:"team_id" db:"team_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Role      string    `json:"role" db:"role"`
+	Username  string    `json:"username" db:"username"`
+	Email     string    `json:"email" db:"email"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ProjectTeam grants every member of a team a role within one project
+type ProjectTeam struct {
+	ProjectID uuid.UUID `json:"project_id" db:"project_id"`
+	TeamID    uuid.UUID `json:"team_id" db:"team_id"`
+	Role      string    `json:"role" db:"role"`
+	TeamName  string    `json:"team_name" db:"team_name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
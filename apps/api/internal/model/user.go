@@ -16,23 +16,55 @@ type User struct {
 	FirstName string    `json:"first_name" db:"first_name"`
 	LastName  string    `json:"last_name" db:"last_name"`
 	Active    bool      `json:"active" db:"active"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// EmailVerified is set once the user follows a verification link, and
+	// cleared when their address changes
+	EmailVerified bool `json:"email_verified" db:"email_verified"`
+	// AuthProvider is how the user signs in; ExternalID is their subject at
+	// that provider and is nil for password users
+	AuthProvider string  `json:"auth_provider" db:"auth_provider"`
+	ExternalID   *string `json:"-" db:"external_id"`
+	// MFASecret is the TOTP secret, set once enrolment starts; MFAEnabled is
+	// set when the user confirms their first code
+	MFASecret  *string `json:"-" db:"mfa_secret"`
+	MFAEnabled bool    `json:"mfa_enabled" db:"mfa_enabled"`
+	// AccountType tells people from service accounts, which can't sign in
+	// and authenticate only with access tokens
+	AccountType    string    `json:"account_type" db:"account_type"`
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Authentication providers
+const (
+	AuthProviderPassword = "password"
+	AuthProviderOIDC     = "oidc"
+	// Service accounts have no way to sign in
+	AuthProviderNone = "none"
+)
 
+// Account types, matching the principal types of the auth middleware
+const (
+	AccountTypeUser           = "user"
+	AccountTypeServiceAccount = "service_account"
+)
 
 // ToResponse converts User model to UserResponse (without password)
 func (u *User) ToResponse() dto.UserResponse {
 	return dto.UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		Role:      u.Role,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Active:    u.Active,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:             u.ID,
+		Username:       u.Username,
+		Email:          u.Email,
+		Role:           u.Role,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+		Active:         u.Active,
+		EmailVerified:  u.EmailVerified,
+		AuthProvider:   u.AuthProvider,
+		MFAEnabled:     u.MFAEnabled,
+		AccountType:    u.AccountType,
+		OrganizationID: u.OrganizationID,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
 	}
 }
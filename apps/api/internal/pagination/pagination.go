@@ -0,0 +1,114 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = errors.New("limit must be a number between 1 and 200")
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidFilter = errors.New("invalid filter value")
+)
+
+// Params holds the pagination, sorting, search and filter options of a list request
+type Params struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Desc    bool
+	Search  string
+	Filters map[string]string
+}
+
+// Page is the response envelope returned by list endpoints
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// cursor is the decoded form of the opaque cursor handed out to clients.
+// It records the sort it was issued for so it cannot be reused with another.
+type cursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// FromRequest builds Params from the query string of a list request.
+// Only the named filters are read; any other query parameter is ignored.
+//
+//	?limit=20&cursor=...&sort=-created_at&q=beta&type=boolean
+func FromRequest(c *fiber.Ctx, filters ...string) (Params, error) {
+	params := Params{
+		Limit:   DefaultLimit,
+		Cursor:  c.Query("cursor"),
+		Search:  strings.TrimSpace(c.Query("q")),
+		Filters: make(map[string]string),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Params{}, ErrInvalidLimit
+		}
+		params.Limit = n
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		params.Sort = strings.TrimPrefix(sort, "-")
+		params.Desc = strings.HasPrefix(sort, "-")
+	}
+
+	for _, name := range filters {
+		if value := c.Query(name); value != "" {
+			params.Filters[name] = value
+		}
+	}
+
+	return params, nil
+}
+
+// Filter returns the value of a filter, or an empty string if unset
+func (p Params) Filter(name string) string {
+	return p.Filters[name]
+}
+
+// IsInvalidRequest reports whether err was caused by bad pagination input
+func IsInvalidRequest(err error) bool {
+	return errors.Is(err, ErrInvalidCursor) ||
+		errors.Is(err, ErrInvalidLimit) ||
+		errors.Is(err, ErrInvalidSort) ||
+		errors.Is(err, ErrInvalidFilter)
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
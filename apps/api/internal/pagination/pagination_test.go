@@ -0,0 +1,123 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{name: "ascending", cursor: cursor{Sort: "name", Value: "beta-banner", ID: uuid.New()}},
+		{name: "descending", cursor: cursor{Sort: "-created_at", Value: "2024-05-01T10:00:00.123456Z", ID: uuid.New()}},
+		{name: "empty value", cursor: cursor{Sort: "key", Value: "", ID: uuid.New()}},
+		{name: "value needing escapes", cursor: cursor{Sort: "name", Value: `a "quoted" name/with+symbols & ünicode`, ID: uuid.New()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+			if _, err := base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				t.Errorf("cursor %q is not URL-safe base64: %v", encoded, err)
+			}
+
+			decoded, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if *decoded != tt.cursor {
+				t.Errorf("decoded %+v, want %+v", *decoded, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "not a cursor!"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"s":"name","v":"a"}`))},
+		{name: "not JSON", cursor: base64.RawURLEncoding.EncodeToString([]byte("name|value"))},
+		{name: "invalid ID", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":"a","id":"not-a-uuid"}`))},
+		{name: "wrong value type", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":42}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    Params
+		wantErr error
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  Params{Limit: DefaultLimit, Filters: map[string]string{}},
+		},
+		{
+			name:  "all options",
+			query: "?limit=20&cursor=abc&sort=-created_at&q=%20beta%20&type=boolean&owner=ignored",
+			want: Params{
+				Limit:   20,
+				Cursor:  "abc",
+				Sort:    "created_at",
+				Desc:    true,
+				Search:  "beta",
+				Filters: map[string]string{"type": "boolean"},
+			},
+		},
+		{
+			name:  "ascending sort",
+			query: "?sort=name",
+			want:  Params{Limit: DefaultLimit, Sort: "name", Filters: map[string]string{}},
+		},
+		{
+			name:  "empty filter",
+			query: "?type=",
+			want:  Params{Limit: DefaultLimit, Filters: map[string]string{}},
+		},
+		{name: "limit at maximum", query: "?limit=200", want: Params{Limit: MaxLimit, Filters: map[string]string{}}},
+		{name: "zero limit", query: "?limit=0", wantErr: ErrInvalidLimit},
+		{name: "limit above maximum", query: "?limit=201", wantErr: ErrInvalidLimit},
+		{name: "limit not a number", query: "?limit=ten", wantErr: ErrInvalidLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				params, err := FromRequest(c, "type")
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FromRequest error = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && !reflect.DeepEqual(params, tt.want) {
+					t.Errorf("FromRequest = %+v, want %+v", params, tt.want)
+				}
+				return nil
+			})
+
+			if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/"+tt.query, nil)); err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+		})
+	}
+}
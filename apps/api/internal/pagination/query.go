@@ -0,0 +1,154 @@
+package pagination
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SortField maps a public sort name to its SQL column
+type SortField struct {
+	Column string
+	// Cast is the Postgres type the cursor value is cast to, e.g. "timestamptz"
+	Cast string
+}
+
+// Sortable describes the sort fields a list query supports
+type Sortable struct {
+	Fields  map[string]SortField
+	Default string
+	// DefaultDesc applies when the request doesn't specify a sort
+	DefaultDesc bool
+}
+
+// Query accumulates the WHERE conditions and positional arguments of a list query
+type Query struct {
+	conditions []string
+	args       []interface{}
+}
+
+// Arg appends a positional argument and returns its placeholder
+func (q *Query) Arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// Where adds a condition; use Arg to obtain placeholders for its values
+func (q *Query) Where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// Search adds a case-insensitive substring match over the given columns
+func (q *Query) Search(term string, columns ...string) {
+	if term == "" || len(columns) == 0 {
+		return
+	}
+
+	placeholder := q.Arg("%" + escapeLike(term) + "%")
+	matches := make([]string, len(columns))
+	for i, column := range columns {
+		matches[i] = fmt.Sprintf("%s ILIKE %s", column, placeholder)
+	}
+	q.Where("(" + strings.Join(matches, " OR ") + ")")
+}
+
+// Args returns the positional arguments collected so far
+func (q *Query) Args() []interface{} {
+	return q.args
+}
+
+// WhereClause renders the collected conditions, or an empty string if there are none
+func (q *Query) WhereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// Clone returns a copy of the query that can be extended independently
+func (q *Query) Clone() *Query {
+	return &Query{
+		conditions: append([]string(nil), q.conditions...),
+		args:       append([]interface{}(nil), q.args...),
+	}
+}
+
+// Paginate resolves the requested sort, adds the keyset condition for the
+// cursor, and returns the ORDER BY/LIMIT suffix for the page query.
+// One extra row is fetched so NewPage can tell whether another page exists.
+func (q *Query) Paginate(params Params, sortable Sortable) (string, error) {
+	sortName, desc := params.Sort, params.Desc
+	if sortName == "" {
+		sortName, desc = sortable.Default, sortable.DefaultDesc
+	}
+
+	field, ok := sortable.Fields[sortName]
+	if !ok {
+		return "", ErrInvalidSort
+	}
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return "", err
+		}
+		if c.Sort != sortKey(sortName, desc) {
+			return "", ErrInvalidCursor
+		}
+		q.Where(fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			field.Column, comparison, q.Arg(c.Value), field.Cast, q.Arg(c.ID)))
+	}
+
+	return fmt.Sprintf("ORDER BY %s %s, id %s LIMIT %d",
+		field.Column, direction, direction, limit(params)+1), nil
+}
+
+// NewPage trims the extra row fetched by Paginate and derives the next cursor
+// from the last item. key returns the item's sort value and ID.
+func NewPage[T any](items []T, total int, params Params, sortable Sortable, key func(item T, sort string) (string, uuid.UUID)) *Page[T] {
+	sortName, desc := params.Sort, params.Desc
+	if sortName == "" {
+		sortName, desc = sortable.Default, sortable.DefaultDesc
+	}
+
+	page := &Page[T]{Items: items, Total: total}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	if n := limit(params); len(page.Items) > n {
+		page.Items = page.Items[:n]
+		value, id := key(page.Items[n-1], sortName)
+		page.NextCursor = encodeCursor(cursor{
+			Sort:  sortKey(sortName, desc),
+			Value: value,
+			ID:    id,
+		})
+	}
+
+	return page
+}
+
+func limit(params Params) int {
+	if params.Limit < 1 || params.Limit > MaxLimit {
+		return DefaultLimit
+	}
+	return params.Limit
+}
+
+func sortKey(name string, desc bool) string {
+	if desc {
+		return "-" + name
+	}
+	return name
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,187 @@
+package pagination
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var testSortable = Sortable{
+	Fields: map[string]SortField{
+		"name":       {Column: "name", Cast: "text"},
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
+}
+
+type item struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func itemKey(i item, sort string) (string, uuid.UUID) {
+	return i.Name, i.ID
+}
+
+func items(n int) []item {
+	all := make([]item, n)
+	for i := range all {
+		all[i] = item{ID: uuid.New(), Name: string(rune('a' + i))}
+	}
+	return all
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    Params
+		wantOrder string
+		wantWhere string
+	}{
+		{
+			name:      "default sort",
+			params:    Params{Limit: 10},
+			wantOrder: "ORDER BY created_at DESC, id DESC LIMIT 11",
+		},
+		{
+			name:      "ascending sort",
+			params:    Params{Limit: 10, Sort: "name"},
+			wantOrder: "ORDER BY name ASC, id ASC LIMIT 11",
+		},
+		{
+			name:      "limit out of range",
+			params:    Params{Limit: 1000, Sort: "name"},
+			wantOrder: "ORDER BY name ASC, id ASC LIMIT 51",
+		},
+		{
+			name:      "ascending cursor",
+			params:    Params{Limit: 10, Sort: "name", Cursor: encodeCursor(cursor{Sort: "name", Value: "m", ID: uuid.New()})},
+			wantOrder: "ORDER BY name ASC, id ASC LIMIT 11",
+			wantWhere: "WHERE (name, id) > ($1::text, $2)",
+		},
+		{
+			name:      "descending cursor",
+			params:    Params{Limit: 10, Sort: "created_at", Desc: true, Cursor: encodeCursor(cursor{Sort: "-created_at", Value: "2024-05-01T10:00:00Z", ID: uuid.New()})},
+			wantOrder: "ORDER BY created_at DESC, id DESC LIMIT 11",
+			wantWhere: "WHERE (created_at, id) < ($1::timestamptz, $2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+			order, err := q.Paginate(tt.params, testSortable)
+			if err != nil {
+				t.Fatalf("Paginate: %v", err)
+			}
+			if order != tt.wantOrder {
+				t.Errorf("order = %q, want %q", order, tt.wantOrder)
+			}
+			if where := q.WhereClause(); where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+		})
+	}
+}
+
+func TestPaginateRejects(t *testing.T) {
+	nameCursor := encodeCursor(cursor{Sort: "name", Value: "m", ID: uuid.New()})
+
+	tests := []struct {
+		name   string
+		params Params
+		want   error
+	}{
+		{name: "unknown sort", params: Params{Sort: "password_hash"}, want: ErrInvalidSort},
+		{name: "malformed cursor", params: Params{Sort: "name", Cursor: "%%%"}, want: ErrInvalidCursor},
+		{name: "cursor for another sort", params: Params{Sort: "created_at", Cursor: nameCursor}, want: ErrInvalidCursor},
+		{name: "cursor for another direction", params: Params{Sort: "name", Desc: true, Cursor: nameCursor}, want: ErrInvalidCursor},
+		{name: "cursor for an explicit sort with the default", params: Params{Cursor: nameCursor}, want: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q Query
+			if _, err := q.Paginate(tt.params, testSortable); !errors.Is(err, tt.want) {
+				t.Errorf("Paginate error = %v, want %v", err, tt.want)
+			}
+			if !IsInvalidRequest(tt.want) {
+				t.Errorf("IsInvalidRequest(%v) = false", tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	all := items(4)
+
+	tests := []struct {
+		name       string
+		fetched    []item
+		params     Params
+		wantItems  []item
+		wantCursor *cursor
+	}{
+		{name: "nothing fetched", fetched: nil, params: Params{Limit: 3}, wantItems: []item{}},
+		{name: "last page", fetched: all[:3], params: Params{Limit: 3}, wantItems: all[:3]},
+		{
+			name:       "more pages",
+			fetched:    all,
+			params:     Params{Limit: 3, Sort: "name"},
+			wantItems:  all[:3],
+			wantCursor: &cursor{Sort: "name", Value: all[2].Name, ID: all[2].ID},
+		},
+		{
+			name:       "default sort",
+			fetched:    all,
+			params:     Params{Limit: 3},
+			wantItems:  all[:3],
+			wantCursor: &cursor{Sort: "-created_at", Value: all[2].Name, ID: all[2].ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := NewPage(tt.fetched, 10, tt.params, testSortable, itemKey)
+			if !reflect.DeepEqual(page.Items, tt.wantItems) {
+				t.Errorf("items = %v, want %v", page.Items, tt.wantItems)
+			}
+			if page.Total != 10 {
+				t.Errorf("total = %d, want 10", page.Total)
+			}
+
+			if tt.wantCursor == nil {
+				if page.NextCursor != "" {
+					t.Errorf("next cursor = %q, want none", page.NextCursor)
+				}
+				return
+			}
+			next, err := decodeCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if *next != *tt.wantCursor {
+				t.Errorf("next cursor = %+v, want %+v", *next, *tt.wantCursor)
+			}
+		})
+	}
+}
+
+// The cursor a page hands out continues the same listing
+func TestNewPageCursorContinuesListing(t *testing.T) {
+	params := Params{Limit: 2, Sort: "name"}
+	all := items(3)
+	page := NewPage(all, len(all), params, testSortable, itemKey)
+
+	params.Cursor = page.NextCursor
+	var q Query
+	if _, err := q.Paginate(params, testSortable); err != nil {
+		t.Fatalf("Paginate with the next cursor: %v", err)
+	}
+	if args := q.Args(); len(args) != 2 || args[0] != all[1].Name || args[1] != all[1].ID {
+		t.Errorf("keyset arguments = %v, want the last item's name and ID", args)
+	}
+}
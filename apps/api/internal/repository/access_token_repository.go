@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type accessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAccessTokenRepository(db *sql.DB) AccessTokenRepository {
+	return &accessTokenRepository{db: db}
+}
+
+const accessTokenColumns = `
+	id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+`
+
+func scanAccessToken(row rowScanner) (*model.AccessToken, error) {
+	token := &model.AccessToken{}
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash,
+		pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *accessTokenRepository) Create(ctx context.Context, token *model.AccessToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO access_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query,
+		token.ID, token.UserID, token.Name, token.Prefix, token.TokenHash,
+		pq.Array(token.Scopes), token.ExpiresAt,
+	).Scan(&token.CreatedAt)
+}
+
+// GetByHash returns the token with a hash, or nil if there is none
+func (r *accessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + ` FROM access_tokens WHERE token_hash = $1`
+	return scanAccessToken(conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash))
+}
+
+// ListForUser returns a user's tokens, newest first
+func (r *accessTokenRepository) ListForUser(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error) {
+	query := `SELECT ` + accessTokenColumns + ` FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []model.AccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke revokes one of a user's tokens, returning whether an active token
+// was revoked
+func (r *accessTokenRepository) Revoke(ctx context.Context, userID, tokenID uuid.UUID) (bool, error) {
+	query := `UPDATE access_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// Touch records that a token was used. It writes at most once a minute per
+// token so busy pipelines don't cause a write per request.
+func (r *accessTokenRepository) Touch(ctx context.Context, tokenID uuid.UUID) error {
+	query := `
+		UPDATE access_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, tokenID)
+	return err
+}
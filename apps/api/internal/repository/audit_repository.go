@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+var auditSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// Record appends an event to the audit trail. Events without an
+// organisation belong to the context's, if it has one.
+func (r *auditRepository) Record(ctx context.Context, event *model.AuditEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OrganizationID == nil {
+		if org, ok := tenant.FromContext(ctx); ok {
+			event.OrganizationID = &org.ID
+		}
+	}
+	if event.Metadata == nil {
+		event.Metadata = map[string]interface{}{}
+	}
+
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_events (id, organization_id, actor_id, actor_type, actor_token_id, action, target_type, target_id, ip_address, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query,
+		event.ID, event.OrganizationID, event.ActorID, event.ActorType, event.ActorTokenID, event.Action,
+		event.TargetType, event.TargetID, event.IPAddress, metadata,
+	).Scan(&event.CreatedAt)
+}
+
+// List returns a page of the organisation's events, newest first by
+// default, filtered by the action, actor_id, actor_type, target_type and
+// target_id filters. The host organisation also sees events outside any
+// organisation.
+func (r *auditRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.AuditEvent], error) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoOrganization
+	}
+
+	q := &pagination.Query{}
+	if org.Host {
+		q.Where("(organization_id = " + q.Arg(org.ID) + " OR organization_id IS NULL)")
+	} else {
+		q.Where("organization_id = " + q.Arg(org.ID))
+	}
+	if action := params.Filter("action"); action != "" {
+		q.Where("action = " + q.Arg(action))
+	}
+	if actorID := params.Filter("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("actor_id = " + q.Arg(id))
+	}
+	if actorType := params.Filter("actor_type"); actorType != "" {
+		q.Where("actor_type = " + q.Arg(actorType))
+	}
+	if targetType := params.Filter("target_type"); targetType != "" {
+		q.Where("target_type = " + q.Arg(targetType))
+	}
+	if targetID := params.Filter("target_id"); targetID != "" {
+		q.Where("target_id = " + q.Arg(targetID))
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM audit_events ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, auditSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, organization_id, actor_id, actor_type, actor_token_id, action, target_type, target_id, ip_address, metadata, created_at
+		FROM audit_events
+		` + q.WhereClause() + `
+		` + suffix
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.AuditEvent
+	for rows.Next() {
+		var event model.AuditEvent
+		var metadata []byte
+		err := rows.Scan(
+			&event.ID, &event.OrganizationID, &event.ActorID, &event.ActorType, &event.ActorTokenID, &event.Action, &event.TargetType,
+			&event.TargetID, &event.IPAddress, &metadata, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(events, total, params, auditSorts, func(e model.AuditEvent, sort string) (string, uuid.UUID) {
+		return e.CreatedAt.Format(time.RFC3339Nano), e.ID
+	}), nil
+}
@@ -3,10 +3,12 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"strconv"
 	"time"
 
 	"api/internal/dto"
 	"api/internal/model"
+	"api/internal/pagination"
 
 	"github.com/google/uuid"
 )
@@ -19,51 +21,140 @@ func NewEnvironmentRepository(db *sql.DB) EnvironmentRepository {
 	return &environmentRepository{db: db}
 }
 
+const environmentColumns = `id, project_id, key, name, sort_order, color, production, new_flags_enabled, version, created_at, updated_at`
+
+func scanEnvironment(row rowScanner) (*model.Environment, error) {
+	env := &model.Environment{}
+	err := row.Scan(
+		&env.ID,
+		&env.ProjectID,
+		&env.Key,
+		&env.Name,
+		&env.SortOrder,
+		&env.Color,
+		&env.Production,
+		&env.NewFlagsEnabled,
+		&env.Version,
+		&env.CreatedAt,
+		&env.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Create creates an environment in a project of the context's organisation
 func (r *environmentRepository) Create(ctx context.Context, env *model.Environment) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return insertEnvironment(ctx, conn(ctx, r.db), env, orgID)
+}
+
+// insertEnvironment inserts an environment into a project of an
+// organisation
+func insertEnvironment(ctx context.Context, tx DBTX, env *model.Environment, orgID uuid.UUID) error {
 	query := `
-		INSERT INTO environments (id, project_id, name, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-	
+		INSERT INTO environments (id, project_id, key, name, sort_order, color, production, new_flags_enabled, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+		WHERE ` + inOrganization("$2::uuid", "$11")
+
 	now := time.Now()
 	env.ID = uuid.New()
+	env.Version = 1
 	env.CreatedAt = now
 	env.UpdatedAt = now
-	
-	_, err := r.db.ExecContext(ctx, query, env.ID, env.ProjectID, env.Name, env.CreatedAt, env.UpdatedAt)
-	return err
+
+	return insertedInOrganization(tx.ExecContext(ctx, query, env.ID, env.ProjectID, env.Key, env.Name, env.SortOrder,
+		env.Color, env.Production, env.NewFlagsEnabled, env.CreatedAt, env.UpdatedAt, orgID))
 }
 
 func (r *environmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Environment, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, project_id, name, created_at, updated_at
+		SELECT ` + environmentColumns + `
 		FROM environments
-		WHERE id = $1
-	`
-	
-	var env model.Environment
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&env.ID,
-		&env.ProjectID,
-		&env.Name,
-		&env.CreatedAt,
-		&env.UpdatedAt,
-	)
+		WHERE id = $1 AND ` + inOrganization("project_id", "$2")
 	
+	env, err := scanEnvironment(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return &env, err
+	return env, err
 }
 
-func (r *environmentRepository) GetAll(ctx context.Context) ([]model.Environment, error) {
+// GetByKey returns the environment of a project with a key, or nil if there
+// is none
+func (r *environmentRepository) GetByKey(ctx context.Context, projectID uuid.UUID, key string) (*model.Environment, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, project_id, name, created_at, updated_at
+		SELECT ` + environmentColumns + `
 		FROM environments
-		ORDER BY created_at DESC
-	`
-	
-	rows, err := r.db.QueryContext(ctx, query)
+		WHERE project_id = $1 AND key = $2 AND ` + inOrganization("project_id", "$3")
+
+	env, err := scanEnvironment(conn(ctx, r.db).QueryRowContext(ctx, query, projectID, key, orgID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return env, err
+}
+
+var environmentSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+		"updated_at": {Column: "updated_at", Cast: "timestamptz"},
+		"name":       {Column: "name", Cast: "text"},
+		"sort_order": {Column: "sort_order", Cast: "integer"},
+	},
+	Default: "sort_order",
+}
+
+func (r *environmentRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Environment], error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &pagination.Query{}
+	q.Where(inOrganization("project_id", q.Arg(orgID)))
+	if projectID := params.Filter("project_id"); projectID != "" {
+		id, err := uuid.Parse(projectID)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("project_id = " + q.Arg(id))
+	}
+	q.Search(params.Search, "name", "key")
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM environments ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, environmentSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + environmentColumns + `
+		FROM environments
+		` + q.WhereClause() + `
+		` + suffix
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,32 +162,44 @@ func (r *environmentRepository) GetAll(ctx context.Context) ([]model.Environment
 	
 	var envs []model.Environment
 	for rows.Next() {
-		var env model.Environment
-		err := rows.Scan(
-			&env.ID,
-			&env.ProjectID,
-			&env.Name,
-			&env.CreatedAt,
-			&env.UpdatedAt,
-		)
+		env, err := scanEnvironment(rows)
 		if err != nil {
 			return nil, err
 		}
-		envs = append(envs, env)
+		envs = append(envs, *env)
 	}
-	
-	return envs, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(envs, total, params, environmentSorts, func(e model.Environment, sort string) (string, uuid.UUID) {
+		switch sort {
+		case "name":
+			return e.Name, e.ID
+		case "updated_at":
+			return e.UpdatedAt.Format(time.RFC3339Nano), e.ID
+		case "sort_order":
+			return strconv.Itoa(e.SortOrder), e.ID
+		default:
+			return e.CreatedAt.Format(time.RFC3339Nano), e.ID
+		}
+	}), nil
 }
 
 func (r *environmentRepository) GetByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.Environment, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, project_id, name, created_at, updated_at
+		SELECT ` + environmentColumns + `
 		FROM environments
-		WHERE project_id = $1
-		ORDER BY created_at DESC
+		WHERE project_id = $1 AND ` + inOrganization("project_id", "$2") + `
+		ORDER BY sort_order, name
 	`
 	
-	rows, err := r.db.QueryContext(ctx, query, projectID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,52 +207,53 @@ func (r *environmentRepository) GetByProjectID(ctx context.Context, projectID uu
 	
 	var envs []model.Environment
 	for rows.Next() {
-		var env model.Environment
-		err := rows.Scan(
-			&env.ID,
-			&env.ProjectID,
-			&env.Name,
-			&env.CreatedAt,
-			&env.UpdatedAt,
-		)
+		env, err := scanEnvironment(rows)
 		if err != nil {
 			return nil, err
 		}
-		envs = append(envs, env)
+		envs = append(envs, *env)
 	}
 	
 	return envs, nil
 }
 
+// Update changes an environment if it is still at the version the request
+// names, if any, and returns nil if it isn't or there is no such environment
 func (r *environmentRepository) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateEnvironmentRequest) (*model.Environment, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		UPDATE environments
 		SET name = COALESCE($1, name),
-			updated_at = $2
-		WHERE id = $3
-		RETURNING id, project_id, name, created_at, updated_at
-	`
+			production = COALESCE($2, production),
+			sort_order = COALESCE($3, sort_order),
+			color = COALESCE($4, color),
+			new_flags_enabled = COALESCE($5, new_flags_enabled),
+			version = version + 1,
+			updated_at = $6
+		WHERE id = $7 AND ` + inOrganization("project_id", "$8") + ` AND ($9::int IS NULL OR version = $9)
+		RETURNING ` + environmentColumns
 	
-	var env model.Environment
 	now := time.Now()
 	
-	err := r.db.QueryRowContext(ctx, query, 
-		req.Name, now, id).Scan(
-		&env.ID,
-		&env.ProjectID,
-		&env.Name,
-		&env.CreatedAt,
-		&env.UpdatedAt,
-	)
-	
+	env, err := scanEnvironment(conn(ctx, r.db).QueryRowContext(ctx, query, 
+		req.Name, req.Production, req.SortOrder, req.Color, req.NewFlagsEnabled, now, id, orgID, req.Version))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return &env, err
+	return env, err
 }
 
 func (r *environmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM environments WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM environments WHERE id = $1 AND ` + inOrganization("project_id", "$2")
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
 	return err
 }
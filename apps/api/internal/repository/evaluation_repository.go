@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type evaluationRepository struct {
+	db *sql.DB
+}
+
+func NewEvaluationRepository(db *sql.DB) EvaluationRepository {
+	return &evaluationRepository{db: db}
+}
+
+// Increment adds the given counts to their buckets and advances the
+// last-evaluated timestamp of each flag. Counts for flags or environments
+// that have since been deleted are dropped. The counts come from requests
+// already authorised for their environment, so the write isn't scoped to
+// an organisation; the recorder flushes them in the background.
+func (r *evaluationRepository) Increment(ctx context.Context, counts []model.EvaluationCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	flagIDs := make([]uuid.UUID, len(counts))
+	envIDs := make([]uuid.UUID, len(counts))
+	values := make([]string, len(counts))
+	buckets := make([]time.Time, len(counts))
+	totals := make([]int64, len(counts))
+	lastEvaluated := make([]time.Time, len(counts))
+	for i, c := range counts {
+		flagIDs[i] = c.FlagID
+		envIDs[i] = c.EnvID
+		values[i] = c.Value
+		buckets[i] = c.BucketStart
+		totals[i] = c.Count
+		lastEvaluated[i] = c.LastEvaluatedAt
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO flag_evaluations (flag_id, env_id, value, bucket_start, count, last_evaluated_at)
+		SELECT u.flag_id, u.env_id, u.value, u.bucket_start, u.count, u.last_evaluated_at
+		FROM unnest($1::uuid[], $2::uuid[], $3::text[], $4::timestamptz[], $5::bigint[], $6::timestamptz[])
+			AS u(flag_id, env_id, value, bucket_start, count, last_evaluated_at)
+		JOIN flags f ON f.id = u.flag_id
+		JOIN environments e ON e.id = u.env_id
+		ON CONFLICT (flag_id, env_id, value, bucket_start) DO UPDATE SET
+			count = flag_evaluations.count + EXCLUDED.count,
+			last_evaluated_at = GREATEST(flag_evaluations.last_evaluated_at, EXCLUDED.last_evaluated_at)
+	`, pq.Array(flagIDs), pq.Array(envIDs), pq.Array(values), pq.Array(buckets), pq.Array(totals), pq.Array(lastEvaluated))
+	if err != nil {
+		return err
+	}
+
+	// updated_at is left alone: evaluations are not changes to the flag
+	_, err = tx.ExecContext(ctx, `
+		UPDATE flags f
+		SET last_evaluated_at = GREATEST(f.last_evaluated_at, u.last_evaluated_at)
+		FROM (
+			SELECT flag_id, MAX(last_evaluated_at) AS last_evaluated_at
+			FROM unnest($1::uuid[], $2::timestamptz[]) AS u(flag_id, last_evaluated_at)
+			GROUP BY flag_id
+		) u
+		WHERE f.id = u.flag_id
+	`, pq.Array(flagIDs), pq.Array(lastEvaluated))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByFlagID returns the evaluation counts of a flag since the given time,
+// grouped into buckets of the given Postgres date_trunc unit (hour or day)
+func (r *evaluationRepository) GetByFlagID(ctx context.Context, flagID uuid.UUID, since time.Time, unit string) ([]model.EvaluationCount, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT env_id, value, date_trunc($3, bucket_start) AS bucket, SUM(count), MAX(last_evaluated_at)
+		FROM flag_evaluations
+		WHERE flag_id = $1 AND bucket_start >= $2 AND ` + flagInOrganization("flag_id", "$4") + `
+		GROUP BY env_id, value, bucket
+		ORDER BY env_id, bucket ASC, value
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, flagID, since, unit, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []model.EvaluationCount
+	for rows.Next() {
+		count := model.EvaluationCount{FlagID: flagID}
+		err := rows.Scan(
+			&count.EnvID,
+			&count.Value,
+			&count.BucketStart,
+			&count.Count,
+			&count.LastEvaluatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetLastEvaluatedByEnv returns when a flag was last evaluated in each environment
+func (r *evaluationRepository) GetLastEvaluatedByEnv(ctx context.Context, flagID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT env_id, MAX(last_evaluated_at)
+		FROM flag_evaluations
+		WHERE flag_id = $1 AND ` + flagInOrganization("flag_id", "$2") + `
+		GROUP BY env_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, flagID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastEvaluated := make(map[uuid.UUID]time.Time)
+	for rows.Next() {
+		var envID uuid.UUID
+		var at time.Time
+		if err := rows.Scan(&envID, &at); err != nil {
+			return nil, err
+		}
+		lastEvaluated[envID] = at
+	}
+
+	return lastEvaluated, rows.Err()
+}
@@ -3,12 +3,15 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"api/internal/dto"
 	"api/internal/model"
+	"api/internal/pagination"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type flagRepository struct {
@@ -19,38 +22,171 @@ func NewFlagRepository(db *sql.DB) FlagRepository {
 	return &flagRepository{db: db}
 }
 
+// flagColumns is the select list shared by every flag query. Tags are
+// aggregated in a subquery so a page of flags still loads in one round-trip.
+const flagColumns = `
+	flags.id, flags.project_id, flags.key, flags.description, flags.type, flags.default_value,
+	flags.owner_type, flags.owner_id,
+	flags.kind, flags.status, flags.removal_date, flags.archived_at, flags.last_evaluated_at,
+	ARRAY(
+		SELECT t.name FROM flag_tags ft JOIN tags t ON t.id = ft.tag_id
+		WHERE ft.flag_id = flags.id ORDER BY t.name
+	),
+	flags.version, flags.created_at, flags.updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFlag scans the columns of flagColumns, followed by any extra columns
+// the query selects after them
+func scanFlag(row rowScanner, flag *model.Flag, extra ...interface{}) error {
+	var ownerType sql.NullString
+	var ownerID uuid.NullUUID
+	var removalDate, archivedAt, lastEvaluatedAt sql.NullTime
+	var tags []string
+
+	dest := []interface{}{
+		&flag.ID,
+		&flag.ProjectID,
+		&flag.Key,
+		&flag.Description,
+		&flag.Type,
+		&flag.DefaultValue,
+		&ownerType,
+		&ownerID,
+		&flag.Kind,
+		&flag.Status,
+		&removalDate,
+		&archivedAt,
+		&lastEvaluatedAt,
+		pq.Array(&tags),
+		&flag.Version,
+		&flag.CreatedAt,
+		&flag.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	flag.RemovalDate = nil
+	if removalDate.Valid {
+		flag.RemovalDate = &removalDate.Time
+	}
+	flag.ArchivedAt = nil
+	if archivedAt.Valid {
+		flag.ArchivedAt = &archivedAt.Time
+	}
+	flag.LastEvaluatedAt = nil
+	if lastEvaluatedAt.Valid {
+		flag.LastEvaluatedAt = &lastEvaluatedAt.Time
+	}
+
+	flag.Tags = tags
+	if flag.Tags == nil {
+		flag.Tags = []string{}
+	}
+
+	flag.Owner = nil
+	if ownerType.Valid && ownerID.Valid {
+		flag.Owner = &model.FlagOwner{Type: ownerType.String, ID: ownerID.UUID}
+	}
+
+	return nil
+}
+
+// Create creates a flag in a project of the context's organisation along
+// with its tags
 func (r *flagRepository) Create(ctx context.Context, flag *model.Flag) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO flags (id, project_id, key, description, type, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
+		INSERT INTO flags (id, project_id, key, description, type, default_value, owner_type, owner_id, kind, status, removal_date, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		WHERE ` + inOrganization("$2::uuid", "$14")
 	
 	now := time.Now()
 	flag.ID = uuid.New()
+	flag.Version = 1
 	flag.CreatedAt = now
 	flag.UpdatedAt = now
-	
-	_, err := r.db.ExecContext(ctx, query, flag.ID, flag.ProjectID, flag.Key, flag.Description, flag.Type, flag.CreatedAt, flag.UpdatedAt)
+	flag.Status = model.FlagStatusActive
+	if flag.Kind == "" {
+		flag.Kind = model.FlagKindTemporary
+	}
+	if flag.Tags == nil {
+		flag.Tags = []string{}
+	}
+
+	var ownerType, ownerID interface{}
+	if flag.Owner != nil {
+		ownerType, ownerID = flag.Owner.Type, flag.Owner.ID
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertedInOrganization(tx.ExecContext(ctx, query, flag.ID, flag.ProjectID, flag.Key, flag.Description, flag.Type, flag.DefaultValue,
+		ownerType, ownerID, flag.Kind, flag.Status, flag.RemovalDate, flag.CreatedAt, flag.UpdatedAt, orgID))
+	if err != nil {
+		return err
+	}
+
+	if err := setFlagTags(ctx, tx, flag.ID, flag.ProjectID, flag.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setFlagTags replaces the tags of a flag, creating missing project tags on the way
+func setFlagTags(ctx context.Context, tx DBTX, flagID, projectID uuid.UUID, tags []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM flag_tags WHERE flag_id = $1`, flagID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tags (project_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (project_id, name) DO NOTHING
+	`, projectID, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO flag_tags (flag_id, tag_id)
+		SELECT $1, id FROM tags
+		WHERE project_id = $2 AND name = ANY($3)
+	`, flagID, projectID, pq.Array(tags))
 	return err
 }
 
 func (r *flagRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, project_id, key, description, type, created_at, updated_at
+		SELECT ` + flagColumns + `
 		FROM flags
-		WHERE id = $1
-	`
+		WHERE id = $1 AND ` + inOrganization("project_id", "$2")
 	
 	var flag model.Flag
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&flag.ID,
-		&flag.ProjectID,
-		&flag.Key,
-		&flag.Description,
-		&flag.Type,
-		&flag.CreatedAt,
-		&flag.UpdatedAt,
-	)
+	err = scanFlag(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID), &flag)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -59,14 +195,19 @@ func (r *flagRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Flag
 }
 
 func (r *flagRepository) GetByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.Flag, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, project_id, key, description, type, created_at, updated_at
+		SELECT ` + flagColumns + `
 		FROM flags
-		WHERE project_id = $1
+		WHERE project_id = $1 AND ` + inOrganization("project_id", "$2") + `
 		ORDER BY created_at DESC
 	`
 	
-	rows, err := r.db.QueryContext(ctx, query, projectID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -75,129 +216,371 @@ func (r *flagRepository) GetByProjectID(ctx context.Context, projectID uuid.UUID
 	var flags []model.Flag
 	for rows.Next() {
 		var flag model.Flag
-		err := rows.Scan(
-			&flag.ID,
-			&flag.ProjectID,
-			&flag.Key,
-			&flag.Description,
-			&flag.Type,
-			&flag.CreatedAt,
-			&flag.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanFlag(rows, &flag); err != nil {
 			return nil, err
 		}
 		flags = append(flags, flag)
 	}
 	
-	return flags, nil
+	return flags, rows.Err()
 }
 
-func (r *flagRepository) GetWithValuesByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.FlagWithValues, error) {
-	flagQuery := `
-		SELECT id, project_id, key, description, type, created_at, updated_at
+var flagSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+		"updated_at": {Column: "updated_at", Cast: "timestamptz"},
+		"key":        {Column: "key", Cast: "text"},
+		"type":       {Column: "type", Cast: "text"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
+}
+
+func (r *flagRepository) List(ctx context.Context, projectID uuid.UUID, params pagination.Params) (*pagination.Page[model.Flag], error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &pagination.Query{}
+	q.Where("project_id = " + q.Arg(projectID))
+	q.Where(inOrganization("project_id", q.Arg(orgID)))
+	q.Search(params.Search, "key", "description")
+
+	// Archived flags are hidden unless explicitly requested
+	switch status := params.Filter("status"); status {
+	case "":
+		q.Where("status = " + q.Arg(model.FlagStatusActive))
+	case model.FlagStatusActive, model.FlagStatusArchived:
+		q.Where("status = " + q.Arg(status))
+	case "all":
+	default:
+		return nil, pagination.ErrInvalidFilter
+	}
+
+	if kind := params.Filter("kind"); kind != "" {
+		if kind != model.FlagKindTemporary && kind != model.FlagKindPermanent {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("kind = " + q.Arg(kind))
+	}
+
+	if flagType := params.Filter("type"); flagType != "" {
+		switch flagType {
+		case "boolean", "string", "number", "json":
+			q.Where("type = " + q.Arg(flagType))
+		default:
+			return nil, pagination.ErrInvalidFilter
+		}
+	}
+
+	if tag := params.Filter("tag"); tag != "" {
+		q.Where(`EXISTS (
+			SELECT 1 FROM flag_tags ft JOIN tags t ON t.id = ft.tag_id
+			WHERE ft.flag_id = flags.id AND t.name = ` + q.Arg(strings.ToLower(tag)) + `
+		)`)
+	}
+
+	if owner := params.Filter("owner"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("owner_id = " + q.Arg(ownerID))
+	}
+
+	if ownerType := params.Filter("owner_type"); ownerType != "" {
+		if ownerType != model.OwnerTypeUser && ownerType != model.OwnerTypeTeam {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("owner_type = " + q.Arg(ownerType))
+	}
+
+	if enabledIn := params.Filter("enabled_in"); enabledIn != "" {
+		envID, err := uuid.Parse(enabledIn)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where(`EXISTS (
+			SELECT 1 FROM flag_values fv
+			WHERE fv.flag_id = flags.id AND fv.env_id = ` + q.Arg(envID) + ` AND fv.enabled
+		)`)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM flags ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, flagSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + flagColumns + `
 		FROM flags
-		WHERE project_id = $1
-		ORDER BY created_at DESC
-	`
-	
-	flagRows, err := r.db.QueryContext(ctx, flagQuery, projectID)
+		` + q.WhereClause() + `
+		` + suffix
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
 	if err != nil {
 		return nil, err
 	}
-	defer flagRows.Close()
-	
-	var flagsWithValues []model.FlagWithValues
-	for flagRows.Next() {
+	defer rows.Close()
+
+	var flags []model.Flag
+	for rows.Next() {
 		var flag model.Flag
-		err := flagRows.Scan(
-			&flag.ID,
-			&flag.ProjectID,
-			&flag.Key,
-			&flag.Description,
-			&flag.Type,
-			&flag.CreatedAt,
-			&flag.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanFlag(rows, &flag); err != nil {
 			return nil, err
 		}
-		
-		// Get values for this flag
-		valueQuery := `
-			SELECT id, flag_id, env_id, value, enabled, created_at, updated_at
-			FROM flag_values
-			WHERE flag_id = $1
-			ORDER BY created_at ASC
-		`
-		
-		valueRows, err := r.db.QueryContext(ctx, valueQuery, flag.ID)
-		if err != nil {
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(flags, total, params, flagSorts, func(f model.Flag, sort string) (string, uuid.UUID) {
+		switch sort {
+		case "key":
+			return f.Key, f.ID
+		case "type":
+			return f.Type, f.ID
+		case "updated_at":
+			return f.UpdatedAt.Format(time.RFC3339Nano), f.ID
+		default:
+			return f.CreatedAt.Format(time.RFC3339Nano), f.ID
+		}
+	}), nil
+}
+
+func (r *flagRepository) GetWithValuesByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.FlagWithValues, error) {
+	flags, err := r.GetByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.WithValues(ctx, flags)
+}
+
+// WithValues loads the values of the given flags in a single round-trip.
+// The flags come from scoped queries, so their values are the tenant's own.
+func (r *flagRepository) WithValues(ctx context.Context, flags []model.Flag) ([]model.FlagWithValues, error) {
+	if len(flags) == 0 {
+		return []model.FlagWithValues{}, nil
+	}
+
+	flagIDs := make([]uuid.UUID, len(flags))
+	for i, flag := range flags {
+		flagIDs[i] = flag.ID
+	}
+
+	valueQuery := `
+		SELECT ` + flagValueColumns + `
+		FROM flag_values
+		WHERE flag_id = ANY($1)
+		ORDER BY created_at ASC
+	`
+
+	valueRows, err := conn(ctx, r.db).QueryContext(ctx, valueQuery, pq.Array(flagIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer valueRows.Close()
+
+	valuesByFlag := make(map[uuid.UUID][]model.FlagValue, len(flags))
+	for valueRows.Next() {
+		var value model.FlagValue
+		if err := scanFlagValue(valueRows, &value); err != nil {
 			return nil, err
 		}
-		
-		var values []model.FlagValue
-		for valueRows.Next() {
-			var value model.FlagValue
-			err := valueRows.Scan(
-				&value.ID,
-				&value.FlagID,
-				&value.EnvID,
-				&value.Value,
-				&value.Enabled,
-				&value.CreatedAt,
-				&value.UpdatedAt,
-			)
-			if err != nil {
-				valueRows.Close()
-				return nil, err
-			}
-			values = append(values, value)
-		}
-		valueRows.Close()
-		
-		flagsWithValues = append(flagsWithValues, model.FlagWithValues{
+		valuesByFlag[value.FlagID] = append(valuesByFlag[value.FlagID], value)
+	}
+	if err := valueRows.Err(); err != nil {
+		return nil, err
+	}
+
+	flagsWithValues := make([]model.FlagWithValues, len(flags))
+	for i, flag := range flags {
+		flagsWithValues[i] = model.FlagWithValues{
 			Flag:   flag,
-			Values: values,
-		})
+			Values: valuesByFlag[flag.ID],
+		}
 	}
-	
+
 	return flagsWithValues, nil
 }
 
+// Update changes a flag if it is still at the version the request names,
+// if any, and returns nil if it isn't or there is no such flag
 func (r *flagRepository) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagRequest) (*model.Flag, error) {
 	query := `
 		UPDATE flags
 		SET key = COALESCE($1, key),
 			description = COALESCE($2, description),
 			type = COALESCE($3, type),
-			updated_at = $4
-		WHERE id = $5
-		RETURNING id, project_id, key, description, type, created_at, updated_at
+			owner_type = CASE WHEN $4 THEN $5 ELSE owner_type END,
+			owner_id = CASE WHEN $4 THEN $6::uuid ELSE owner_id END,
+			kind = COALESCE($7, kind),
+			removal_date = COALESCE($8::date, removal_date),
+			default_value = COALESCE($9, default_value),
+			version = version + 1,
+			updated_at = $10
+		WHERE id = $11 AND ` + inOrganization("project_id", "$12") + ` AND ($13::int IS NULL OR version = $13)
+		RETURNING project_id
 	`
 	
-	var flag model.Flag
+	// An owner with an empty type clears the current owner
+	setOwner := req.Owner != nil
+	var ownerType, ownerID interface{}
+	if setOwner && req.Owner.Type != "" {
+		ownerType, ownerID = req.Owner.Type, req.Owner.ID
+	}
+
 	now := time.Now()
-	
-	err := r.db.QueryRowContext(ctx, query, 
-		req.Key, req.Description, req.Type, now, id).Scan(
-		&flag.ID,
-		&flag.ProjectID,
-		&flag.Key,
-		&flag.Description,
-		&flag.Type,
-		&flag.CreatedAt,
-		&flag.UpdatedAt,
-	)
-	
+
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var projectID uuid.UUID
+	err = tx.QueryRowContext(ctx, query, 
+		req.Key, req.Description, req.Type, setOwner, ownerType, ownerID, req.Kind, req.RemovalDate, req.DefaultValue, now, id, orgID, req.Version).Scan(&projectID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Tags != nil {
+		if err := setFlagTags(ctx, tx, id, projectID, *req.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	var flag model.Flag
+	err = scanFlag(tx.QueryRowContext(ctx, `SELECT `+flagColumns+` FROM flags WHERE id = $1`, id), &flag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flag, tx.Commit()
+}
+
+func (r *flagRepository) SetStatus(ctx context.Context, id uuid.UUID, status string) (*model.Flag, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE flags
+		SET status = $1,
+			archived_at = CASE WHEN $1 = 'archived' THEN $2 ELSE NULL END,
+			version = version + 1,
+			updated_at = $2
+		WHERE id = $3 AND ` + inOrganization("project_id", "$4") + `
+		RETURNING ` + flagColumns
+
+	var flag model.Flag
+	err = scanFlag(conn(ctx, r.db).QueryRowContext(ctx, query, status, time.Now(), id, orgID), &flag)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return &flag, err
 }
 
+// GetStale returns the active temporary flags of a project that haven't
+// changed or been evaluated since olderThan, are enabled with the same value
+// in every environment, or are past their expected removal date
+func (r *flagRepository) GetStale(ctx context.Context, projectID uuid.UUID, olderThan time.Time) ([]model.StaleFlag, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + flagColumns + `, stats.last_changed_at, stats.fully_rolled_out
+		FROM flags
+		CROSS JOIN LATERAL (
+			SELECT
+				GREATEST(flags.updated_at, MAX(fv.updated_at)) AS last_changed_at,
+				COALESCE(
+					COUNT(fv.id) > 0
+					AND COUNT(fv.id) = (SELECT COUNT(*) FROM environments e WHERE e.project_id = flags.project_id)
+					AND BOOL_AND(fv.enabled)
+					AND COUNT(DISTINCT fv.value) = 1,
+					false
+				) AS fully_rolled_out
+			FROM flag_values fv
+			WHERE fv.flag_id = flags.id
+		) stats
+		WHERE flags.project_id = $1
+			AND ` + inOrganization("flags.project_id", "$3") + `
+			AND flags.status = 'active'
+			AND flags.kind = 'temporary'
+			AND (
+				stats.last_changed_at < $2
+				OR COALESCE(flags.last_evaluated_at, flags.created_at) < $2
+				OR stats.fully_rolled_out
+				OR flags.removal_date < CURRENT_DATE
+			)
+		ORDER BY stats.last_changed_at ASC
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, olderThan, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	today := time.Now().Truncate(24 * time.Hour)
+
+	var staleFlags []model.StaleFlag
+	for rows.Next() {
+		var stale model.StaleFlag
+		var fullyRolledOut bool
+		if err := scanFlag(rows, &stale.Flag, &stale.LastChangedAt, &fullyRolledOut); err != nil {
+			return nil, err
+		}
+
+		stale.Reasons = []string{}
+		if stale.LastChangedAt.Before(olderThan) {
+			stale.Reasons = append(stale.Reasons, model.StaleReasonUnchanged)
+		}
+		if fullyRolledOut {
+			stale.Reasons = append(stale.Reasons, model.StaleReasonFullyRolledOut)
+		}
+		if stale.LastEvaluatedAt == nil && stale.CreatedAt.Before(olderThan) ||
+			stale.LastEvaluatedAt != nil && stale.LastEvaluatedAt.Before(olderThan) {
+			stale.Reasons = append(stale.Reasons, model.StaleReasonNotEvaluated)
+		}
+		if stale.RemovalDate != nil && stale.RemovalDate.Before(today) {
+			stale.Reasons = append(stale.Reasons, model.StaleReasonPastRemoval)
+		}
+		staleFlags = append(staleFlags, stale)
+	}
+
+	return staleFlags, rows.Err()
+}
+
 func (r *flagRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM flags WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM flags WHERE id = $1 AND ` + inOrganization("project_id", "$2")
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
 	return err
 }
@@ -9,6 +9,7 @@ import (
 	"api/internal/model"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type flagValueRepository struct {
@@ -19,43 +20,144 @@ func NewFlagValueRepository(db *sql.DB) FlagValueRepository {
 	return &flagValueRepository{db: db}
 }
 
+const flagValueColumns = `id, flag_id, env_id, value, enabled, version, created_at, updated_at`
+
+// scanFlagValue scans the columns of flagValueColumns, followed by any extra
+// columns the query selects after them
+func scanFlagValue(row rowScanner, value *model.FlagValue, extra ...interface{}) error {
+	dest := []interface{}{
+		&value.ID,
+		&value.FlagID,
+		&value.EnvID,
+		&value.Value,
+		&value.Enabled,
+		&value.Version,
+		&value.CreatedAt,
+		&value.UpdatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// Create sets the value of a flag in an environment, both of which must
+// belong to the context's organisation. Setting an existing value updates
+// it, bumping its version.
 func (r *flagValueRepository) Create(ctx context.Context, flagValue *model.FlagValue) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO flag_values (id, flag_id, env_id, value, enabled, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE ` + flagInOrganization("$2::uuid", "$8") + `
+			AND $3::uuid IN (SELECT id FROM environments WHERE ` + inOrganization("project_id", "$8") + `)
 		ON CONFLICT (flag_id, env_id) DO UPDATE SET
 			value = EXCLUDED.value,
 			enabled = EXCLUDED.enabled,
+			version = flag_values.version + 1,
 			updated_at = EXCLUDED.updated_at
-	`
+		RETURNING ` + flagValueColumns
 	
 	now := time.Now()
-	flagValue.ID = uuid.New()
-	flagValue.CreatedAt = now
-	flagValue.UpdatedAt = now
-	
-	_, err := r.db.ExecContext(ctx, query, 
-		flagValue.ID, flagValue.FlagID, flagValue.EnvID, flagValue.Value, flagValue.Enabled, flagValue.CreatedAt, flagValue.UpdatedAt)
+	err = scanFlagValue(conn(ctx, r.db).QueryRowContext(ctx, query, 
+		uuid.New(), flagValue.FlagID, flagValue.EnvID, flagValue.Value, flagValue.Enabled, now, now, orgID), flagValue)
+	if err == sql.ErrNoRows {
+		return ErrProjectOutsideOrganization
+	}
 	return err
 }
 
+// CreateDefaults gives a new flag its default value in every environment
+// of its project, enabled where the environment starts new flags enabled,
+// and returns the values created
+func (r *flagValueRepository) CreateDefaults(ctx context.Context, flag *model.Flag) ([]model.FlagValue, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO flag_values (id, flag_id, env_id, value, enabled, created_at, updated_at)
+		SELECT gen_random_uuid(), $1, e.id, $2, e.new_flags_enabled, $3, $3
+		FROM environments e
+		WHERE e.project_id = $4 AND ` + inOrganization("e.project_id", "$5") + `
+		ON CONFLICT (flag_id, env_id) DO NOTHING
+		RETURNING ` + flagValueColumns
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, flag.ID, flag.DefaultValue, flag.CreatedAt, flag.ProjectID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []model.FlagValue{}
+	for rows.Next() {
+		var value model.FlagValue
+		if err := scanFlagValue(rows, &value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// FillEnvironment gives a new environment a value for every flag of its
+// project. With a source environment of the same project its values are
+// copied; flags without one there, or every flag without a source, get
+// their default value, enabled if the environment starts new flags enabled.
+func (r *flagValueRepository) FillEnvironment(ctx context.Context, env *model.Environment, sourceID uuid.UUID) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if sourceID != uuid.Nil {
+		copyQuery := `
+			INSERT INTO flag_values (id, flag_id, env_id, value, enabled, created_at, updated_at)
+			SELECT gen_random_uuid(), flag_id, $1, value, enabled, $2, $2
+			FROM flag_values
+			WHERE env_id = $3
+				AND env_id IN (SELECT id FROM environments WHERE project_id = $4 AND ` + inOrganization("project_id", "$5") + `)
+		`
+		if _, err := tx.ExecContext(ctx, copyQuery, env.ID, env.CreatedAt, sourceID, env.ProjectID, orgID); err != nil {
+			return err
+		}
+	}
+
+	defaultQuery := `
+		INSERT INTO flag_values (id, flag_id, env_id, value, enabled, created_at, updated_at)
+		SELECT gen_random_uuid(), f.id, $1, f.default_value, $2, $3, $3
+		FROM flags f
+		WHERE f.project_id = $4 AND ` + inOrganization("f.project_id", "$5") + `
+		ON CONFLICT (flag_id, env_id) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, defaultQuery, env.ID, env.NewFlagsEnabled, env.CreatedAt, env.ProjectID, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *flagValueRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.FlagValue, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, flag_id, env_id, value, enabled, created_at, updated_at
+		SELECT ` + flagValueColumns + `
 		FROM flag_values
-		WHERE id = $1
-	`
+		WHERE id = $1 AND ` + flagInOrganization("flag_id", "$2")
 	
 	var flagValue model.FlagValue
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&flagValue.ID,
-		&flagValue.FlagID,
-		&flagValue.EnvID,
-		&flagValue.Value,
-		&flagValue.Enabled,
-		&flagValue.CreatedAt,
-		&flagValue.UpdatedAt,
-	)
+	err = scanFlagValue(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID), &flagValue)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -64,14 +166,19 @@ func (r *flagValueRepository) GetByID(ctx context.Context, id uuid.UUID) (*model
 }
 
 func (r *flagValueRepository) GetByFlagID(ctx context.Context, flagID uuid.UUID) ([]model.FlagValue, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, flag_id, env_id, value, enabled, created_at, updated_at
+		SELECT ` + flagValueColumns + `
 		FROM flag_values
-		WHERE flag_id = $1
+		WHERE flag_id = $1 AND ` + flagInOrganization("flag_id", "$2") + `
 		ORDER BY created_at ASC
 	`
 	
-	rows, err := r.db.QueryContext(ctx, query, flagID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, flagID, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -80,16 +187,7 @@ func (r *flagValueRepository) GetByFlagID(ctx context.Context, flagID uuid.UUID)
 	var flagValues []model.FlagValue
 	for rows.Next() {
 		var flagValue model.FlagValue
-		err := rows.Scan(
-			&flagValue.ID,
-			&flagValue.FlagID,
-			&flagValue.EnvID,
-			&flagValue.Value,
-			&flagValue.Enabled,
-			&flagValue.CreatedAt,
-			&flagValue.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanFlagValue(rows, &flagValue); err != nil {
 			return nil, err
 		}
 		flagValues = append(flagValues, flagValue)
@@ -98,15 +196,23 @@ func (r *flagValueRepository) GetByFlagID(ctx context.Context, flagID uuid.UUID)
 	return flagValues, nil
 }
 
+// GetByEnvID returns the values served in an environment along with their
+// flag keys; values of archived flags are excluded
 func (r *flagValueRepository) GetByEnvID(ctx context.Context, envID uuid.UUID) ([]model.FlagValue, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, flag_id, env_id, value, enabled, created_at, updated_at
-		FROM flag_values
-		WHERE env_id = $1
-		ORDER BY created_at ASC
+		SELECT fv.id, fv.flag_id, fv.env_id, fv.value, fv.enabled, fv.version, fv.created_at, fv.updated_at, f.key
+		FROM flag_values fv
+		JOIN flags f ON f.id = fv.flag_id
+		WHERE fv.env_id = $1 AND f.status = 'active' AND ` + inOrganization("f.project_id", "$2") + `
+		ORDER BY fv.created_at ASC
 	`
 	
-	rows, err := r.db.QueryContext(ctx, query, envID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, envID, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,16 +221,7 @@ func (r *flagValueRepository) GetByEnvID(ctx context.Context, envID uuid.UUID) (
 	var flagValues []model.FlagValue
 	for rows.Next() {
 		var flagValue model.FlagValue
-		err := rows.Scan(
-			&flagValue.ID,
-			&flagValue.FlagID,
-			&flagValue.EnvID,
-			&flagValue.Value,
-			&flagValue.Enabled,
-			&flagValue.CreatedAt,
-			&flagValue.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanFlagValue(rows, &flagValue, &flagValue.FlagKey); err != nil {
 			return nil, err
 		}
 		flagValues = append(flagValues, flagValue)
@@ -133,29 +230,26 @@ func (r *flagValueRepository) GetByEnvID(ctx context.Context, envID uuid.UUID) (
 	return flagValues, nil
 }
 
+// Update changes a flag value if it is still at the version the request
+// names, if any, and returns nil if it isn't or there is no such value
 func (r *flagValueRepository) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagValueRequest) (*model.FlagValue, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		UPDATE flag_values
 		SET value = COALESCE($1, value),
 			enabled = COALESCE($2, enabled),
+			version = version + 1,
 			updated_at = $3
-		WHERE id = $4
-		RETURNING id, flag_id, env_id, value, enabled, created_at, updated_at
-	`
+		WHERE id = $4 AND ` + flagInOrganization("flag_id", "$5") + ` AND ($6::int IS NULL OR version = $6)
+		RETURNING ` + flagValueColumns
 	
 	var flagValue model.FlagValue
-	now := time.Now()
-	
-	err := r.db.QueryRowContext(ctx, query, 
-		req.Value, req.Enabled, now, id).Scan(
-		&flagValue.ID,
-		&flagValue.FlagID,
-		&flagValue.EnvID,
-		&flagValue.Value,
-		&flagValue.Enabled,
-		&flagValue.CreatedAt,
-		&flagValue.UpdatedAt,
-	)
+	err = scanFlagValue(conn(ctx, r.db).QueryRowContext(ctx, query, 
+		req.Value, req.Enabled, time.Now(), id, orgID, req.Version), &flagValue)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -164,7 +258,128 @@ func (r *flagValueRepository) Update(ctx context.Context, id uuid.UUID, req *dto
 }
 
 func (r *flagValueRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM flag_values WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM flag_values WHERE id = $1 AND ` + flagInOrganization("flag_id", "$2")
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
 	return err
 }
+
+// Promote plans copying the values of a project's active flags from one
+// environment to another and, unless the promotion is a dry run or blocked
+// by conflicts, applies it. Planning and writing happen in one transaction
+// holding locks on both environments' values, so the applied changes are
+// exactly the ones reported.
+func (r *flagValueRepository) Promote(ctx context.Context, promotion *model.Promotion) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM flag_values WHERE env_id = $1 FOR UPDATE`, promotion.TargetEnvID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM flag_values WHERE env_id = $1 FOR SHARE`, promotion.SourceEnvID); err != nil {
+		return err
+	}
+
+	// Without a selection every flag with a source value is promoted
+	query := `
+		SELECT f.id, f.key, f.type,
+			src.value, src.enabled, src.updated_at,
+			dst.value, dst.enabled, dst.updated_at
+		FROM flags f
+		JOIN environments e ON e.id = $1 AND e.project_id = f.project_id
+		LEFT JOIN flag_values src ON src.flag_id = f.id AND src.env_id = $1
+		LEFT JOIN flag_values dst ON dst.flag_id = f.id AND dst.env_id = $2
+		WHERE f.status = 'active' AND ` + inOrganization("f.project_id", "$3") + `
+			AND CASE WHEN cardinality($4::uuid[]) > 0 THEN f.id = ANY($4) ELSE src.id IS NOT NULL END
+		ORDER BY f.key
+	`
+	rows, err := tx.QueryContext(ctx, query, promotion.SourceEnvID, promotion.TargetEnvID, orgID, pq.Array(promotion.FlagIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var flagID uuid.UUID
+		var flagKey, flagType string
+		var srcValue, dstValue sql.NullString
+		var srcEnabled, dstEnabled sql.NullBool
+		var srcUpdated, dstUpdated sql.NullTime
+		err := rows.Scan(&flagID, &flagKey, &flagType,
+			&srcValue, &srcEnabled, &srcUpdated,
+			&dstValue, &dstEnabled, &dstUpdated)
+		if err != nil {
+			return err
+		}
+
+		var source, target *model.FlagValueState
+		if srcValue.Valid {
+			source = &model.FlagValueState{Value: srcValue.String, Enabled: srcEnabled.Bool, UpdatedAt: srcUpdated.Time}
+		}
+		if dstValue.Valid {
+			target = &model.FlagValueState{Value: dstValue.String, Enabled: dstEnabled.Bool, UpdatedAt: dstUpdated.Time}
+		}
+		promotion.Plan(flagID, flagKey, flagType, source, target)
+		found[flagID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, flagID := range promotion.FlagIDs {
+		if !found[flagID] {
+			promotion.PlanMissing(flagID)
+			found[flagID] = true
+		}
+	}
+
+	if !promotion.CanApply() {
+		return nil
+	}
+
+	upsert := `
+		INSERT INTO flag_values (id, flag_id, env_id, value, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (flag_id, env_id) DO UPDATE SET
+			value = EXCLUDED.value,
+			enabled = EXCLUDED.enabled,
+			version = flag_values.version + 1,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, version
+	`
+	now := time.Now()
+	for i := range promotion.Changes {
+		change := &promotion.Changes[i]
+		if !change.Copies() {
+			continue
+		}
+
+		var id uuid.UUID
+		err := tx.QueryRowContext(ctx, upsert, uuid.New(), change.FlagID, promotion.TargetEnvID,
+			change.Source.Value, change.Source.Enabled, now).Scan(&id, &change.Version)
+		if err != nil {
+			return err
+		}
+		change.FlagValueID = &id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	promotion.Applied = true
+	return nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"api/internal/model"
+)
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve claims a key for a request about to be handled, for the length of
+// the lease. It returns nil once the key is claimed, or the request already
+// holding the key if there is one that hasn't expired.
+func (r *idempotencyRepository) Reserve(ctx context.Context, req *model.IdempotentRequest, lease time.Duration) (*model.IdempotentRequest, error) {
+	claim := `
+		INSERT INTO idempotency_keys (scope, key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, NOW(), NOW() + $4 * INTERVAL '1 millisecond')
+		ON CONFLICT (scope, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = NULL,
+			content_type = NULL,
+			etag = NULL,
+			location = NULL,
+			response_body = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+		RETURNING created_at, expires_at
+	`
+	lookup := `
+		SELECT fingerprint, status_code, content_type, etag, location, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND expires_at >= NOW()
+	`
+
+	// The key can expire between failing to claim it and looking it up, in
+	// which case claiming it again succeeds
+	for attempt := 0; ; attempt++ {
+		err := conn(ctx, r.db).QueryRowContext(ctx, claim, req.Scope, req.Key, req.Fingerprint, lease.Milliseconds()).
+			Scan(&req.CreatedAt, &req.ExpiresAt)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		existing := &model.IdempotentRequest{Scope: req.Scope, Key: req.Key}
+		var statusCode sql.NullInt64
+		var contentType, etag, location sql.NullString
+		err = conn(ctx, r.db).QueryRowContext(ctx, lookup, req.Scope, req.Key).Scan(
+			&existing.Fingerprint,
+			&statusCode,
+			&contentType,
+			&etag,
+			&location,
+			&existing.ResponseBody,
+			&existing.CreatedAt,
+			&existing.ExpiresAt,
+		)
+		if err == sql.ErrNoRows && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing.StatusCode = int(statusCode.Int64)
+		existing.ContentType = contentType.String
+		existing.ETag = etag.String
+		existing.Location = location.String
+		return existing, nil
+	}
+}
+
+// Complete stores the response to a request reserved with Reserve, to be
+// replayed until the window has passed. A reservation whose lease ran out
+// and was taken over by a retry is left alone.
+func (r *idempotencyRepository) Complete(ctx context.Context, req *model.IdempotentRequest, window time.Duration) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $3, content_type = $4, etag = $5, location = $6, response_body = $7,
+			expires_at = NOW() + $8 * INTERVAL '1 millisecond'
+		WHERE scope = $1 AND key = $2 AND created_at = $9 AND status_code IS NULL
+		RETURNING expires_at
+	`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, req.Scope, req.Key,
+		req.StatusCode, req.ContentType, req.ETag, req.Location, req.ResponseBody, window.Milliseconds(), req.CreatedAt).Scan(&req.ExpiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+// Release gives up a request's reservation without storing a response, so
+// a retry handles the request afresh
+func (r *idempotencyRepository) Release(ctx context.Context, req *model.IdempotentRequest) error {
+	query := `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND created_at = $3 AND status_code IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, req.Scope, req.Key, req.CreatedAt)
+	return err
+}
+
+// DeleteExpired deletes the keys whose window or lease has passed, returning
+// how many there were
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type loginThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewLoginThrottleRepository(db *sql.DB) LoginThrottleRepository {
+	return &loginThrottleRepository{db: db}
+}
+
+// LockedUntil returns the latest lockout still in force for any of the keys,
+// or the zero time if none is locked
+func (r *loginThrottleRepository) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	query := `
+		SELECT MAX(locked_until) FROM login_throttles
+		WHERE key = ANY($1) AND locked_until > NOW()
+	`
+	var until sql.NullTime
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, pq.Array(keys)).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// RecordFailure counts a failed attempt against a key and returns the number
+// of failures within the window, restarting the count once the window has
+// passed since the previous failure
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < NOW() - $2 * INTERVAL '1 millisecond' THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures
+	`
+	var failures int
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, key, window.Milliseconds()).Scan(&failures)
+	return failures, err
+}
+
+// Lock locks a key until the given time and restarts its failure count.
+// Keys with no recent failures and no lockout are pruned at the same time,
+// since guesses at unknown usernames leave rows behind.
+func (r *loginThrottleRepository) Lock(ctx context.Context, key string, until time.Time, window time.Duration) error {
+	query := `UPDATE login_throttles SET failures = 0, locked_until = $2 WHERE key = $1`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, key, until); err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM login_throttles
+		WHERE last_failure_at < NOW() - $1 * INTERVAL '1 millisecond'
+			AND (locked_until IS NULL OR locked_until < NOW())
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, window.Milliseconds())
+	return err
+}
+
+// Clear forgets a key's failures and lifts any lockout, returning whether it
+// was locked
+func (r *loginThrottleRepository) Clear(ctx context.Context, key string) (bool, error) {
+	query := `DELETE FROM login_throttles WHERE key = $1 RETURNING locked_until > NOW()`
+	var locked sql.NullBool
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, key).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return locked.Bool, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type mfaRepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+// SetSecret stores the secret of a pending enrolment; MFA stays disabled
+// until Enable is called
+func (r *mfaRepository) SetSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+		UPDATE users SET mfa_secret = $2, mfa_enabled = false, mfa_last_used_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+// Enable turns MFA on and replaces the user's recovery codes
+func (r *mfaRepository) Enable(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET mfa_enabled = true, updated_at = NOW() WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, pq.Array(recoveryCodeHashes)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns MFA off, forgetting the secret and recovery codes
+func (r *mfaRepository) Disable(ctx context.Context, userID uuid.UUID) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users SET mfa_secret = NULL, mfa_enabled = false, mfa_last_used_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records that the code for a time step was used. It returns false
+// if that step or a later one was already used, so each code works once.
+func (r *mfaRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	query := `
+		UPDATE users SET mfa_last_used_step = $2
+		WHERE id = $1 AND (mfa_last_used_step IS NULL OR mfa_last_used_step < $2)
+	`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// UseRecoveryCode redeems an unused recovery code
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
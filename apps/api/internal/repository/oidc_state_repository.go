@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+)
+
+type oidcStateRepository struct {
+	db *sql.DB
+}
+
+func NewOIDCStateRepository(db *sql.DB) OIDCStateRepository {
+	return &oidcStateRepository{db: db}
+}
+
+// Create stores a login state, clearing out any abandoned ones first
+func (r *oidcStateRepository) Create(ctx context.Context, state *model.OIDCLoginState) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query,
+		state.State, state.Nonce, state.CodeVerifier, state.ExpiresAt,
+	).Scan(&state.CreatedAt)
+}
+
+// Consume deletes and returns an unexpired login state, so each state can
+// complete at most one login
+func (r *oidcStateRepository) Consume(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND expires_at > NOW()
+		RETURNING state, nonce, code_verifier, created_at, expires_at
+	`
+	var s model.OIDCLoginState
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, state).Scan(
+		&s.State, &s.Nonce, &s.CodeVerifier, &s.CreatedAt, &s.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"api/internal/model"
+	"api/internal/pagination"
+
+	"github.com/google/uuid"
+)
+
+var organizationSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+		"name":       {Column: "name", Cast: "text"},
+		"slug":       {Column: "slug", Cast: "text"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
+}
+
+// organizationRepository manages the tenants themselves, so unlike the
+// repositories of tenant data it isn't scoped to the context's organisation
+type organizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+const organizationColumns = `id, name, slug, host, created_at, updated_at`
+
+func scanOrganization(row rowScanner) (*model.Organization, error) {
+	org := &model.Organization{}
+	err := row.Scan(&org.ID, &org.Name, &org.Slug, &org.Host, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+func (r *organizationRepository) Create(ctx context.Context, org *model.Organization) error {
+	if org.ID == uuid.Nil {
+		org.ID = uuid.New()
+	}
+
+	query := `
+		INSERT INTO organizations (id, name, slug)
+		VALUES ($1, $2, $3)
+		RETURNING host, created_at, updated_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, org.ID, org.Name, org.Slug).
+		Scan(&org.Host, &org.CreatedAt, &org.UpdatedAt)
+}
+
+// GetByID returns an organisation, or nil if there is none
+func (r *organizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE id = $1`
+	return scanOrganization(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+// GetBySlug returns an organisation, or nil if there is none
+func (r *organizationRepository) GetBySlug(ctx context.Context, slug string) (*model.Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE slug = $1`
+	return scanOrganization(conn(ctx, r.db).QueryRowContext(ctx, query, slug))
+}
+
+// GetHost returns the organisation that runs the installation
+func (r *organizationRepository) GetHost(ctx context.Context) (*model.Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE host`
+	return scanOrganization(conn(ctx, r.db).QueryRowContext(ctx, query))
+}
+
+// List returns a page of organisations, searching name and slug
+func (r *organizationRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Organization], error) {
+	q := &pagination.Query{}
+	q.Search(params.Search, "name", "slug")
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM organizations ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, organizationSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + organizationColumns + ` FROM organizations ` + q.WhereClause() + ` ` + suffix
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []model.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(orgs, total, params, organizationSorts, func(o model.Organization, sort string) (string, uuid.UUID) {
+		switch sort {
+		case "name":
+			return o.Name, o.ID
+		case "slug":
+			return o.Slug, o.ID
+		default:
+			return o.CreatedAt.Format(time.RFC3339Nano), o.ID
+		}
+	}), nil
+}
+
+// Update renames an organisation
+func (r *organizationRepository) Update(ctx context.Context, org *model.Organization) error {
+	query := `
+		UPDATE organizations SET name = $2, slug = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, org.ID, org.Name, org.Slug).Scan(&org.UpdatedAt)
+}
+
+// Delete deletes an organisation along with its users and projects
+func (r *organizationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM organizations WHERE id = $1 AND NOT host`, id)
+	return err
+}
@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+type projectMemberRepository struct {
+	db *sql.DB
+}
+
+func NewProjectMemberRepository(db *sql.DB) ProjectMemberRepository {
+	return &projectMemberRepository{db: db}
+}
+
+// List returns a project's members with their usernames and emails
+func (r *projectMemberRepository) List(ctx context.Context, projectID uuid.UUID) ([]model.ProjectMember, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT m.project_id, m.user_id, m.role, u.username, u.email, m.created_at, m.updated_at
+		FROM project_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.project_id = $1 AND ` + inOrganization("m.project_id", "$2") + `
+		ORDER BY u.username
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.ProjectMember{}
+	for rows.Next() {
+		var member model.ProjectMember
+		err := rows.Scan(
+			&member.ProjectID, &member.UserID, &member.Role, &member.Username,
+			&member.Email, &member.CreatedAt, &member.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// Set adds a member or changes their role. The project and the user must
+// both belong to the context's organisation.
+func (r *projectMemberRepository) Set(ctx context.Context, member *model.ProjectMember) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO project_members (project_id, user_id, role)
+		SELECT $1, $2, $3
+		WHERE ` + inOrganization("$1::uuid", "$4") + `
+			AND EXISTS (SELECT 1 FROM users WHERE id = $2 AND organization_id = $4)
+		ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, member.ProjectID, member.UserID, member.Role, orgID).
+		Scan(&member.CreatedAt, &member.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrProjectOutsideOrganization
+	}
+	return err
+}
+
+// Delete removes a member, returning whether they were one
+func (r *projectMemberRepository) Delete(ctx context.Context, projectID, userID uuid.UUID) (bool, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM project_members WHERE project_id = $1 AND user_id = $2 AND ` + inOrganization("project_id", "$3")
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, projectID, userID, orgID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ListTeams returns the teams with a role in a project
+func (r *projectMemberRepository) ListTeams(ctx context.Context, projectID uuid.UUID) ([]model.ProjectTeam, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT pt.project_id, pt.team_id, pt.role, t.name, pt.created_at, pt.updated_at
+		FROM project_teams pt
+		JOIN teams t ON t.id = pt.team_id
+		WHERE pt.project_id = $1 AND ` + inOrganization("pt.project_id", "$2") + `
+		ORDER BY t.name
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []model.ProjectTeam{}
+	for rows.Next() {
+		var team model.ProjectTeam
+		err := rows.Scan(&team.ProjectID, &team.TeamID, &team.Role, &team.TeamName, &team.CreatedAt, &team.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// SetTeam gives a team a role in a project or changes it. The project and
+// the team must both belong to the context's organisation.
+func (r *projectMemberRepository) SetTeam(ctx context.Context, team *model.ProjectTeam) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO project_teams (project_id, team_id, role)
+		SELECT $1, $2, $3
+		WHERE ` + inOrganization("$1::uuid", "$4") + `
+			AND EXISTS (SELECT 1 FROM teams WHERE id = $2 AND organization_id = $4)
+		ON CONFLICT (project_id, team_id) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, team.ProjectID, team.TeamID, team.Role, orgID).
+		Scan(&team.CreatedAt, &team.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTeamOutsideOrganization
+	}
+	return err
+}
+
+// DeleteTeam takes away a team's project role, returning whether it had one
+func (r *projectMemberRepository) DeleteTeam(ctx context.Context, projectID, teamID uuid.UUID) (bool, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM project_teams WHERE project_id = $1 AND team_id = $2 AND ` + inOrganization("project_id", "$3")
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, projectID, teamID, orgID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// MemberRoles returns the roles a user holds in a project: their own
+// membership's and those of the teams they belong to. It is empty if they
+// have none there.
+func (r *projectMemberRepository) MemberRoles(ctx context.Context, projectID, userID uuid.UUID) ([]string, error) {
+	query := `
+		SELECT role FROM project_members WHERE project_id = $1 AND user_id = $2
+		UNION
+		SELECT pt.role FROM project_teams pt
+		JOIN team_members tm ON tm.team_id = pt.team_id
+		WHERE pt.project_id = $1 AND tm.user_id = $2
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// ProjectExists reports whether a project exists in the context's
+// organisation
+func (r *projectMemberRepository) ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	id, err := r.queryID(ctx, `SELECT id FROM projects WHERE id = $1 AND organization_id = $2`, projectID)
+	return id != uuid.Nil, err
+}
+
+// ProjectOfEnvironment returns the project an environment belongs to, or
+// uuid.Nil if it doesn't exist. Like every lookup here it only sees the
+// context's organisation, so other tenants' resources don't exist.
+func (r *projectMemberRepository) ProjectOfEnvironment(ctx context.Context, envID uuid.UUID) (uuid.UUID, error) {
+	query := `SELECT project_id FROM environments WHERE id = $1 AND ` + inOrganization("project_id", "$2")
+	return r.queryID(ctx, query, envID)
+}
+
+// ProjectOfFlag returns the project a flag belongs to, or uuid.Nil if it
+// doesn't exist
+func (r *projectMemberRepository) ProjectOfFlag(ctx context.Context, flagID uuid.UUID) (uuid.UUID, error) {
+	query := `SELECT project_id FROM flags WHERE id = $1 AND ` + inOrganization("project_id", "$2")
+	return r.queryID(ctx, query, flagID)
+}
+
+// ProjectOfFlagValue returns the project of a flag value's flag, or uuid.Nil
+// if it doesn't exist
+func (r *projectMemberRepository) ProjectOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error) {
+	query := `
+		SELECT f.project_id FROM flag_values fv
+		JOIN flags f ON f.id = fv.flag_id
+		WHERE fv.id = $1 AND ` + inOrganization("f.project_id", "$2")
+	return r.queryID(ctx, query, valueID)
+}
+
+// EnvironmentOfFlagValue returns the environment a flag value is set in, or
+// uuid.Nil if it doesn't exist
+func (r *projectMemberRepository) EnvironmentOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error) {
+	query := `SELECT env_id FROM flag_values WHERE id = $1 AND ` + flagInOrganization("flag_id", "$2")
+	return r.queryID(ctx, query, valueID)
+}
+
+// EnvironmentInfo returns an environment's project, or uuid.Nil if it
+// doesn't exist, its key and whether it is marked as production
+func (r *projectMemberRepository) EnvironmentInfo(ctx context.Context, envID uuid.UUID) (uuid.UUID, string, bool, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return uuid.Nil, "", false, err
+	}
+
+	var projectID uuid.UUID
+	var key string
+	var production bool
+	query := `SELECT project_id, key, production FROM environments WHERE id = $1 AND ` + inOrganization("project_id", "$2")
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, envID, orgID).Scan(&projectID, &key, &production)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, "", false, nil
+	}
+	return projectID, key, production, err
+}
+
+// EnvironmentByKey returns the ID of a project's environment with a key, or
+// uuid.Nil if there is none
+func (r *projectMemberRepository) EnvironmentByKey(ctx context.Context, projectID uuid.UUID, key string) (uuid.UUID, error) {
+	query := `SELECT id FROM environments WHERE project_id = $1 AND key = $2 AND ` + inOrganization("project_id", "$3")
+	return r.queryID(ctx, query, projectID, key)
+}
+
+// queryID runs a single-row lookup, passing the context's organisation as
+// the argument after args
+func (r *projectMemberRepository) queryID(ctx context.Context, query string, args ...interface{}) (uuid.UUID, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var id uuid.UUID
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, append(args, orgID)...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	return id, err
+}
@@ -7,6 +7,7 @@ import (
 
 	"api/internal/dto"
 	"api/internal/model"
+	"api/internal/pagination"
 
 	"github.com/google/uuid"
 )
@@ -19,51 +20,106 @@ func NewProjectRepository(db *sql.DB) ProjectRepository {
 	return &projectRepository{db: db}
 }
 
+const projectColumns = `id, organization_id, name, description, version, created_at, updated_at`
+
+func scanProject(row rowScanner) (*model.Project, error) {
+	project := &model.Project{}
+	err := row.Scan(
+		&project.ID,
+		&project.OrganizationID,
+		&project.Name,
+		&project.Description,
+		&project.Version,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// Create creates a project in the context's organisation
 func (r *projectRepository) Create(ctx context.Context, project *model.Project) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO projects (id, name, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO projects (id, organization_id, name, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
 	now := time.Now()
 	project.ID = uuid.New()
+	project.OrganizationID = orgID
+	project.Version = 1
 	project.CreatedAt = now
 	project.UpdatedAt = now
 
-	_, err := r.db.ExecContext(ctx, query, project.ID, project.Name, project.Description, project.CreatedAt, project.UpdatedAt)
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, project.ID, project.OrganizationID, project.Name, project.Description, project.CreatedAt, project.UpdatedAt)
 	return err
 }
 
+// GetByID returns a project of the context's organisation, or nil if there
+// is none
 func (r *projectRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Project, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT ` + projectColumns + `
 		FROM projects
-		WHERE id = $1
-	`
-
-	var project model.Project
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&project.ID,
-		&project.Name,
-		&project.Description,
-		&project.CreatedAt,
-		&project.UpdatedAt,
-	)
+		WHERE id = $1 AND organization_id = $2`
 
+	project, err := scanProject(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return &project, err
+	return project, err
 }
 
-func (r *projectRepository) GetAll(ctx context.Context) ([]model.Project, error) {
+var projectSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+		"updated_at": {Column: "updated_at", Cast: "timestamptz"},
+		"name":       {Column: "name", Cast: "text"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
+}
+
+func (r *projectRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Project], error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &pagination.Query{}
+	q.Where("organization_id = " + q.Arg(orgID))
+	q.Search(params.Search, "name", "description")
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM projects ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, projectSorts)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT ` + projectColumns + `
 		FROM projects
-		ORDER BY created_at DESC
-	`
+		` + q.WhereClause() + `
+		` + suffix
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,53 +127,60 @@ func (r *projectRepository) GetAll(ctx context.Context) ([]model.Project, error)
 
 	var projects []model.Project
 	for rows.Next() {
-		var project model.Project
-		err := rows.Scan(
-			&project.ID,
-			&project.Name,
-			&project.Description,
-			&project.CreatedAt,
-			&project.UpdatedAt,
-		)
+		project, err := scanProject(rows)
 		if err != nil {
 			return nil, err
 		}
-		projects = append(projects, project)
+		projects = append(projects, *project)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return projects, nil
+	return pagination.NewPage(projects, total, params, projectSorts, func(p model.Project, sort string) (string, uuid.UUID) {
+		switch sort {
+		case "name":
+			return p.Name, p.ID
+		case "updated_at":
+			return p.UpdatedAt.Format(time.RFC3339Nano), p.ID
+		default:
+			return p.CreatedAt.Format(time.RFC3339Nano), p.ID
+		}
+	}), nil
 }
 
+// Update changes a project if it is still at the version the request names,
+// if any, and returns nil if it isn't or there is no such project
 func (r *projectRepository) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateProjectRequest) (*model.Project, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		UPDATE projects
 		SET name = COALESCE($1, name),
 			description = COALESCE($2, description),
+			version = version + 1,
 			updated_at = $3
-		WHERE id = $4
-		RETURNING id, name, description, created_at, updated_at
-	`
-
-	var project model.Project
-	now := time.Now()
-
-	err := r.db.QueryRowContext(ctx, query,
-		req.Name, req.Description, now, id).Scan(
-		&project.ID,
-		&project.Name,
-		&project.Description,
-		&project.CreatedAt,
-		&project.UpdatedAt,
-	)
+		WHERE id = $4 AND organization_id = $5 AND ($6::int IS NULL OR version = $6)
+		RETURNING ` + projectColumns
 
+	project, err := scanProject(conn(ctx, r.db).QueryRowContext(ctx, query,
+		req.Name, req.Description, time.Now(), id, orgID, req.Version))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return &project, err
+	return project, err
 }
 
 func (r *projectRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM projects WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM projects WHERE id = $1 AND organization_id = $2`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
 	return err
 }
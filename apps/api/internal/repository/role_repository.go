@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+// List returns every role with its permissions, built-in roles first
+func (r *roleRepository) List(ctx context.Context) ([]model.Role, error) {
+	query := `
+		SELECT name, description, built_in, created_at, updated_at
+		FROM roles
+		ORDER BY built_in DESC, name
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []model.Role{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var role model.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt, &role.UpdatedAt); err != nil {
+			return nil, err
+		}
+		role.Permissions = []model.RolePermission{}
+		index[role.Name] = len(roles)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	permRows, err := conn(ctx, r.db).QueryContext(ctx, `
+		SELECT role, permission, non_production, environment_ids
+		FROM role_permissions
+		ORDER BY role, permission
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer permRows.Close()
+
+	for permRows.Next() {
+		var roleName string
+		var permission model.RolePermission
+		err := permRows.Scan(&roleName, &permission.Permission, &permission.NonProduction, pq.Array(&permission.EnvironmentIDs))
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[roleName]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, permission)
+		}
+	}
+
+	return roles, permRows.Err()
+}
+
+// GetByName returns a role with its permissions, or nil if it doesn't exist
+func (r *roleRepository) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	var role model.Role
+	query := `SELECT name, description, built_in, created_at, updated_at FROM roles WHERE name = $1`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, name).Scan(&role.Name, &role.Description, &role.BuiltIn, &role.CreatedAt, &role.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, `
+		SELECT permission, non_production, environment_ids
+		FROM role_permissions
+		WHERE role = $1
+		ORDER BY permission
+	`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	role.Permissions = []model.RolePermission{}
+	for rows.Next() {
+		var permission model.RolePermission
+		if err := rows.Scan(&permission.Permission, &permission.NonProduction, pq.Array(&permission.EnvironmentIDs)); err != nil {
+			return nil, err
+		}
+		role.Permissions = append(role.Permissions, permission)
+	}
+
+	return &role, rows.Err()
+}
+
+// Create inserts a custom role and its permissions
+func (r *roleRepository) Create(ctx context.Context, role *model.Role) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+	query := `
+		INSERT INTO roles (name, description, built_in, created_at, updated_at)
+		VALUES ($1, $2, FALSE, $3, $4)
+	`
+	if _, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.CreatedAt, role.UpdatedAt); err != nil {
+		return err
+	}
+	if err := insertRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update replaces a role's description and permissions
+func (r *roleRepository) Update(ctx context.Context, role *model.Role) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	role.UpdatedAt = time.Now()
+	query := `UPDATE roles SET description = $1, updated_at = $2 WHERE name = $3`
+	if _, err := tx.ExecContext(ctx, query, role.Description, role.UpdatedAt, role.Name); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1`, role.Name); err != nil {
+		return err
+	}
+	if err := insertRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *roleRepository) Delete(ctx context.Context, name string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	return err
+}
+
+// CountAssignments counts the users, project memberships and project teams
+// holding a role
+func (r *roleRepository) CountAssignments(ctx context.Context, name string) (int, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM users WHERE role = $1)
+			+ (SELECT COUNT(*) FROM project_members WHERE role = $1)
+			+ (SELECT COUNT(*) FROM project_teams WHERE role = $1)
+	`
+	var count int
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, name).Scan(&count)
+	return count, err
+}
+
+func insertRolePermissions(ctx context.Context, tx DBTX, role *model.Role) error {
+	query := `
+		INSERT INTO role_permissions (role, permission, non_production, environment_ids)
+		VALUES ($1, $2, $3, $4)
+	`
+	for _, permission := range role.Permissions {
+		envIDs := permission.EnvironmentIDs
+		if envIDs == nil {
+			envIDs = []uuid.UUID{}
+		}
+		_, err := tx.ExecContext(ctx, query, role.Name, permission.Permission, permission.NonProduction, pq.Array(envIDs))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+// Create stores a new session together with its first refresh token
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session, token *model.RefreshToken) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, last_used_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastUsedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRefreshToken(ctx context.Context, tx DBTX, token *model.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	return tx.QueryRowContext(ctx, query,
+		token.ID, token.SessionID, token.TokenHash, token.ExpiresAt,
+	).Scan(&token.CreatedAt)
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at, revoked_reason
+		FROM sessions
+		WHERE id = $1
+	`
+	var session model.Session
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+		&session.RevokedAt, &session.RevokedReason,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	query := `
+		SELECT id, session_id, token_hash, created_at, expires_at, used_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	var token model.RefreshToken
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID, &token.SessionID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Rotate marks a refresh token as used, stores its replacement and extends
+// the session to the replacement's expiry. It returns false without storing
+// anything if the token had already been used, which happens when two
+// requests race to redeem the same token.
+func (r *sessionRepository) Rotate(ctx context.Context, usedTokenID uuid.UUID, next *model.RefreshToken) (bool, error) {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL
+	`, usedTokenID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sessions SET last_used_at = NOW(), expires_at = $2
+		WHERE id = $1
+	`, next.SessionID, next.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// CheckActive reports whether the user is active and the session belongs to
+// them and is neither revoked nor expired
+func (r *sessionRepository) CheckActive(ctx context.Context, sessionID, userID uuid.UUID) (bool, bool, error) {
+	query := `
+		SELECT COALESCE(u.active, false), s.revoked_at IS NULL AND s.expires_at > NOW()
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.user_id = $2
+	`
+	var userActive, sessionActive bool
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, sessionID, userID).Scan(&userActive, &sessionActive)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return userActive, sessionActive, nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, reason)
+	return err
+}
+
+// RevokeAllForUser revokes every active session of a user and returns how
+// many were revoked
+func (r *sessionRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID, reason string) (int64, error) {
+	query := `
+		UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeOthersForUser revokes every active session of a user except one,
+// e.g. the session a password was changed from
+func (r *sessionRepository) RevokeOthersForUser(ctx context.Context, userID, keepID uuid.UUID, reason string) (int64, error) {
+	query := `
+		UPDATE sessions SET revoked_at = NOW(), revoked_reason = $3
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, keepID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
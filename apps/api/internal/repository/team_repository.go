@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"api/internal/model"
+	"api/internal/pagination"
+
+	"github.com/google/uuid"
+)
+
+var teamSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "t.created_at", Cast: "timestamptz"},
+		"name":       {Column: "t.name", Cast: "text"},
+	},
+	Default: "name",
+}
+
+type teamRepository struct {
+	db *sql.DB
+}
+
+func NewTeamRepository(db *sql.DB) TeamRepository {
+	return &teamRepository{db: db}
+}
+
+const teamColumns = `t.id, t.organization_id, t.name, t.description,
+	(SELECT COUNT(*) FROM team_members m WHERE m.team_id = t.id),
+	t.created_at, t.updated_at`
+
+func scanTeam(row rowScanner) (*model.Team, error) {
+	team := &model.Team{}
+	err := row.Scan(&team.ID, &team.OrganizationID, &team.Name, &team.Description,
+		&team.MemberCount, &team.CreatedAt, &team.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return team, nil
+}
+
+// Create creates a team in the context's organisation
+func (r *teamRepository) Create(ctx context.Context, team *model.Team) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	team.ID = uuid.New()
+	team.OrganizationID = orgID
+	query := `
+		INSERT INTO teams (id, organization_id, name, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, updated_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, team.ID, team.OrganizationID, team.Name, team.Description).
+		Scan(&team.CreatedAt, &team.UpdatedAt)
+}
+
+// GetByID returns a team of the context's organisation, or nil if there is
+// none
+func (r *teamRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Team, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + teamColumns + ` FROM teams t WHERE t.id = $1 AND t.organization_id = $2`
+	return scanTeam(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID))
+}
+
+// GetByName returns the context organisation's team with a name, or nil if
+// there is none
+func (r *teamRepository) GetByName(ctx context.Context, name string) (*model.Team, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + teamColumns + ` FROM teams t WHERE t.name = $1 AND t.organization_id = $2`
+	return scanTeam(conn(ctx, r.db).QueryRowContext(ctx, query, name, orgID))
+}
+
+// List returns a page of the context organisation's teams, searching names
+// and descriptions. With the member filter only the teams of that user are
+// listed.
+func (r *teamRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Team], error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &pagination.Query{}
+	q.Where("t.organization_id = " + q.Arg(orgID))
+	q.Search(params.Search, "t.name", "t.description")
+	if member := params.Filter("member"); member != "" {
+		userID, err := uuid.Parse(member)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
+		}
+		q.Where("t.id IN (SELECT team_id FROM team_members WHERE user_id = " + q.Arg(userID) + ")")
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM teams t ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	suffix, err := q.Paginate(params, teamSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + teamColumns + ` FROM teams t ` + q.WhereClause() + ` ` + suffix
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []model.Team
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, *team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(teams, total, params, teamSorts, func(t model.Team, sort string) (string, uuid.UUID) {
+		if sort == "created_at" {
+			return t.CreatedAt.Format(time.RFC3339Nano), t.ID
+		}
+		return t.Name, t.ID
+	}), nil
+}
+
+// Update renames a team or changes its description
+func (r *teamRepository) Update(ctx context.Context, team *model.Team) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE teams SET name = $2, description = $3, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $4
+		RETURNING updated_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, team.ID, team.Name, team.Description, orgID).Scan(&team.UpdatedAt)
+}
+
+// Delete deletes a team with its memberships and project roles. Flags it
+// owned are left without an owner.
+func (r *teamRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM teams WHERE id = $1 AND organization_id = $2`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return err
+	}
+
+	query := `
+		UPDATE flags SET owner_type = NULL, owner_id = NULL, version = version + 1, updated_at = NOW()
+		WHERE owner_type = $1 AND owner_id = $2 AND ` + inOrganization("project_id", "$3")
+	if _, err := tx.ExecContext(ctx, query, model.OwnerTypeTeam, id, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListMembers returns a team's members with their usernames and emails
+func (r *teamRepository) ListMembers(ctx context.Context, teamID uuid.UUID) ([]model.TeamMember, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT m.team_id, m.user_id, m.role, u.username, u.email, m.created_at, m.updated_at
+		FROM team_members m
+		JOIN teams t ON t.id = m.team_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1 AND t.organization_id = $2
+		ORDER BY u.username
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, teamID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.TeamMember{}
+	for rows.Next() {
+		var member model.TeamMember
+		err := rows.Scan(
+			&member.TeamID, &member.UserID, &member.Role, &member.Username,
+			&member.Email, &member.CreatedAt, &member.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds a user to a team or changes their team role. The team and
+// the user must both belong to the context's organisation.
+func (r *teamRepository) SetMember(ctx context.Context, member *model.TeamMember) error {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO team_members (team_id, user_id, role)
+		SELECT $1, $2, $3
+		WHERE EXISTS (SELECT 1 FROM teams WHERE id = $1 AND organization_id = $4)
+			AND EXISTS (SELECT 1 FROM users WHERE id = $2 AND organization_id = $4)
+		ON CONFLICT (team_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, member.TeamID, member.UserID, member.Role, orgID).
+		Scan(&member.CreatedAt, &member.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTeamOutsideOrganization
+	}
+	return err
+}
+
+// RemoveMember takes a user out of a team, returning whether they were in it
+func (r *teamRepository) RemoveMember(ctx context.Context, teamID, userID uuid.UUID) (bool, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM team_members
+		WHERE team_id = $1 AND user_id = $2
+			AND team_id IN (SELECT id FROM teams WHERE organization_id = $3)
+	`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, teamID, userID, orgID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// TeamExists reports whether a team exists in the context's organisation
+func (r *teamRepository) TeamExists(ctx context.Context, teamID uuid.UUID) (bool, error) {
+	orgID, err := organizationID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM teams WHERE id = $1 AND organization_id = $2)`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, teamID, orgID).Scan(&exists)
+	return exists, err
+}
+
+// MemberRole returns a user's role in a team, or an empty string if they
+// aren't a member
+func (r *teamRepository) MemberRole(ctx context.Context, teamID, userID uuid.UUID) (string, error) {
+	var role string
+	query := `SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, teamID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoOrganization is returned by queries on tenant data when the context
+// names no organisation; scoped queries fail closed rather than reading
+// across tenants
+var ErrNoOrganization = errors.New("no organization in context")
+
+// ErrProjectOutsideOrganization is returned when creating a resource in a
+// project the context's organisation doesn't own
+var ErrProjectOutsideOrganization = errors.New("project not in organization")
+
+// ErrTeamOutsideOrganization is returned when adding to a team, or granting
+// a role to one, outside the context's organisation
+var ErrTeamOutsideOrganization = errors.New("team not in organization")
+
+// organizationID returns the organisation ctx acts in
+func organizationID(ctx context.Context) (uuid.UUID, error) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return uuid.Nil, ErrNoOrganization
+	}
+	return org.ID, nil
+}
+
+// inOrganization is a condition restricting a project ID column to the
+// projects of an organisation, given as a query argument placeholder
+func inOrganization(projectColumn, orgArg string) string {
+	return projectColumn + " IN (SELECT id FROM projects WHERE organization_id = " + orgArg + ")"
+}
+
+// flagInOrganization is a condition restricting a flag ID column to the
+// flags of an organisation's projects
+func flagInOrganization(flagColumn, orgArg string) string {
+	return flagColumn + " IN (SELECT id FROM flags WHERE " + inOrganization("project_id", orgArg) + ")"
+}
+
+// insertedInOrganization checks the result of an INSERT ... SELECT guarded
+// by inOrganization, which writes nothing for projects of other tenants
+func insertedInOrganization(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrProjectOutsideOrganization
+	}
+	return nil
+}
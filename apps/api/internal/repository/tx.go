@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is the query interface shared by *sql.DB and *sql.Tx. Repositories
+// run every statement through the one the context carries, so calls made
+// within TxManager.WithinTx share its transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TxManager runs units of work spanning several repository calls in one
+// transaction
+type TxManager interface {
+	// WithinTx runs fn in a transaction, committing if it returns nil and
+	// rolling back otherwise. Repository calls made with the context fn is
+	// given join the transaction, as do nested WithinTx calls.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txManager struct {
+	db *sql.DB
+}
+
+func NewTxManager(db *sql.DB) TxManager {
+	return &txManager{db: db}
+}
+
+type txKey struct{}
+
+// unitOfWork is the transaction a context carries, with the callbacks to
+// run once it commits. It is used by one goroutine at a time.
+type unitOfWork struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+func (m *txManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	work := &unitOfWork{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, work)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, callback := range work.afterCommit {
+		callback()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction the context carries commits, and
+// never if it rolls back. Outside a transaction fn runs straight away.
+// Services use it for side effects such as SSE broadcasts and cache
+// invalidation, which must not announce changes that could be undone.
+func AfterCommit(ctx context.Context, fn func()) {
+	if work, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		work.afterCommit = append(work.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// conn returns the transaction the context carries, or db outside one
+func conn(ctx context.Context, db *sql.DB) DBTX {
+	if work, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return work.tx
+	}
+	return db
+}
+
+// scopedTx is a transaction begun by a repository method writing several
+// statements. When the method runs within a unit of work it joins that
+// transaction instead, and leaves committing and rolling back to its owner.
+type scopedTx struct {
+	*sql.Tx
+	joined bool
+}
+
+func beginTx(ctx context.Context, db *sql.DB) (*scopedTx, error) {
+	if work, ok := ctx.Value(txKey{}).(*unitOfWork); ok {
+		return &scopedTx{Tx: work.tx, joined: true}, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &scopedTx{Tx: tx}, nil
+}
+
+func (t *scopedTx) Commit() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *scopedTx) Rollback() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
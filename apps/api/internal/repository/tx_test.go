@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// txLog is a database/sql driver that runs no statements but records when
+// transactions begin, commit and roll back, in order with the after-commit
+// callbacks the tests append to the same log
+type txLog struct {
+	mutex     sync.Mutex
+	events    []string
+	commitErr error
+}
+
+func (l *txLog) record(event string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *txLog) Connect(ctx context.Context) (driver.Conn, error) { return txLogConn{l}, nil }
+func (l *txLog) Driver() driver.Driver                            { return nil }
+
+type txLogConn struct{ log *txLog }
+
+func (c txLogConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("txLog runs no statements")
+}
+func (c txLogConn) Close() error { return nil }
+func (c txLogConn) Begin() (driver.Tx, error) {
+	c.log.record("begin")
+	return txLogTx(c), nil
+}
+
+type txLogTx struct{ log *txLog }
+
+func (t txLogTx) Commit() error {
+	if t.log.commitErr != nil {
+		t.log.record("commit failed")
+		return t.log.commitErr
+	}
+	t.log.record("commit")
+	return nil
+}
+
+func (t txLogTx) Rollback() error {
+	t.log.record("rollback")
+	return nil
+}
+
+func newTxLog(t *testing.T) (*txLog, TxManager) {
+	t.Helper()
+	log := &txLog{}
+	db := sql.OpenDB(log)
+	t.Cleanup(func() { db.Close() })
+	return log, NewTxManager(db)
+}
+
+func TestWithinTxAfterCommit(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name      string
+		commitErr error
+		fn        func(log *txLog, tx TxManager) func(ctx context.Context) error
+		wantErr   error
+		want      []string
+	}{
+		{
+			name: "committed",
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					AfterCommit(ctx, func() { log.record("first callback") })
+					AfterCommit(ctx, func() { log.record("second callback") })
+					log.record("work done")
+					return nil
+				}
+			},
+			want: []string{"begin", "work done", "commit", "first callback", "second callback"},
+		},
+		{
+			name: "rolled back",
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					AfterCommit(ctx, func() { log.record("callback") })
+					return errFailed
+				}
+			},
+			wantErr: errFailed,
+			want:    []string{"begin", "rollback"},
+		},
+		{
+			name:      "commit fails",
+			commitErr: errFailed,
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					AfterCommit(ctx, func() { log.record("callback") })
+					return nil
+				}
+			},
+			wantErr: errFailed,
+			want:    []string{"begin", "commit failed"},
+		},
+		{
+			name: "nested call waits for the outer commit",
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					err := tx.WithinTx(ctx, func(ctx context.Context) error {
+						AfterCommit(ctx, func() { log.record("inner callback") })
+						return nil
+					})
+					log.record("inner returned")
+					return err
+				}
+			},
+			want: []string{"begin", "inner returned", "commit", "inner callback"},
+		},
+		{
+			name: "nested call rolled back with the outer one",
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if err := tx.WithinTx(ctx, func(ctx context.Context) error {
+						AfterCommit(ctx, func() { log.record("inner callback") })
+						return nil
+					}); err != nil {
+						return err
+					}
+					return errFailed
+				}
+			},
+			wantErr: errFailed,
+			want:    []string{"begin", "rollback"},
+		},
+		{
+			name: "repository transaction joins the unit of work",
+			fn: func(log *txLog, tx TxManager) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					scoped, err := beginTx(ctx, nil)
+					if err != nil {
+						return err
+					}
+					AfterCommit(ctx, func() { log.record("callback") })
+					if err := scoped.Commit(); err != nil {
+						return err
+					}
+					log.record("repository committed")
+					return nil
+				}
+			},
+			want: []string{"begin", "repository committed", "commit", "callback"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, tx := newTxLog(t)
+			log.commitErr = tt.commitErr
+
+			err := tx.WithinTx(context.Background(), tt.fn(log, tx))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(log.events, tt.want) {
+				t.Errorf("events = %q, want %q", log.events, tt.want)
+			}
+		})
+	}
+}
+
+// A panicking unit of work rolls back without running its callbacks
+func TestWithinTxPanic(t *testing.T) {
+	log, tx := newTxLog(t)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithinTx swallowed the panic")
+			}
+		}()
+		tx.WithinTx(context.Background(), func(ctx context.Context) error {
+			AfterCommit(ctx, func() { log.record("callback") })
+			panic("boom")
+		})
+	}()
+
+	if want := []string{"begin", "rollback"}; !reflect.DeepEqual(log.events, want) {
+		t.Errorf("events = %q, want %q", log.events, want)
+	}
+}
+
+// Outside a transaction there's nothing to wait for
+func TestAfterCommitWithoutTx(t *testing.T) {
+	ran := false
+	AfterCommit(context.Background(), func() { ran = true })
+	if !ran {
+		t.Error("callback didn't run straight away")
+	}
+}
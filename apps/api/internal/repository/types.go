@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 	"api/internal/dto"
 	"api/internal/model"
+	"api/internal/pagination"
 	"github.com/google/uuid"
 )
 
@@ -12,7 +14,7 @@ import (
 type ProjectRepository interface {
 	Create(ctx context.Context, project *model.Project) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Project, error)
-	GetAll(ctx context.Context) ([]model.Project, error)
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Project], error)
 	Update(ctx context.Context, id uuid.UUID, req *dto.UpdateProjectRequest) (*model.Project, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -20,7 +22,8 @@ type ProjectRepository interface {
 type EnvironmentRepository interface {
 	Create(ctx context.Context, env *model.Environment) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Environment, error)
-	GetAll(ctx context.Context) ([]model.Environment, error)
+	GetByKey(ctx context.Context, projectID uuid.UUID, key string) (*model.Environment, error)
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Environment], error)
 	GetByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.Environment, error)
 	Update(ctx context.Context, id uuid.UUID, req *dto.UpdateEnvironmentRequest) (*model.Environment, error)
 	Delete(ctx context.Context, id uuid.UUID) error
@@ -30,16 +33,135 @@ type FlagRepository interface {
 	Create(ctx context.Context, flag *model.Flag) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.Flag, error)
 	GetByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.Flag, error)
+	List(ctx context.Context, projectID uuid.UUID, params pagination.Params) (*pagination.Page[model.Flag], error)
 	GetWithValuesByProjectID(ctx context.Context, projectID uuid.UUID) ([]model.FlagWithValues, error)
+	WithValues(ctx context.Context, flags []model.Flag) ([]model.FlagWithValues, error)
 	Update(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagRequest) (*model.Flag, error)
+	SetStatus(ctx context.Context, id uuid.UUID, status string) (*model.Flag, error)
+	GetStale(ctx context.Context, projectID uuid.UUID, olderThan time.Time) ([]model.StaleFlag, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 type FlagValueRepository interface {
 	Create(ctx context.Context, flagValue *model.FlagValue) error
+	CreateDefaults(ctx context.Context, flag *model.Flag) ([]model.FlagValue, error)
+	FillEnvironment(ctx context.Context, env *model.Environment, sourceID uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*model.FlagValue, error)
 	GetByFlagID(ctx context.Context, flagID uuid.UUID) ([]model.FlagValue, error)
 	GetByEnvID(ctx context.Context, envID uuid.UUID) ([]model.FlagValue, error)
 	Update(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagValueRequest) (*model.FlagValue, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	Promote(ctx context.Context, promotion *model.Promotion) error
+}
+
+type EvaluationRepository interface {
+	Increment(ctx context.Context, counts []model.EvaluationCount) error
+	GetByFlagID(ctx context.Context, flagID uuid.UUID, since time.Time, unit string) ([]model.EvaluationCount, error)
+	GetLastEvaluatedByEnv(ctx context.Context, flagID uuid.UUID) (map[uuid.UUID]time.Time, error)
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session, token *model.RefreshToken) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	Rotate(ctx context.Context, usedTokenID uuid.UUID, next *model.RefreshToken) (bool, error)
+	CheckActive(ctx context.Context, sessionID, userID uuid.UUID) (userActive bool, sessionActive bool, err error)
+	Revoke(ctx context.Context, id uuid.UUID, reason string) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID, reason string) (int64, error)
+	RevokeOthersForUser(ctx context.Context, userID, keepID uuid.UUID, reason string) (int64, error)
+}
+
+type OIDCStateRepository interface {
+	Create(ctx context.Context, state *model.OIDCLoginState) error
+	Consume(ctx context.Context, state string) (*model.OIDCLoginState, error)
+}
+
+type MFARepository interface {
+	SetSecret(ctx context.Context, userID uuid.UUID, secret string) error
+	Enable(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error
+	Disable(ctx context.Context, userID uuid.UUID) error
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+}
+
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *model.UserToken) error
+	Consume(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error)
+}
+
+type LoginThrottleRepository interface {
+	LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time, window time.Duration) error
+	Clear(ctx context.Context, key string) (bool, error)
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, event *model.AuditEvent) error
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.AuditEvent], error)
+}
+
+type ProjectMemberRepository interface {
+	List(ctx context.Context, projectID uuid.UUID) ([]model.ProjectMember, error)
+	Set(ctx context.Context, member *model.ProjectMember) error
+	Delete(ctx context.Context, projectID, userID uuid.UUID) (bool, error)
+	ListTeams(ctx context.Context, projectID uuid.UUID) ([]model.ProjectTeam, error)
+	SetTeam(ctx context.Context, team *model.ProjectTeam) error
+	DeleteTeam(ctx context.Context, projectID, teamID uuid.UUID) (bool, error)
+	MemberRoles(ctx context.Context, projectID, userID uuid.UUID) ([]string, error)
+	ProjectExists(ctx context.Context, projectID uuid.UUID) (bool, error)
+	ProjectOfEnvironment(ctx context.Context, envID uuid.UUID) (uuid.UUID, error)
+	ProjectOfFlag(ctx context.Context, flagID uuid.UUID) (uuid.UUID, error)
+	ProjectOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error)
+	EnvironmentOfFlagValue(ctx context.Context, valueID uuid.UUID) (uuid.UUID, error)
+	EnvironmentInfo(ctx context.Context, envID uuid.UUID) (uuid.UUID, string, bool, error)
+	EnvironmentByKey(ctx context.Context, projectID uuid.UUID, key string) (uuid.UUID, error)
+}
+
+type RoleRepository interface {
+	List(ctx context.Context) ([]model.Role, error)
+	GetByName(ctx context.Context, name string) (*model.Role, error)
+	Create(ctx context.Context, role *model.Role) error
+	Update(ctx context.Context, role *model.Role) error
+	Delete(ctx context.Context, name string) error
+	CountAssignments(ctx context.Context, name string) (int, error)
+}
+
+type AccessTokenRepository interface {
+	Create(ctx context.Context, token *model.AccessToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*model.AccessToken, error)
+	ListForUser(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error)
+	Revoke(ctx context.Context, userID, tokenID uuid.UUID) (bool, error)
+	Touch(ctx context.Context, tokenID uuid.UUID) error
+}
+
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *model.Organization) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*model.Organization, error)
+	GetHost(ctx context.Context) (*model.Organization, error)
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Organization], error)
+	Update(ctx context.Context, org *model.Organization) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type TeamRepository interface {
+	Create(ctx context.Context, team *model.Team) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Team, error)
+	GetByName(ctx context.Context, name string) (*model.Team, error)
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.Team], error)
+	Update(ctx context.Context, team *model.Team) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListMembers(ctx context.Context, teamID uuid.UUID) ([]model.TeamMember, error)
+	SetMember(ctx context.Context, member *model.TeamMember) error
+	RemoveMember(ctx context.Context, teamID, userID uuid.UUID) (bool, error)
+	TeamExists(ctx context.Context, teamID uuid.UUID) (bool, error)
+	MemberRole(ctx context.Context, teamID, userID uuid.UUID) (string, error)
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, req *model.IdempotentRequest, lease time.Duration) (*model.IdempotentRequest, error)
+	Complete(ctx context.Context, req *model.IdempotentRequest, window time.Duration) error
+	Release(ctx context.Context, req *model.IdempotentRequest) error
+	DeleteExpired(ctx context.Context) (int64, error)
 }
@@ -2,9 +2,12 @@ package repository
 
 import (
 	"api/internal/model"
+	"api/internal/pagination"
 	"context"
 	"database/sql"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,10 +15,16 @@ import (
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
+	CreateFirst(ctx context.Context, user *model.User) (bool, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetByUsername(ctx context.Context, username string) (*model.User, error)
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*model.User, error)
+	List(ctx context.Context, params pagination.Params) (*pagination.Page[model.User], error)
+	CountActiveAdmins(ctx context.Context, organizationID uuid.UUID) (int, error)
 	Update(ctx context.Context, id uuid.UUID, user *model.User) error
+	SetPassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	SetEmailVerified(ctx context.Context, id uuid.UUID, email string) (bool, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -29,30 +38,30 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-// Create creates a new user
-func (r *userRepository) Create(ctx context.Context, user *model.User) error {
-	query := `
-		INSERT INTO users (id, username, email, password, role, first_name, last_name, active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-	_, err := r.db.ExecContext(ctx, query,
-		user.ID, user.Username, user.Email, user.Password,
-		user.Role, user.FirstName, user.LastName, user.Active)
-	return err
+var userSorts = pagination.Sortable{
+	Fields: map[string]pagination.SortField{
+		"created_at": {Column: "created_at", Cast: "timestamptz"},
+		"username":   {Column: "username", Cast: "text"},
+		"email":      {Column: "email", Cast: "text"},
+	},
+	Default:     "created_at",
+	DefaultDesc: true,
 }
 
-// GetByID retrieves a user by ID
-func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
-	query := `
-		SELECT id, username, email, password, role, first_name, last_name, active, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
+// userColumns is the select list shared by every user query
+const userColumns = `
+	id, username, email, password, role, first_name, last_name, active, email_verified,
+	auth_provider, external_id, mfa_secret, mfa_enabled, account_type, organization_id,
+	created_at, updated_at
+`
+
+func scanUser(row rowScanner) (*model.User, error) {
 	user := &model.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := row.Scan(
 		&user.ID, &user.Username, &user.Email, &user.Password,
-		&user.Role, &user.FirstName, &user.LastName, &user.Active,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.Role, &user.FirstName, &user.LastName, &user.Active, &user.EmailVerified,
+		&user.AuthProvider, &user.ExternalID, &user.MFASecret, &user.MFAEnabled,
+		&user.AccountType, &user.OrganizationID, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -63,66 +72,216 @@ func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 	return user, nil
 }
 
-// GetByUsername retrieves a user by username
-func (r *userRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+// Create creates a new user
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	return insertUser(ctx, conn(ctx, r.db), user)
+}
+
+// CreateFirst creates the user only while there are no users at all,
+// returning whether it did. The table is locked for the check, so of
+// concurrent calls only one can create the first user.
+func (r *userRepository) CreateFirst(ctx context.Context, user *model.User) (bool, error) {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return false, err
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users)`).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func insertUser(ctx context.Context, db DBTX, user *model.User) error {
+	if user.AuthProvider == "" {
+		user.AuthProvider = model.AuthProviderPassword
+	}
+	if user.AccountType == "" {
+		user.AccountType = model.AccountTypeUser
+	}
+
 	query := `
-		SELECT id, username, email, password, role, first_name, last_name, active, created_at, updated_at
-		FROM users
-		WHERE username = $1
+		INSERT INTO users (id, username, email, password, role, first_name, last_name, active, auth_provider, external_id, account_type, organization_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING created_at, updated_at
 	`
-	user := &model.User{}
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password,
-		&user.Role, &user.FirstName, &user.LastName, &user.Active,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	return db.QueryRowContext(ctx, query,
+		user.ID, user.Username, user.Email, user.Password,
+		user.Role, user.FirstName, user.LastName, user.Active,
+		user.AuthProvider, user.ExternalID, user.AccountType, user.OrganizationID,
+	).Scan(&user.CreatedAt, &user.UpdatedAt)
+}
+
+// GetByID retrieves a user by ID in any organisation; services check the
+// organisation before acting on a user for a tenant
+func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+// GetByUsername retrieves a user by username
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, username))
+}
+
+// GetByEmail retrieves a user by email
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	return scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, email))
+}
+
+// GetByExternalID retrieves a user by their identity at an external provider
+func (r *userRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE auth_provider = $1 AND external_id = $2`
+	return scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, provider, externalID))
+}
+
+// List returns a page of the organisation's users, searching username,
+// email and name and filtered by the role, active and type filters
+func (r *userRepository) List(ctx context.Context, params pagination.Params) (*pagination.Page[model.User], error) {
+	orgID, err := organizationID(ctx)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+		return nil, err
+	}
+
+	q := &pagination.Query{}
+	q.Where("organization_id = " + q.Arg(orgID))
+	q.Search(params.Search, "username", "email", "first_name", "last_name")
+	if role := params.Filter("role"); role != "" {
+		q.Where("role = " + q.Arg(role))
+	}
+	if active := params.Filter("active"); active != "" {
+		value, err := strconv.ParseBool(active)
+		if err != nil {
+			return nil, pagination.ErrInvalidFilter
 		}
+		q.Where("active = " + q.Arg(value))
+	}
+	if accountType := params.Filter("type"); accountType != "" {
+		q.Where("account_type = " + q.Arg(accountType))
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM users ` + q.WhereClause()
+	if err := conn(ctx, r.db).QueryRowContext(ctx, countQuery, q.Args()...).Scan(&total); err != nil {
 		return nil, err
 	}
-	return user, nil
-}
 
-// GetByEmail retrieves a user by email
-func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
-	query := `
-		SELECT id, username, email, password, role, first_name, last_name, active, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
-	user := &model.User{}
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password,
-		&user.Role, &user.FirstName, &user.LastName, &user.Active,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	suffix, err := q.Paginate(params, userSorts)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+		return nil, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users ` + q.WhereClause() + ` ` + suffix
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, q.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
 		}
+		users = append(users, *user)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	return user, nil
+
+	return pagination.NewPage(users, total, params, userSorts, func(u model.User, sort string) (string, uuid.UUID) {
+		switch sort {
+		case "username":
+			return u.Username, u.ID
+		case "email":
+			return u.Email, u.ID
+		default:
+			return u.CreatedAt.Format(time.RFC3339Nano), u.ID
+		}
+	}), nil
 }
 
-// Update updates an existing user
+// CountActiveAdmins returns how many active users of an organisation have
+// the admin role
+func (r *userRepository) CountActiveAdmins(ctx context.Context, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM users
+		WHERE organization_id = $1 AND role = 'admin' AND active = true AND account_type = 'user'
+	`
+	var count int
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, organizationID).Scan(&count)
+	return count, err
+}
+
+// Update updates an existing user. Changing the email address clears its
+// verification.
 func (r *userRepository) Update(ctx context.Context, id uuid.UUID, user *model.User) error {
 	query := `
 		UPDATE users
-		SET username = $2, email = $3, role = $4, first_name = $5, last_name = $6, active = $7, updated_at = NOW()
+		SET username = $2, email = $3, role = $4, first_name = $5, last_name = $6, active = $7,
+			auth_provider = $8, external_id = $9, email_verified = (email_verified AND email = $3),
+			updated_at = NOW()
 		WHERE id = $1
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		id, user.Username, user.Email, user.Role,
-		user.FirstName, user.LastName, user.Active)
+		user.FirstName, user.LastName, user.Active,
+		user.AuthProvider, user.ExternalID)
 	return err
 }
 
-// Delete deletes a user
-func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+// SetPassword replaces a user's password hash
+func (r *userRepository) SetPassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, passwordHash)
 	return err
 }
+
+// SetEmailVerified marks a user's email verified, provided it is still the
+// address the verification was sent to
+func (r *userRepository) SetEmailVerified(ctx context.Context, id uuid.UUID, email string) (bool, error) {
+	query := `UPDATE users SET email_verified = true, updated_at = NOW() WHERE id = $1 AND email = $2`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id, email)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// Delete deletes a user, releasing the flags they own
+func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE flags SET owner_type = NULL, owner_id = NULL, version = version + 1 WHERE owner_type = 'user' AND owner_id = $1`
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
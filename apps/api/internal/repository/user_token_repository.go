@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+)
+
+type userTokenRepository struct {
+	db *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) UserTokenRepository {
+	return &userTokenRepository{db: db}
+}
+
+// Create stores a token, invalidating any earlier unused token the user has
+// for the same purpose so only the latest link works
+func (r *userTokenRepository) Create(ctx context.Context, token *model.UserToken) error {
+	tx, err := beginTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	if _, err := tx.ExecContext(ctx, query, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO user_tokens (id, user_id, purpose, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		token.ID, token.UserID, token.Purpose, token.Email, token.TokenHash, token.ExpiresAt,
+	).Scan(&token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Consume marks an unused, unexpired token as used and returns it, or nil if
+// there is no such token
+func (r *userTokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (*model.UserToken, error) {
+	query := `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, email, token_hash, created_at, expires_at, used_at
+	`
+	token := &model.UserToken{}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash, purpose).Scan(
+		&token.ID, &token.UserID, &token.Purpose, &token.Email,
+		&token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
@@ -15,6 +15,23 @@ type Router struct {
 	flagController      *controller.FlagController
 	sseController       *controller.SSEController
 	authController      *controller.AuthController
+	evaluationController *controller.EvaluationController
+	oidcController      *controller.OIDCController
+	mfaController       *controller.MFAController
+	accountController   *controller.AccountController
+	auditController     *controller.AuditController
+	userController      *controller.UserController
+	memberController    *controller.ProjectMemberController
+	roleController      *controller.RoleController
+	tokenController     *controller.AccessTokenController
+	orgController       *controller.OrganizationController
+	teamController      *controller.TeamController
+	authz               *middleware.Authorizer
+	keyRing             *middleware.KeyRing
+	sessions            middleware.SessionValidator
+	tokens              middleware.TokenValidator
+	idempotency         middleware.IdempotencyStore
+	cfg                 *env.Config
 }
 
 func NewRouter(
@@ -24,6 +41,22 @@ func NewRouter(
 	flagController *controller.FlagController,
 	sseController *controller.SSEController,
 	authController *controller.AuthController,
+	evaluationController *controller.EvaluationController,
+	oidcController *controller.OIDCController,
+	mfaController *controller.MFAController,
+	accountController *controller.AccountController,
+	auditController *controller.AuditController,
+	userController *controller.UserController,
+	memberController *controller.ProjectMemberController,
+	roleController *controller.RoleController,
+	tokenController *controller.AccessTokenController,
+	orgController *controller.OrganizationController,
+	teamController *controller.TeamController,
+	authz *middleware.Authorizer,
+	keyRing *middleware.KeyRing,
+	sessions middleware.SessionValidator,
+	tokens middleware.TokenValidator,
+	idempotency middleware.IdempotencyStore,
 	cfg *env.Config,
 ) *Router {
 	router := &Router{
@@ -33,65 +66,203 @@ func NewRouter(
 		flagController:      flagController,
 		sseController:       sseController,
 		authController:      authController,
+		evaluationController: evaluationController,
+		oidcController:      oidcController,
+		mfaController:       mfaController,
+		accountController:   accountController,
+		auditController:     auditController,
+		userController:      userController,
+		memberController:    memberController,
+		roleController:      roleController,
+		tokenController:     tokenController,
+		orgController:       orgController,
+		teamController:      teamController,
+		authz:               authz,
+		keyRing:             keyRing,
+		sessions:            sessions,
+		tokens:              tokens,
+		idempotency:         idempotency,
+		cfg:                 cfg,
 	}
-	
-	// Store JWT secret in router struct
-	// In a real app, you'd want to handle this more securely
+
 	return router
 }
 
 func (r *Router) SetupRoutes() {
+	// Public keys for verifying access tokens
+	r.app.Get("/.well-known/jwks.json", r.authController.JWKS)
+
 	api := r.app.Group("/api")
+	auth := middleware.AuthMiddleware(r.keyRing, r.sessions, r.tokens)
+	// Retried writes to resources with the same Idempotency-Key replay the
+	// first response. Auth and token routes don't take part, as their
+	// responses carry credentials that mustn't be stored.
+	idempotent := middleware.Idempotency(r.idempotency, r.cfg.Idempotency.Window)
 
 	// Authentication routes (public)
 	api.Post("/auth/register", r.authController.Register)
 	api.Post("/auth/login", r.authController.Login)
+	api.Post("/auth/refresh", r.authController.Refresh)
+
+	// Account recovery and email verification
+	api.Post("/auth/password/forgot", r.accountController.ForgotPassword)
+	api.Post("/auth/password/reset", r.accountController.ResetPassword)
+	api.Post("/auth/email/verify", r.accountController.VerifyEmail)
+	api.Post("/auth/invitations/accept", r.accountController.AcceptInvitation)
+
+	// Second factor for logins that returned an MFA challenge token
+	api.Post("/auth/mfa/verify", r.mfaController.Verify)
+	api.Post("/auth/mfa/setup", r.mfaController.Setup)
+	api.Post("/auth/mfa/setup/confirm", r.mfaController.SetupConfirm)
+
+	// Single sign-on, when an OIDC provider is configured
+	if r.oidcController != nil {
+		api.Get("/auth/oidc/login", r.oidcController.Login)
+		api.Get("/auth/oidc/callback", r.oidcController.Callback)
+	}
 	
-	// Profile route (authenticated)
-	api.Get("/auth/profile", r.authController.Profile)
+	// Profile route (authenticated). Account changes need a signed-in
+	// session; access tokens can't make them.
+	session := middleware.RequireSession()
+	api.Get("/auth/profile", auth, r.authController.Profile)
+	api.Post("/auth/logout", auth, session, r.authController.Logout)
+	api.Post("/auth/password/change", auth, session, r.accountController.ChangePassword)
+	api.Post("/auth/email/verify/resend", auth, session, r.accountController.ResendVerification)
+	api.Post("/auth/mfa/enroll", auth, session, r.mfaController.Enroll)
+	api.Post("/auth/mfa/confirm", auth, session, r.mfaController.Confirm)
+	api.Post("/auth/mfa/disable", auth, session, r.mfaController.Disable)
+
+	// Personal access tokens
+	api.Get("/auth/tokens", auth, session, r.tokenController.GetOwnTokens)
+	api.Post("/auth/tokens", auth, session, r.tokenController.CreateOwnToken)
+	api.Delete("/auth/tokens/:id", auth, session, r.tokenController.RevokeOwnToken)
 
-	// SSE endpoint for real-time updates
-	api.Get("/events", r.sseController.RegisterClient)
+	// User administration
+	users := api.Group("/users")
+	users.Use(auth)
+	users.Get("/", middleware.RequireAdmin(), r.userController.GetUsers)
+	users.Post("/invite", idempotent, middleware.RequireAdmin(), r.userController.InviteUser)
+	users.Post("/service-accounts", idempotent, middleware.RequireAdmin(), r.userController.CreateServiceAccount)
+	users.Get("/:id", middleware.RequireAdmin(), r.userController.GetUser)
+	users.Put("/:id/role", idempotent, middleware.RequireAdmin(), r.userController.UpdateRole)
+	users.Post("/:id/activate", idempotent, middleware.RequireAdmin(), r.userController.ActivateUser)
+	users.Post("/:id/deactivate", idempotent, middleware.RequireAdmin(), r.userController.DeactivateUser)
+	users.Delete("/:id", idempotent, middleware.RequireAdmin(), r.userController.DeleteUser)
+	users.Delete("/:id/sessions", idempotent, middleware.RequirePermission(middleware.UserManage), r.authController.RevokeUserSessions)
+	users.Delete("/:id/mfa", idempotent, middleware.RequirePermission(middleware.UserManage), r.mfaController.Reset)
+	users.Post("/:id/unlock", idempotent, middleware.RequirePermission(middleware.UserManage), r.authController.UnlockUser)
+	users.Get("/:id/tokens", middleware.RequireAdmin(), r.tokenController.GetUserTokens)
+	users.Post("/:id/tokens", middleware.RequireAdmin(), r.tokenController.CreateUserToken)
+	users.Delete("/:id/tokens/:tokenId", idempotent, middleware.RequireAdmin(), r.tokenController.RevokeUserToken)
 
-	// Projects (secured with authentication)
+	// The caller's organisation
+	api.Get("/organization", auth, r.orgController.GetCurrent)
+	api.Put("/organization", auth, idempotent, middleware.RequirePermission(middleware.OrganizationManage), r.orgController.UpdateCurrent)
+
+	// Organisations are managed by admins of the host organisation
+	host := middleware.RequireHostOrganization()
+	orgs := api.Group("/organizations")
+	orgs.Use(auth, host, idempotent)
+	orgs.Get("/", middleware.RequirePermission(middleware.OrganizationManage), r.orgController.GetOrganizations)
+	orgs.Post("/", middleware.RequirePermission(middleware.OrganizationManage), r.orgController.CreateOrganization)
+	orgs.Get("/:id", middleware.RequirePermission(middleware.OrganizationManage), r.orgController.GetOrganization)
+	orgs.Put("/:id", middleware.RequirePermission(middleware.OrganizationManage), r.orgController.UpdateOrganization)
+	orgs.Delete("/:id", middleware.RequirePermission(middleware.OrganizationManage), r.orgController.DeleteOrganization)
+
+	// Roles and their permissions. Roles are shared by every organisation,
+	// so only the host organisation changes them.
+	roles := api.Group("/roles")
+	roles.Use(auth, idempotent)
+	roles.Get("/", middleware.RequirePermission(middleware.RoleManage), r.roleController.GetRoles)
+	roles.Post("/", host, middleware.RequirePermission(middleware.RoleManage), r.roleController.CreateRole)
+	roles.Get("/:name", middleware.RequirePermission(middleware.RoleManage), r.roleController.GetRole)
+	roles.Put("/:name", host, middleware.RequirePermission(middleware.RoleManage), r.roleController.UpdateRole)
+	roles.Delete("/:name", host, middleware.RequirePermission(middleware.RoleManage), r.roleController.DeleteRole)
+
+	// Audit trail
+	api.Get("/audit-events", auth, middleware.RequirePermission(middleware.AuditRead), r.auditController.GetEvents)
+
+	// SSE endpoint for real-time updates in the caller's organisation
+	api.Get("/events", auth, r.sseController.RegisterClient)
+
+	// Teams. Maintainers manage their own team's details and members.
+	authz := r.authz
+	teams := api.Group("/teams")
+	teams.Use(auth, idempotent)
+	teams.Get("/", r.teamController.GetTeams)
+	teams.Post("/", middleware.RequirePermission(middleware.TeamManage), r.teamController.CreateTeam)
+	teams.Get("/:id", r.teamController.GetTeam)
+	teams.Put("/:id", authz.RequireTeamMaintainer("id"), r.teamController.UpdateTeam)
+	teams.Delete("/:id", middleware.RequirePermission(middleware.TeamManage), r.teamController.DeleteTeam)
+	teams.Get("/:id/members", r.teamController.GetMembers)
+	teams.Put("/:id/members/:userId", authz.RequireTeamMaintainer("id"), r.teamController.SetMember)
+	teams.Delete("/:id/members/:userId", authz.RequireTeamMaintainer("id"), r.teamController.RemoveMember)
+
+	// Projects (secured with authentication). Project-scoped routes check the
+	// caller's roles in the project they act on, granted directly or through
+	// their teams, which fall back to their global role when they have none.
 	projects := api.Group("/projects")
-	projects.Use(middleware.AuthMiddleware("jwt-secret-placeholder")) // TODO: Get from config
+	projects.Use(auth, idempotent)
 	projects.Get("/", middleware.RequirePermission(middleware.ProjectRead), r.projectController.GetProjects)
 	projects.Post("/", middleware.RequirePermission(middleware.ProjectCreate), r.projectController.CreateProject)
-	projects.Get("/:id", middleware.RequirePermission(middleware.ProjectRead), r.projectController.GetProject)
-	projects.Put("/:id", middleware.RequirePermission(middleware.ProjectUpdate), r.projectController.UpdateProject)
-	projects.Delete("/:id", middleware.RequirePermission(middleware.ProjectDelete), r.projectController.DeleteProject)
+	projects.Get("/:id", authz.RequirePermission(middleware.ProjectRead, middleware.ProjectParam("id")), r.projectController.GetProject)
+	projects.Put("/:id", authz.RequirePermission(middleware.ProjectUpdate, middleware.ProjectParam("id")), r.projectController.UpdateProject)
+	projects.Delete("/:id", authz.RequirePermission(middleware.ProjectDelete, middleware.ProjectParam("id")), r.projectController.DeleteProject)
+
+	// Project members
+	projects.Get("/:id/members", authz.RequirePermission(middleware.ProjectRead, middleware.ProjectParam("id")), r.memberController.GetMembers)
+	projects.Put("/:id/members/:userId", authz.RequireOwnerOrAdmin(middleware.ProjectParam("id")), r.memberController.SetMember)
+	projects.Delete("/:id/members/:userId", authz.RequireOwnerOrAdmin(middleware.ProjectParam("id")), r.memberController.RemoveMember)
+	projects.Get("/:id/teams", authz.RequirePermission(middleware.ProjectRead, middleware.ProjectParam("id")), r.memberController.GetTeams)
+	projects.Put("/:id/teams/:teamId", authz.RequireOwnerOrAdmin(middleware.ProjectParam("id")), r.memberController.SetTeam)
+	projects.Delete("/:id/teams/:teamId", authz.RequireOwnerOrAdmin(middleware.ProjectParam("id")), r.memberController.RemoveTeam)
 
 	// Environments (secured)
 	environments := api.Group("/environments")
-	environments.Use(middleware.AuthMiddleware("jwt-secret-placeholder")) // TODO: Get from config
+	environments.Use(auth, idempotent)
+	// Environments can be named by key, e.g. /api/environments/staging/flags?project_id=
+	environments.Use(authz.ResolveEnvironmentKeys("/api/environments"))
 	environments.Get("/", middleware.RequirePermission(middleware.EnvironmentRead), r.envController.GetEnvironments)
-	environments.Post("/", middleware.RequirePermission(middleware.EnvironmentCreate), r.envController.CreateEnvironment)
-	environments.Get("/:id", middleware.RequirePermission(middleware.EnvironmentRead), r.envController.GetEnvironment)
-	environments.Put("/:id", middleware.RequirePermission(middleware.EnvironmentUpdate), r.envController.UpdateEnvironment)
-	environments.Delete("/:id", middleware.RequirePermission(middleware.EnvironmentDelete), r.envController.DeleteEnvironment)
+	environments.Post("/", authz.RequirePermission(middleware.EnvironmentCreate, middleware.ProjectBody("project_id")), r.envController.CreateEnvironment)
+	environments.Get("/:id", authz.RequirePermission(middleware.EnvironmentRead, middleware.EnvironmentParam("id")), r.envController.GetEnvironment)
+	// Changes to production environments must be confirmed with their key
+	environments.Put("/:id", authz.RequirePermission(middleware.EnvironmentUpdate, middleware.EnvironmentParam("id")), authz.RequireConfirmation(middleware.EnvironmentIDParam("id")), r.envController.UpdateEnvironment)
+	environments.Delete("/:id", authz.RequirePermission(middleware.EnvironmentDelete, middleware.EnvironmentParam("id")), authz.RequireConfirmation(middleware.EnvironmentIDParam("id")), r.envController.DeleteEnvironment)
+	// Promotion writes values in the target environment, so needs the same
+	// grant there as setting them one by one
+	environments.Post("/:id/promote", authz.RequireEnvironmentPermission(middleware.FlagValueUpdate, middleware.EnvironmentParam("id"), middleware.EnvironmentBody("target_env_id")), authz.RequireConfirmation(middleware.UnlessDryRun(middleware.EnvironmentBody("target_env_id"))), r.envController.PromoteEnvironment)
 
 	// Project environments
-	projects.Get("/:projectId/environments", middleware.RequirePermission(middleware.EnvironmentRead), r.envController.GetProjectEnvironments)
+	projects.Get("/:projectId/environments", authz.RequirePermission(middleware.EnvironmentRead, middleware.ProjectParam("projectId")), r.envController.GetProjectEnvironments)
 
 	// Flags (secured)
 	flags := api.Group("/flags")
-	flags.Use(middleware.AuthMiddleware("jwt-secret-placeholder")) // TODO: Get from config
-	flags.Get("/", middleware.RequirePermission(middleware.FlagRead), r.flagController.GetProjectFlags) // Using GetProjectFlags as fallback
-	flags.Post("/", middleware.RequirePermission(middleware.FlagCreate), r.flagController.CreateFlag)
-	flags.Get("/:id", middleware.RequirePermission(middleware.FlagRead), r.flagController.GetFlag)
-	flags.Put("/:id", middleware.RequirePermission(middleware.FlagUpdate), r.flagController.UpdateFlag)
-	flags.Delete("/:id", middleware.RequirePermission(middleware.FlagDelete), r.flagController.DeleteFlag)
+	flags.Use(auth, idempotent)
+	flags.Get("/", authz.RequirePermission(middleware.FlagRead, middleware.ProjectParam("projectId")), r.flagController.GetProjectFlags) // Requires ?project_id=
+	flags.Post("/", authz.RequirePermission(middleware.FlagCreate, middleware.ProjectBody("project_id")), r.flagController.CreateFlag)
+	flags.Get("/:id", authz.RequirePermission(middleware.FlagRead, middleware.FlagParam("id")), r.flagController.GetFlag)
+	flags.Put("/:id", authz.RequirePermission(middleware.FlagUpdate, middleware.FlagParam("id")), r.flagController.UpdateFlag)
+	flags.Post("/:id/archive", authz.RequirePermission(middleware.FlagUpdate, middleware.FlagParam("id")), r.flagController.ArchiveFlag)
+	flags.Post("/:id/restore", authz.RequirePermission(middleware.FlagUpdate, middleware.FlagParam("id")), r.flagController.RestoreFlag)
+	flags.Delete("/:id", authz.RequirePermission(middleware.FlagDelete, middleware.FlagParam("id")), r.flagController.DeleteFlag) // Archived flags only
 
 	// Project flags
-	projects.Get("/:projectId/flags", middleware.RequirePermission(middleware.FlagRead), r.flagController.GetProjectFlags)
+	projects.Get("/:projectId/flags", authz.RequirePermission(middleware.FlagRead, middleware.ProjectParam("projectId")), r.flagController.GetProjectFlags)
+	projects.Get("/:projectId/flags/stale", authz.RequirePermission(middleware.FlagRead, middleware.ProjectParam("projectId")), r.flagController.GetStaleFlags)
 	
 	// Flag values
-	flags.Get("/:flagId/values", middleware.RequirePermission(middleware.FlagRead), r.flagController.GetFlagValues)
-	flags.Post("/values", middleware.RequirePermission(middleware.FlagCreate), r.flagController.CreateOrUpdateFlagValue)
-	flags.Put("/values/:id", middleware.RequirePermission(middleware.FlagUpdate), r.flagController.UpdateFlagValue)
-	flags.Delete("/values/:id", middleware.RequirePermission(middleware.FlagDelete), r.flagController.DeleteFlagValue)
+	flags.Get("/:flagId/values", authz.RequirePermission(middleware.FlagRead, middleware.FlagParam("flagId")), r.flagController.GetFlagValues)
+	// Value changes are checked against the target environment, so roles can
+	// be limited to non-production environments
+	flags.Post("/values", authz.RequireEnvironmentPermission(middleware.FlagValueUpdate, middleware.FlagBody("flag_id"), middleware.EnvironmentBody("env_id")), authz.RequireConfirmation(middleware.EnvironmentBody("env_id")), r.flagController.CreateOrUpdateFlagValue)
+	flags.Put("/values/:id", authz.RequireEnvironmentPermission(middleware.FlagValueUpdate, middleware.FlagValueParam("id"), middleware.FlagValueEnvironment("id")), authz.RequireConfirmation(middleware.FlagValueEnvironment("id")), r.flagController.UpdateFlagValue)
+	flags.Delete("/values/:id", authz.RequirePermission(middleware.FlagDelete, middleware.FlagValueParam("id")), authz.RequireConfirmation(middleware.FlagValueEnvironment("id")), r.flagController.DeleteFlagValue)
 	
 	// Environment flags
-	environments.Get("/:envId/flags", middleware.RequirePermission(middleware.FlagRead), r.flagController.GetEnvironmentFlags)
+	environments.Get("/:envId/flags", authz.RequirePermission(middleware.FlagRead, middleware.EnvironmentParam("envId")), r.flagController.GetEnvironmentFlags)
+
+	// Flag evaluation and analytics
+	environments.Get("/:envId/evaluate", authz.RequirePermission(middleware.FlagRead, middleware.EnvironmentParam("envId")), r.evaluationController.Evaluate)
+	environments.Post("/:envId/evaluations", authz.RequirePermission(middleware.FlagRead, middleware.EnvironmentParam("envId")), r.evaluationController.SubmitSummary)
+	flags.Get("/:id/insights", authz.RequirePermission(middleware.FlagRead, middleware.FlagParam("id")), r.evaluationController.GetFlagInsights)
 }
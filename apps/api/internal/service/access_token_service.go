@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// accessTokenPrefixLength is how much of a token is kept in the clear so
+// users can tell their tokens apart
+const accessTokenPrefixLength = 12
+
+type accessTokenService struct {
+	tokenRepo repository.AccessTokenRepository
+	userRepo  repository.UserRepository
+	orgRepo   repository.OrganizationRepository
+	auditRepo repository.AuditRepository
+}
+
+func NewAccessTokenService(tokenRepo repository.AccessTokenRepository, userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, auditRepo repository.AuditRepository) AccessTokenService {
+	return &accessTokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+		orgRepo:   orgRepo,
+		auditRepo: auditRepo,
+	}
+}
+
+// ListTokens returns a user's access tokens, including revoked and expired
+// ones
+func (s *accessTokenService) ListTokens(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error) {
+	if _, err := s.owner(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.tokenRepo.ListForUser(ctx, userID)
+}
+
+// CreateToken issues an access token for a user. Users create tokens for
+// themselves; admins also create them for service accounts. The token is
+// returned only this once.
+func (s *accessTokenService) CreateToken(ctx context.Context, actorID, userID uuid.UUID, req *dto.CreateAccessTokenRequest, client dto.ClientInfo) (*model.AccessToken, string, error) {
+	for _, scope := range req.Scopes {
+		if !middleware.ValidPermission(middleware.Permission(scope)) {
+			return nil, "", apperrors.ErrInvalidScope
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", apperrors.ErrInvalidExpiry
+	}
+
+	user, err := s.owner(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if actorID != userID && user.AccountType != model.AccountTypeServiceAccount {
+		return nil, "", apperrors.ErrNotServiceAccount
+	}
+
+	random, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := middleware.AccessTokenPrefix + random
+
+	token := &model.AccessToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    raw[:accessTokenPrefixLength],
+		TokenHash: hashToken(raw),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditTokenCreate, user, client, map[string]interface{}{
+		"token_id": token.ID.String(),
+		"name":     token.Name,
+		"scopes":   token.Scopes,
+	}); err != nil {
+		return nil, "", err
+	}
+
+	return token, raw, nil
+}
+
+// RevokeToken revokes one of a user's access tokens
+func (s *accessTokenService) RevokeToken(ctx context.Context, actorID, userID, tokenID uuid.UUID, client dto.ClientInfo) error {
+	user, err := s.owner(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.tokenRepo.Revoke(ctx, userID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return apperrors.ErrAccessTokenNotFound
+	}
+
+	return s.audit(ctx, actorID, model.AuditTokenRevoke, user, client, map[string]interface{}{
+		"token_id": tokenID.String(),
+	})
+}
+
+// ValidateAccessToken resolves a token presented to the API to its owner
+func (s *accessTokenService) ValidateAccessToken(ctx context.Context, raw string) (*middleware.TokenPrincipal, error) {
+	token, err := s.tokenRepo.GetByHash(ctx, hashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || !token.Usable(time.Now()) {
+		return nil, apperrors.ErrInvalidAccessToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		return nil, apperrors.ErrInvalidAccessToken
+	}
+
+	org, err := s.orgRepo.GetByID(ctx, user.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, apperrors.ErrInvalidAccessToken
+	}
+
+	// Usage tracking is best effort; it mustn't fail the request
+	if err := s.tokenRepo.Touch(ctx, token.ID); err != nil {
+		log.Printf("Failed to record use of access token %s: %v", token.ID, err)
+	}
+
+	return &middleware.TokenPrincipal{
+		UserID:           user.ID.String(),
+		Username:         user.Username,
+		Role:             user.Role,
+		Type:             user.AccountType,
+		TokenID:          token.ID.String(),
+		Scopes:           token.Scopes,
+		OrganizationID:   org.ID.String(),
+		HostOrganization: org.Host,
+	}, nil
+}
+
+func (s *accessTokenService) owner(ctx context.Context, userID uuid.UUID) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !inOrganization(ctx, user) {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *accessTokenService) audit(ctx context.Context, actorID uuid.UUID, action string, user *model.User, client dto.ClientInfo, metadata map[string]interface{}) error {
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetUser,
+		TargetID:     user.ID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata:     metadata,
+	})
+}
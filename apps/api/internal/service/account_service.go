@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/mail"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type accountService struct {
+	userRepo    repository.UserRepository
+	tokenRepo   repository.UserTokenRepository
+	sessionRepo repository.SessionRepository
+	mailer      mail.Mailer
+	authConfig  env.AuthConfig
+	appURL      string
+}
+
+func NewAccountService(userRepo repository.UserRepository, tokenRepo repository.UserTokenRepository, sessionRepo repository.SessionRepository, mailer mail.Mailer, authConfig env.AuthConfig, appURL string) AccountService {
+	return &accountService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		sessionRepo: sessionRepo,
+		mailer:      mailer,
+		authConfig:  authConfig,
+		appURL:      strings.TrimRight(appURL, "/"),
+	}
+}
+
+// ForgotPassword emails a reset link. It succeeds whether or not the address
+// belongs to an account, so it can't be used to discover accounts.
+func (s *accountService) ForgotPassword(ctx context.Context, email string) error {
+	if !s.authConfig.PasswordLogin {
+		return apperrors.ErrPasswordLoginDisabled
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	// Single sign-on users have no password to reset
+	if user == nil || !user.Active || user.AuthProvider != model.AuthProviderPassword {
+		return nil
+	}
+
+	link, err := s.issueToken(ctx, user, model.UserTokenPasswordReset, s.authConfig.PasswordResetTTL, "/reset-password")
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Flagit password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your Flagit account. "+
+			"To choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			user.FirstName, s.authConfig.PasswordResetTTL, link),
+	}
+	// Failures are logged rather than returned so the response doesn't
+	// reveal that the account exists
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed reset token and signs
+// the user out everywhere
+func (s *accountService) ResetPassword(ctx context.Context, req *dto.ResetPasswordRequest) error {
+	if !s.authConfig.PasswordLogin {
+		return apperrors.ErrPasswordLoginDisabled
+	}
+
+	token, err := s.tokenRepo.Consume(ctx, model.UserTokenPasswordReset, hashToken(req.Token))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return apperrors.ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.Active || user.Email != token.Email {
+		return apperrors.ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.Password); err != nil {
+		return err
+	}
+
+	if _, err := s.sessionRepo.RevokeAllForUser(ctx, user.ID, model.SessionRevokedPassword); err != nil {
+		return err
+	}
+
+	// Following the link proved the user owns the address
+	_, err = s.userRepo.SetEmailVerified(ctx, user.ID, token.Email)
+	return err
+}
+
+// ChangePassword replaces the signed-in user's password after checking the
+// current one, and revokes their other sessions
+func (s *accountService) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *dto.ChangePasswordRequest) error {
+	if !s.authConfig.PasswordLogin {
+		return apperrors.ErrPasswordLoginDisabled
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return apperrors.ErrUserNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return apperrors.ErrIncorrectPassword
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.NewPassword); err != nil {
+		return err
+	}
+
+	_, err = s.sessionRepo.RevokeOthersForUser(ctx, user.ID, sessionID, model.SessionRevokedPassword)
+	return err
+}
+
+// SendVerificationEmail emails a link confirming the user owns their address
+func (s *accountService) SendVerificationEmail(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return apperrors.ErrUserNotFound
+	}
+	if user.EmailVerified {
+		return apperrors.ErrEmailAlreadyVerified
+	}
+
+	link, err := s.issueToken(ctx, user, model.UserTokenEmailVerification, s.authConfig.EmailVerificationTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Flagit email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening this link within %s:\n\n%s\n",
+			user.FirstName, s.authConfig.EmailVerificationTTL, link),
+	})
+}
+
+// VerifyEmail marks an address verified using an emailed token
+func (s *accountService) VerifyEmail(ctx context.Context, token string) error {
+	userToken, err := s.tokenRepo.Consume(ctx, model.UserTokenEmailVerification, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if userToken == nil {
+		return apperrors.ErrInvalidVerificationToken
+	}
+
+	// The address may have changed since the link was sent
+	verified, err := s.userRepo.SetEmailVerified(ctx, userToken.UserID, userToken.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return apperrors.ErrInvalidVerificationToken
+	}
+
+	return nil
+}
+
+// SendInvitation emails an invited user a link to choose their password
+func (s *accountService) SendInvitation(ctx context.Context, user *model.User, inviter *model.User) error {
+	link, err := s.issueToken(ctx, user, model.UserTokenInvitation, s.authConfig.InvitationTTL, "/accept-invitation")
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "You've been invited to Flagit",
+		Body: fmt.Sprintf("Hi,\n\n%s %s has invited you to Flagit as %s (username %s). "+
+			"To set your password and sign in, open this link within %s:\n\n%s\n",
+			inviter.FirstName, inviter.LastName, user.Role, user.Username, s.authConfig.InvitationTTL, link),
+	})
+}
+
+// AcceptInvitation sets an invited user's first password. Following the
+// link also verifies their address.
+func (s *accountService) AcceptInvitation(ctx context.Context, req *dto.AcceptInvitationRequest) error {
+	token, err := s.tokenRepo.Consume(ctx, model.UserTokenInvitation, hashToken(req.Token))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return apperrors.ErrInvalidInvitation
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.Active || user.Email != token.Email {
+		return apperrors.ErrInvalidInvitation
+	}
+
+	if err := s.setPassword(ctx, user.ID, req.Password); err != nil {
+		return err
+	}
+
+	_, err = s.userRepo.SetEmailVerified(ctx, user.ID, token.Email)
+	return err
+}
+
+// issueToken stores a new single-use token and returns the admin UI link
+// carrying it
+func (s *accountService) issueToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration, path string) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	token := &model.UserToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return "", err
+	}
+
+	return s.appURL + path + "?token=" + url.QueryEscape(raw), nil
+}
+
+func (s *accountService) setPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.SetPassword(ctx, userID, string(hashedPassword))
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/repository"
+)
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+// ListEvents returns a page of the audit trail
+func (s *auditService) ListEvents(ctx context.Context, params pagination.Params) (*pagination.Page[model.AuditEvent], error) {
+	return s.repo.List(ctx, params)
+}
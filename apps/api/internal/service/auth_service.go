@@ -1,12 +1,21 @@
 package service
 
 import (
+	"api/internal/config/env"
 	"api/internal/dto"
+	apperrors "api/internal/errors"
 	"api/internal/middleware"
 	"api/internal/model"
 	"api/internal/repository"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/google/uuid"
@@ -14,27 +23,63 @@ import (
 
 // AuthService defines the interface for authentication operations
 type AuthService interface {
-	Register(ctx context.Context, req *dto.RegisterRequest) (*dto.LoginResponse, error)
-	Login(ctx context.Context, req *dto.LoginRequest) (*dto.LoginResponse, error)
+	Register(ctx context.Context, req *dto.RegisterRequest, client dto.ClientInfo) (*dto.LoginResponse, error)
+	Login(ctx context.Context, req *dto.LoginRequest, client dto.ClientInfo) (*dto.LoginResponse, error)
+	Refresh(ctx context.Context, refreshToken string, client dto.ClientInfo) (*dto.LoginResponse, error)
+	Logout(ctx context.Context, sessionID uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) (int64, error)
+	ValidateSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	UnlockUser(ctx context.Context, actorID, userID uuid.UUID, client dto.ClientInfo) (bool, error)
+	StartSession(ctx context.Context, user *model.User, client dto.ClientInfo) (*dto.LoginResponse, error)
+	JWKS() middleware.JWKSet
 	GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error)
 }
 
 // authService implements AuthService interface
 type authService struct {
-	userRepo repository.UserRepository
-	jwtSecret string
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	auditRepo   repository.AuditRepository
+	orgRepo     repository.OrganizationRepository
+	throttle    *loginThrottle
+	accounts    AccountService
+	keyRing     *middleware.KeyRing
+	authConfig  env.AuthConfig
+	// dummyHash is compared against when a username doesn't exist, so the
+	// response takes as long as for a wrong password
+	dummyHash []byte
 }
 
 // NewAuthService creates a new instance of AuthService
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, throttleRepo repository.LoginThrottleRepository, auditRepo repository.AuditRepository, orgRepo repository.OrganizationRepository, accounts AccountService, keyRing *middleware.KeyRing, authConfig env.AuthConfig) AuthService {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte(uuid.NewString()), bcrypt.DefaultCost)
+
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+		orgRepo:     orgRepo,
+		throttle: &loginThrottle{
+			repo:      throttleRepo,
+			auditRepo: auditRepo,
+			cfg:       authConfig.Lockout,
+		},
+		accounts:   accounts,
+		keyRing:    keyRing,
+		authConfig: authConfig,
+		dummyHash:  dummyHash,
 	}
 }
 
 // Register creates a new user and returns JWT token
-func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*dto.LoginResponse, error) {
+func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	if !s.authConfig.PasswordLogin {
+		return nil, apperrors.ErrPasswordLoginDisabled
+	}
+	if !s.authConfig.OpenRegistration {
+		return nil, apperrors.ErrRegistrationDisabled
+	}
+
 	// Check if user already exists by username
 	existingUser, err := s.userRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
@@ -59,69 +104,331 @@ func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*
 		return nil, err
 	}
 
+	// Self-registered accounts join the host organisation
+	host, err := hostOrganization(ctx, s.orgRepo)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create new user
 	user := &model.User{
-		ID:        uuid.New(),
-		Username:  req.Username,
-		Email:     req.Email,
-		Password:  string(hashedPassword),
-		Role:      string(middleware.RoleDeveloper), // Default role
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		Active:    true,
+		ID:             uuid.New(),
+		OrganizationID: host.ID,
+		Username:       req.Username,
+		Email:          req.Email,
+		Password:       string(hashedPassword),
+		Role:           string(middleware.RoleAdmin),
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Active:         true,
+	}
+
+	// Only the very first account on a fresh install becomes admin, so it
+	// can be administered; later ones get the registration role
+	first, err := s.userRepo.CreateFirst(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		user.Role = s.authConfig.RegistrationRole
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	// The account is usable straight away; the address is confirmed later
+	if err := s.accounts.SendVerificationEmail(ctx, user.ID); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
+	// Start a session, or ask for a second factor first
+	return s.completePasswordLogin(ctx, user, client)
+}
+
+// Login authenticates a user and returns JWT token
+func (s *authService) Login(ctx context.Context, req *dto.LoginRequest, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	if !s.authConfig.PasswordLogin {
+		return nil, apperrors.ErrPasswordLoginDisabled
+	}
+
+	lockedUntil, err := s.throttle.lockedUntil(ctx, req.Username, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get user by username
+	user, err := s.userRepo.GetByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare password, against a dummy hash for unknown users so both
+	// cases take the same time
+	hash := s.dummyHash
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	passwordMatches := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) == nil && user != nil
+
+	// Lockouts, wrong passwords and inactive accounts all get the same
+	// answer, so it reveals nothing about the account; the reason is logged
+	switch {
+	case !lockedUntil.IsZero():
+		log.Printf("Login as %q from %s refused: locked out until %s", req.Username, client.IPAddress, lockedUntil.Format(time.RFC3339))
+		s.throttle.refuse(ctx)
+		return nil, apperrors.ErrInvalidCredentials
+	case !passwordMatches || !user.Active:
+		if passwordMatches {
+			log.Printf("Login as %q from %s refused: account inactive", req.Username, client.IPAddress)
+		}
+		if err := s.throttle.fail(ctx, req.Username, client); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrInvalidCredentials
+	}
+
+	if err := s.throttle.succeed(ctx, req.Username); err != nil {
+		return nil, err
+	}
+
+	// Start a session, or ask for a second factor first
+	return s.completePasswordLogin(ctx, user, client)
+}
+
+// Refresh redeems a refresh token for a new access token and a new refresh
+// token. Presenting a token that was already redeemed means it has leaked,
+// so the whole session is revoked.
+func (s *authService) Refresh(ctx context.Context, refreshToken string, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	token, err := s.sessionRepo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, apperrors.ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, apperrors.ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReusedSession(ctx, session.ID)
+	}
+
+	now := time.Now()
+	if !session.IsActive(now) || !now.Before(token.ExpiresAt) {
+		return nil, apperrors.ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		if err := s.sessionRepo.Revoke(ctx, session.ID, model.SessionRevokedUserInactive); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrAccountInactive
 	}
 
-	err = s.userRepo.Create(ctx, user)
+	raw, next, err := s.newRefreshToken(session.ID, now)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateJWT(user.ID.String(), user.Username, user.Role, s.jwtSecret)
+	rotated, err := s.sessionRepo.Rotate(ctx, token.ID, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request redeemed the token first
+		return nil, s.revokeReusedSession(ctx, session.ID)
+	}
+
+	return s.tokenResponse(ctx, user, session.ID, raw)
+}
+
+// Logout revokes a session, invalidating its refresh and access tokens
+func (s *authService) Logout(ctx context.Context, sessionID uuid.UUID) error {
+	return s.sessionRepo.Revoke(ctx, sessionID, model.SessionRevokedLogout)
+}
+
+// RevokeUserSessions signs a user out everywhere
+func (s *authService) RevokeUserSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if !inOrganization(ctx, user) {
+		return 0, apperrors.ErrUserNotFound
+	}
+
+	return s.sessionRepo.RevokeAllForUser(ctx, userID, model.SessionRevokedByAdmin)
+}
+
+// ValidateSession checks that the session behind an access token is still
+// active and that its user hasn't been deactivated
+func (s *authService) ValidateSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	userActive, sessionActive, err := s.sessionRepo.CheckActive(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if !sessionActive {
+		return apperrors.ErrSessionRevoked
+	}
+	if !userActive {
+		return apperrors.ErrAccountInactive
+	}
+	return nil
+}
+
+// UnlockUser lifts a login lockout on a user's username, returning whether
+// it was locked
+func (s *authService) UnlockUser(ctx context.Context, actorID, userID uuid.UUID, client dto.ClientInfo) (bool, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !inOrganization(ctx, user) {
+		return false, apperrors.ErrUserNotFound
+	}
+
+	unlocked, err := s.throttle.unlock(ctx, user.Username)
+	if err != nil {
+		return false, err
+	}
+	if !unlocked {
+		return false, nil
+	}
+
+	err = s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       model.AuditAccountUnlock,
+		TargetType:   model.AuditTargetUser,
+		TargetID:     user.ID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata: map[string]interface{}{
+			"username": user.Username,
+		},
+	})
+	return true, err
+}
+
+// completePasswordLogin starts a session after a correct password, unless
+// the user must first present or enrol a second factor, in which case a
+// challenge token is returned instead
+func (s *authService) completePasswordLogin(ctx context.Context, user *model.User, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	purpose := ""
+	if user.MFAEnabled {
+		purpose = middleware.MFAPurposeVerify
+	} else if mfaRequiredForRole(s.authConfig.MFA, user.Role) {
+		purpose = middleware.MFAPurposeEnroll
+	}
+
+	if purpose == "" {
+		return s.StartSession(ctx, user, client)
+	}
+
+	token, err := middleware.GenerateMFAToken(user.ID.String(), purpose, s.authConfig.MFA.ChallengeTTL, s.keyRing)
 	if err != nil {
 		return nil, err
 	}
 
 	return &dto.LoginResponse{
-		User:  user.ToResponse(),
-		Token: token,
+		User:                  user.ToResponse(),
+		MFARequired:           purpose == middleware.MFAPurposeVerify,
+		MFAEnrollmentRequired: purpose == middleware.MFAPurposeEnroll,
+		MFAToken:              token,
 	}, nil
 }
 
-// Login authenticates a user and returns JWT token
-func (s *authService) Login(ctx context.Context, req *dto.LoginRequest) (*dto.LoginResponse, error) {
-	// Get user by username
-	user, err := s.userRepo.GetByUsername(ctx, req.Username)
+// StartSession signs a user in, creating a session and issuing its tokens
+func (s *authService) StartSession(ctx context.Context, user *model.User, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	now := time.Now()
+	session := &model.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: now.Add(s.authConfig.RefreshTokenTTL),
+	}
+
+	raw, token, err := s.newRefreshToken(session.ID, now)
 	if err != nil {
 		return nil, err
 	}
-	if user == nil {
-		return nil, errors.New("invalid username or password")
+
+	if err := s.sessionRepo.Create(ctx, session, token); err != nil {
+		return nil, err
 	}
 
-	// Check if user is active
-	if !user.Active {
-		return nil, errors.New("user account is inactive")
+	return s.tokenResponse(ctx, user, session.ID, raw)
+}
+
+func (s *authService) revokeReusedSession(ctx context.Context, sessionID uuid.UUID) error {
+	if err := s.sessionRepo.Revoke(ctx, sessionID, model.SessionRevokedReuseDetected); err != nil {
+		return err
 	}
+	return apperrors.ErrRefreshTokenReused
+}
 
-	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+// tokenResponse issues an access token carrying the user's organisation,
+// so every request made with it is scoped to that tenant
+func (s *authService) tokenResponse(ctx context.Context, user *model.User, sessionID uuid.UUID, refreshToken string) (*dto.LoginResponse, error) {
+	org, err := s.orgRepo.GetByID(ctx, user.OrganizationID)
 	if err != nil {
-		return nil, errors.New("invalid username or password")
+		return nil, err
+	}
+	if org == nil {
+		return nil, apperrors.ErrOrganizationNotFound
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateJWT(user.ID.String(), user.Username, user.Role, s.jwtSecret)
+	token, err := middleware.GenerateJWT(user.ID.String(), user.Username, user.Role, sessionID.String(), org.ID.String(), org.Host, s.keyRing)
 	if err != nil {
 		return nil, err
 	}
 
 	return &dto.LoginResponse{
-		User:  user.ToResponse(),
-		Token: token,
+		User:         user.ToResponse(),
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.authConfig.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// newRefreshToken generates a random refresh token, returning the raw value
+// for the client and the hashed record to store
+func (s *authService) newRefreshToken(sessionID uuid.UUID, now time.Time) (string, *model.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	return raw, &model.RefreshToken{
+		ID:        uuid.New(),
+		SessionID: sessionID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(s.authConfig.RefreshTokenTTL),
 	}, nil
 }
 
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// JWKS returns the public keys other services can verify access tokens with
+func (s *authService) JWKS() middleware.JWKSet {
+	return s.keyRing.JWKS()
+}
+
 // GetUserByID retrieves a user by ID
 func (s *authService) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	return s.userRepo.GetByID(ctx, id)
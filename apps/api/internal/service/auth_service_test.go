@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+func testAuthConfig() env.AuthConfig {
+	return env.AuthConfig{
+		Algorithm:       middleware.AlgorithmHS256,
+		JWTSecrets:      []string{"test-secret"},
+		Issuer:          "flagit",
+		Audience:        "flagit-api",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+		PasswordLogin:   true,
+		MFA:             env.MFAConfig{ChallengeTTL: 5 * time.Minute, MaxChallengeFailures: 3},
+		Lockout: env.LockoutConfig{
+			MaxUserFailures: 10,
+			MaxIPFailures:   100,
+			FailureWindow:   time.Hour,
+			Duration:        time.Hour,
+			DelayAfter:      100,
+		},
+	}
+}
+
+func testKeyRing(t *testing.T, cfg env.AuthConfig) *middleware.KeyRing {
+	t.Helper()
+	ring, err := middleware.NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return ring
+}
+
+type authFixture struct {
+	service  AuthService
+	users    *memUserRepo
+	sessions *memSessionRepo
+	user     *model.User
+}
+
+// newAuthFixture signs in through sessions, which defaults to an in-memory
+// store
+func newAuthFixture(t *testing.T, sessions repository.SessionRepository) *authFixture {
+	t.Helper()
+
+	orgs := newMemOrgRepo()
+	f := &authFixture{
+		sessions: newMemSessionRepo(),
+		user: &model.User{
+			ID:             uuid.New(),
+			Username:       "ada",
+			Email:          "ada@example.com",
+			Role:           "developer",
+			Active:         true,
+			OrganizationID: orgs.host.ID,
+		},
+	}
+	if sessions == nil {
+		sessions = f.sessions
+	}
+	f.users = newMemUserRepo(f.user)
+
+	cfg := testAuthConfig()
+	f.service = NewAuthService(f.users, sessions, nil, nil, orgs, nil, testKeyRing(t, cfg), cfg)
+	return f
+}
+
+// signIn starts a session, returning its ID and first refresh token
+func (f *authFixture) signIn(t *testing.T) (uuid.UUID, string) {
+	t.Helper()
+
+	response, err := f.service.StartSession(context.Background(), f.user, dto.ClientInfo{})
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	token, _ := f.sessions.GetRefreshToken(context.Background(), hashToken(response.RefreshToken))
+	return token.SessionID, response.RefreshToken
+}
+
+func (f *authFixture) revokedReason(sessionID uuid.UUID) string {
+	session, _ := f.sessions.GetByID(context.Background(), sessionID)
+	if session == nil || session.RevokedReason == nil {
+		return ""
+	}
+	return *session.RevokedReason
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	_, first := f.signIn(t)
+
+	second, err := f.service.Refresh(context.Background(), first, dto.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first {
+		t.Fatalf("Refresh issued refresh token %q after %q", second.RefreshToken, first)
+	}
+	if second.Token == "" {
+		t.Error("Refresh issued no access token")
+	}
+
+	if _, err := f.service.Refresh(context.Background(), second.RefreshToken, dto.ClientInfo{}); err != nil {
+		t.Errorf("Refresh with the rotated token: %v", err)
+	}
+}
+
+func TestRefreshRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the refresh token to present for the signed-in
+		// session, changing whatever the case needs first
+		present func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string
+		// stale makes the store miss that the token was redeemed
+		// concurrently, as if another request won the race
+		stale       bool
+		want        error
+		wantRevoked string
+	}{
+		{
+			name: "unknown token",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				return "unknown"
+			},
+			want: apperrors.ErrInvalidRefreshToken,
+		},
+		{
+			name: "redeemed token",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				if _, err := f.service.Refresh(context.Background(), token, dto.ClientInfo{}); err != nil {
+					t.Fatalf("Refresh: %v", err)
+				}
+				return token
+			},
+			want:        apperrors.ErrRefreshTokenReused,
+			wantRevoked: model.SessionRevokedReuseDetected,
+		},
+		{
+			name: "token redeemed concurrently",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				if _, err := f.service.Refresh(context.Background(), token, dto.ClientInfo{}); err != nil {
+					t.Fatalf("Refresh: %v", err)
+				}
+				return token
+			},
+			stale:       true,
+			want:        apperrors.ErrRefreshTokenReused,
+			wantRevoked: model.SessionRevokedReuseDetected,
+		},
+		{
+			name: "expired token",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				stored := f.sessions.tokens[hashToken(token)]
+				stored.ExpiresAt = time.Now().Add(-time.Second)
+				f.sessions.tokens[hashToken(token)] = stored
+				return token
+			},
+			want: apperrors.ErrInvalidRefreshToken,
+		},
+		{
+			name: "signed-out session",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				if err := f.service.Logout(context.Background(), sessionID); err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+				return token
+			},
+			want:        apperrors.ErrInvalidRefreshToken,
+			wantRevoked: model.SessionRevokedLogout,
+		},
+		{
+			name: "deactivated user",
+			present: func(t *testing.T, f *authFixture, sessionID uuid.UUID, token string) string {
+				user := *f.user
+				user.Active = false
+				f.users.Update(context.Background(), user.ID, &user)
+				return token
+			},
+			want:        apperrors.ErrAccountInactive,
+			wantRevoked: model.SessionRevokedUserInactive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sessions repository.SessionRepository
+			stale := &staleSessionRepo{}
+			if tt.stale {
+				sessions = stale
+			}
+			f := newAuthFixture(t, sessions)
+			stale.memSessionRepo = f.sessions
+			sessionID, token := f.signIn(t)
+
+			_, err := f.service.Refresh(context.Background(), tt.present(t, f, sessionID, token), dto.ClientInfo{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Refresh error = %v, want %v", err, tt.want)
+			}
+			if got := f.revokedReason(sessionID); got != tt.wantRevoked {
+				t.Errorf("session revoked for %q, want %q", got, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+// Once a redeemed token is replayed, the token it was rotated for is no
+// longer valid either, signing out whoever holds the session
+func TestRefreshReuseRevokesLatestToken(t *testing.T) {
+	f := newAuthFixture(t, nil)
+	_, first := f.signIn(t)
+
+	second, err := f.service.Refresh(context.Background(), first, dto.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := f.service.Refresh(context.Background(), first, dto.ClientInfo{}); !errors.Is(err, apperrors.ErrRefreshTokenReused) {
+		t.Fatalf("replayed Refresh error = %v, want %v", err, apperrors.ErrRefreshTokenReused)
+	}
+
+	if _, err := f.service.Refresh(context.Background(), second.RefreshToken, dto.ClientInfo{}); !errors.Is(err, apperrors.ErrInvalidRefreshToken) {
+		t.Errorf("Refresh with the latest token error = %v, want %v", err, apperrors.ErrInvalidRefreshToken)
+	}
+}
+
+// staleSessionRepo reads refresh tokens as they were before being redeemed
+type staleSessionRepo struct {
+	*memSessionRepo
+}
+
+func (r *staleSessionRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	token, err := r.memSessionRepo.GetRefreshToken(ctx, tokenHash)
+	if token != nil {
+		token.UsedAt = nil
+	}
+	return token, err
+}
@@ -3,22 +3,44 @@ package service
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
+	"api/internal/cache"
 	"api/internal/dto"
+	apperrors "api/internal/errors"
 	"api/internal/model"
+	"api/internal/pagination"
 	"api/internal/repository"
 	"api/internal/sse"
 	"github.com/google/uuid"
 )
 
+var (
+	environmentKeyPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+	environmentKeySeparators = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Colours environments get unless one is chosen
+const (
+	defaultEnvironmentColor = "#6b7280"
+	defaultProductionColor  = "#dc2626"
+)
+
 type environmentService struct {
-	envRepo    repository.EnvironmentRepository
-	sseService SSEService
+	envRepo       repository.EnvironmentRepository
+	flagValueRepo repository.FlagValueRepository
+	txManager     repository.TxManager
+	sseService    SSEService
+	configCache   *cache.ConfigCache
 }
 
-func NewEnvironmentService(envRepo repository.EnvironmentRepository, sseService SSEService) EnvironmentService {
+func NewEnvironmentService(envRepo repository.EnvironmentRepository, flagValueRepo repository.FlagValueRepository, txManager repository.TxManager, sseService SSEService, configCache *cache.ConfigCache) EnvironmentService {
 	return &environmentService{
-		envRepo:    envRepo,
-		sseService: sseService,
+		envRepo:       envRepo,
+		flagValueRepo: flagValueRepo,
+		txManager:     txManager,
+		sseService:    sseService,
+		configCache:   configCache,
 	}
 }
 
@@ -35,23 +57,77 @@ func (s *environmentService) CreateEnvironment(ctx context.Context, req *dto.Cre
 		return nil, errors.New("environment name must be less than 100 characters")
 	}
 
+	key := req.Key
+	if key == "" {
+		key = environmentKeyFromName(req.Name)
+	}
+	if err := s.checkKey(ctx, req.ProjectID, key); err != nil {
+		return nil, err
+	}
+
+	color := strings.ToLower(req.Color)
+	if color == "" {
+		color = defaultEnvironmentColor
+		if req.Production {
+			color = defaultProductionColor
+		}
+	}
+
 	env := &model.Environment{
-		ProjectID: req.ProjectID,
-		Name:      req.Name,
+		ProjectID:       req.ProjectID,
+		Key:             key,
+		Name:            req.Name,
+		Color:           color,
+		Production:      req.Production,
+		NewFlagsEnabled: req.NewFlagsEnabled,
 	}
 
-	err := s.envRepo.Create(ctx, env)
-	if err != nil {
-		return nil, err
+	if req.SortOrder != nil {
+		env.SortOrder = *req.SortOrder
+	} else {
+		// New environments go after the project's existing ones
+		existing, err := s.envRepo.GetByProjectID(ctx, req.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range existing {
+			if other.SortOrder >= env.SortOrder {
+				env.SortOrder = other.SortOrder + 1
+			}
+		}
 	}
 
-	// Broadcast SSE event
-	eventData := model.EnvironmentEvent{
-		EnvironmentID: env.ID,
-		ProjectID:     env.ProjectID,
-		Name:          env.Name,
+	sourceID := uuid.Nil
+	if req.CloneFrom != nil {
+		if _, err := s.projectEnvironment(ctx, *req.CloneFrom, env.ProjectID); err != nil {
+			return nil, err
+		}
+		sourceID = *req.CloneFrom
+	}
+
+	// The environment and its flag values are created together
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.envRepo.Create(ctx, env); err != nil {
+			return err
+		}
+		if err := s.flagValueRepo.FillEnvironment(ctx, env, sourceID); err != nil {
+			return err
+		}
+
+		// Broadcast SSE event
+		eventData := model.EnvironmentEvent{
+			EnvironmentID: env.ID,
+			ProjectID:     env.ProjectID,
+			Key:           env.Key,
+			Name:          env.Name,
+			Version:       env.Version,
+		}
+		broadcast(ctx, s.sseService, sse.EnvironmentCreated, eventData)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	s.sseService.BroadcastEvent(sse.EnvironmentCreated, eventData)
 
 	return env, nil
 }
@@ -63,14 +139,14 @@ func (s *environmentService) GetEnvironment(ctx context.Context, id uuid.UUID) (
 	}
 	
 	if env == nil {
-		return nil, errors.New("environment not found")
+		return nil, apperrors.ErrEnvironmentNotFound
 	}
 
 	return env, nil
 }
 
-func (s *environmentService) GetAllEnvironments(ctx context.Context) ([]model.Environment, error) {
-	envs, err := s.envRepo.GetAll(ctx)
+func (s *environmentService) GetAllEnvironments(ctx context.Context, params pagination.Params) (*pagination.Page[model.Environment], error) {
+	envs, err := s.envRepo.List(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -78,12 +154,17 @@ func (s *environmentService) GetAllEnvironments(ctx context.Context) ([]model.En
 	return envs, nil
 }
 
-func (s *environmentService) GetProjectEnvironments(ctx context.Context, projectID uuid.UUID) ([]model.Environment, error) {
+func (s *environmentService) GetProjectEnvironments(ctx context.Context, projectID uuid.UUID, params pagination.Params) (*pagination.Page[model.Environment], error) {
 	if projectID == uuid.Nil {
 		return nil, errors.New("project ID is required")
 	}
 
-	envs, err := s.envRepo.GetByProjectID(ctx, projectID)
+	if params.Filters == nil {
+		params.Filters = make(map[string]string)
+	}
+	params.Filters["project_id"] = projectID.String()
+
+	envs, err := s.envRepo.List(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +179,14 @@ func (s *environmentService) UpdateEnvironment(ctx context.Context, id uuid.UUID
 	}
 	
 	if exists == nil {
-		return nil, errors.New("environment not found")
+		return nil, apperrors.ErrEnvironmentNotFound
+	}
+
+	version, err := checkVersion(req.Version, req.IfMatch, exists.Version)
+	if err != nil {
+		return exists, err
 	}
+	req.Version = version
 
 	if req.Name != nil {
 		if *req.Name == "" {
@@ -111,18 +198,29 @@ func (s *environmentService) UpdateEnvironment(ctx context.Context, id uuid.UUID
 		}
 	}
 
+	if req.Color != nil {
+		color := strings.ToLower(*req.Color)
+		req.Color = &color
+	}
+
 	env, err := s.envRepo.Update(ctx, id, req)
 	if err != nil {
 		return nil, err
 	}
+	if env == nil {
+		current, err := s.envRepo.GetByID(ctx, id)
+		return staleUpdate(current, err, apperrors.ErrEnvironmentNotFound)
+	}
 
 	// Broadcast SSE event
 	eventData := model.EnvironmentEvent{
 		EnvironmentID: env.ID,
 		ProjectID:     env.ProjectID,
+		Key:           env.Key,
 		Name:          env.Name,
+		Version:       env.Version,
 	}
-	s.sseService.BroadcastEvent(sse.EnvironmentUpdated, eventData)
+	broadcast(ctx, s.sseService, sse.EnvironmentUpdated, eventData)
 
 	return env, nil
 }
@@ -134,7 +232,7 @@ func (s *environmentService) DeleteEnvironment(ctx context.Context, id uuid.UUID
 	}
 	
 	if exists == nil {
-		return errors.New("environment not found")
+		return apperrors.ErrEnvironmentNotFound
 	}
 
 	err = s.envRepo.Delete(ctx, id)
@@ -142,13 +240,129 @@ func (s *environmentService) DeleteEnvironment(ctx context.Context, id uuid.UUID
 		return err
 	}
 
+	invalidate(ctx, s.configCache, id)
+
 	// Broadcast SSE event
 	eventData := model.EnvironmentEvent{
 		EnvironmentID: exists.ID,
 		ProjectID:     exists.ProjectID,
+		Key:           exists.Key,
 		Name:          exists.Name,
+		Version:       exists.Version,
 	}
-	s.sseService.BroadcastEvent(sse.EnvironmentDeleted, eventData)
+	broadcast(ctx, s.sseService, sse.EnvironmentDeleted, eventData)
 
 	return nil
 }
+
+// PromoteEnvironment copies flag values from an environment to another of
+// the same project. Dry runs and promotions blocked by conflicts return the
+// planned changes without writing any; blocked ones also return
+// ErrPromotionConflict.
+func (s *environmentService) PromoteEnvironment(ctx context.Context, sourceID uuid.UUID, req *dto.PromoteEnvironmentRequest) (*model.Promotion, error) {
+	if sourceID == req.TargetEnvID {
+		return nil, apperrors.ErrPromoteSameEnvironment
+	}
+
+	source, err := s.envRepo.GetByID(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, apperrors.ErrEnvironmentNotFound
+	}
+	if _, err := s.projectEnvironment(ctx, req.TargetEnvID, source.ProjectID); err != nil {
+		return nil, err
+	}
+
+	promotion := &model.Promotion{
+		SourceEnvID: source.ID,
+		TargetEnvID: req.TargetEnvID,
+		FlagIDs:     req.FlagIDs,
+		DryRun:      req.DryRun,
+		Overwrite:   req.Overwrite,
+	}
+	if err := s.flagValueRepo.Promote(ctx, promotion); err != nil {
+		return nil, err
+	}
+
+	if !promotion.Applied {
+		if !promotion.DryRun && promotion.HasInvalidValues() {
+			return promotion, apperrors.ErrInvalidFlagValue
+		}
+		if !promotion.DryRun && promotion.Conflicts > 0 {
+			return promotion, apperrors.ErrPromotionConflict
+		}
+		return promotion, nil
+	}
+
+	invalidate(ctx, s.configCache, promotion.TargetEnvID)
+
+	// Broadcast SSE events
+	for _, change := range promotion.Changes {
+		if change.FlagValueID == nil {
+			continue
+		}
+		eventType := sse.FlagValueUpdated
+		if change.Action == model.PromoteActionCreate {
+			eventType = sse.FlagValueCreated
+		}
+		broadcast(ctx, s.sseService, eventType, model.FlagValueEvent{
+			FlagValueID:   *change.FlagValueID,
+			FlagID:        change.FlagID,
+			EnvironmentID: promotion.TargetEnvID,
+			Version:       change.Version,
+		})
+	}
+
+	return promotion, nil
+}
+
+// checkKey checks an environment key is well formed and not taken by
+// another environment of the project
+func (s *environmentService) checkKey(ctx context.Context, projectID uuid.UUID, key string) error {
+	if !environmentKeyPattern.MatchString(key) {
+		return apperrors.ErrInvalidEnvironmentKey
+	}
+	// Route parameters holding a UUID are read as an ID, not a key
+	if _, err := uuid.Parse(key); err == nil {
+		return apperrors.ErrInvalidEnvironmentKey
+	}
+
+	existing, err := s.envRepo.GetByKey(ctx, projectID, key)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return apperrors.ErrEnvironmentKeyExists
+	}
+	return nil
+}
+
+// environmentKeyFromName derives a key from an environment's name, e.g.
+// "QA 2" becomes "qa-2"
+func environmentKeyFromName(name string) string {
+	key := strings.Trim(environmentKeySeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(key) > 50 {
+		key = strings.TrimRight(key[:50], "-")
+	}
+	if key == "" {
+		return "env"
+	}
+	return key
+}
+
+// projectEnvironment retrieves an environment that must belong to a project
+func (s *environmentService) projectEnvironment(ctx context.Context, id, projectID uuid.UUID) (*model.Environment, error) {
+	env, err := s.envRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return nil, apperrors.ErrEnvironmentNotFound
+	}
+	if env.ProjectID != projectID {
+		return nil, apperrors.ErrEnvironmentProjectMismatch
+	}
+	return env, nil
+}
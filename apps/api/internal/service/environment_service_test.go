@@ -0,0 +1,24 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+)
+
+// Promoting an environment onto itself is refused before anything is looked
+// up or planned
+func TestPromoteEnvironmentToItself(t *testing.T) {
+	f := newTenantFixture()
+	req := &dto.PromoteEnvironmentRequest{TargetEnvID: f.own.environment, DryRun: true}
+
+	promotion, err := f.environments().PromoteEnvironment(f.ctx, f.own.environment, req)
+	if !errors.Is(err, apperrors.ErrPromoteSameEnvironment) {
+		t.Errorf("error = %v, want %v", err, apperrors.ErrPromoteSameEnvironment)
+	}
+	if promotion != nil {
+		t.Errorf("promotion = %+v, want none", promotion)
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"api/internal/cache"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/repository"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type evaluationService struct {
+	flagRepo       repository.FlagRepository
+	flagValueRepo  repository.FlagValueRepository
+	evaluationRepo repository.EvaluationRepository
+	configCache    *cache.ConfigCache
+	recorder       EvaluationRecorder
+}
+
+func NewEvaluationService(
+	flagRepo repository.FlagRepository,
+	flagValueRepo repository.FlagValueRepository,
+	evaluationRepo repository.EvaluationRepository,
+	configCache *cache.ConfigCache,
+	recorder EvaluationRecorder,
+) EvaluationService {
+	return &evaluationService{
+		flagRepo:       flagRepo,
+		flagValueRepo:  flagValueRepo,
+		evaluationRepo: evaluationRepo,
+		configCache:    configCache,
+		recorder:       recorder,
+	}
+}
+
+// Evaluate serves the values of the requested flags (all flags if keys is
+// empty) in an environment and records one evaluation per flag served
+func (s *evaluationService) Evaluate(ctx context.Context, envID uuid.UUID, keys []string) ([]model.EvaluationResult, error) {
+	if envID == uuid.Nil {
+		return nil, errors.New("environment ID is required")
+	}
+
+	values, err := s.configCache.GetOrLoad(ctx, envID, s.flagValueRepo.GetByEnvID)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		requested[key] = true
+	}
+
+	now := time.Now()
+	results := []model.EvaluationResult{}
+	for _, value := range values {
+		if len(keys) > 0 && !requested[value.FlagKey] {
+			continue
+		}
+
+		results = append(results, model.EvaluationResult{
+			Key:     value.FlagKey,
+			Value:   value.Value,
+			Enabled: value.Enabled,
+		})
+
+		served := value.Value
+		if !value.Enabled {
+			served = model.EvaluationValueOff
+		}
+		s.recorder.Record(value.FlagID, envID, served, 1, now)
+	}
+
+	return results, nil
+}
+
+// RecordSummary records evaluation counts reported by an SDK and returns
+// how many counters matched a flag served in the environment
+func (s *evaluationService) RecordSummary(ctx context.Context, envID uuid.UUID, req *dto.EvaluationSummaryRequest) (int, error) {
+	if envID == uuid.Nil {
+		return 0, errors.New("environment ID is required")
+	}
+
+	values, err := s.configCache.GetOrLoad(ctx, envID, s.flagValueRepo.GetByEnvID)
+	if err != nil {
+		return 0, err
+	}
+
+	flagIDs := make(map[string]uuid.UUID, len(values))
+	for _, value := range values {
+		flagIDs[value.FlagKey] = value.FlagID
+	}
+
+	now := time.Now()
+	accepted := 0
+	for _, counter := range req.Counters {
+		flagID, ok := flagIDs[counter.FlagKey]
+		if !ok || counter.Count < 1 {
+			continue
+		}
+
+		// Don't let clocks that run ahead push buckets into the future
+		at := now
+		if counter.LastEvaluatedAt != nil && counter.LastEvaluatedAt.Before(now) {
+			at = *counter.LastEvaluatedAt
+		}
+
+		s.recorder.Record(flagID, envID, counter.Value, counter.Count, at)
+		accepted++
+	}
+
+	return accepted, nil
+}
+
+// GetFlagInsights returns per-environment evaluation counts of a flag over
+// the last days, bucketed by hour or day
+func (s *evaluationService) GetFlagInsights(ctx context.Context, flagID uuid.UUID, days int, interval string) (*model.FlagInsights, error) {
+	if interval != "hour" && interval != "day" {
+		return nil, errors.New("interval must be one of: hour, day")
+	}
+
+	if days < 1 || days > 90 {
+		return nil, errors.New("days must be between 1 and 90")
+	}
+
+	flag, err := s.flagRepo.GetByID(ctx, flagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag == nil {
+		return nil, apperrors.ErrFlagNotFound
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	counts, err := s.evaluationRepo.GetByFlagID(ctx, flagID, since, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	lastEvaluated, err := s.evaluationRepo.GetLastEvaluatedByEnv(ctx, flagID)
+	if err != nil {
+		return nil, err
+	}
+
+	insights := &model.FlagInsights{
+		FlagID:          flagID,
+		LastEvaluatedAt: flag.LastEvaluatedAt,
+		Environments:    []model.EnvironmentInsights{},
+	}
+
+	byEnv := make(map[uuid.UUID]int)
+	for _, count := range counts {
+		i, ok := byEnv[count.EnvID]
+		if !ok {
+			i = len(insights.Environments)
+			byEnv[count.EnvID] = i
+			insights.Environments = append(insights.Environments, model.EnvironmentInsights{
+				EnvID:  count.EnvID,
+				Series: []model.EvaluationBucket{},
+			})
+		}
+
+		env := &insights.Environments[i]
+		env.Total += count.Count
+		env.Series = append(env.Series, model.EvaluationBucket{
+			BucketStart: count.BucketStart,
+			Value:       count.Value,
+			Count:       count.Count,
+		})
+	}
+
+	// Environments without evaluations in the window still report when they were last seen
+	for envID, at := range lastEvaluated {
+		if i, ok := byEnv[envID]; ok {
+			insights.Environments[i].LastEvaluatedAt = &at
+			continue
+		}
+		insights.Environments = append(insights.Environments, model.EnvironmentInsights{
+			EnvID:           envID,
+			LastEvaluatedAt: &at,
+			Series:          []model.EvaluationBucket{},
+		})
+	}
+
+	return insights, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"api/internal/cache"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// envFlagValueRepo serves environment configurations from memory, counting
+// the loads that would each be a query
+type envFlagValueRepo struct {
+	repository.FlagValueRepository
+	values map[uuid.UUID][]model.FlagValue
+	loads  int
+}
+
+func (r *envFlagValueRepo) GetByEnvID(ctx context.Context, envID uuid.UUID) ([]model.FlagValue, error) {
+	r.loads++
+	return r.values[envID], nil
+}
+
+type countingRecorder struct {
+	records int
+}
+
+func (r *countingRecorder) Record(flagID, envID uuid.UUID, value string, n int64, at time.Time) {
+	r.records++
+}
+
+func newEvaluationFixture(flags int) (*evaluationService, *envFlagValueRepo, *countingRecorder, uuid.UUID) {
+	envID := uuid.New()
+	values := make([]model.FlagValue, flags)
+	for i := range values {
+		values[i] = model.FlagValue{
+			ID:      uuid.New(),
+			FlagID:  uuid.New(),
+			FlagKey: fmt.Sprintf("flag_%d", i),
+			EnvID:   envID,
+			Value:   "true",
+			Enabled: i%2 == 0,
+		}
+	}
+
+	repo := &envFlagValueRepo{values: map[uuid.UUID][]model.FlagValue{envID: values}}
+	recorder := &countingRecorder{}
+	svc := NewEvaluationService(nil, repo, nil, cache.NewConfigCache(time.Minute), recorder).(*evaluationService)
+	return svc, repo, recorder, envID
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want int
+	}{
+		{name: "all flags", keys: nil, want: 10},
+		{name: "selected flags", keys: []string{"flag_1", "flag_4"}, want: 2},
+		{name: "unknown flag", keys: []string{"missing"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, recorder, envID := newEvaluationFixture(10)
+
+			for i := 0; i < 2; i++ {
+				results, err := svc.Evaluate(context.Background(), envID, tt.keys)
+				if err != nil {
+					t.Fatalf("Evaluate: %v", err)
+				}
+				if len(results) != tt.want {
+					t.Fatalf("Evaluate returned %d results, want %d", len(results), tt.want)
+				}
+			}
+
+			if repo.loads != 1 {
+				t.Errorf("loaded the configuration %d times, want 1", repo.loads)
+			}
+			if recorder.records != 2*tt.want {
+				t.Errorf("recorded %d evaluations, want %d", recorder.records, 2*tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	for _, flags := range []int{100, 2000} {
+		b.Run(fmt.Sprintf("all/flags=%d", flags), func(b *testing.B) {
+			svc, repo, _, envID := newEvaluationFixture(flags)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.Evaluate(ctx, envID, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repo.loads)/float64(b.N), "loads/op")
+		})
+
+		b.Run(fmt.Sprintf("selected/flags=%d", flags), func(b *testing.B) {
+			svc, repo, _, envID := newEvaluationFixture(flags)
+			ctx := context.Background()
+			keys := []string{"flag_0", "flag_7", "flag_42"}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.Evaluate(ctx, envID, keys); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repo.loads)/float64(b.N), "loads/op")
+		})
+
+		// Every evaluation follows a write, so the cache never helps
+		b.Run(fmt.Sprintf("uncached/flags=%d", flags), func(b *testing.B) {
+			svc, repo, _, envID := newEvaluationFixture(flags)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				svc.configCache.Invalidate(envID)
+				if _, err := svc.Evaluate(ctx, envID, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repo.loads)/float64(b.N), "loads/op")
+		})
+	}
+}
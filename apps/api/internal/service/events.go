@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/cache"
+	"api/internal/repository"
+	"api/internal/sse"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// broadcast sends an SSE event to the clients of the organisation the
+// context acts in once the transaction it carries commits, so clients never
+// hear of changes that are rolled back
+func broadcast(ctx context.Context, sseService SSEService, eventType sse.EventType, data interface{}) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return
+	}
+	repository.AfterCommit(ctx, func() {
+		sseService.BroadcastEvent(org.ID, eventType, data)
+	})
+}
+
+// invalidate drops an environment's cached configuration once the
+// transaction the context carries commits. Dropping it earlier would let a
+// concurrent request cache the configuration from before the change.
+func invalidate(ctx context.Context, configCache *cache.ConfigCache, envID uuid.UUID) {
+	repository.AfterCommit(ctx, func() {
+		configCache.Invalidate(envID)
+	})
+}
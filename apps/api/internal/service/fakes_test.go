@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"api/internal/dto"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// In-memory repositories for service tests. Each embeds its interface so
+// tests fail loudly if a service calls a method the fake doesn't implement.
+
+type memUserRepo struct {
+	repository.UserRepository
+	mutex sync.Mutex
+	users map[uuid.UUID]model.User
+}
+
+func newMemUserRepo(users ...*model.User) *memUserRepo {
+	r := &memUserRepo{users: make(map[uuid.UUID]model.User)}
+	for _, user := range users {
+		r.users[user.ID] = *user
+	}
+	return r
+}
+
+func (r *memUserRepo) Create(ctx context.Context, user *model.User) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memUserRepo) CreateFirst(ctx context.Context, user *model.User) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.users) > 0 {
+		return false, nil
+	}
+	r.users[user.ID] = *user
+	return true, nil
+}
+
+func (r *memUserRepo) Update(ctx context.Context, id uuid.UUID, user *model.User) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.users[id] = *user
+	return nil
+}
+
+func (r *memUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.ID == id }), nil
+}
+
+func (r *memUserRepo) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.Username == username }), nil
+}
+
+func (r *memUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.Email == email }), nil
+}
+
+func (r *memUserRepo) GetByExternalID(ctx context.Context, provider, externalID string) (*model.User, error) {
+	return r.find(func(u *model.User) bool {
+		return u.AuthProvider == provider && u.ExternalID != nil && *u.ExternalID == externalID
+	}), nil
+}
+
+func (r *memUserRepo) find(match func(*model.User) bool) *model.User {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, user := range r.users {
+		if match(&user) {
+			found := user
+			return &found
+		}
+	}
+	return nil
+}
+
+type memOrgRepo struct {
+	repository.OrganizationRepository
+	host *model.Organization
+}
+
+func newMemOrgRepo() *memOrgRepo {
+	return &memOrgRepo{host: &model.Organization{ID: uuid.New(), Name: "Host", Slug: "host", Host: true}}
+}
+
+func (r *memOrgRepo) GetHost(ctx context.Context) (*model.Organization, error) {
+	return r.host, nil
+}
+
+func (r *memOrgRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	if id == r.host.ID {
+		return r.host, nil
+	}
+	return nil, nil
+}
+
+type memSessionRepo struct {
+	repository.SessionRepository
+	mutex    sync.Mutex
+	sessions map[uuid.UUID]model.Session
+	tokens   map[string]model.RefreshToken
+}
+
+func newMemSessionRepo() *memSessionRepo {
+	return &memSessionRepo{
+		sessions: make(map[uuid.UUID]model.Session),
+		tokens:   make(map[string]model.RefreshToken),
+	}
+}
+
+func (r *memSessionRepo) Create(ctx context.Context, session *model.Session, token *model.RefreshToken) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sessions[session.ID] = *session
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *memSessionRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (r *memSessionRepo) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (r *memSessionRepo) Rotate(ctx context.Context, usedTokenID uuid.UUID, next *model.RefreshToken) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for hash, token := range r.tokens {
+		if token.ID != usedTokenID {
+			continue
+		}
+		if token.UsedAt != nil {
+			return false, nil
+		}
+		now := time.Now()
+		token.UsedAt = &now
+		r.tokens[hash] = token
+		r.tokens[next.TokenHash] = *next
+
+		session := r.sessions[next.SessionID]
+		session.LastUsedAt, session.ExpiresAt = now, next.ExpiresAt
+		r.sessions[next.SessionID] = session
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *memSessionRepo) Revoke(ctx context.Context, id uuid.UUID, reason string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	session, ok := r.sessions[id]
+	if ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt, session.RevokedReason = &now, &reason
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+type memThrottleRepo struct {
+	mutex    sync.Mutex
+	failures map[string]int
+	locks    map[string]time.Time
+}
+
+func newMemThrottleRepo() *memThrottleRepo {
+	return &memThrottleRepo{failures: make(map[string]int), locks: make(map[string]time.Time)}
+}
+
+func (r *memThrottleRepo) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var latest time.Time
+	for _, key := range keys {
+		if until := r.locks[key]; until.After(time.Now()) && until.After(latest) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+func (r *memThrottleRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures[key]++
+	return r.failures[key], nil
+}
+
+func (r *memThrottleRepo) Lock(ctx context.Context, key string, until time.Time, window time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.locks[key] = until
+	return nil
+}
+
+func (r *memThrottleRepo) Clear(ctx context.Context, key string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, locked := r.locks[key]
+	delete(r.failures, key)
+	delete(r.locks, key)
+	return locked, nil
+}
+
+type memMFARepo struct {
+	repository.MFARepository
+	mutex         sync.Mutex
+	usedSteps     map[uuid.UUID]int64
+	recoveryCodes map[uuid.UUID]map[string]bool
+}
+
+func newMemMFARepo() *memMFARepo {
+	return &memMFARepo{usedSteps: make(map[uuid.UUID]int64), recoveryCodes: make(map[uuid.UUID]map[string]bool)}
+}
+
+func (r *memMFARepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if last, ok := r.usedSteps[userID]; ok && step <= last {
+		return false, nil
+	}
+	r.usedSteps[userID] = step
+	return true, nil
+}
+
+func (r *memMFARepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.recoveryCodes[userID][codeHash] {
+		return false, nil
+	}
+	delete(r.recoveryCodes[userID], codeHash)
+	return true, nil
+}
+
+type memAuditRepo struct {
+	repository.AuditRepository
+	mutex  sync.Mutex
+	events []model.AuditEvent
+}
+
+func (r *memAuditRepo) Record(ctx context.Context, event *model.AuditEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+type memProjectRepo struct {
+	repository.ProjectRepository
+	mutex    sync.Mutex
+	projects map[uuid.UUID]model.Project
+	// beforeUpdate runs as an update starts, standing in for a concurrent
+	// request
+	beforeUpdate func(r *memProjectRepo)
+}
+
+func newMemProjectRepo(projects ...*model.Project) *memProjectRepo {
+	r := &memProjectRepo{projects: make(map[uuid.UUID]model.Project)}
+	for _, project := range projects {
+		r.projects[project.ID] = *project
+	}
+	return r
+}
+
+func (r *memProjectRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Project, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	project, ok := r.projects[id]
+	if !ok {
+		return nil, nil
+	}
+	return &project, nil
+}
+
+func (r *memProjectRepo) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateProjectRequest) (*model.Project, error) {
+	if r.beforeUpdate != nil {
+		r.beforeUpdate(r)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	project, ok := r.projects[id]
+	if !ok || (req.Version != nil && *req.Version != project.Version) {
+		return nil, nil
+	}
+	if req.Name != nil {
+		project.Name = *req.Name
+	}
+	if req.Description != nil {
+		project.Description = *req.Description
+	}
+	project.Version++
+	r.projects[id] = project
+	return &project, nil
+}
+
+type memFlagRepo struct {
+	repository.FlagRepository
+	mutex sync.Mutex
+	flags map[uuid.UUID]model.Flag
+	// beforeWrite runs as a write starts, standing in for a concurrent
+	// request
+	beforeWrite func(r *memFlagRepo)
+}
+
+func newMemFlagRepo(flags ...*model.Flag) *memFlagRepo {
+	r := &memFlagRepo{flags: make(map[uuid.UUID]model.Flag)}
+	for _, flag := range flags {
+		r.flags[flag.ID] = *flag
+	}
+	return r
+}
+
+func (r *memFlagRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	flag, ok := r.flags[id]
+	if !ok {
+		return nil, nil
+	}
+	return &flag, nil
+}
+
+func (r *memFlagRepo) SetStatus(ctx context.Context, id uuid.UUID, status string) (*model.Flag, error) {
+	if r.beforeWrite != nil {
+		r.beforeWrite(r)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	flag, ok := r.flags[id]
+	if !ok {
+		return nil, nil
+	}
+	flag.Status = status
+	flag.Version++
+	r.flags[id] = flag
+	return &flag, nil
+}
+
+type memFlagValueRepo struct {
+	repository.FlagValueRepository
+	mutex  sync.Mutex
+	values map[uuid.UUID]model.FlagValue
+}
+
+func newMemFlagValueRepo(values ...*model.FlagValue) *memFlagValueRepo {
+	r := &memFlagValueRepo{values: make(map[uuid.UUID]model.FlagValue)}
+	for _, value := range values {
+		r.values[value.ID] = *value
+	}
+	return r
+}
+
+func (r *memFlagValueRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.FlagValue, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	value, ok := r.values[id]
+	if !ok {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+func (r *memFlagValueRepo) GetByFlagID(ctx context.Context, flagID uuid.UUID) ([]model.FlagValue, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var values []model.FlagValue
+	for _, value := range r.values {
+		if value.FlagID == flagID {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
@@ -3,8 +3,13 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
+	"api/internal/cache"
 	"api/internal/dto"
+	apperrors "api/internal/errors"
 	"api/internal/model"
+	"api/internal/pagination"
 	"api/internal/repository"
 	"api/internal/sse"
 	"github.com/google/uuid"
@@ -13,14 +18,22 @@ import (
 type flagService struct {
 	flagRepo      repository.FlagRepository
 	flagValueRepo repository.FlagValueRepository
+	userRepo      repository.UserRepository
+	teamRepo      repository.TeamRepository
+	txManager     repository.TxManager
 	sseService    SSEService
+	configCache   *cache.ConfigCache
 }
 
-func NewFlagService(flagRepo repository.FlagRepository, flagValueRepo repository.FlagValueRepository, sseService SSEService) FlagService {
+func NewFlagService(flagRepo repository.FlagRepository, flagValueRepo repository.FlagValueRepository, userRepo repository.UserRepository, teamRepo repository.TeamRepository, txManager repository.TxManager, sseService SSEService, configCache *cache.ConfigCache) FlagService {
 	return &flagService{
 		flagRepo:      flagRepo,
 		flagValueRepo: flagValueRepo,
+		userRepo:      userRepo,
+		teamRepo:      teamRepo,
+		txManager:     txManager,
 		sseService:    sseService,
+		configCache:   configCache,
 	}
 }
 
@@ -57,26 +70,85 @@ func (s *flagService) CreateFlag(ctx context.Context, req *dto.CreateFlagRequest
 		return nil, errors.New("flag type must be one of: boolean, string, number, json")
 	}
 
-	flag := &model.Flag{
-		ProjectID:   req.ProjectID,
-		Key:         req.Key,
-		Description: req.Description,
-		Type:        req.Type,
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.flagRepo.Create(ctx, flag)
+	owner, err := toFlagOwner(req.Owner)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkOwner(ctx, owner); err != nil {
+		return nil, err
+	}
 
-	// Broadcast SSE event
-	eventData := model.FlagEvent{
-		FlagID:    flag.ID,
-		ProjectID: flag.ProjectID,
-		Name:      flag.Description, // Using description as name since flag model doesn't have name
-		Key:       flag.Key,
+	if req.Kind != "" && req.Kind != model.FlagKindTemporary && req.Kind != model.FlagKindPermanent {
+		return nil, errors.New("flag kind must be one of: temporary, permanent")
+	}
+
+	removalDate, err := parseRemovalDate(req.RemovalDate)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultValue := defaultFlagValues[req.Type]
+	if req.DefaultValue != nil {
+		defaultValue = *req.DefaultValue
+	}
+	if !model.ValidFlagValue(req.Type, defaultValue) {
+		return nil, apperrors.ErrInvalidFlagValue
+	}
+
+	flag := &model.Flag{
+		ProjectID:    req.ProjectID,
+		Key:          req.Key,
+		Description:  req.Description,
+		Type:         req.Type,
+		DefaultValue: defaultValue,
+		Tags:        tags,
+		Owner:       owner,
+		Kind:        req.Kind,
+		RemovalDate: removalDate,
+	}
+
+	// The flag is created together with its default value in every
+	// environment of the project
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.flagRepo.Create(ctx, flag); err != nil {
+			return err
+		}
+		values, err := s.flagValueRepo.CreateDefaults(ctx, flag)
+		if err != nil {
+			return err
+		}
+
+		// Broadcast SSE event
+		eventData := model.FlagEvent{
+			FlagID:    flag.ID,
+			ProjectID: flag.ProjectID,
+			Name:      flag.Description, // Using description as name since flag model doesn't have name
+			Key:       flag.Key,
+			Tags:      flag.Tags,
+			Owner:     flag.Owner,
+			Version:   flag.Version,
+		}
+		broadcast(ctx, s.sseService, sse.FlagCreated, eventData)
+
+		for _, value := range values {
+			invalidate(ctx, s.configCache, value.EnvID)
+			broadcast(ctx, s.sseService, sse.FlagValueCreated, model.FlagValueEvent{
+				FlagValueID:   value.ID,
+				FlagID:        value.FlagID,
+				EnvironmentID: value.EnvID,
+				Version:       value.Version,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	s.sseService.BroadcastEvent(sse.FlagCreated, eventData)
 
 	return flag, nil
 }
@@ -88,35 +160,43 @@ func (s *flagService) GetFlag(ctx context.Context, id uuid.UUID) (*model.Flag, e
 	}
 	
 	if flag == nil {
-		return nil, errors.New("flag not found")
+		return nil, apperrors.ErrFlagNotFound
 	}
 
 	return flag, nil
 }
 
-func (s *flagService) GetProjectFlags(ctx context.Context, projectID uuid.UUID, includeValues bool) ([]model.FlagWithValues, error) {
+func (s *flagService) GetProjectFlags(ctx context.Context, projectID uuid.UUID, params pagination.Params, includeValues bool) (*pagination.Page[model.FlagWithValues], error) {
 	if projectID == uuid.Nil {
 		return nil, errors.New("project ID is required")
 	}
 
-	if includeValues {
-		return s.flagRepo.GetWithValuesByProjectID(ctx, projectID)
-	}
-
-	flags, err := s.flagRepo.GetByProjectID(ctx, projectID)
+	flags, err := s.flagRepo.List(ctx, projectID, params)
 	if err != nil {
 		return nil, err
 	}
 
 	var flagsWithValues []model.FlagWithValues
-	for _, flag := range flags {
-		flagsWithValues = append(flagsWithValues, model.FlagWithValues{
-			Flag:   flag,
-			Values: []model.FlagValue{},
-		})
+	if includeValues {
+		flagsWithValues, err = s.flagRepo.WithValues(ctx, flags.Items)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		flagsWithValues = make([]model.FlagWithValues, len(flags.Items))
+		for i, flag := range flags.Items {
+			flagsWithValues[i] = model.FlagWithValues{
+				Flag:   flag,
+				Values: []model.FlagValue{},
+			}
+		}
 	}
 
-	return flagsWithValues, nil
+	return &pagination.Page[model.FlagWithValues]{
+		Items:      flagsWithValues,
+		NextCursor: flags.NextCursor,
+		Total:      flags.Total,
+	}, nil
 }
 
 func (s *flagService) UpdateFlag(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagRequest) (*model.Flag, error) {
@@ -126,7 +206,17 @@ func (s *flagService) UpdateFlag(ctx context.Context, id uuid.UUID, req *dto.Upd
 	}
 	
 	if exists == nil {
-		return nil, errors.New("flag not found")
+		return nil, apperrors.ErrFlagNotFound
+	}
+
+	version, err := checkVersion(req.Version, req.IfMatch, exists.Version)
+	if err != nil {
+		return exists, err
+	}
+	req.Version = version
+
+	if exists.IsArchived() {
+		return nil, apperrors.ErrFlagArchived
 	}
 
 	if req.Key != nil {
@@ -161,10 +251,103 @@ func (s *flagService) UpdateFlag(ctx context.Context, id uuid.UUID, req *dto.Upd
 		}
 	}
 
+	if err := s.checkValuesMatchType(ctx, exists, req); err != nil {
+		return nil, err
+	}
+
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return nil, err
+		}
+		req.Tags = &tags
+	}
+
+	if req.Owner != nil && req.Owner.Type != "" {
+		owner, err := toFlagOwner(req.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkOwner(ctx, owner); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Kind != nil && *req.Kind != model.FlagKindTemporary && *req.Kind != model.FlagKindPermanent {
+		return nil, errors.New("flag kind must be one of: temporary, permanent")
+	}
+
+	if _, err := parseRemovalDate(req.RemovalDate); err != nil {
+		return nil, err
+	}
+
 	flag, err := s.flagRepo.Update(ctx, id, req)
 	if err != nil {
 		return nil, err
 	}
+	if flag == nil {
+		current, err := s.flagRepo.GetByID(ctx, id)
+		return staleUpdate(current, err, apperrors.ErrFlagNotFound)
+	}
+
+	// Cached configurations serve values under the flag's key and type
+	if flag.Key != exists.Key || flag.Type != exists.Type {
+		if err := s.invalidateFlagEnvironments(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Broadcast SSE event
+	eventData := model.FlagEvent{
+		FlagID:    flag.ID,
+		ProjectID: flag.ProjectID,
+		Name:      flag.Description,
+		Key:       flag.Key,
+		Tags:      flag.Tags,
+		Owner:     flag.Owner,
+		Version:   flag.Version,
+	}
+	broadcast(ctx, s.sseService, sse.FlagUpdated, eventData)
+
+	return flag, nil
+}
+
+// ArchiveFlag hides a flag from listings and stops serving its values
+func (s *flagService) ArchiveFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	return s.setFlagStatus(ctx, id, model.FlagStatusArchived, sse.FlagArchived)
+}
+
+// RestoreFlag brings an archived flag back into service
+func (s *flagService) RestoreFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	return s.setFlagStatus(ctx, id, model.FlagStatusActive, sse.FlagRestored)
+}
+
+func (s *flagService) setFlagStatus(ctx context.Context, id uuid.UUID, status string, eventType sse.EventType) (*model.Flag, error) {
+	exists, err := s.flagRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	
+	if exists == nil {
+		return nil, apperrors.ErrFlagNotFound
+	}
+
+	if exists.Status == status {
+		return exists, nil
+	}
+
+	flag, err := s.flagRepo.SetStatus(ctx, id, status)
+	if err != nil {
+		return nil, err
+	}
+	// Deleted since it was looked up
+	if flag == nil {
+		return nil, apperrors.ErrFlagNotFound
+	}
+
+	if err := s.invalidateFlagEnvironments(ctx, id); err != nil {
+		return nil, err
+	}
 
 	// Broadcast SSE event
 	eventData := model.FlagEvent{
@@ -172,12 +355,16 @@ func (s *flagService) UpdateFlag(ctx context.Context, id uuid.UUID, req *dto.Upd
 		ProjectID: flag.ProjectID,
 		Name:      flag.Description,
 		Key:       flag.Key,
+		Tags:      flag.Tags,
+		Owner:     flag.Owner,
+		Version:   flag.Version,
 	}
-	s.sseService.BroadcastEvent(sse.FlagUpdated, eventData)
+	broadcast(ctx, s.sseService, eventType, eventData)
 
 	return flag, nil
 }
 
+// DeleteFlag permanently removes an archived flag and its values
 func (s *flagService) DeleteFlag(ctx context.Context, id uuid.UUID) error {
 	exists, err := s.flagRepo.GetByID(ctx, id)
 	if err != nil {
@@ -185,26 +372,214 @@ func (s *flagService) DeleteFlag(ctx context.Context, id uuid.UUID) error {
 	}
 	
 	if exists == nil {
-		return errors.New("flag not found")
+		return apperrors.ErrFlagNotFound
+	}
+
+	if !exists.IsArchived() {
+		return apperrors.ErrFlagNotArchived
 	}
 
-	err = s.flagRepo.Delete(ctx, id)
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Values cascade with the flag, so remember which environments they
+		// belong to. Reading them in the same transaction means no value
+		// created meanwhile is missed.
+		values, err := s.flagValueRepo.GetByFlagID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.flagRepo.Delete(ctx, id); err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			invalidate(ctx, s.configCache, value.EnvID)
+		}
+
+		// Broadcast SSE event
+		eventData := model.FlagEvent{
+			FlagID:    exists.ID,
+			ProjectID: exists.ProjectID,
+			Name:      exists.Description,
+			Key:       exists.Key,
+			Tags:      exists.Tags,
+			Owner:     exists.Owner,
+			Version:   exists.Version,
+		}
+		broadcast(ctx, s.sseService, sse.FlagDeleted, eventData)
+		return nil
+	})
+}
+
+// GetStaleFlags reports temporary flags that are candidates for removal
+func (s *flagService) GetStaleFlags(ctx context.Context, projectID uuid.UUID, days int) ([]model.StaleFlag, error) {
+	if projectID == uuid.Nil {
+		return nil, errors.New("project ID is required")
+	}
+
+	if days < 1 {
+		return nil, errors.New("days must be at least 1")
+	}
+
+	olderThan := time.Now().AddDate(0, 0, -days)
+	staleFlags, err := s.flagRepo.GetStale(ctx, projectID, olderThan)
+	if err != nil {
+		return nil, err
+	}
+
+	if staleFlags == nil {
+		staleFlags = []model.StaleFlag{}
+	}
+	return staleFlags, nil
+}
+
+// checkValuesMatchType checks the flag's default value and values match its type after the update
+func (s *flagService) checkValuesMatchType(ctx context.Context, flag *model.Flag, req *dto.UpdateFlagRequest) error {
+	flagType := flag.Type
+	if req.Type != nil {
+		flagType = *req.Type
+	}
+	defaultValue := flag.DefaultValue
+	if req.DefaultValue != nil {
+		defaultValue = *req.DefaultValue
+	}
+	if !model.ValidFlagValue(flagType, defaultValue) {
+		return apperrors.ErrInvalidFlagValue
+	}
+
+	if flagType == flag.Type {
+		return nil
+	}
+	values, err := s.flagValueRepo.GetByFlagID(ctx, flag.ID)
 	if err != nil {
 		return err
 	}
+	for _, value := range values {
+		if !model.ValidFlagValue(flagType, value.Value) {
+			return apperrors.ErrFlagTypeMismatchesValues
+		}
+	}
+	return nil
+}
 
-	// Broadcast SSE event
-	eventData := model.FlagEvent{
-		FlagID:    exists.ID,
-		ProjectID: exists.ProjectID,
-		Name:      exists.Description,
-		Key:       exists.Key,
+// checkValueMatchesType checks a value matches the type of its flag
+func (s *flagService) checkValueMatchesType(ctx context.Context, flagID uuid.UUID, value string) error {
+	flag, err := s.flagRepo.GetByID(ctx, flagID)
+	if err != nil {
+		return err
+	}
+	if flag == nil {
+		return apperrors.ErrFlagNotFound
+	}
+	if !model.ValidFlagValue(flag.Type, value) {
+		return apperrors.ErrInvalidFlagValue
+	}
+	return nil
+}
+
+// invalidateFlagEnvironments drops the cached configuration of every environment the flag has a value in
+func (s *flagService) invalidateFlagEnvironments(ctx context.Context, flagID uuid.UUID) error {
+	values, err := s.flagValueRepo.GetByFlagID(ctx, flagID)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		invalidate(ctx, s.configCache, value.EnvID)
+	}
+	return nil
+}
+
+func parseRemovalDate(date *string) (*time.Time, error) {
+	if date == nil || *date == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return nil, errors.New("removal date must be in YYYY-MM-DD format")
+	}
+	return &t, nil
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > 20 {
+		return nil, errors.New("a flag can have at most 20 tags")
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("tags cannot be empty")
+		}
+		if len(tag) > 50 {
+			return nil, errors.New("tags must be less than 50 characters")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+func toFlagOwner(req *dto.FlagOwnerRequest) (*model.FlagOwner, error) {
+	if req == nil || req.Type == "" {
+		return nil, nil
+	}
+
+	if req.Type != model.OwnerTypeUser && req.Type != model.OwnerTypeTeam {
+		return nil, errors.New("owner type must be one of: user, team")
+	}
+
+	if req.ID == uuid.Nil {
+		return nil, errors.New("owner ID is required")
+	}
+
+	return &model.FlagOwner{Type: req.Type, ID: req.ID}, nil
+}
+
+// checkOwner checks a flag's owner is a user or team of the caller's
+// organisation
+func (s *flagService) checkOwner(ctx context.Context, owner *model.FlagOwner) error {
+	if owner == nil {
+		return nil
+	}
+
+	if owner.Type == model.OwnerTypeTeam {
+		team, err := s.teamRepo.GetByID(ctx, owner.ID)
+		if err != nil {
+			return err
+		}
+		if team == nil {
+			return apperrors.ErrInvalidFlagOwner
+		}
+		return nil
 	}
-	s.sseService.BroadcastEvent(sse.FlagDeleted, eventData)
 
+	user, err := s.userRepo.GetByID(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	if !inOrganization(ctx, user) {
+		return apperrors.ErrInvalidFlagOwner
+	}
 	return nil
 }
 
+// defaultFlagValues are the default values of flags created without one,
+// by type
+var defaultFlagValues = map[string]string{
+	"boolean": "false",
+	"string":  "",
+	"number":  "0",
+	"json":    "{}",
+}
+
 // Flag value operations
 func (s *flagService) CreateOrUpdateFlagValue(ctx context.Context, req *dto.CreateFlagValueRequest) (*model.FlagValue, error) {
 	if req.FlagID == uuid.Nil {
@@ -219,6 +594,10 @@ func (s *flagService) CreateOrUpdateFlagValue(ctx context.Context, req *dto.Crea
 		return nil, errors.New("flag value is required")
 	}
 
+	if err := s.checkValueMatchesType(ctx, req.FlagID, req.Value); err != nil {
+		return nil, err
+	}
+
 	flagValue := &model.FlagValue{
 		FlagID:  req.FlagID,
 		EnvID:   req.EnvID,
@@ -231,13 +610,16 @@ func (s *flagService) CreateOrUpdateFlagValue(ctx context.Context, req *dto.Crea
 		return nil, err
 	}
 
+	invalidate(ctx, s.configCache, flagValue.EnvID)
+
 	// Broadcast SSE event
 	eventData := model.FlagValueEvent{
 		FlagValueID:  flagValue.ID,
 		FlagID:       flagValue.FlagID,
 		EnvironmentID: flagValue.EnvID,
+		Version:      flagValue.Version,
 	}
-	s.sseService.BroadcastEvent(sse.FlagValueCreated, eventData)
+	broadcast(ctx, s.sseService, sse.FlagValueCreated, eventData)
 
 	return flagValue, nil
 }
@@ -260,7 +642,7 @@ func (s *flagService) GetEnvironmentFlags(ctx context.Context, envID uuid.UUID)
 		return nil, errors.New("environment ID is required")
 	}
 
-	values, err := s.flagValueRepo.GetByEnvID(ctx, envID)
+	values, err := s.configCache.GetOrLoad(ctx, envID, s.flagValueRepo.GetByEnvID)
 	if err != nil {
 		return nil, err
 	}
@@ -275,21 +657,40 @@ func (s *flagService) UpdateFlagValue(ctx context.Context, id uuid.UUID, req *dt
 	}
 	
 	if exists == nil {
-		return nil, errors.New("flag value not found")
+		return nil, apperrors.ErrFlagValueNotFound
+	}
+
+	version, err := checkVersion(req.Version, req.IfMatch, exists.Version)
+	if err != nil {
+		return exists, err
+	}
+	req.Version = version
+
+	if req.Value != nil {
+		if err := s.checkValueMatchesType(ctx, exists.FlagID, *req.Value); err != nil {
+			return nil, err
+		}
 	}
 
 	flagValue, err := s.flagValueRepo.Update(ctx, id, req)
 	if err != nil {
 		return nil, err
 	}
+	if flagValue == nil {
+		current, err := s.flagValueRepo.GetByID(ctx, id)
+		return staleUpdate(current, err, apperrors.ErrFlagValueNotFound)
+	}
+
+	invalidate(ctx, s.configCache, flagValue.EnvID)
 
 	// Broadcast SSE event
 	eventData := model.FlagValueEvent{
 		FlagValueID:  flagValue.ID,
 		FlagID:       flagValue.FlagID,
 		EnvironmentID: flagValue.EnvID,
+		Version:      flagValue.Version,
 	}
-	s.sseService.BroadcastEvent(sse.FlagValueUpdated, eventData)
+	broadcast(ctx, s.sseService, sse.FlagValueUpdated, eventData)
 
 	return flagValue, nil
 }
@@ -301,7 +702,7 @@ func (s *flagService) DeleteFlagValue(ctx context.Context, id uuid.UUID) error {
 	}
 	
 	if exists == nil {
-		return errors.New("flag value not found")
+		return apperrors.ErrFlagValueNotFound
 	}
 
 	err = s.flagValueRepo.Delete(ctx, id)
@@ -309,13 +710,16 @@ func (s *flagService) DeleteFlagValue(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
+	invalidate(ctx, s.configCache, exists.EnvID)
+
 	// Broadcast SSE event
 	eventData := model.FlagValueEvent{
 		FlagValueID:  exists.ID,
 		FlagID:       exists.FlagID,
 		EnvironmentID: exists.EnvID,
+		Version:      exists.Version,
 	}
-	s.sseService.BroadcastEvent(sse.FlagValueDeleted, eventData)
+	broadcast(ctx, s.sseService, sse.FlagValueDeleted, eventData)
 
 	return nil
 }
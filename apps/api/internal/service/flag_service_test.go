@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+func TestSetFlagStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		// concurrent changes the flag between the lookup and the write
+		concurrent  func(r *memFlagRepo, id uuid.UUID)
+		archive     bool
+		want        error
+		wantStatus  string
+		wantVersion int
+	}{
+		{name: "archive", status: model.FlagStatusActive, archive: true, wantStatus: model.FlagStatusArchived, wantVersion: 2},
+		{name: "restore", status: model.FlagStatusArchived, wantStatus: model.FlagStatusActive, wantVersion: 2},
+		{name: "already archived", status: model.FlagStatusArchived, archive: true, wantStatus: model.FlagStatusArchived, wantVersion: 1},
+		{
+			name:       "deleted concurrently",
+			status:     model.FlagStatusActive,
+			archive:    true,
+			concurrent: func(r *memFlagRepo, id uuid.UUID) { delete(r.flags, id) },
+			want:       apperrors.ErrFlagNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag := &model.Flag{ID: uuid.New(), Key: "beta-banner", Status: tt.status, Version: 1}
+			repo := newMemFlagRepo(flag)
+			if tt.concurrent != nil {
+				repo.beforeWrite = func(r *memFlagRepo) { tt.concurrent(r, flag.ID) }
+			}
+			svc := NewFlagService(repo, newMemFlagValueRepo(), nil, nil, nil, nil, nil)
+
+			var got *model.Flag
+			var err error
+			if tt.archive {
+				got, err = svc.ArchiveFlag(context.Background(), flag.ID)
+			} else {
+				got, err = svc.RestoreFlag(context.Background(), flag.ID)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if got != nil {
+					t.Errorf("returned %+v with the error", got)
+				}
+				return
+			}
+			if got.Status != tt.wantStatus || got.Version != tt.wantVersion {
+				t.Errorf("flag is %s at version %d, want %s at version %d", got.Status, got.Version, tt.wantStatus, tt.wantVersion)
+			}
+		})
+	}
+}
+
+// Unknown flags and values are reported as not found, so handlers answer 404
+func TestFlagNotFound(t *testing.T) {
+	svc := NewFlagService(newMemFlagRepo(), newMemFlagValueRepo(), nil, nil, nil, nil, nil)
+	ctx, id := context.Background(), uuid.New()
+	version := 1
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "get", call: func() error { _, err := svc.GetFlag(ctx, id); return err }, want: apperrors.ErrFlagNotFound},
+		{name: "update", call: func() error { _, err := svc.UpdateFlag(ctx, id, &dto.UpdateFlagRequest{Version: &version}); return err }, want: apperrors.ErrFlagNotFound},
+		{name: "archive", call: func() error { _, err := svc.ArchiveFlag(ctx, id); return err }, want: apperrors.ErrFlagNotFound},
+		{name: "restore", call: func() error { _, err := svc.RestoreFlag(ctx, id); return err }, want: apperrors.ErrFlagNotFound},
+		{name: "delete", call: func() error { return svc.DeleteFlag(ctx, id) }, want: apperrors.ErrFlagNotFound},
+		{name: "update value", call: func() error {
+			_, err := svc.UpdateFlagValue(ctx, id, &dto.UpdateFlagValueRequest{Version: &version})
+			return err
+		}, want: apperrors.ErrFlagValueNotFound},
+		{name: "delete value", call: func() error { return svc.DeleteFlagValue(ctx, id) }, want: apperrors.ErrFlagValueNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// queryLatency stands in for a round trip to Postgres in the benchmarks
+const queryLatency = 50 * time.Microsecond
+
+// projectFlagRepos serve a project's flags and values from memory, taking
+// queryLatency and counting a query for each call that would be one
+type projectFlagRepos struct {
+	flags   []model.Flag
+	values  map[uuid.UUID][]model.FlagValue
+	queries int
+}
+
+func newProjectFlagRepos(flags, envs int) *projectFlagRepos {
+	r := &projectFlagRepos{values: make(map[uuid.UUID][]model.FlagValue)}
+	envIDs := make([]uuid.UUID, envs)
+	for i := range envIDs {
+		envIDs[i] = uuid.New()
+	}
+	for i := 0; i < flags; i++ {
+		flag := model.Flag{ID: uuid.New(), Key: fmt.Sprintf("flag_%d", i), Type: "boolean"}
+		r.flags = append(r.flags, flag)
+		for _, envID := range envIDs {
+			r.values[flag.ID] = append(r.values[flag.ID], model.FlagValue{ID: uuid.New(), FlagID: flag.ID, EnvID: envID, Value: "false"})
+		}
+	}
+	return r
+}
+
+func (r *projectFlagRepos) query() {
+	r.queries++
+	time.Sleep(queryLatency)
+}
+
+type projectFlagRepo struct {
+	repository.FlagRepository
+	*projectFlagRepos
+}
+
+func (r projectFlagRepo) List(ctx context.Context, projectID uuid.UUID, params pagination.Params) (*pagination.Page[model.Flag], error) {
+	r.query()
+	return &pagination.Page[model.Flag]{Items: r.flags, Total: len(r.flags)}, nil
+}
+
+func (r projectFlagRepo) WithValues(ctx context.Context, flags []model.Flag) ([]model.FlagWithValues, error) {
+	r.query()
+	withValues := make([]model.FlagWithValues, len(flags))
+	for i, flag := range flags {
+		withValues[i] = model.FlagWithValues{Flag: flag, Values: r.values[flag.ID]}
+	}
+	return withValues, nil
+}
+
+type projectFlagValueRepo struct {
+	repository.FlagValueRepository
+	*projectFlagRepos
+}
+
+func (r projectFlagValueRepo) GetByFlagID(ctx context.Context, flagID uuid.UUID) ([]model.FlagValue, error) {
+	r.query()
+	return r.values[flagID], nil
+}
+
+// flagsWithValuesOneByOne is how flags were listed with their values before
+// WithValues: a query for the flags, then one per flag for its values
+func flagsWithValuesOneByOne(ctx context.Context, flagRepo repository.FlagRepository, flagValueRepo repository.FlagValueRepository, projectID uuid.UUID, params pagination.Params) ([]model.FlagWithValues, error) {
+	flags, err := flagRepo.List(ctx, projectID, params)
+	if err != nil {
+		return nil, err
+	}
+	withValues := make([]model.FlagWithValues, len(flags.Items))
+	for i, flag := range flags.Items {
+		values, err := flagValueRepo.GetByFlagID(ctx, flag.ID)
+		if err != nil {
+			return nil, err
+		}
+		withValues[i] = model.FlagWithValues{Flag: flag, Values: values}
+	}
+	return withValues, nil
+}
+
+// Compares listing a project's flags with their values one flag at a time
+// against the batched WithValues query GetProjectFlags uses
+func BenchmarkGetProjectFlagsWithValues(b *testing.B) {
+	ctx := context.Background()
+	params := pagination.Params{Limit: pagination.MaxLimit}
+
+	for _, flags := range []int{50, pagination.MaxLimit} {
+		b.Run(fmt.Sprintf("one-by-one/flags=%d", flags), func(b *testing.B) {
+			repos := newProjectFlagRepos(flags, 3)
+			flagRepo, flagValueRepo := projectFlagRepo{projectFlagRepos: repos}, projectFlagValueRepo{projectFlagRepos: repos}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := flagsWithValuesOneByOne(ctx, flagRepo, flagValueRepo, uuid.New(), params); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repos.queries)/float64(b.N), "queries/op")
+		})
+
+		b.Run(fmt.Sprintf("batched/flags=%d", flags), func(b *testing.B) {
+			repos := newProjectFlagRepos(flags, 3)
+			svc := NewFlagService(projectFlagRepo{projectFlagRepos: repos}, projectFlagValueRepo{projectFlagRepos: repos}, nil, nil, nil, nil, nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.GetProjectFlags(ctx, uuid.New(), params, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repos.queries)/float64(b.N), "queries/op")
+		})
+	}
+}
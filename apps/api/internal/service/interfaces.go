@@ -2,9 +2,12 @@ package service
 
 import (
 	"api/internal/dto"
+	"api/internal/middleware"
 	"api/internal/model"
+	"api/internal/pagination"
 	"api/internal/sse"
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,7 +15,7 @@ import (
 type ProjectService interface {
 	CreateProject(ctx context.Context, req *dto.CreateProjectRequest) (*model.Project, error)
 	GetProject(ctx context.Context, id uuid.UUID) (*model.Project, error)
-	GetAllProjects(ctx context.Context) ([]model.Project, error)
+	GetAllProjects(ctx context.Context, params pagination.Params) (*pagination.Page[model.Project], error)
 	UpdateProject(ctx context.Context, id uuid.UUID, req *dto.UpdateProjectRequest) (*model.Project, error)
 	DeleteProject(ctx context.Context, id uuid.UUID) error
 }
@@ -20,18 +23,22 @@ type ProjectService interface {
 type EnvironmentService interface {
 	CreateEnvironment(ctx context.Context, req *dto.CreateEnvironmentRequest) (*model.Environment, error)
 	GetEnvironment(ctx context.Context, id uuid.UUID) (*model.Environment, error)
-	GetAllEnvironments(ctx context.Context) ([]model.Environment, error)
-	GetProjectEnvironments(ctx context.Context, projectID uuid.UUID) ([]model.Environment, error)
+	GetAllEnvironments(ctx context.Context, params pagination.Params) (*pagination.Page[model.Environment], error)
+	GetProjectEnvironments(ctx context.Context, projectID uuid.UUID, params pagination.Params) (*pagination.Page[model.Environment], error)
 	UpdateEnvironment(ctx context.Context, id uuid.UUID, req *dto.UpdateEnvironmentRequest) (*model.Environment, error)
 	DeleteEnvironment(ctx context.Context, id uuid.UUID) error
+	PromoteEnvironment(ctx context.Context, sourceID uuid.UUID, req *dto.PromoteEnvironmentRequest) (*model.Promotion, error)
 }
 
 type FlagService interface {
 	CreateFlag(ctx context.Context, req *dto.CreateFlagRequest) (*model.Flag, error)
 	GetFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error)
-	GetProjectFlags(ctx context.Context, projectID uuid.UUID, includeValues bool) ([]model.FlagWithValues, error)
+	GetProjectFlags(ctx context.Context, projectID uuid.UUID, params pagination.Params, includeValues bool) (*pagination.Page[model.FlagWithValues], error)
 	UpdateFlag(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagRequest) (*model.Flag, error)
+	ArchiveFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error)
+	RestoreFlag(ctx context.Context, id uuid.UUID) (*model.Flag, error)
 	DeleteFlag(ctx context.Context, id uuid.UUID) error
+	GetStaleFlags(ctx context.Context, projectID uuid.UUID, days int) ([]model.StaleFlag, error)
 
 	// Flag value operations
 	CreateOrUpdateFlagValue(ctx context.Context, req *dto.CreateFlagValueRequest) (*model.FlagValue, error)
@@ -41,6 +48,102 @@ type FlagService interface {
 	DeleteFlagValue(ctx context.Context, id uuid.UUID) error
 }
 
+type EvaluationService interface {
+	Evaluate(ctx context.Context, envID uuid.UUID, keys []string) ([]model.EvaluationResult, error)
+	RecordSummary(ctx context.Context, envID uuid.UUID, req *dto.EvaluationSummaryRequest) (int, error)
+	GetFlagInsights(ctx context.Context, flagID uuid.UUID, days int, interval string) (*model.FlagInsights, error)
+}
+
+type OIDCService interface {
+	AuthorizationURL(ctx context.Context) (authURL string, state string, err error)
+	Callback(ctx context.Context, state, code string, client dto.ClientInfo) (*dto.LoginResponse, error)
+}
+
+type MFAService interface {
+	Verify(ctx context.Context, req *dto.MFAVerifyRequest, client dto.ClientInfo) (*dto.LoginResponse, error)
+	StartEnrollment(ctx context.Context, userID uuid.UUID) (*dto.MFAEnrollmentResponse, error)
+	ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) (*dto.MFAConfirmResponse, error)
+	StartChallengeEnrollment(ctx context.Context, mfaToken string) (*dto.MFAEnrollmentResponse, error)
+	ConfirmChallengeEnrollment(ctx context.Context, req *dto.MFASetupConfirmRequest, client dto.ClientInfo) (*dto.MFAConfirmResponse, error)
+	Disable(ctx context.Context, userID uuid.UUID, code string) error
+	Reset(ctx context.Context, userID uuid.UUID) error
+}
+
+type EvaluationRecorder interface {
+	Record(flagID, envID uuid.UUID, value string, n int64, at time.Time)
+}
+
 type SSEService interface {
-	BroadcastEvent(eventType sse.EventType, data interface{})
+	BroadcastEvent(organizationID uuid.UUID, eventType sse.EventType, data interface{})
+}
+
+type AccountService interface {
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, req *dto.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req *dto.ChangePasswordRequest) error
+	SendVerificationEmail(ctx context.Context, userID uuid.UUID) error
+	VerifyEmail(ctx context.Context, token string) error
+	SendInvitation(ctx context.Context, user *model.User, inviter *model.User) error
+	AcceptInvitation(ctx context.Context, req *dto.AcceptInvitationRequest) error
+}
+
+type AuditService interface {
+	ListEvents(ctx context.Context, params pagination.Params) (*pagination.Page[model.AuditEvent], error)
+}
+
+type UserService interface {
+	ListUsers(ctx context.Context, params pagination.Params) (*pagination.Page[model.User], error)
+	GetUser(ctx context.Context, id uuid.UUID) (*model.User, error)
+	// InviteUser returns no user, and no error, when the address belongs to
+	// another organisation
+	InviteUser(ctx context.Context, actorID uuid.UUID, req *dto.InviteUserRequest, client dto.ClientInfo) (*model.User, error)
+	CreateServiceAccount(ctx context.Context, actorID uuid.UUID, req *dto.CreateServiceAccountRequest, client dto.ClientInfo) (*model.User, error)
+	UpdateRole(ctx context.Context, actorID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.User, error)
+	SetActive(ctx context.Context, actorID, userID uuid.UUID, active bool, client dto.ClientInfo) (*model.User, error)
+	DeleteUser(ctx context.Context, actorID, userID uuid.UUID, client dto.ClientInfo) error
+}
+
+type RoleService interface {
+	ListRoles(ctx context.Context) ([]model.Role, error)
+	GetRole(ctx context.Context, name string) (*model.Role, error)
+	CreateRole(ctx context.Context, actorID uuid.UUID, req *dto.CreateRoleRequest, client dto.ClientInfo) (*model.Role, error)
+	UpdateRole(ctx context.Context, actorID uuid.UUID, name string, req *dto.UpdateRoleRequest, client dto.ClientInfo) (*model.Role, error)
+	DeleteRole(ctx context.Context, actorID uuid.UUID, name string, client dto.ClientInfo) error
+}
+
+type ProjectMemberService interface {
+	ListMembers(ctx context.Context, projectID uuid.UUID) ([]model.ProjectMember, error)
+	SetMember(ctx context.Context, actorID, projectID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.ProjectMember, error)
+	RemoveMember(ctx context.Context, actorID, projectID, userID uuid.UUID, client dto.ClientInfo) error
+	ListTeams(ctx context.Context, projectID uuid.UUID) ([]model.ProjectTeam, error)
+	SetTeam(ctx context.Context, actorID, projectID, teamID uuid.UUID, role string, client dto.ClientInfo) (*model.ProjectTeam, error)
+	RemoveTeam(ctx context.Context, actorID, projectID, teamID uuid.UUID, client dto.ClientInfo) error
+}
+
+type TeamService interface {
+	ListTeams(ctx context.Context, params pagination.Params) (*pagination.Page[model.Team], error)
+	GetTeam(ctx context.Context, id uuid.UUID) (*model.Team, error)
+	CreateTeam(ctx context.Context, actorID uuid.UUID, req *dto.CreateTeamRequest, client dto.ClientInfo) (*model.Team, error)
+	UpdateTeam(ctx context.Context, actorID, id uuid.UUID, req *dto.UpdateTeamRequest, client dto.ClientInfo) (*model.Team, error)
+	DeleteTeam(ctx context.Context, actorID, id uuid.UUID, client dto.ClientInfo) error
+	ListMembers(ctx context.Context, teamID uuid.UUID) ([]model.TeamMember, error)
+	SetMember(ctx context.Context, actorID, teamID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.TeamMember, error)
+	RemoveMember(ctx context.Context, actorID, teamID, userID uuid.UUID, client dto.ClientInfo) error
+}
+
+type AccessTokenService interface {
+	ListTokens(ctx context.Context, userID uuid.UUID) ([]model.AccessToken, error)
+	CreateToken(ctx context.Context, actorID, userID uuid.UUID, req *dto.CreateAccessTokenRequest, client dto.ClientInfo) (*model.AccessToken, string, error)
+	RevokeToken(ctx context.Context, actorID, userID, tokenID uuid.UUID, client dto.ClientInfo) error
+	ValidateAccessToken(ctx context.Context, token string) (*middleware.TokenPrincipal, error)
+}
+
+type OrganizationService interface {
+	GetCurrent(ctx context.Context) (*model.Organization, error)
+	UpdateCurrent(ctx context.Context, actorID uuid.UUID, req *dto.UpdateOrganizationRequest, client dto.ClientInfo) (*model.Organization, error)
+	ListOrganizations(ctx context.Context, params pagination.Params) (*pagination.Page[model.Organization], error)
+	GetOrganization(ctx context.Context, id uuid.UUID) (*model.Organization, error)
+	CreateOrganization(ctx context.Context, actorID uuid.UUID, req *dto.CreateOrganizationRequest, client dto.ClientInfo) (*model.Organization, *model.User, error)
+	UpdateOrganization(ctx context.Context, actorID, id uuid.UUID, req *dto.UpdateOrganizationRequest, client dto.ClientInfo) (*model.Organization, error)
+	DeleteOrganization(ctx context.Context, actorID, id uuid.UUID, client dto.ClientInfo) error
 }
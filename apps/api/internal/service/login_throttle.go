@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// baseLoginDelay is the delay for the first throttled failure; it doubles with
+// each further failure up to the configured maximum
+const baseLoginDelay = 250 * time.Millisecond
+
+// loginThrottle counts failed password logins per username and per client IP,
+// slowing down and then locking out repeated guessing. Keys are tracked
+// whether or not the username exists, so responses don't reveal accounts.
+type loginThrottle struct {
+	repo      repository.LoginThrottleRepository
+	auditRepo repository.AuditRepository
+	cfg       env.LockoutConfig
+}
+
+func usernameThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// lockedUntil returns when the lockout on the username or IP ends, or the
+// zero time if neither is locked
+func (t *loginThrottle) lockedUntil(ctx context.Context, username string, client dto.ClientInfo) (time.Time, error) {
+	return t.repo.LockedUntil(ctx, []string{usernameThrottleKey(username), ipThrottleKey(client.IPAddress)})
+}
+
+// fail records a failed attempt, starting a lockout when a threshold is
+// reached, and waits out the progressive delay
+func (t *loginThrottle) fail(ctx context.Context, username string, client dto.ClientInfo) error {
+	userFailures, err := t.count(ctx, usernameThrottleKey(username), model.AuditTargetUsername, username, t.cfg.MaxUserFailures, client)
+	if err != nil {
+		return err
+	}
+	ipFailures, err := t.count(ctx, ipThrottleKey(client.IPAddress), model.AuditTargetIPAddress, client.IPAddress, t.cfg.MaxIPFailures, client)
+	if err != nil {
+		return err
+	}
+
+	failures := userFailures
+	if ipFailures > failures {
+		failures = ipFailures
+	}
+	t.delay(ctx, failures)
+	return nil
+}
+
+// succeed clears the username's failures. The IP's are kept so that signing
+// in to one account doesn't reset guessing against others.
+func (t *loginThrottle) succeed(ctx context.Context, username string) error {
+	_, err := t.repo.Clear(ctx, usernameThrottleKey(username))
+	return err
+}
+
+// unlock lifts a lockout on a username, returning whether it was locked
+func (t *loginThrottle) unlock(ctx context.Context, username string) (bool, error) {
+	return t.repo.Clear(ctx, usernameThrottleKey(username))
+}
+
+func (t *loginThrottle) count(ctx context.Context, key, targetType, targetID string, max int, client dto.ClientInfo) (int, error) {
+	failures, err := t.repo.RecordFailure(ctx, key, t.cfg.FailureWindow)
+	if err != nil {
+		return 0, err
+	}
+	if failures < max {
+		return failures, nil
+	}
+
+	until := time.Now().Add(t.cfg.Duration)
+	if err := t.repo.Lock(ctx, key, until, t.cfg.FailureWindow); err != nil {
+		return 0, err
+	}
+
+	err = t.auditRepo.Record(ctx, &model.AuditEvent{
+		Action:     model.AuditLoginLockout,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  client.IPAddress,
+		Metadata: map[string]interface{}{
+			"failures":     failures,
+			"locked_until": until,
+		},
+	})
+	return failures, err
+}
+
+// refuse waits as long as a failure at the lockout threshold would, so
+// attempts refused during a lockout answer like wrong passwords
+func (t *loginThrottle) refuse(ctx context.Context) {
+	t.delay(ctx, t.cfg.MaxUserFailures)
+}
+
+func (t *loginThrottle) delay(ctx context.Context, failures int) {
+	delay := t.delayFor(failures)
+	if delay <= 0 {
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// delayFor returns how long to wait after the given number of failures: none
+// up to DelayAfter, then baseLoginDelay doubling with each failure up to
+// MaxDelay
+func (t *loginThrottle) delayFor(failures int) time.Duration {
+	if t.cfg.DelayAfter <= 0 || failures <= t.cfg.DelayAfter {
+		return 0
+	}
+
+	delay := baseLoginDelay
+	for i := t.cfg.DelayAfter + 1; i < failures && delay < t.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.cfg.MaxDelay {
+		delay = t.cfg.MaxDelay
+	}
+	return delay
+}
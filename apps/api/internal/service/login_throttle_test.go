@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	"api/internal/model"
+)
+
+func newTestThrottle(cfg env.LockoutConfig) (*loginThrottle, *memThrottleRepo, *memAuditRepo) {
+	repo, audit := newMemThrottleRepo(), &memAuditRepo{}
+	return &loginThrottle{repo: repo, auditRepo: audit, cfg: cfg}, repo, audit
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      env.LockoutConfig
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 0, want: 0},
+		{name: "at the threshold", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 3, want: 0},
+		{name: "first delayed failure", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 4, want: baseLoginDelay},
+		{name: "doubles", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 5, want: 2 * baseLoginDelay},
+		{name: "doubles again", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 6, want: 4 * baseLoginDelay},
+		{name: "reaches the cap", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 7, want: 2 * time.Second},
+		{name: "stays at the cap", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 2 * time.Second}, failures: 1000, want: 2 * time.Second},
+		{name: "cap between doublings", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 700 * time.Millisecond}, failures: 6, want: 700 * time.Millisecond},
+		{name: "cap below the base delay", cfg: env.LockoutConfig{DelayAfter: 3, MaxDelay: 100 * time.Millisecond}, failures: 4, want: 100 * time.Millisecond},
+		{name: "delays disabled", cfg: env.LockoutConfig{DelayAfter: 0, MaxDelay: 2 * time.Second}, failures: 50, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle, _, _ := newTestThrottle(tt.cfg)
+			if got := throttle.delayFor(tt.failures); got != tt.want {
+				t.Errorf("delayFor(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+// A failure past DelayAfter waits out its delay before returning
+func TestLoginThrottleFailWaits(t *testing.T) {
+	throttle, _, _ := newTestThrottle(env.LockoutConfig{
+		MaxUserFailures: 10, MaxIPFailures: 10, FailureWindow: time.Hour, Duration: time.Hour,
+		DelayAfter: 1, MaxDelay: 20 * time.Millisecond,
+	})
+	ctx, client := context.Background(), dto.ClientInfo{IPAddress: "203.0.113.7"}
+
+	start := time.Now()
+	if err := throttle.fail(ctx, "alice", client); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 20*time.Millisecond {
+		t.Errorf("first failure waited %v, want no delay", elapsed)
+	}
+
+	start = time.Now()
+	if err := throttle.fail(ctx, "alice", client); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("second failure waited %v, want at least 20ms", elapsed)
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	cfg := env.LockoutConfig{MaxUserFailures: 3, MaxIPFailures: 5, FailureWindow: time.Hour, Duration: 15 * time.Minute}
+	ctx := context.Background()
+
+	t.Run("username", func(t *testing.T) {
+		throttle, _, audit := newTestThrottle(cfg)
+		client := dto.ClientInfo{IPAddress: "203.0.113.7"}
+
+		for i := 1; i < cfg.MaxUserFailures; i++ {
+			if err := throttle.fail(ctx, "alice", client); err != nil {
+				t.Fatalf("fail: %v", err)
+			}
+			if until, _ := throttle.lockedUntil(ctx, "alice", client); !until.IsZero() {
+				t.Fatalf("locked after %d failures, want %d", i, cfg.MaxUserFailures)
+			}
+		}
+
+		if err := throttle.fail(ctx, "Alice", client); err != nil {
+			t.Fatalf("fail: %v", err)
+		}
+		until, err := throttle.lockedUntil(ctx, "alice", dto.ClientInfo{IPAddress: "198.51.100.1"})
+		if err != nil {
+			t.Fatalf("lockedUntil: %v", err)
+		}
+		if remaining := time.Until(until); remaining <= 0 || remaining > cfg.Duration {
+			t.Errorf("locked until %v, want about %v from now", until, cfg.Duration)
+		}
+
+		if len(audit.events) != 1 {
+			t.Fatalf("audited %d events, want 1", len(audit.events))
+		}
+		event := audit.events[0]
+		if event.Action != model.AuditLoginLockout || event.TargetType != model.AuditTargetUsername || event.TargetID != "Alice" {
+			t.Errorf("audited %s of %s %q, want a lockout of the username", event.Action, event.TargetType, event.TargetID)
+		}
+	})
+
+	t.Run("IP address", func(t *testing.T) {
+		throttle, _, audit := newTestThrottle(cfg)
+		client := dto.ClientInfo{IPAddress: "203.0.113.7"}
+
+		// Each username stays under its own threshold
+		for _, username := range []string{"a", "b", "c", "d", "e"} {
+			if err := throttle.fail(ctx, username, client); err != nil {
+				t.Fatalf("fail: %v", err)
+			}
+		}
+
+		if until, _ := throttle.lockedUntil(ctx, "someone-else", client); until.IsZero() {
+			t.Error("IP isn't locked after reaching its threshold")
+		}
+		if until, _ := throttle.lockedUntil(ctx, "someone-else", dto.ClientInfo{IPAddress: "198.51.100.1"}); !until.IsZero() {
+			t.Error("another IP is locked")
+		}
+		if len(audit.events) != 1 || audit.events[0].TargetType != model.AuditTargetIPAddress {
+			t.Errorf("audited %+v, want one lockout of the IP address", audit.events)
+		}
+	})
+}
+
+// Signing in clears the username's failures, but not the IP address's
+func TestLoginThrottleSucceed(t *testing.T) {
+	cfg := env.LockoutConfig{MaxUserFailures: 3, MaxIPFailures: 100, FailureWindow: time.Hour, Duration: time.Hour}
+	throttle, repo, _ := newTestThrottle(cfg)
+	ctx, client := context.Background(), dto.ClientInfo{IPAddress: "203.0.113.7"}
+
+	for i := 0; i < cfg.MaxUserFailures-1; i++ {
+		if err := throttle.fail(ctx, "alice", client); err != nil {
+			t.Fatalf("fail: %v", err)
+		}
+	}
+	if err := throttle.succeed(ctx, "alice"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if n := repo.failures[usernameThrottleKey("alice")]; n != 0 {
+		t.Errorf("username failures = %d after signing in, want 0", n)
+	}
+	if n := repo.failures[ipThrottleKey(client.IPAddress)]; n != cfg.MaxUserFailures-1 {
+		t.Errorf("IP failures = %d after signing in, want %d", n, cfg.MaxUserFailures-1)
+	}
+
+	// The count starts again, so one more failure doesn't lock the username
+	if err := throttle.fail(ctx, "alice", client); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	if until, _ := throttle.lockedUntil(ctx, "alice", client); !until.IsZero() {
+		t.Error("locked by failures from before signing in")
+	}
+}
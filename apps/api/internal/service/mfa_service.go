@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+	"api/internal/totp"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts codes from one step either side of now
+	totpSkew = 1
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type mfaService struct {
+	userRepo    repository.UserRepository
+	mfaRepo     repository.MFARepository
+	authService AuthService
+	keyRing     *middleware.KeyRing
+	throttle    *loginThrottle
+	cfg         env.MFAConfig
+}
+
+func NewMFAService(userRepo repository.UserRepository, mfaRepo repository.MFARepository, throttleRepo repository.LoginThrottleRepository, auditRepo repository.AuditRepository, authService AuthService, keyRing *middleware.KeyRing, cfg env.MFAConfig, lockout env.LockoutConfig) MFAService {
+	return &mfaService{
+		userRepo:    userRepo,
+		mfaRepo:     mfaRepo,
+		authService: authService,
+		keyRing:     keyRing,
+		throttle: &loginThrottle{
+			repo:      throttleRepo,
+			auditRepo: auditRepo,
+			cfg:       lockout,
+		},
+		cfg: cfg,
+	}
+}
+
+// mfaChallengeThrottleKey identifies a login challenge in the login throttle
+func mfaChallengeThrottleKey(mfaToken string) string {
+	return "mfa:" + hashToken(mfaToken)
+}
+
+// mfaRequiredForRole reports whether policy requires users with the role to
+// enrol in two-factor authentication
+func mfaRequiredForRole(cfg env.MFAConfig, role string) bool {
+	for _, required := range cfg.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify completes a login challenge with a TOTP code or a recovery code.
+// Wrong codes count as failed logins for the user and client IP, and a
+// challenge stops accepting codes after MaxChallengeFailures of them.
+func (s *mfaService) Verify(ctx context.Context, req *dto.MFAVerifyRequest, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	user, err := s.challengeUser(ctx, req.MFAToken, middleware.MFAPurposeVerify)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, apperrors.ErrInvalidMFAToken
+	}
+
+	challengeKey := mfaChallengeThrottleKey(req.MFAToken)
+	challengeLockedUntil, err := s.throttle.repo.LockedUntil(ctx, []string{challengeKey})
+	if err != nil {
+		return nil, err
+	}
+	if !challengeLockedUntil.IsZero() {
+		return nil, apperrors.ErrInvalidMFAToken
+	}
+	lockedUntil, err := s.throttle.lockedUntil(ctx, user.Username, client)
+	if err != nil {
+		return nil, err
+	}
+	if !lockedUntil.IsZero() {
+		return nil, apperrors.ErrTooManyLoginAttempts
+	}
+
+	if err := s.checkChallengeCode(ctx, user, req); err != nil {
+		if err != apperrors.ErrInvalidMFACode {
+			return nil, err
+		}
+		if err := s.failChallenge(ctx, challengeKey, user, client); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrInvalidMFACode
+	}
+
+	if err := s.throttle.succeed(ctx, user.Username); err != nil {
+		return nil, err
+	}
+	return s.authService.StartSession(ctx, user, client)
+}
+
+func (s *mfaService) checkChallengeCode(ctx context.Context, user *model.User, req *dto.MFAVerifyRequest) error {
+	if req.Code != "" {
+		return s.checkCode(ctx, user, req.Code)
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(req.RecoveryCode)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return apperrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// failChallenge records a wrong code against the challenge, invalidating it
+// once it reaches MaxChallengeFailures, and as a failed login for the user
+// and client IP
+func (s *mfaService) failChallenge(ctx context.Context, challengeKey string, user *model.User, client dto.ClientInfo) error {
+	failures, err := s.throttle.repo.RecordFailure(ctx, challengeKey, s.cfg.ChallengeTTL)
+	if err != nil {
+		return err
+	}
+	if failures >= s.cfg.MaxChallengeFailures {
+		if err := s.throttle.repo.Lock(ctx, challengeKey, time.Now().Add(s.cfg.ChallengeTTL), s.cfg.ChallengeTTL); err != nil {
+			return err
+		}
+	}
+
+	return s.throttle.fail(ctx, user.Username, client)
+}
+
+// StartEnrollment generates a new secret for a signed-in user
+func (s *mfaService) StartEnrollment(ctx context.Context, userID uuid.UUID) (*dto.MFAEnrollmentResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, apperrors.ErrUserNotFound
+	}
+
+	return s.startEnrollment(ctx, user)
+}
+
+// ConfirmEnrollment enables MFA for a signed-in user once they prove their
+// authenticator works, returning their recovery codes
+func (s *mfaService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) (*dto.MFAConfirmResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, apperrors.ErrUserNotFound
+	}
+
+	codes, err := s.confirmEnrollment(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.MFAConfirmResponse{RecoveryCodes: codes}, nil
+}
+
+// StartChallengeEnrollment generates a secret for a user whose login is
+// waiting on mandatory enrolment
+func (s *mfaService) StartChallengeEnrollment(ctx context.Context, mfaToken string) (*dto.MFAEnrollmentResponse, error) {
+	user, err := s.challengeUser(ctx, mfaToken, middleware.MFAPurposeEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startEnrollment(ctx, user)
+}
+
+// ConfirmChallengeEnrollment enables MFA and completes the waiting login
+func (s *mfaService) ConfirmChallengeEnrollment(ctx context.Context, req *dto.MFASetupConfirmRequest, client dto.ClientInfo) (*dto.MFAConfirmResponse, error) {
+	user, err := s.challengeUser(ctx, req.MFAToken, middleware.MFAPurposeEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.confirmEnrollment(ctx, user, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFAEnabled = true
+	login, err := s.authService.StartSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.MFAConfirmResponse{RecoveryCodes: codes, Login: login}, nil
+}
+
+// Disable turns MFA off after checking a current code. Users whose role
+// requires MFA can't turn it off.
+func (s *mfaService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return apperrors.ErrUserNotFound
+	}
+	if !user.MFAEnabled {
+		return apperrors.ErrMFANotEnabled
+	}
+	if mfaRequiredForRole(s.cfg, user.Role) {
+		return apperrors.ErrMFARequired
+	}
+
+	if err := s.checkCode(ctx, user, code); err != nil {
+		return err
+	}
+
+	return s.mfaRepo.Disable(ctx, user.ID)
+}
+
+// Reset lets an administrator clear a user's MFA, e.g. after they lose
+// both their device and recovery codes. The user enrols again on next login
+// if their role requires it.
+func (s *mfaService) Reset(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !inOrganization(ctx, user) {
+		return apperrors.ErrUserNotFound
+	}
+
+	return s.mfaRepo.Disable(ctx, user.ID)
+}
+
+func (s *mfaService) challengeUser(ctx context.Context, mfaToken, purpose string) (*model.User, error) {
+	claims, err := middleware.ValidateMFAToken(mfaToken, purpose, s.keyRing)
+	if err != nil {
+		return nil, apperrors.ErrInvalidMFAToken
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, apperrors.ErrInvalidMFAToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active {
+		return nil, apperrors.ErrAccountInactive
+	}
+
+	return user, nil
+}
+
+func (s *mfaService) startEnrollment(ctx context.Context, user *model.User) (*dto.MFAEnrollmentResponse, error) {
+	if user.MFAEnabled {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.SetSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &dto.MFAEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(s.cfg.Issuer, user.Email, secret),
+	}, nil
+}
+
+func (s *mfaService) confirmEnrollment(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, apperrors.ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == nil {
+		return nil, apperrors.ErrMFAEnrollmentNotStarted
+	}
+
+	if err := s.checkCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.mfaRepo.Enable(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// checkCode validates a TOTP code and marks its time step used
+func (s *mfaService) checkCode(ctx context.Context, user *model.User, code string) error {
+	if user.MFASecret == nil {
+		return apperrors.ErrMFANotEnabled
+	}
+
+	step, ok := totp.Validate(*user.MFASecret, code, time.Now(), totpSkew)
+	if !ok {
+		return apperrors.ErrInvalidMFACode
+	}
+
+	fresh, err := s.mfaRepo.UseStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return apperrors.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// generateRecoveryCode returns a code like "k3m9q-x7p2w"
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
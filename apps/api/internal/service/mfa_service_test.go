@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/totp"
+
+	"github.com/google/uuid"
+)
+
+const testRecoveryCode = "abcde-fghij"
+
+type mfaFixture struct {
+	service  MFAService
+	keyRing  *middleware.KeyRing
+	cfg      env.AuthConfig
+	users    *memUserRepo
+	throttle *memThrottleRepo
+	sessions *sessionStarter
+	user     *model.User
+	secret   string
+}
+
+func newMFAFixture(t *testing.T, cfg env.AuthConfig) *mfaFixture {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	f := &mfaFixture{
+		keyRing:  testKeyRing(t, cfg),
+		cfg:      cfg,
+		throttle: newMemThrottleRepo(),
+		sessions: &sessionStarter{},
+		secret:   secret,
+		user: &model.User{
+			ID:         uuid.New(),
+			Username:   "ada",
+			Email:      "ada@example.com",
+			Role:       "developer",
+			Active:     true,
+			MFASecret:  &secret,
+			MFAEnabled: true,
+		},
+	}
+	f.users = newMemUserRepo(f.user)
+
+	mfaRepo := newMemMFARepo()
+	mfaRepo.recoveryCodes[f.user.ID] = map[string]bool{hashToken(normalizeRecoveryCode(testRecoveryCode)): true}
+
+	f.service = NewMFAService(f.users, mfaRepo, f.throttle, &memAuditRepo{}, f.sessions, f.keyRing, cfg.MFA, cfg.Lockout)
+	return f
+}
+
+// challenge issues the token a correct password is answered with
+func (f *mfaFixture) challenge(t *testing.T, purpose string) string {
+	t.Helper()
+	token, err := middleware.GenerateMFAToken(f.user.ID.String(), purpose, f.cfg.MFA.ChallengeTTL, f.keyRing)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	return token
+}
+
+// code returns the TOTP code steps away from now
+func (f *mfaFixture) code(t *testing.T, steps int64) string {
+	t.Helper()
+	code, err := totp.Code(f.secret, totp.Step(time.Now())+steps)
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	return code
+}
+
+func (f *mfaFixture) verify(req *dto.MFAVerifyRequest) error {
+	_, err := f.service.Verify(context.Background(), req, dto.ClientInfo{IPAddress: "192.0.2.1"})
+	return err
+}
+
+func TestMFAVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// request builds the request, after any setup the case needs
+		request func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest
+		want    error
+	}{
+		{
+			name: "current code",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}
+			},
+		},
+		{
+			name: "code from the previous step",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, -1)}
+			},
+		},
+		{
+			name: "recovery code",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), RecoveryCode: "ABCDE FGHIJ"}
+			},
+		},
+		{
+			name: "wrong code",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, -5)}
+			},
+			want: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "replayed code",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				code := f.code(t, 0)
+				if err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: code}); err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: code}
+			},
+			want: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "used recovery code",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				if err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), RecoveryCode: testRecoveryCode}); err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), RecoveryCode: testRecoveryCode}
+			},
+			want: apperrors.ErrInvalidMFACode,
+		},
+		{
+			name: "enrolment challenge",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeEnroll), Code: f.code(t, 0)}
+			},
+			want: apperrors.ErrInvalidMFAToken,
+		},
+		{
+			name: "forged challenge",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				return &dto.MFAVerifyRequest{MFAToken: "not-a-token", Code: f.code(t, 0)}
+			},
+			want: apperrors.ErrInvalidMFAToken,
+		},
+		{
+			name: "two-factor authentication turned off",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				user := *f.user
+				user.MFAEnabled = false
+				f.users.Update(context.Background(), user.ID, &user)
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}
+			},
+			want: apperrors.ErrInvalidMFAToken,
+		},
+		{
+			name: "deactivated user",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				user := *f.user
+				user.Active = false
+				f.users.Update(context.Background(), user.ID, &user)
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}
+			},
+			want: apperrors.ErrAccountInactive,
+		},
+		{
+			name: "locked-out user",
+			request: func(t *testing.T, f *mfaFixture) *dto.MFAVerifyRequest {
+				f.throttle.Lock(context.Background(), usernameThrottleKey("ada"), time.Now().Add(time.Hour), time.Hour)
+				return &dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}
+			},
+			want: apperrors.ErrTooManyLoginAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMFAFixture(t, testAuthConfig())
+			req := tt.request(t, f)
+			before := len(f.sessions.started)
+
+			if err := f.verify(req); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+
+			wantStarted := 0
+			if tt.want == nil {
+				wantStarted = 1
+			}
+			if started := len(f.sessions.started) - before; started != wantStarted {
+				t.Errorf("started %d sessions, want %d", started, wantStarted)
+			}
+		})
+	}
+}
+
+func TestMFAVerifyInvalidatesChallengeAfterFailures(t *testing.T) {
+	cfg := testAuthConfig()
+	f := newMFAFixture(t, cfg)
+	challenge := f.challenge(t, middleware.MFAPurposeVerify)
+
+	for i := 0; i < cfg.MFA.MaxChallengeFailures; i++ {
+		err := f.verify(&dto.MFAVerifyRequest{MFAToken: challenge, Code: f.code(t, -5)})
+		if !errors.Is(err, apperrors.ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: Verify error = %v, want %v", i+1, err, apperrors.ErrInvalidMFACode)
+		}
+	}
+
+	// Guessing stops, even with the right code or a recovery code
+	for _, req := range []*dto.MFAVerifyRequest{
+		{MFAToken: challenge, Code: f.code(t, 0)},
+		{MFAToken: challenge, RecoveryCode: testRecoveryCode},
+	} {
+		if err := f.verify(req); !errors.Is(err, apperrors.ErrInvalidMFAToken) {
+			t.Errorf("Verify on the spent challenge error = %v, want %v", err, apperrors.ErrInvalidMFAToken)
+		}
+	}
+	if len(f.sessions.started) != 0 {
+		t.Fatal("the spent challenge started a session")
+	}
+
+	// Signing in again issues a new challenge
+	if err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}); err != nil {
+		t.Errorf("Verify on a new challenge: %v", err)
+	}
+}
+
+func TestMFAVerifyCountsFailuresAgainstUser(t *testing.T) {
+	cfg := testAuthConfig()
+	cfg.Lockout.MaxUserFailures = cfg.MFA.MaxChallengeFailures + 1
+	f := newMFAFixture(t, cfg)
+
+	// Fresh challenges don't give an attacker fresh guesses
+	for i := 0; i < cfg.Lockout.MaxUserFailures; i++ {
+		err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, -5)})
+		if !errors.Is(err, apperrors.ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: Verify error = %v, want %v", i+1, err, apperrors.ErrInvalidMFACode)
+		}
+	}
+
+	err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)})
+	if !errors.Is(err, apperrors.ErrTooManyLoginAttempts) {
+		t.Errorf("Verify after the user was locked out error = %v, want %v", err, apperrors.ErrTooManyLoginAttempts)
+	}
+}
+
+func TestMFAVerifyClearsUserFailures(t *testing.T) {
+	f := newMFAFixture(t, testAuthConfig())
+
+	if err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, -5)}); !errors.Is(err, apperrors.ErrInvalidMFACode) {
+		t.Fatalf("Verify error = %v, want %v", err, apperrors.ErrInvalidMFACode)
+	}
+	if err := f.verify(&dto.MFAVerifyRequest{MFAToken: f.challenge(t, middleware.MFAPurposeVerify), Code: f.code(t, 0)}); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if failures := f.throttle.failures[usernameThrottleKey("ada")]; failures != 0 {
+		t.Errorf("user has %d failures after signing in, want 0", failures)
+	}
+}
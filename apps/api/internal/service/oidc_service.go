@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateTTL bounds how long a user may take at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// roleRank orders the built-in roles so the most privileged mapped group
+// wins. Custom roles rank below them.
+var roleRank = map[middleware.Role]int{
+	middleware.RoleViewer:    1,
+	middleware.RoleDeveloper: 2,
+	middleware.RoleManager:   3,
+	middleware.RoleAdmin:     4,
+}
+
+// oidcClaims are the ID token claims used for provisioning
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+}
+
+type oidcService struct {
+	cfg         env.OIDCConfig
+	userRepo    repository.UserRepository
+	orgRepo     repository.OrganizationRepository
+	stateRepo   repository.OIDCStateRepository
+	authService AuthService
+
+	// The provider is discovered on first use so the API can start while
+	// the identity provider is unreachable
+	mutex    sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCService creates the single sign-on service, checking that the role
+// mapping only names known roles
+func NewOIDCService(cfg env.OIDCConfig, userRepo repository.UserRepository, orgRepo repository.OrganizationRepository, stateRepo repository.OIDCStateRepository, authService AuthService) (OIDCService, error) {
+	if !middleware.ValidRole(middleware.Role(cfg.DefaultRole)) {
+		return nil, fmt.Errorf("invalid OIDC default role %q", cfg.DefaultRole)
+	}
+	for group, role := range cfg.RoleMapping {
+		if !middleware.ValidRole(middleware.Role(role)) {
+			return nil, fmt.Errorf("invalid role %q mapped from OIDC group %q", role, group)
+		}
+	}
+
+	return &oidcService{
+		cfg:         cfg,
+		userRepo:    userRepo,
+		orgRepo:     orgRepo,
+		stateRepo:   stateRepo,
+		authService: authService,
+	}, nil
+}
+
+func (s *oidcService) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.oauth != nil {
+		return s.oauth, s.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, s.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+
+	s.oauth = &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       s.cfg.Scopes,
+	}
+	s.verifier = provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID})
+
+	return s.oauth, s.verifier, nil
+}
+
+// AuthorizationURL starts an authorization-code login with PKCE, returning
+// the provider URL to redirect to and the state the callback must present
+func (s *oidcService) AuthorizationURL(ctx context.Context) (string, string, error) {
+	oauth, _, err := s.client(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	loginState := &model.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := s.stateRepo.Create(ctx, loginState); err != nil {
+		return "", "", err
+	}
+
+	authURL := oauth.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(loginState.CodeVerifier),
+	)
+	return authURL, state, nil
+}
+
+// Callback completes a login: it redeems the code, verifies the ID token,
+// provisions or updates the user and starts a session
+func (s *oidcService) Callback(ctx context.Context, state, code string, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	loginState, err := s.stateRepo.Consume(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if loginState == nil {
+		return nil, apperrors.ErrOIDCStateInvalid
+	}
+
+	oauth, verifier, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, apperrors.ErrOIDCLoginFailed
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, apperrors.ErrOIDCLoginFailed
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != loginState.Nonce {
+		return nil, apperrors.ErrOIDCLoginFailed
+	}
+
+	var claims oidcClaims
+	var rawClaims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if err := idToken.Claims(&rawClaims); err != nil {
+		return nil, err
+	}
+	if claims.Email == "" {
+		return nil, apperrors.NewAppError(apperrors.ErrOIDCLoginFailed.Code, "Identity provider did not return an email address")
+	}
+
+	user, err := s.provisionUser(ctx, &claims, s.groups(rawClaims))
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		return nil, apperrors.ErrAccountInactive
+	}
+
+	return s.authService.StartSession(ctx, user, client)
+}
+
+// provisionUser finds the user for an identity, linking an existing account
+// by verified email or creating one just in time, and syncs its profile and
+// role from the claims
+func (s *oidcService) provisionUser(ctx context.Context, claims *oidcClaims, groups []string) (*model.User, error) {
+	user, err := s.userRepo.GetByExternalID(ctx, model.AuthProviderOIDC, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		existing, err := s.userRepo.GetByEmail(ctx, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			// Only link accounts when the provider vouches for the address
+			if !claims.EmailVerified || existing.ExternalID != nil {
+				return nil, apperrors.ErrEmailExists
+			}
+			user = existing
+		}
+	}
+
+	subject := claims.Subject
+	if user == nil {
+		username, err := uniqueUsername(ctx, s.userRepo, claims.PreferredUsername, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		// Single sign-on provisions into the host organisation
+		host, err := hostOrganization(ctx, s.orgRepo)
+		if err != nil {
+			return nil, err
+		}
+
+		user = &model.User{
+			ID:             uuid.New(),
+			OrganizationID: host.ID,
+			Username:       username,
+			Email:          claims.Email,
+			Role:           s.role(groups, s.cfg.DefaultRole),
+			FirstName:      claims.GivenName,
+			LastName:       claims.FamilyName,
+			Active:         true,
+			AuthProvider:   model.AuthProviderOIDC,
+			ExternalID:     &subject,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	user.AuthProvider = model.AuthProviderOIDC
+	user.ExternalID = &subject
+	user.Email = claims.Email
+	if claims.GivenName != "" {
+		user.FirstName = claims.GivenName
+	}
+	if claims.FamilyName != "" {
+		user.LastName = claims.FamilyName
+	}
+	// With a role mapping the provider's groups are authoritative
+	if len(s.cfg.RoleMapping) > 0 {
+		user.Role = s.role(groups, s.cfg.DefaultRole)
+	}
+
+	if err := s.userRepo.Update(ctx, user.ID, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// role returns the most privileged role mapped from the groups, or the
+// fallback if none is mapped
+func (s *oidcService) role(groups []string, fallback string) string {
+	var best middleware.Role
+	for _, group := range groups {
+		mapped, ok := s.cfg.RoleMapping[group]
+		if !ok {
+			continue
+		}
+		if role := middleware.Role(mapped); best == "" || roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	if best == "" {
+		return fallback
+	}
+	return string(best)
+}
+
+// groups reads the configured groups claim, which may be a list or a
+// single string
+func (s *oidcService) groups(claims map[string]interface{}) []string {
+	switch value := claims[s.cfg.GroupsClaim].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, v := range value {
+			if group, ok := v.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
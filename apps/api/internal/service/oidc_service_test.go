@@ -0,0 +1,443 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"api/internal/config/env"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testOIDCClientID = "flagit"
+	testOIDCKeyID    = "idp-key"
+)
+
+// fakeIdP is an OpenID provider serving discovery, its JWKS and a token
+// endpoint. Tests register the grant a code redeems, as the provider would
+// once the user signed in.
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	grants map[string]idpGrant
+}
+
+// idpGrant is what redeeming a code returns, provided the code verifier
+// matches the PKCE challenge sent with the authorization request
+type idpGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIdP{key: key, grants: make(map[string]idpGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testOIDCKeyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mutex.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mutex.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	idToken.Header["kid"] = testOIDCKeyID
+	signed, err := idToken.SignedString(idp.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// grant lets the code redeem an ID token with the claims, on top of valid
+// defaults for this provider and client
+func (idp *fakeIdP) grant(code, challenge string, claims jwt.MapClaims) {
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testOIDCClientID,
+		"sub":            "subject-1",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		all[name] = value
+	}
+
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+	idp.grants[code] = idpGrant{challenge: challenge, claims: all}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+type memOIDCStateRepo struct {
+	mutex  sync.Mutex
+	states map[string]model.OIDCLoginState
+}
+
+func (r *memOIDCStateRepo) Create(ctx context.Context, state *model.OIDCLoginState) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.states[state.State] = *state
+	return nil
+}
+
+func (r *memOIDCStateRepo) Consume(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	loginState, ok := r.states[state]
+	if !ok || time.Now().After(loginState.ExpiresAt) {
+		return nil, nil
+	}
+	delete(r.states, state)
+	return &loginState, nil
+}
+
+// sessionStarter stands in for the auth service, signing users in without
+// issuing real tokens
+type sessionStarter struct {
+	AuthService
+	started []*model.User
+}
+
+func (s *sessionStarter) StartSession(ctx context.Context, user *model.User, client dto.ClientInfo) (*dto.LoginResponse, error) {
+	s.started = append(s.started, user)
+	return &dto.LoginResponse{User: user.ToResponse(), Token: "session-token"}, nil
+}
+
+type oidcFixture struct {
+	idp      *fakeIdP
+	service  OIDCService
+	users    *memUserRepo
+	sessions *sessionStarter
+}
+
+func newOIDCFixture(t *testing.T, users ...*model.User) *oidcFixture {
+	t.Helper()
+
+	f := &oidcFixture{
+		idp:      newFakeIdP(t),
+		users:    newMemUserRepo(users...),
+		sessions: &sessionStarter{},
+	}
+	cfg := env.OIDCConfig{
+		Issuer:       f.idp.server.URL,
+		ClientID:     testOIDCClientID,
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "profile", "email"},
+		GroupsClaim:  "groups",
+		DefaultRole:  "viewer",
+		RoleMapping: map[string]string{
+			"engineering": "developer",
+			"leads":       "manager",
+			"platform":    "admin",
+		},
+	}
+
+	service, err := NewOIDCService(cfg, f.users, newMemOrgRepo(), &memOIDCStateRepo{states: make(map[string]model.OIDCLoginState)}, f.sessions)
+	if err != nil {
+		t.Fatalf("NewOIDCService: %v", err)
+	}
+	f.service = service
+	return f
+}
+
+// authorize starts a login, returning the state, nonce and PKCE challenge
+// the provider received
+func (f *oidcFixture) authorize(t *testing.T) (state, nonce, challenge string) {
+	t.Helper()
+
+	authURL, state, err := f.service.AuthorizationURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+
+	query := parsed.Query()
+	if query.Get("state") != state {
+		t.Fatalf("authorization URL state = %q, want %q", query.Get("state"), state)
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+	return state, query.Get("nonce"), query.Get("code_challenge")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	f := newOIDCFixture(t)
+	state, nonce, challenge := f.authorize(t)
+	f.idp.grant("code-1", challenge, jwt.MapClaims{
+		"nonce":              nonce,
+		"preferred_username": "ada",
+		"given_name":         "Ada",
+		"family_name":        "Lovelace",
+	})
+
+	response, err := f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if response.Token == "" {
+		t.Error("Callback returned no token")
+	}
+
+	user, _ := f.users.GetByExternalID(context.Background(), model.AuthProviderOIDC, "subject-1")
+	if user == nil {
+		t.Fatal("user was not provisioned")
+	}
+	if user.Username != "ada" || user.Email != "ada@example.com" || user.FirstName != "Ada" || user.Role != "viewer" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+	if len(f.sessions.started) != 1 || f.sessions.started[0].ID != user.ID {
+		t.Errorf("started sessions = %v, want one for the provisioned user", f.sessions.started)
+	}
+
+	// The state is single-use
+	_, err = f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{})
+	if !errors.Is(err, apperrors.ErrOIDCStateInvalid) {
+		t.Errorf("replayed callback error = %v, want %v", err, apperrors.ErrOIDCStateInvalid)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// state and verifierMismatch tamper with the callback; claims with
+		// the ID token
+		state            string
+		verifierMismatch bool
+		claims           func(nonce string) jwt.MapClaims
+		want             error
+	}{
+		{
+			name:   "unknown state",
+			state:  "forged-state",
+			claims: func(nonce string) jwt.MapClaims { return jwt.MapClaims{"nonce": nonce} },
+			want:   apperrors.ErrOIDCStateInvalid,
+		},
+		{
+			name:             "PKCE verifier mismatch",
+			verifierMismatch: true,
+			claims:           func(nonce string) jwt.MapClaims { return jwt.MapClaims{"nonce": nonce} },
+			want:             apperrors.ErrOIDCLoginFailed,
+		},
+		{
+			name:   "nonce mismatch",
+			claims: func(nonce string) jwt.MapClaims { return jwt.MapClaims{"nonce": "another-login"} },
+			want:   apperrors.ErrOIDCLoginFailed,
+		},
+		{
+			name:   "missing nonce",
+			claims: func(nonce string) jwt.MapClaims { return jwt.MapClaims{} },
+			want:   apperrors.ErrOIDCLoginFailed,
+		},
+		{
+			name: "wrong audience",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"nonce": nonce, "aud": "another-client"}
+			},
+			want: apperrors.ErrOIDCLoginFailed,
+		},
+		{
+			name: "wrong issuer",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"nonce": nonce, "iss": "https://idp.example.com"}
+			},
+			want: apperrors.ErrOIDCLoginFailed,
+		},
+		{
+			name: "expired ID token",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"nonce": nonce, "exp": time.Now().Add(-time.Hour).Unix()}
+			},
+			want: apperrors.ErrOIDCLoginFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			state, nonce, challenge := f.authorize(t)
+			if tt.verifierMismatch {
+				// The code was issued for another authorization request
+				other := sha256.Sum256([]byte("another-verifier"))
+				challenge = base64.RawURLEncoding.EncodeToString(other[:])
+			}
+			if tt.state != "" {
+				state = tt.state
+			}
+			f.idp.grant("code-1", challenge, tt.claims(nonce))
+
+			_, err := f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Callback error = %v, want %v", err, tt.want)
+			}
+			if len(f.sessions.started) != 0 {
+				t.Error("a session was started")
+			}
+		})
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups interface{}
+		want   string
+	}{
+		{name: "no groups", groups: nil, want: "viewer"},
+		{name: "unmapped group", groups: []string{"marketing"}, want: "viewer"},
+		{name: "mapped group", groups: []string{"marketing", "engineering"}, want: "developer"},
+		{name: "most privileged group wins", groups: []string{"platform", "engineering", "leads"}, want: "admin"},
+		{name: "single group as a string", groups: "leads", want: "manager"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			state, nonce, challenge := f.authorize(t)
+			claims := jwt.MapClaims{"nonce": nonce}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			f.idp.grant("code-1", challenge, claims)
+
+			response, err := f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{})
+			if err != nil {
+				t.Fatalf("Callback: %v", err)
+			}
+			if response.User.Role != tt.want {
+				t.Errorf("role = %q, want %q", response.User.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCRoleMappingUpdatesLinkedUser(t *testing.T) {
+	subject := "subject-1"
+	existing := &model.User{
+		ID:           uuid.New(),
+		Username:     "ada",
+		Email:        "ada@example.com",
+		Role:         "admin",
+		Active:       true,
+		AuthProvider: model.AuthProviderOIDC,
+		ExternalID:   &subject,
+	}
+	f := newOIDCFixture(t, existing)
+	state, nonce, challenge := f.authorize(t)
+	f.idp.grant("code-1", challenge, jwt.MapClaims{"nonce": nonce, "groups": []string{"engineering"}})
+
+	if _, err := f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{}); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+
+	user, _ := f.users.GetByID(context.Background(), existing.ID)
+	if user.Role != "developer" {
+		t.Errorf("role = %q, want the provider's groups to demote the user to developer", user.Role)
+	}
+}
+
+func TestOIDCDoesNotLinkUnverifiedEmail(t *testing.T) {
+	existing := &model.User{
+		ID:       uuid.New(),
+		Username: "ada",
+		Email:    "ada@example.com",
+		Role:     "admin",
+		Active:   true,
+	}
+	f := newOIDCFixture(t, existing)
+	state, nonce, challenge := f.authorize(t)
+	f.idp.grant("code-1", challenge, jwt.MapClaims{"nonce": nonce, "email_verified": false})
+
+	_, err := f.service.Callback(context.Background(), state, "code-1", dto.ClientInfo{})
+	if !errors.Is(err, apperrors.ErrEmailExists) {
+		t.Fatalf("Callback error = %v, want %v", err, apperrors.ErrEmailExists)
+	}
+}
+
+var _ repository.OIDCStateRepository = (*memOIDCStateRepo)(nil)
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"regexp"
+
+	"api/internal/cache"
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/repository"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,49}$`)
+
+type organizationService struct {
+	orgRepo     repository.OrganizationRepository
+	auditRepo   repository.AuditRepository
+	users       UserService
+	configCache *cache.ConfigCache
+}
+
+func NewOrganizationService(orgRepo repository.OrganizationRepository, auditRepo repository.AuditRepository, users UserService, configCache *cache.ConfigCache) OrganizationService {
+	return &organizationService{
+		orgRepo:     orgRepo,
+		auditRepo:   auditRepo,
+		users:       users,
+		configCache: configCache,
+	}
+}
+
+// GetCurrent returns the organisation the caller acts in
+func (s *organizationService) GetCurrent(ctx context.Context) (*model.Organization, error) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, repository.ErrNoOrganization
+	}
+	return s.GetOrganization(ctx, org.ID)
+}
+
+// ListOrganizations returns a page of organisations
+func (s *organizationService) ListOrganizations(ctx context.Context, params pagination.Params) (*pagination.Page[model.Organization], error) {
+	return s.orgRepo.List(ctx, params)
+}
+
+// GetOrganization retrieves an organisation by ID
+func (s *organizationService) GetOrganization(ctx context.Context, id uuid.UUID) (*model.Organization, error) {
+	org, err := s.orgRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, apperrors.ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// CreateOrganization adds a tenant and invites its first admin, who sets a
+// password from the emailed link and manages the organisation from there
+func (s *organizationService) CreateOrganization(ctx context.Context, actorID uuid.UUID, req *dto.CreateOrganizationRequest, client dto.ClientInfo) (*model.Organization, *model.User, error) {
+	if err := s.checkSlug(ctx, uuid.Nil, req.Slug); err != nil {
+		return nil, nil, err
+	}
+
+	org := &model.Organization{
+		Name: req.Name,
+		Slug: req.Slug,
+	}
+	if err := s.orgRepo.Create(ctx, org); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditOrgCreate, org, client); err != nil {
+		return nil, nil, err
+	}
+
+	// The admin belongs to the new organisation, not the caller's
+	admin, err := s.users.InviteUser(tenant.WithOrganization(ctx, tenant.Organization{ID: org.ID}), actorID, &dto.InviteUserRequest{
+		Email:     req.AdminEmail,
+		Role:      string(middleware.RoleAdmin),
+		FirstName: req.AdminFirstName,
+		LastName:  req.AdminLastName,
+	}, client)
+	// The address may belong to another organisation; host admins can see
+	// every organisation, so they are told
+	if err == nil && admin == nil {
+		err = apperrors.ErrEmailExists
+	}
+	if err != nil {
+		// Don't leave behind an organisation nobody can sign in to
+		if deleteErr := s.orgRepo.Delete(ctx, org.ID); deleteErr != nil {
+			return nil, nil, deleteErr
+		}
+		return nil, nil, err
+	}
+
+	return org, admin, nil
+}
+
+// UpdateCurrent renames the organisation the caller acts in
+func (s *organizationService) UpdateCurrent(ctx context.Context, actorID uuid.UUID, req *dto.UpdateOrganizationRequest, client dto.ClientInfo) (*model.Organization, error) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, repository.ErrNoOrganization
+	}
+	return s.UpdateOrganization(ctx, actorID, org.ID, req, client)
+}
+
+// UpdateOrganization renames an organisation or changes its slug
+func (s *organizationService) UpdateOrganization(ctx context.Context, actorID, id uuid.UUID, req *dto.UpdateOrganizationRequest, client dto.ClientInfo) (*model.Organization, error) {
+	org, err := s.GetOrganization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		org.Name = *req.Name
+	}
+	if req.Slug != nil && *req.Slug != org.Slug {
+		if err := s.checkSlug(ctx, org.ID, *req.Slug); err != nil {
+			return nil, err
+		}
+		org.Slug = *req.Slug
+	}
+
+	if err := s.orgRepo.Update(ctx, org); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditOrgUpdate, org, client); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// DeleteOrganization deletes a tenant with all its users, projects and
+// flags. The host organisation can't be deleted.
+func (s *organizationService) DeleteOrganization(ctx context.Context, actorID, id uuid.UUID, client dto.ClientInfo) error {
+	org, err := s.GetOrganization(ctx, id)
+	if err != nil {
+		return err
+	}
+	if org.Host {
+		return apperrors.ErrHostOrganizationDelete
+	}
+
+	if err := s.orgRepo.Delete(ctx, org.ID); err != nil {
+		return err
+	}
+
+	// Its environments are gone; drop whatever of them is cached
+	if s.configCache != nil {
+		s.configCache.InvalidateAll()
+	}
+
+	return s.audit(ctx, actorID, model.AuditOrgDelete, org, client)
+}
+
+// checkSlug checks a slug is well formed and not taken by another
+// organisation
+func (s *organizationService) checkSlug(ctx context.Context, id uuid.UUID, slug string) error {
+	if !organizationSlugPattern.MatchString(slug) {
+		return apperrors.ErrInvalidOrganizationSlug
+	}
+
+	existing, err := s.orgRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != id {
+		return apperrors.ErrOrganizationSlugExists
+	}
+	return nil
+}
+
+func (s *organizationService) audit(ctx context.Context, actorID uuid.UUID, action string, org *model.Organization, client dto.ClientInfo) error {
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetOrg,
+		TargetID:     org.ID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata: map[string]interface{}{
+			"name": org.Name,
+			"slug": org.Slug,
+		},
+	})
+}
+
+// hostOrganization returns the organisation self-registered and single
+// sign-on accounts join
+func hostOrganization(ctx context.Context, orgRepo repository.OrganizationRepository) (*model.Organization, error) {
+	org, err := orgRepo.GetHost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, apperrors.ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// inOrganization reports whether a user belongs to the organisation the
+// caller acts in. Users of other organisations are treated as not found.
+func inOrganization(ctx context.Context, user *model.User) bool {
+	if user == nil {
+		return false
+	}
+	org, ok := tenant.FromContext(ctx)
+	return ok && user.OrganizationID == org.ID
+}
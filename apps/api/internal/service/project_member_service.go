@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type projectMemberService struct {
+	memberRepo  repository.ProjectMemberRepository
+	projectRepo repository.ProjectRepository
+	userRepo    repository.UserRepository
+	teamRepo    repository.TeamRepository
+	auditRepo   repository.AuditRepository
+}
+
+func NewProjectMemberService(memberRepo repository.ProjectMemberRepository, projectRepo repository.ProjectRepository, userRepo repository.UserRepository, teamRepo repository.TeamRepository, auditRepo repository.AuditRepository) ProjectMemberService {
+	return &projectMemberService{
+		memberRepo:  memberRepo,
+		projectRepo: projectRepo,
+		userRepo:    userRepo,
+		teamRepo:    teamRepo,
+		auditRepo:   auditRepo,
+	}
+}
+
+// ListMembers returns the users with a role in a project
+func (s *projectMemberService) ListMembers(ctx context.Context, projectID uuid.UUID) ([]model.ProjectMember, error) {
+	if err := s.checkProject(ctx, projectID); err != nil {
+		return nil, err
+	}
+	return s.memberRepo.List(ctx, projectID)
+}
+
+// SetMember gives a user a role in a project, replacing any role they had
+// there. It applies from the user's next request.
+func (s *projectMemberService) SetMember(ctx context.Context, actorID, projectID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.ProjectMember, error) {
+	if !middleware.ValidRole(middleware.Role(role)) {
+		return nil, apperrors.ErrInvalidRole
+	}
+	if err := s.checkProject(ctx, projectID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !inOrganization(ctx, user) {
+		return nil, apperrors.ErrUserNotFound
+	}
+
+	member := &model.ProjectMember{
+		ProjectID: projectID,
+		UserID:    userID,
+		Role:      role,
+		Username:  user.Username,
+		Email:     user.Email,
+	}
+	if err := s.memberRepo.Set(ctx, member); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditMemberSet, projectID, client, map[string]interface{}{
+		"user_id": userID.String(),
+		"role":    role,
+	}); err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// RemoveMember takes away a user's project role, leaving them with their
+// global role there
+func (s *projectMemberService) RemoveMember(ctx context.Context, actorID, projectID, userID uuid.UUID, client dto.ClientInfo) error {
+	removed, err := s.memberRepo.Delete(ctx, projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return apperrors.ErrProjectMemberNotFound
+	}
+
+	return s.audit(ctx, actorID, model.AuditMemberRemove, projectID, client, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+}
+
+// ListTeams returns the teams with a role in a project
+func (s *projectMemberService) ListTeams(ctx context.Context, projectID uuid.UUID) ([]model.ProjectTeam, error) {
+	if err := s.checkProject(ctx, projectID); err != nil {
+		return nil, err
+	}
+	return s.memberRepo.ListTeams(ctx, projectID)
+}
+
+// SetTeam gives a team a role in a project, replacing any role it had
+// there. Its members hold the role alongside their own; it applies from
+// their next request.
+func (s *projectMemberService) SetTeam(ctx context.Context, actorID, projectID, teamID uuid.UUID, role string, client dto.ClientInfo) (*model.ProjectTeam, error) {
+	if !middleware.ValidRole(middleware.Role(role)) {
+		return nil, apperrors.ErrInvalidRole
+	}
+	if err := s.checkProject(ctx, projectID); err != nil {
+		return nil, err
+	}
+
+	team, err := s.teamRepo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if team == nil {
+		return nil, apperrors.ErrTeamNotFound
+	}
+
+	projectTeam := &model.ProjectTeam{
+		ProjectID: projectID,
+		TeamID:    teamID,
+		Role:      role,
+		TeamName:  team.Name,
+	}
+	if err := s.memberRepo.SetTeam(ctx, projectTeam); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditProjectTeamSet, projectID, client, map[string]interface{}{
+		"team_id": teamID.String(),
+		"role":    role,
+	}); err != nil {
+		return nil, err
+	}
+
+	return projectTeam, nil
+}
+
+// RemoveTeam takes away a team's project role
+func (s *projectMemberService) RemoveTeam(ctx context.Context, actorID, projectID, teamID uuid.UUID, client dto.ClientInfo) error {
+	removed, err := s.memberRepo.DeleteTeam(ctx, projectID, teamID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return apperrors.ErrProjectTeamNotFound
+	}
+
+	return s.audit(ctx, actorID, model.AuditProjectTeamRemove, projectID, client, map[string]interface{}{
+		"team_id": teamID.String(),
+	})
+}
+
+func (s *projectMemberService) checkProject(ctx context.Context, projectID uuid.UUID) error {
+	project, err := s.projectRepo.GetByID(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return apperrors.ErrProjectNotFound
+	}
+	return nil
+}
+
+func (s *projectMemberService) audit(ctx context.Context, actorID uuid.UUID, action string, projectID uuid.UUID, client dto.ClientInfo, metadata map[string]interface{}) error {
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetProject,
+		TargetID:     projectID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata:     metadata,
+	})
+}
@@ -3,8 +3,11 @@ package service
 import (
 	"context"
 	"errors"
+	"api/internal/cache"
 	"api/internal/dto"
+	apperrors "api/internal/errors"
 	"api/internal/model"
+	"api/internal/pagination"
 	"api/internal/repository"
 	"api/internal/sse"
 	"github.com/google/uuid"
@@ -13,12 +16,14 @@ import (
 type projectService struct {
 	projectRepo repository.ProjectRepository
 	sseService  SSEService
+	configCache *cache.ConfigCache
 }
 
-func NewProjectService(projectRepo repository.ProjectRepository, sseService SSEService) ProjectService {
+func NewProjectService(projectRepo repository.ProjectRepository, sseService SSEService, configCache *cache.ConfigCache) ProjectService {
 	return &projectService{
 		projectRepo: projectRepo,
 		sseService:  sseService,
+		configCache: configCache,
 	}
 }
 
@@ -49,8 +54,9 @@ func (s *projectService) CreateProject(ctx context.Context, req *dto.CreateProje
 	eventData := model.ProjectEvent{
 		ProjectID: project.ID,
 		Name:      project.Name,
+		Version:   project.Version,
 	}
-	s.sseService.BroadcastEvent(sse.ProjectCreated, eventData)
+	broadcast(ctx, s.sseService, sse.ProjectCreated, eventData)
 
 	return project, nil
 }
@@ -62,14 +68,14 @@ func (s *projectService) GetProject(ctx context.Context, id uuid.UUID) (*model.P
 	}
 	
 	if project == nil {
-		return nil, errors.New("project not found")
+		return nil, apperrors.ErrProjectNotFound
 	}
 
 	return project, nil
 }
 
-func (s *projectService) GetAllProjects(ctx context.Context) ([]model.Project, error) {
-	projects, err := s.projectRepo.GetAll(ctx)
+func (s *projectService) GetAllProjects(ctx context.Context, params pagination.Params) (*pagination.Page[model.Project], error) {
+	projects, err := s.projectRepo.List(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -84,9 +90,15 @@ func (s *projectService) UpdateProject(ctx context.Context, id uuid.UUID, req *d
 	}
 	
 	if exists == nil {
-		return nil, errors.New("project not found")
+		return nil, apperrors.ErrProjectNotFound
 	}
 
+	version, err := checkVersion(req.Version, req.IfMatch, exists.Version)
+	if err != nil {
+		return exists, err
+	}
+	req.Version = version
+
 	if req.Name != nil {
 		if *req.Name == "" {
 			return nil, errors.New("project name cannot be empty")
@@ -105,13 +117,18 @@ func (s *projectService) UpdateProject(ctx context.Context, id uuid.UUID, req *d
 	if err != nil {
 		return nil, err
 	}
+	if project == nil {
+		current, err := s.projectRepo.GetByID(ctx, id)
+		return staleUpdate(current, err, apperrors.ErrProjectNotFound)
+	}
 
 	// Broadcast SSE event
 	eventData := model.ProjectEvent{
 		ProjectID: project.ID,
 		Name:      project.Name,
+		Version:   project.Version,
 	}
-	s.sseService.BroadcastEvent(sse.ProjectUpdated, eventData)
+	broadcast(ctx, s.sseService, sse.ProjectUpdated, eventData)
 
 	return project, nil
 }
@@ -123,7 +140,7 @@ func (s *projectService) DeleteProject(ctx context.Context, id uuid.UUID) error
 	}
 	
 	if exists == nil {
-		return errors.New("project not found")
+		return apperrors.ErrProjectNotFound
 	}
 
 	err = s.projectRepo.Delete(ctx, id)
@@ -131,12 +148,16 @@ func (s *projectService) DeleteProject(ctx context.Context, id uuid.UUID) error
 		return err
 	}
 
+	// Environments cascade with the project
+	s.configCache.InvalidateAll()
+
 	// Broadcast SSE event
 	eventData := model.ProjectEvent{
 		ProjectID: exists.ID,
 		Name:      exists.Name,
+		Version:   exists.Version,
 	}
-	s.sseService.BroadcastEvent(sse.ProjectDeleted, eventData)
+	broadcast(ctx, s.sseService, sse.ProjectDeleted, eventData)
 
 	return nil
 }
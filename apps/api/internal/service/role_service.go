@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,19}$`)
+
+type roleService struct {
+	roleRepo  repository.RoleRepository
+	auditRepo repository.AuditRepository
+	roles     *middleware.RoleCache
+}
+
+func NewRoleService(roleRepo repository.RoleRepository, auditRepo repository.AuditRepository, roles *middleware.RoleCache) RoleService {
+	return &roleService{
+		roleRepo:  roleRepo,
+		auditRepo: auditRepo,
+		roles:     roles,
+	}
+}
+
+// RoleDefinitions loads the role definitions permission checks use
+func RoleDefinitions(roleRepo repository.RoleRepository) middleware.RoleLoader {
+	return func(ctx context.Context) (map[middleware.Role]middleware.RoleDefinition, error) {
+		roles, err := roleRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		definitions := make(map[middleware.Role]middleware.RoleDefinition, len(roles))
+		for _, role := range roles {
+			definition := middleware.RoleDefinition{
+				Permissions: make([]middleware.Permission, 0, len(role.Permissions)),
+				Scopes:      make(map[middleware.Permission]middleware.EnvironmentScope),
+			}
+			for _, p := range role.Permissions {
+				permission := middleware.Permission(p.Permission)
+				definition.Permissions = append(definition.Permissions, permission)
+				if p.NonProduction || len(p.EnvironmentIDs) > 0 {
+					definition.Scopes[permission] = middleware.EnvironmentScope{
+						NonProduction: p.NonProduction,
+						Environments:  p.EnvironmentIDs,
+					}
+				}
+			}
+			definitions[middleware.Role(role.Name)] = definition
+		}
+		return definitions, nil
+	}
+}
+
+// ListRoles returns the built-in and custom roles
+func (s *roleService) ListRoles(ctx context.Context) ([]model.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+// GetRole retrieves a role by name
+func (s *roleService) GetRole(ctx context.Context, name string) (*model.Role, error) {
+	role, err := s.roleRepo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, apperrors.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// CreateRole adds a custom role
+func (s *roleService) CreateRole(ctx context.Context, actorID uuid.UUID, req *dto.CreateRoleRequest, client dto.ClientInfo) (*model.Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, apperrors.ErrInvalidRoleName
+	}
+	permissions, err := rolePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.roleRepo.GetByName(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, apperrors.ErrRoleExists
+	}
+
+	role := &model.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := s.roleRepo.Create(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.reload(ctx)
+	if err := s.audit(ctx, actorID, model.AuditRoleCreate, role, client); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// UpdateRole changes a custom role's description or replaces its
+// permissions. Holders of the role get the new permissions immediately.
+func (s *roleService) UpdateRole(ctx context.Context, actorID uuid.UUID, name string, req *dto.UpdateRoleRequest, client dto.ClientInfo) (*model.Role, error) {
+	role, err := s.customRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if role.Permissions, err = rolePermissions(*req.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.reload(ctx)
+	if err := s.audit(ctx, actorID, model.AuditRoleUpdate, role, client); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// DeleteRole deletes a custom role nobody holds
+func (s *roleService) DeleteRole(ctx context.Context, actorID uuid.UUID, name string, client dto.ClientInfo) error {
+	role, err := s.customRole(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	assigned, err := s.roleRepo.CountAssignments(ctx, name)
+	if err != nil {
+		return err
+	}
+	if assigned > 0 {
+		return apperrors.ErrRoleInUse
+	}
+
+	if err := s.roleRepo.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	s.reload(ctx)
+	return s.audit(ctx, actorID, model.AuditRoleDelete, role, client)
+}
+
+// customRole loads a role that may be changed
+func (s *roleService) customRole(ctx context.Context, name string) (*model.Role, error) {
+	role, err := s.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role.BuiltIn {
+		return nil, apperrors.ErrBuiltInRole
+	}
+	return role, nil
+}
+
+// reload refreshes the cached role definitions after a change. On failure
+// the cache catches up when it expires.
+func (s *roleService) reload(ctx context.Context) {
+	if err := s.roles.Reload(ctx); err != nil {
+		log.Printf("Failed to reload roles: %v", err)
+	}
+}
+
+func (s *roleService) audit(ctx context.Context, actorID uuid.UUID, action string, role *model.Role, client dto.ClientInfo) error {
+	permissions := make([]string, len(role.Permissions))
+	for i, p := range role.Permissions {
+		permissions[i] = p.Permission
+	}
+
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetRole,
+		TargetID:     role.Name,
+		IPAddress:    client.IPAddress,
+		Metadata: map[string]interface{}{
+			"permissions": permissions,
+		},
+	})
+}
+
+// rolePermissions checks requested permissions are known and not repeated
+func rolePermissions(reqs []dto.RolePermissionRequest) ([]model.RolePermission, error) {
+	permissions := make([]model.RolePermission, 0, len(reqs))
+	seen := make(map[string]bool, len(reqs))
+	for _, req := range reqs {
+		if !middleware.ValidPermission(middleware.Permission(req.Permission)) {
+			return nil, apperrors.ErrInvalidPermission
+		}
+		if seen[req.Permission] {
+			return nil, apperrors.NewAppError(apperrors.ErrInvalidPermission.Code, "Permission "+req.Permission+" is listed more than once")
+		}
+		seen[req.Permission] = true
+
+		envIDs := req.EnvironmentIDs
+		if envIDs == nil {
+			envIDs = []uuid.UUID{}
+		}
+		permissions = append(permissions, model.RolePermission{
+			Permission:     req.Permission,
+			NonProduction:  req.NonProduction,
+			EnvironmentIDs: envIDs,
+		})
+	}
+	return permissions, nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type teamService struct {
+	teamRepo  repository.TeamRepository
+	userRepo  repository.UserRepository
+	auditRepo repository.AuditRepository
+}
+
+func NewTeamService(teamRepo repository.TeamRepository, userRepo repository.UserRepository, auditRepo repository.AuditRepository) TeamService {
+	return &teamService{
+		teamRepo:  teamRepo,
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+	}
+}
+
+// ListTeams returns a page of the organisation's teams
+func (s *teamService) ListTeams(ctx context.Context, params pagination.Params) (*pagination.Page[model.Team], error) {
+	return s.teamRepo.List(ctx, params)
+}
+
+// GetTeam retrieves a team by ID
+func (s *teamService) GetTeam(ctx context.Context, id uuid.UUID) (*model.Team, error) {
+	team, err := s.teamRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if team == nil {
+		return nil, apperrors.ErrTeamNotFound
+	}
+	return team, nil
+}
+
+// CreateTeam adds an empty team to the organisation
+func (s *teamService) CreateTeam(ctx context.Context, actorID uuid.UUID, req *dto.CreateTeamRequest, client dto.ClientInfo) (*model.Team, error) {
+	if err := s.checkName(ctx, uuid.Nil, req.Name); err != nil {
+		return nil, err
+	}
+
+	team := &model.Team{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := s.teamRepo.Create(ctx, team); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditTeamCreate, team.ID, client, map[string]interface{}{
+		"name": team.Name,
+	}); err != nil {
+		return nil, err
+	}
+
+	return team, nil
+}
+
+// UpdateTeam renames a team or changes its description
+func (s *teamService) UpdateTeam(ctx context.Context, actorID, id uuid.UUID, req *dto.UpdateTeamRequest, client dto.ClientInfo) (*model.Team, error) {
+	team, err := s.GetTeam(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil && *req.Name != team.Name {
+		if err := s.checkName(ctx, team.ID, *req.Name); err != nil {
+			return nil, err
+		}
+		team.Name = *req.Name
+	}
+	if req.Description != nil {
+		team.Description = *req.Description
+	}
+
+	if err := s.teamRepo.Update(ctx, team); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditTeamUpdate, team.ID, client, map[string]interface{}{
+		"name": team.Name,
+	}); err != nil {
+		return nil, err
+	}
+
+	return team, nil
+}
+
+// DeleteTeam deletes a team. Its members lose the project roles they held
+// through it, and flags it owned are left without an owner.
+func (s *teamService) DeleteTeam(ctx context.Context, actorID, id uuid.UUID, client dto.ClientInfo) error {
+	team, err := s.GetTeam(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.teamRepo.Delete(ctx, team.ID); err != nil {
+		return err
+	}
+
+	return s.audit(ctx, actorID, model.AuditTeamDelete, team.ID, client, map[string]interface{}{
+		"name": team.Name,
+	})
+}
+
+// ListMembers returns a team's members and maintainers
+func (s *teamService) ListMembers(ctx context.Context, teamID uuid.UUID) ([]model.TeamMember, error) {
+	if _, err := s.GetTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	return s.teamRepo.ListMembers(ctx, teamID)
+}
+
+// SetMember adds a user of the organisation to a team or changes their role
+// in it. Project roles granted to the team apply from their next request.
+func (s *teamService) SetMember(ctx context.Context, actorID, teamID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.TeamMember, error) {
+	if _, err := s.GetTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !inOrganization(ctx, user) {
+		return nil, apperrors.ErrUserNotFound
+	}
+
+	member := &model.TeamMember{
+		TeamID:   teamID,
+		UserID:   userID,
+		Role:     role,
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if err := s.teamRepo.SetMember(ctx, member); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditTeamMemberSet, teamID, client, map[string]interface{}{
+		"user_id": userID.String(),
+		"role":    role,
+	}); err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// RemoveMember takes a user out of a team, along with the project roles
+// they held through it
+func (s *teamService) RemoveMember(ctx context.Context, actorID, teamID, userID uuid.UUID, client dto.ClientInfo) error {
+	removed, err := s.teamRepo.RemoveMember(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return apperrors.ErrTeamMemberNotFound
+	}
+
+	return s.audit(ctx, actorID, model.AuditTeamMemberRemove, teamID, client, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+}
+
+// checkName checks no other team of the organisation has a name
+func (s *teamService) checkName(ctx context.Context, id uuid.UUID, name string) error {
+	existing, err := s.teamRepo.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != id {
+		return apperrors.ErrTeamNameExists
+	}
+	return nil
+}
+
+func (s *teamService) audit(ctx context.Context, actorID uuid.UUID, action string, teamID uuid.UUID, client dto.ClientInfo, metadata map[string]interface{}) error {
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetTeam,
+		TargetID:     teamID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata:     metadata,
+	})
+}
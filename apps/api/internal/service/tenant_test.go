@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/repository"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// tenantData holds projects, environments and flags of several
+// organisations. Its repositories only find rows of the organisation in the
+// context, as the SQL repositories do, and count every write they're asked
+// for, found or not.
+type tenantData struct {
+	projects     map[uuid.UUID]model.Project
+	environments map[uuid.UUID]model.Environment
+	flags        map[uuid.UUID]model.Flag
+	writes       int
+}
+
+// projectInOrganization reports whether the project belongs to the
+// organisation in the context
+func (d *tenantData) projectInOrganization(ctx context.Context, projectID uuid.UUID) (bool, error) {
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return false, repository.ErrNoOrganization
+	}
+	project, ok := d.projects[projectID]
+	return ok && project.OrganizationID == org.ID, nil
+}
+
+type tenantProjectRepo struct {
+	repository.ProjectRepository
+	*tenantData
+}
+
+func (r tenantProjectRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Project, error) {
+	found, err := r.projectInOrganization(ctx, id)
+	if err != nil || !found {
+		return nil, err
+	}
+	project := r.projects[id]
+	return &project, nil
+}
+
+func (r tenantProjectRepo) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateProjectRequest) (*model.Project, error) {
+	r.writes++
+	return nil, nil
+}
+
+func (r tenantProjectRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	r.writes++
+	return nil
+}
+
+type tenantEnvironmentRepo struct {
+	repository.EnvironmentRepository
+	*tenantData
+}
+
+func (r tenantEnvironmentRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Environment, error) {
+	env, ok := r.environments[id]
+	found, err := r.projectInOrganization(ctx, env.ProjectID)
+	if err != nil || !ok || !found {
+		return nil, err
+	}
+	return &env, nil
+}
+
+func (r tenantEnvironmentRepo) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateEnvironmentRequest) (*model.Environment, error) {
+	r.writes++
+	return nil, nil
+}
+
+func (r tenantEnvironmentRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	r.writes++
+	return nil
+}
+
+type tenantFlagRepo struct {
+	repository.FlagRepository
+	*tenantData
+}
+
+func (r tenantFlagRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Flag, error) {
+	flag, ok := r.flags[id]
+	found, err := r.projectInOrganization(ctx, flag.ProjectID)
+	if err != nil || !ok || !found {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r tenantFlagRepo) Update(ctx context.Context, id uuid.UUID, req *dto.UpdateFlagRequest) (*model.Flag, error) {
+	r.writes++
+	return nil, nil
+}
+
+func (r tenantFlagRepo) SetStatus(ctx context.Context, id uuid.UUID, status string) (*model.Flag, error) {
+	r.writes++
+	return nil, nil
+}
+
+func (r tenantFlagRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	r.writes++
+	return nil
+}
+
+// tenantFixture is an organisation acting on data of its own and of another
+// organisation
+type tenantFixture struct {
+	ctx  context.Context
+	data *tenantData
+	// own and other are a project, environment, flag and user of the acting
+	// organisation and of the other one
+	own, other tenantRows
+	admin      *model.User
+	users      *memUserRepo
+}
+
+type tenantRows struct {
+	project, environment, flag, user uuid.UUID
+}
+
+func newTenantFixture() *tenantFixture {
+	f := &tenantFixture{data: &tenantData{
+		projects:     make(map[uuid.UUID]model.Project),
+		environments: make(map[uuid.UUID]model.Environment),
+		flags:        make(map[uuid.UUID]model.Flag),
+	}}
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	f.ctx = tenant.WithOrganization(context.Background(), tenant.Organization{ID: orgID})
+	f.admin = &model.User{ID: uuid.New(), OrganizationID: orgID, Username: "admin", Role: "admin", Active: true}
+
+	var users []*model.User
+	for _, org := range []struct {
+		id   uuid.UUID
+		rows *tenantRows
+	}{{orgID, &f.own}, {otherOrgID, &f.other}} {
+		project := model.Project{ID: uuid.New(), OrganizationID: org.id, Name: "Checkout", Version: 1}
+		env := model.Environment{ID: uuid.New(), ProjectID: project.ID, Key: "production", Version: 1}
+		flag := model.Flag{ID: uuid.New(), ProjectID: project.ID, Key: "beta-banner", Status: model.FlagStatusArchived, Version: 1}
+		user := &model.User{ID: uuid.New(), OrganizationID: org.id, Username: "member_" + org.id.String()[:8], Role: "viewer", Active: true}
+
+		f.data.projects[project.ID] = project
+		f.data.environments[env.ID] = env
+		f.data.flags[flag.ID] = flag
+		users = append(users, user)
+		*org.rows = tenantRows{project: project.ID, environment: env.ID, flag: flag.ID, user: user.ID}
+	}
+	f.users = newMemUserRepo(append(users, f.admin)...)
+	return f
+}
+
+// Reads and writes of another organisation's projects, environments, flags
+// and users find nothing and change nothing
+func TestTenantIsolation(t *testing.T) {
+	version := 1
+	name := "Renamed"
+	role := "developer"
+
+	tests := []struct {
+		name string
+		call func(f *tenantFixture, rows tenantRows) error
+		want error
+	}{
+		{
+			name: "get project",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.projects().GetProject(f.ctx, rows.project)
+				return err
+			},
+			want: apperrors.ErrProjectNotFound,
+		},
+		{
+			name: "update project",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.projects().UpdateProject(f.ctx, rows.project, &dto.UpdateProjectRequest{Name: &name, Version: &version})
+				return err
+			},
+			want: apperrors.ErrProjectNotFound,
+		},
+		{
+			name: "delete project",
+			call: func(f *tenantFixture, rows tenantRows) error { return f.projects().DeleteProject(f.ctx, rows.project) },
+			want: apperrors.ErrProjectNotFound,
+		},
+		{
+			name: "get environment",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.environments().GetEnvironment(f.ctx, rows.environment)
+				return err
+			},
+			want: apperrors.ErrEnvironmentNotFound,
+		},
+		{
+			name: "update environment",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.environments().UpdateEnvironment(f.ctx, rows.environment, &dto.UpdateEnvironmentRequest{Name: &name, Version: &version})
+				return err
+			},
+			want: apperrors.ErrEnvironmentNotFound,
+		},
+		{
+			name: "delete environment",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				return f.environments().DeleteEnvironment(f.ctx, rows.environment)
+			},
+			want: apperrors.ErrEnvironmentNotFound,
+		},
+		{
+			name: "get flag",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.flags().GetFlag(f.ctx, rows.flag)
+				return err
+			},
+			want: apperrors.ErrFlagNotFound,
+		},
+		{
+			name: "update flag",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.flags().UpdateFlag(f.ctx, rows.flag, &dto.UpdateFlagRequest{Version: &version})
+				return err
+			},
+			want: apperrors.ErrFlagNotFound,
+		},
+		{
+			name: "restore flag",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.flags().RestoreFlag(f.ctx, rows.flag)
+				return err
+			},
+			want: apperrors.ErrFlagNotFound,
+		},
+		{
+			name: "delete flag",
+			call: func(f *tenantFixture, rows tenantRows) error { return f.flags().DeleteFlag(f.ctx, rows.flag) },
+			want: apperrors.ErrFlagNotFound,
+		},
+		{
+			name: "get user",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.userService().GetUser(f.ctx, rows.user)
+				return err
+			},
+			want: apperrors.ErrUserNotFound,
+		},
+		{
+			name: "change user role",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.userService().UpdateRole(f.ctx, f.admin.ID, rows.user, role, dto.ClientInfo{})
+				return err
+			},
+			want: apperrors.ErrUserNotFound,
+		},
+		{
+			name: "deactivate user",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				_, err := f.userService().SetActive(f.ctx, f.admin.ID, rows.user, false, dto.ClientInfo{})
+				return err
+			},
+			want: apperrors.ErrUserNotFound,
+		},
+		{
+			name: "delete user",
+			call: func(f *tenantFixture, rows tenantRows) error {
+				return f.userService().DeleteUser(f.ctx, f.admin.ID, rows.user, dto.ClientInfo{})
+			},
+			want: apperrors.ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTenantFixture()
+			before := f.users.users[f.other.user]
+
+			if err := tt.call(f, f.other); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if f.data.writes != 0 {
+				t.Errorf("made %d writes to the other organisation's data", f.data.writes)
+			}
+			if after := f.users.users[f.other.user]; !reflect.DeepEqual(after, before) {
+				t.Errorf("the other organisation's user changed from %+v to %+v", before, after)
+			}
+		})
+	}
+}
+
+// The same reads find the organisation's own data, so the fixture's scoping
+// isn't what makes TestTenantIsolation pass
+func TestTenantIsolationFindsOwnData(t *testing.T) {
+	f := newTenantFixture()
+
+	if _, err := f.projects().GetProject(f.ctx, f.own.project); err != nil {
+		t.Errorf("GetProject: %v", err)
+	}
+	if _, err := f.environments().GetEnvironment(f.ctx, f.own.environment); err != nil {
+		t.Errorf("GetEnvironment: %v", err)
+	}
+	if _, err := f.flags().GetFlag(f.ctx, f.own.flag); err != nil {
+		t.Errorf("GetFlag: %v", err)
+	}
+	if _, err := f.userService().GetUser(f.ctx, f.own.user); err != nil {
+		t.Errorf("GetUser: %v", err)
+	}
+}
+
+// Without an organisation in the context nothing is found
+func TestTenantIsolationWithoutOrganization(t *testing.T) {
+	f := newTenantFixture()
+	f.ctx = context.Background()
+
+	if _, err := f.projects().GetProject(f.ctx, f.own.project); !errors.Is(err, repository.ErrNoOrganization) {
+		t.Errorf("GetProject error = %v, want %v", err, repository.ErrNoOrganization)
+	}
+	if _, err := f.userService().GetUser(f.ctx, f.own.user); !errors.Is(err, apperrors.ErrUserNotFound) {
+		t.Errorf("GetUser error = %v, want %v", err, apperrors.ErrUserNotFound)
+	}
+}
+
+func (f *tenantFixture) projects() ProjectService {
+	return NewProjectService(tenantProjectRepo{tenantData: f.data}, nil, nil)
+}
+
+func (f *tenantFixture) environments() EnvironmentService {
+	return NewEnvironmentService(tenantEnvironmentRepo{tenantData: f.data}, newMemFlagValueRepo(), nil, nil, nil)
+}
+
+func (f *tenantFixture) flags() FlagService {
+	return NewFlagService(tenantFlagRepo{tenantData: f.data}, newMemFlagValueRepo(), nil, nil, nil, nil, nil)
+}
+
+func (f *tenantFixture) userService() UserService {
+	return NewUserService(f.users, nil, &memAuditRepo{}, nil)
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/middleware"
+	"api/internal/model"
+	"api/internal/pagination"
+	"api/internal/repository"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+var invalidUsernameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+type userService struct {
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	auditRepo   repository.AuditRepository
+	accounts    AccountService
+}
+
+func NewUserService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, auditRepo repository.AuditRepository, accounts AccountService) UserService {
+	return &userService{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+		accounts:    accounts,
+	}
+}
+
+// ListUsers returns a page of users
+func (s *userService) ListUsers(ctx context.Context, params pagination.Params) (*pagination.Page[model.User], error) {
+	return s.userRepo.List(ctx, params)
+}
+
+// GetUser retrieves a user by ID
+func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !inOrganization(ctx, user) {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// InviteUser creates an account with a pre-assigned role and emails the user
+// a link to set their password. The account can't sign in until then. It
+// joins the organisation ctx acts in.
+func (s *userService) InviteUser(ctx context.Context, actorID uuid.UUID, req *dto.InviteUserRequest, client dto.ClientInfo) (*model.User, error) {
+	if !middleware.ValidRole(middleware.Role(req.Role)) {
+		return nil, apperrors.ErrInvalidRole
+	}
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, repository.ErrNoOrganization
+	}
+
+	// Addresses are unique across organisations. Only a conflict with a
+	// member of this organisation is reported; an address in use elsewhere
+	// is dropped without creating anything, so invitations can't be used to
+	// find accounts in other organisations.
+	existing, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.OrganizationID == org.ID {
+		return nil, apperrors.ErrEmailExists
+	}
+	if existing != nil {
+		log.Printf("Dropped invitation to organization %s for user %s of another organization", org.ID, existing.ID)
+		return nil, nil
+	}
+
+	// Host admins invite the first admin of other organisations, so the
+	// inviter isn't necessarily a member of this one
+	inviter, err := s.userRepo.GetByID(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if inviter == nil {
+		return nil, apperrors.ErrUserNotFound
+	}
+
+	username, err := uniqueUsername(ctx, s.userRepo, "", req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		Username:       username,
+		Email:          req.Email,
+		Role:           req.Role,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Active:         true,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditUserInvite, user, client, map[string]interface{}{
+		"email": user.Email,
+		"role":  user.Role,
+	}); err != nil {
+		return nil, err
+	}
+
+	// The account exists either way; a failed email can be retried with a
+	// password reset
+	if err := s.accounts.SendInvitation(ctx, user, inviter); err != nil {
+		log.Printf("Failed to send invitation email to user %s: %v", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// CreateServiceAccount creates a non-human account for automation. It has
+// no password and authenticates only with access tokens an admin issues it.
+func (s *userService) CreateServiceAccount(ctx context.Context, actorID uuid.UUID, req *dto.CreateServiceAccountRequest, client dto.ClientInfo) (*model.User, error) {
+	if !middleware.ValidRole(middleware.Role(req.Role)) {
+		return nil, apperrors.ErrInvalidRole
+	}
+	org, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, repository.ErrNoOrganization
+	}
+
+	username, err := uniqueUsername(ctx, s.userRepo, "svc_"+req.Name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		Username:       username,
+		// Emails are unique, so every account needs one; this one can
+		// never receive mail
+		Email:        username + "@service-accounts.invalid",
+		Role:         req.Role,
+		FirstName:    req.Name,
+		LastName:     req.Description,
+		Active:       true,
+		AuthProvider: model.AuthProviderNone,
+		AccountType:  model.AccountTypeServiceAccount,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditServiceAccount, user, client, map[string]interface{}{
+		"username": user.Username,
+		"role":     user.Role,
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdateRole changes a user's role and signs them out, so no access token
+// carries the old role
+func (s *userService) UpdateRole(ctx context.Context, actorID, userID uuid.UUID, role string, client dto.ClientInfo) (*model.User, error) {
+	if !middleware.ValidRole(middleware.Role(role)) {
+		return nil, apperrors.ErrInvalidRole
+	}
+
+	user, err := s.modifiableUser(ctx, actorID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if err := s.checkNotLastAdmin(ctx, user); err != nil {
+		return nil, err
+	}
+
+	previous := user.Role
+	user.Role = role
+	if err := s.userRepo.Update(ctx, user.ID, user); err != nil {
+		return nil, err
+	}
+	if _, err := s.sessionRepo.RevokeAllForUser(ctx, user.ID, model.SessionRevokedRoleChanged); err != nil {
+		return nil, err
+	}
+
+	if err := s.audit(ctx, actorID, model.AuditUserRoleChange, user, client, map[string]interface{}{
+		"from": previous,
+		"to":   role,
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SetActive activates or deactivates a user. Deactivating signs them out.
+func (s *userService) SetActive(ctx context.Context, actorID, userID uuid.UUID, active bool, client dto.ClientInfo) (*model.User, error) {
+	user, err := s.modifiableUser(ctx, actorID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Active == active {
+		return user, nil
+	}
+
+	action := model.AuditUserActivate
+	if !active {
+		if err := s.checkNotLastAdmin(ctx, user); err != nil {
+			return nil, err
+		}
+		action = model.AuditUserDeactivate
+	}
+
+	user.Active = active
+	if err := s.userRepo.Update(ctx, user.ID, user); err != nil {
+		return nil, err
+	}
+	if !active {
+		if _, err := s.sessionRepo.RevokeAllForUser(ctx, user.ID, model.SessionRevokedUserInactive); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.audit(ctx, actorID, action, user, client, nil); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser permanently deletes a user
+func (s *userService) DeleteUser(ctx context.Context, actorID, userID uuid.UUID, client dto.ClientInfo) error {
+	user, err := s.modifiableUser(ctx, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkNotLastAdmin(ctx, user); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.audit(ctx, actorID, model.AuditUserDelete, user, client, map[string]interface{}{
+		"username": user.Username,
+		"email":    user.Email,
+	})
+}
+
+// modifiableUser loads the target of an admin action; admins can't change
+// their own role or status, so they can't lock themselves out
+func (s *userService) modifiableUser(ctx context.Context, actorID, userID uuid.UUID) (*model.User, error) {
+	if actorID == userID {
+		return nil, apperrors.ErrCannotModifySelf
+	}
+	return s.GetUser(ctx, userID)
+}
+
+// checkNotLastAdmin refuses to demote, deactivate or delete the last active
+// admin
+func (s *userService) checkNotLastAdmin(ctx context.Context, user *model.User) error {
+	if user.Role != string(middleware.RoleAdmin) || !user.Active {
+		return nil
+	}
+
+	admins, err := s.userRepo.CountActiveAdmins(ctx, user.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return apperrors.ErrLastAdmin
+	}
+	return nil
+}
+
+func (s *userService) audit(ctx context.Context, actorID uuid.UUID, action string, user *model.User, client dto.ClientInfo, metadata map[string]interface{}) error {
+	return s.auditRepo.Record(ctx, &model.AuditEvent{
+		ActorID:      &actorID,
+		ActorType:    client.PrincipalType,
+		ActorTokenID: client.TokenID,
+		Action:       action,
+		TargetType:   model.AuditTargetUser,
+		TargetID:     user.ID.String(),
+		IPAddress:    client.IPAddress,
+		Metadata:     metadata,
+	})
+}
+
+// uniqueUsername derives a valid, unused username from a preferred username
+// or, failing that, the local part of an email address
+func uniqueUsername(ctx context.Context, userRepo repository.UserRepository, preferred, email string) (string, error) {
+	base := preferred
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = strings.Trim(invalidUsernameChars.ReplaceAllString(base, "_"), "_")
+	if len(base) < 3 {
+		base = "user_" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for i := 1; i <= 20; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s_%d", base, i)
+		}
+
+		existing, err := userRepo.GetByUsername(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", apperrors.ErrUsernameExists
+}
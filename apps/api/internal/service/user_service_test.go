@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+	"api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// invitationOutbox records the invitations that would be emailed
+type invitationOutbox struct {
+	AccountService
+	sent []string
+}
+
+func (o *invitationOutbox) SendInvitation(ctx context.Context, user *model.User, inviter *model.User) error {
+	o.sent = append(o.sent, user.Email)
+	return nil
+}
+
+func TestInviteUser(t *testing.T) {
+	orgID, otherOrgID := uuid.New(), uuid.New()
+	admin := &model.User{ID: uuid.New(), OrganizationID: orgID, Username: "admin", Email: "admin@example.com", Role: "admin"}
+	member := &model.User{ID: uuid.New(), OrganizationID: orgID, Username: "ada", Email: "ada@example.com", Role: "viewer"}
+	outsider := &model.User{ID: uuid.New(), OrganizationID: otherOrgID, Username: "eve", Email: "eve@example.com", Role: "viewer"}
+
+	tests := []struct {
+		name  string
+		email string
+		want  error
+		// wantCreated is whether an account is created and invited
+		wantCreated bool
+	}{
+		{name: "new address", email: "grace@example.com", wantCreated: true},
+		{name: "member of the organisation", email: member.Email, want: apperrors.ErrEmailExists},
+		{name: "account in another organisation", email: outsider.Email},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newMemUserRepo(admin, member, outsider)
+			outbox := &invitationOutbox{}
+			svc := NewUserService(users, nil, &memAuditRepo{}, outbox)
+			ctx := tenant.WithOrganization(context.Background(), tenant.Organization{ID: orgID})
+
+			user, err := svc.InviteUser(ctx, admin.ID, &dto.InviteUserRequest{Email: tt.email, Role: "viewer"}, dto.ClientInfo{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("InviteUser error = %v, want %v", err, tt.want)
+			}
+			if (user != nil) != tt.wantCreated {
+				t.Fatalf("InviteUser returned %v, want an account %v", user, tt.wantCreated)
+			}
+			if tt.wantCreated && user.OrganizationID != orgID {
+				t.Errorf("invited user joined organisation %s, want %s", user.OrganizationID, orgID)
+			}
+			if n := len(users.users); n != 3+boolCount(tt.wantCreated) {
+				t.Errorf("%d accounts exist, want %d", n, 3+boolCount(tt.wantCreated))
+			}
+			if len(outbox.sent) != boolCount(tt.wantCreated) {
+				t.Errorf("sent invitations to %v", outbox.sent)
+			}
+			if stored, _ := users.GetByID(ctx, outsider.ID); stored.OrganizationID != otherOrgID || stored.Role != outsider.Role {
+				t.Errorf("the other organisation's account changed: %+v", stored)
+			}
+		})
+	}
+}
+
+func boolCount(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
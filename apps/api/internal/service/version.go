@@ -0,0 +1,46 @@
+package service
+
+import (
+	"slices"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+)
+
+// checkVersion checks an update names the version of the resource it was
+// made from, so it can't silently overwrite changes made since. It returns
+// the version the write must still find: the one named, the current one
+// when it matches one of several, or nil when ifMatch accepts any version.
+func checkVersion(version *int, ifMatch *dto.IfMatch, current int) (*int, error) {
+	if ifMatch != nil {
+		if ifMatch.Any {
+			return nil, nil
+		}
+		if slices.Contains(ifMatch.Versions, current) {
+			return &current, nil
+		}
+		return nil, apperrors.ErrVersionMismatch
+	}
+
+	if version == nil {
+		return nil, apperrors.ErrVersionRequired
+	}
+	if *version != current {
+		return nil, apperrors.ErrVersionMismatch
+	}
+	return version, nil
+}
+
+// staleUpdate explains an update that wrote nothing although the resource
+// was at the right version when checked: a concurrent request either
+// changed it, in which case its current state is returned with
+// ErrVersionMismatch, or deleted it
+func staleUpdate[T any](current *T, err error, notFound error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, notFound
+	}
+	return current, apperrors.ErrVersionMismatch
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"api/internal/dto"
+	apperrors "api/internal/errors"
+	"api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckVersion(t *testing.T) {
+	version := func(v int) *int { return &v }
+
+	tests := []struct {
+		name      string
+		version   *int
+		ifMatch   *dto.IfMatch
+		current   int
+		want      error
+		wantWrite *int
+	}{
+		{name: "current version", version: version(3), current: 3, wantWrite: version(3)},
+		{name: "no version", version: nil, current: 3, want: apperrors.ErrVersionRequired},
+		{name: "older version", version: version(2), current: 3, want: apperrors.ErrVersionMismatch},
+		{name: "newer version", version: version(4), current: 3, want: apperrors.ErrVersionMismatch},
+		{name: "any version", ifMatch: &dto.IfMatch{Any: true}, current: 3, wantWrite: nil},
+		{name: "any version overrides the body's", version: version(2), ifMatch: &dto.IfMatch{Any: true}, current: 3, wantWrite: nil},
+		{name: "one of several versions", ifMatch: &dto.IfMatch{Versions: []int{1, 3, 5}}, current: 3, wantWrite: version(3)},
+		{name: "none of several versions", ifMatch: &dto.IfMatch{Versions: []int{1, 2}}, current: 3, want: apperrors.ErrVersionMismatch},
+		{name: "several versions override the body's", version: version(3), ifMatch: &dto.IfMatch{Versions: []int{1, 2}}, current: 3, want: apperrors.ErrVersionMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write, err := checkVersion(tt.version, tt.ifMatch, tt.current)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("checkVersion error = %v, want %v", err, tt.want)
+			}
+			if (write == nil) != (tt.wantWrite == nil) || (write != nil && *write != *tt.wantWrite) {
+				t.Errorf("checkVersion wrote against version %v, want %v", write, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestStaleUpdate(t *testing.T) {
+	notFound := errors.New("project not found")
+	lookupFailed := errors.New("connection reset")
+	current := &model.Project{ID: uuid.New(), Version: 4}
+
+	tests := []struct {
+		name        string
+		current     *model.Project
+		err         error
+		wantCurrent bool
+		want        error
+	}{
+		{name: "changed concurrently", current: current, wantCurrent: true, want: apperrors.ErrVersionMismatch},
+		{name: "deleted concurrently", current: nil, want: notFound},
+		{name: "lookup failed", current: nil, err: lookupFailed, want: lookupFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := staleUpdate(tt.current, tt.err, notFound)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("staleUpdate error = %v, want %v", err, tt.want)
+			}
+			if (got != nil) != tt.wantCurrent {
+				t.Errorf("staleUpdate returned %v, want current state %v", got, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestUpdateProjectVersion(t *testing.T) {
+	version := func(v int) *int { return &v }
+	name := "Renamed"
+
+	changedElsewhere := func(r *memProjectRepo, id uuid.UUID) {
+		project := r.projects[id]
+		project.Name, project.Version = "Changed elsewhere", 4
+		r.projects[id] = project
+	}
+
+	tests := []struct {
+		name    string
+		version *int
+		ifMatch *dto.IfMatch
+		// concurrent changes the project between the version check and the
+		// write
+		concurrent  func(r *memProjectRepo, id uuid.UUID)
+		want        error
+		wantVersion int
+		wantName    string
+	}{
+		{name: "current version", version: version(3), wantVersion: 4, wantName: "Renamed"},
+		{name: "no version", version: nil, want: apperrors.ErrVersionRequired, wantVersion: 3, wantName: "Checkout"},
+		{name: "outdated version", version: version(2), want: apperrors.ErrVersionMismatch, wantVersion: 3, wantName: "Checkout"},
+		{
+			name:        "changed concurrently",
+			version:     version(3),
+			concurrent:  changedElsewhere,
+			want:        apperrors.ErrVersionMismatch,
+			wantVersion: 4,
+			wantName:    "Changed elsewhere",
+		},
+		{name: "one of several versions", ifMatch: &dto.IfMatch{Versions: []int{2, 3}}, wantVersion: 4, wantName: "Renamed"},
+		{name: "none of several versions", ifMatch: &dto.IfMatch{Versions: []int{1, 2}}, want: apperrors.ErrVersionMismatch, wantVersion: 3, wantName: "Checkout"},
+		{
+			name:        "one of several versions, changed concurrently",
+			ifMatch:     &dto.IfMatch{Versions: []int{2, 3}},
+			concurrent:  changedElsewhere,
+			want:        apperrors.ErrVersionMismatch,
+			wantVersion: 4,
+			wantName:    "Changed elsewhere",
+		},
+		{name: "any version", ifMatch: &dto.IfMatch{Any: true}, wantVersion: 4, wantName: "Renamed"},
+		{name: "any version, changed concurrently", ifMatch: &dto.IfMatch{Any: true}, concurrent: changedElsewhere, wantVersion: 5, wantName: "Renamed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &model.Project{ID: uuid.New(), Name: "Checkout", Version: 3}
+			repo := newMemProjectRepo(project)
+			if tt.concurrent != nil {
+				repo.beforeUpdate = func(r *memProjectRepo) { tt.concurrent(r, project.ID) }
+			}
+			svc := NewProjectService(repo, nil, nil)
+
+			got, err := svc.UpdateProject(context.Background(), project.ID, &dto.UpdateProjectRequest{Name: &name, Version: tt.version, IfMatch: tt.ifMatch})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateProject error = %v, want %v", err, tt.want)
+			}
+
+			// A mismatch comes back with the current state to merge into
+			if errors.Is(err, apperrors.ErrVersionMismatch) || err == nil {
+				if got == nil {
+					t.Fatal("UpdateProject returned no project")
+				}
+				if got.Version != tt.wantVersion || got.Name != tt.wantName {
+					t.Errorf("UpdateProject returned %q at version %d, want %q at version %d", got.Name, got.Version, tt.wantName, tt.wantVersion)
+				}
+			}
+
+			stored, _ := repo.GetByID(context.Background(), project.ID)
+			if stored.Version != tt.wantVersion || stored.Name != tt.wantName {
+				t.Errorf("stored %q at version %d, want %q at version %d", stored.Name, stored.Version, tt.wantName, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestUpdateProjectDeletedConcurrently(t *testing.T) {
+	project := &model.Project{ID: uuid.New(), Name: "Checkout", Version: 3}
+	repo := newMemProjectRepo(project)
+	repo.beforeUpdate = func(r *memProjectRepo) { delete(r.projects, project.ID) }
+	svc := NewProjectService(repo, nil, nil)
+
+	version := 3
+	got, err := svc.UpdateProject(context.Background(), project.ID, &dto.UpdateProjectRequest{Version: &version})
+	if err == nil || errors.Is(err, apperrors.ErrVersionMismatch) || got != nil {
+		t.Errorf("UpdateProject = %v, %v; want a not-found error", got, err)
+	}
+}
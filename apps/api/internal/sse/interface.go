@@ -1,5 +1,7 @@
 package sse
 
+import "github.com/google/uuid"
+
 // EventType represents the type of event being broadcast
 type EventType string
 
@@ -18,12 +20,15 @@ const (
 	FlagCreated       EventType = "flag.created"
 	FlagUpdated       EventType = "flag.updated"
 	FlagDeleted       EventType = "flag.deleted"
+	FlagArchived      EventType = "flag.archived"
+	FlagRestored      EventType = "flag.restored"
 	FlagValueCreated  EventType = "flag.value.created"
 	FlagValueUpdated  EventType = "flag.value.updated"
 	FlagValueDeleted  EventType = "flag.value.deleted"
 )
 
-// Service defines the interface for server-sent events
+// Service defines the interface for server-sent events. Events only reach
+// the clients of the organisation they happened in.
 type Service interface {
-	BroadcastEvent(eventType EventType, data interface{})
+	BroadcastEvent(organizationID uuid.UUID, eventType EventType, data interface{})
 }
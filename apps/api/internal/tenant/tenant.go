@@ -0,0 +1,29 @@
+// Package tenant carries the organisation a request acts in through its
+// context, so repositories can scope every query to it.
+package tenant
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Organization identifies the tenant of a request
+type Organization struct {
+	ID uuid.UUID
+	// Host is set for the organisation that runs the installation
+	Host bool
+}
+
+type contextKey struct{}
+
+// WithOrganization returns a copy of ctx acting in an organisation
+func WithOrganization(ctx context.Context, org Organization) context.Context {
+	return context.WithValue(ctx, contextKey{}, org)
+}
+
+// FromContext returns the organisation ctx acts in, if any
+func FromContext(ctx context.Context) (Organization, bool) {
+	org, ok := ctx.Value(contextKey{}).(Organization)
+	return org, ok && org.ID != uuid.Nil
+}
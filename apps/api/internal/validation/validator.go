@@ -19,6 +19,7 @@ func NewValidator() *Validator {
 	// Register custom validators
 	v.RegisterValidation("alphanumunderscore", validateAlphaNumUnderscore)
 	v.RegisterValidation("alpha_space", validateAlphaSpace)
+	v.RegisterValidation("hexrgb", validateHexRGB)
 
 	return &Validator{
 		validate: v,
@@ -58,6 +59,21 @@ func validateAlphaSpace(fl validator.FieldLevel) bool {
 	return true
 }
 
+// validateHexRGB validates that a string is a #RRGGBB colour, the only form
+// colour columns store
+func validateHexRGB(fl validator.FieldLevel) bool {
+	field := fl.Field().String()
+	if len(field) != 7 || field[0] != '#' {
+		return false
+	}
+	for _, c := range field[1:] {
+		if !((c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
 // ErrValidationFailed represents a validation error
 type ErrValidationFailed struct {
 	Message string
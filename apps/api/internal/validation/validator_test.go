@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"testing"
+
+	"api/internal/dto"
+
+	"github.com/google/uuid"
+)
+
+func TestEnvironmentColor(t *testing.T) {
+	tests := []struct {
+		color string
+		ok    bool
+	}{
+		{color: "", ok: true},
+		{color: "#6b7280", ok: true},
+		{color: "#DC2626", ok: true},
+		{color: "#fff", ok: false},
+		{color: "#6b7280ff", ok: false},
+		{color: "#6b72", ok: false},
+		{color: "6b7280a", ok: false},
+		{color: "#6b728g", ok: false},
+	}
+
+	v := NewValidator()
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			create := &dto.CreateEnvironmentRequest{ProjectID: uuid.New(), Name: "Staging", Color: tt.color}
+			if err := v.Validate(create); (err == nil) != tt.ok {
+				t.Errorf("create with %q: error = %v, want valid %v", tt.color, err, tt.ok)
+			}
+
+			if tt.color == "" {
+				return
+			}
+			color := tt.color
+			update := &dto.UpdateEnvironmentRequest{Color: &color}
+			if err := v.Validate(update); (err == nil) != tt.ok {
+				t.Errorf("update with %q: error = %v, want valid %v", tt.color, err, tt.ok)
+			}
+		})
+	}
+}